@@ -0,0 +1,132 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"milesconnect-optimization/internal/data"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/stopfile"
+	"milesconnect-optimization/internal/tsplib"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//go:embed datasets/*.tsp
+var bundledTSPLIB embed.FS
+
+// dataset is a closed-tour problem: every tour starts and ends at points[0]
+type dataset struct {
+	name      string
+	points    []models.Location // IDs are positions in points
+	length    func(tour []int) float64
+	unit      string
+	bestKnown float64 // 0 when unknown
+}
+
+// bundledDatasets are benchmarked when no files are given: TSPLIB instances with
+// published optima, the all-India city tour, and a seeded uniform instance for runtime
+func bundledDatasets() ([]dataset, error) {
+	var sets []dataset
+	err := fs.WalkDir(bundledTSPLIB, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := bundledTSPLIB.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		set, err := readTSPLIB(path, f)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, set)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	india := data.GetAllIndiaLocations()
+	sets = append(sets, greatCircleDataset("all-india", india, 0))
+
+	rng := rand.New(rand.NewSource(1))
+	uniform := make([]models.Location, 1000)
+	for i := range uniform {
+		uniform[i] = models.Location{Lat: 18 + 2*rng.Float64(), Lng: 72 + 2*rng.Float64()}
+	}
+	sets = append(sets, greatCircleDataset("uniform-1000", uniform, 0))
+	return sets, nil
+}
+
+// readDataset loads a TSPLIB (.tsp) or CSV (.csv) file
+func readDataset(path string) (dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return dataset{}, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tsp":
+		return readTSPLIB(path, f)
+	case ".csv":
+		return readCSV(path, f)
+	default:
+		return dataset{}, fmt.Errorf("%s: unknown dataset format, want .tsp or .csv", path)
+	}
+}
+
+func readTSPLIB(path string, r io.Reader) (dataset, error) {
+	p, err := tsplib.Parse(r)
+	if err != nil {
+		return dataset{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if p.Name == "" {
+		p.Name = baseName(path)
+	}
+	best, _ := tsplib.BestKnown(p.Name)
+	return dataset{name: p.Name, points: p.Locations(), length: p.TourLength, bestKnown: best}, nil
+}
+
+// readCSV reads a stop list whose first stop is the depot
+func readCSV(path string, r io.Reader) (dataset, error) {
+	list, err := stopfile.ReadCSV(r)
+	if err != nil {
+		return dataset{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(list.Stops) < 2 {
+		return dataset{}, fmt.Errorf("%s: at least 2 stops required", path)
+	}
+	return greatCircleDataset(baseName(path), list.Stops, list.BestKnown), nil
+}
+
+// greatCircleDataset measures tours over points in great-circle kilometres
+func greatCircleDataset(name string, points []models.Location, best float64) dataset {
+	points = append([]models.Location(nil), points...)
+	for i := range points {
+		points[i].ID = strconv.Itoa(i)
+	}
+	return dataset{
+		name:   name,
+		points: points,
+		length: func(tour []int) float64 {
+			var km float64
+			for k := range tour {
+				km += geo.HaversineKm(points[tour[k]], points[tour[(k+1)%len(tour)]])
+			}
+			return km
+		},
+		unit:      "km",
+		bestKnown: best,
+	}
+}
+
+func baseName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
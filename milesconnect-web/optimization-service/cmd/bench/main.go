@@ -0,0 +1,246 @@
+// Command bench runs the registered TSP solvers over benchmark datasets and reports
+// each tour's length, its gap to the best-known length and the solve time, so solver
+// changes can be compared before they ship:
+//
+//	go run ./cmd/bench                      # bundled datasets
+//	go run ./cmd/bench -runs 5 kroA100.tsp stops.csv
+//	go run ./cmd/bench -solvers tsp-2opt -json eil51.tsp > after.json
+//
+// Datasets are TSPLIB files (.tsp), measured with the instance's own distance function,
+// or CSV stop lists (.csv), measured in great-circle kilometres.
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"milesconnect-optimization/internal/catalog"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/solvers"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// result is one solver's outcome on one dataset over all runs
+type result struct {
+	Dataset        string  `json:"dataset"`
+	Stops          int     `json:"stops"`
+	Solver         string  `json:"solver"`
+	Version        string  `json:"version"`
+	Runs           int     `json:"runs"`
+	Unit           string  `json:"unit,omitempty"` // empty for TSPLIB distance units
+	DistanceMean   float64 `json:"distance_mean"`
+	DistanceMin    float64 `json:"distance_min"`
+	BestKnown      float64 `json:"best_known"`
+	BestKnownOfRun bool    `json:"best_known_of_run,omitempty"` // no published length; the run's shortest tour is used
+	GapPct         float64 `json:"gap_pct"`                     // of the mean distance over best_known
+	TimeMsMedian   float64 `json:"time_ms_median"`
+	Iterations     float64 `json:"iterations_mean"`
+	BudgetHit      int     `json:"budget_exhausted_runs"`
+}
+
+func main() {
+	solverList := flag.String("solvers", "", "comma-separated solver names (default: every registered TSP solver)")
+	runs := flag.Int("runs", 3, "solves per solver and dataset")
+	timeout := flag.Duration("timeout", 30*time.Second, "time budget per solve, as solver.timeout on the server")
+	seed := flag.Int64("seed", 1, "genetic solver seed; run r uses seed+r")
+	clusterSize := flag.Int("cluster-size", solver.DefaultHierarchicalParams().ClusterSize, "cluster size of "+solver.HierarchicalName)
+	bundled := flag.Bool("bundled", false, "also run the bundled datasets when files are given")
+	asJSON := flag.Bool("json", false, "write results as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: bench [flags] [dataset.tsp|dataset.csv ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *runs < 1 {
+		fatal("-runs must be at least 1")
+	}
+
+	var sets []dataset
+	if flag.NArg() == 0 || *bundled {
+		b, err := bundledDatasets()
+		if err != nil {
+			fatal(err.Error())
+		}
+		sets = append(sets, b...)
+	}
+	for _, path := range flag.Args() {
+		set, err := readDataset(path)
+		if err != nil {
+			fatal(err.Error())
+		}
+		sets = append(sets, set)
+	}
+
+	opts := solvers.DefaultOptions()
+	opts.ClusterSize = *clusterSize
+	names, err := selectSolvers(*solverList)
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	var results []result
+	for _, set := range sets {
+		first := len(results)
+		for _, name := range names {
+			res, err := bench(set, name, opts, *seed, *runs, *timeout)
+			if err != nil {
+				fatal(err.Error())
+			}
+			results = append(results, res)
+		}
+		scoreGaps(results[first:])
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+	printTable(results)
+}
+
+// selectSolvers resolves -solvers against the catalog. Registered TSP solvers the
+// bench can't run are reported and skipped rather than silently left out.
+func selectSolvers(list string) ([]string, error) {
+	if list != "" {
+		names := strings.Split(list, ",")
+		for _, name := range names {
+			if !slices.Contains(solvers.RouteNames(), name) {
+				return nil, fmt.Errorf("unknown solver %q", name)
+			}
+		}
+		return names, nil
+	}
+	var names []string
+	for _, d := range catalog.All() {
+		if d.Problem != "tsp" {
+			continue
+		}
+		if !slices.Contains(solvers.RouteNames(), d.Name) {
+			fmt.Fprintf(os.Stderr, "bench: no runner for solver %s, skipped\n", d.Name)
+			continue
+		}
+		names = append(names, d.Name)
+	}
+	return names, nil
+}
+
+// bench solves set with one solver runs times, the genetic one seeded with seed+run.
+// The tour is measured with the dataset's distance function, not the solver's own
+// total, and must visit every stop once.
+func bench(set dataset, name string, opts solvers.Options, seed int64, runs int, timeout time.Duration) (result, error) {
+	req := models.OptimizationRequest{Start: set.points[0], End: set.points[0], Waypoints: set.points[1:]}
+	res := result{Dataset: set.name, Stops: len(set.points), Solver: name, Runs: runs, Unit: set.unit,
+		BestKnown: set.bestKnown, DistanceMin: -1}
+	times := make([]float64, runs)
+	var total, iterations float64
+	for r := range runs {
+		opts.Genetic.Seed = seed + int64(r)
+		solve, _ := solvers.Route(name, opts)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		started := time.Now()
+		resp := solve(ctx, req, nil)
+		times[r] = float64(time.Since(started).Microseconds()) / 1000
+		cancel()
+
+		tour, err := closedTour(resp.Route, len(set.points))
+		if err != nil {
+			return result{}, fmt.Errorf("%s on %s: %w", name, set.name, err)
+		}
+		length := set.length(tour)
+		total += length
+		if res.DistanceMin < 0 || length < res.DistanceMin {
+			res.DistanceMin = length
+		}
+		iterations += float64(resp.Metadata.Iterations)
+		if resp.Metadata.BudgetExhausted {
+			res.BudgetHit++
+		}
+		res.Version = resp.Metadata.Version
+	}
+	res.DistanceMean = total / float64(runs)
+	res.Iterations = iterations / float64(runs)
+	sort.Float64s(times)
+	res.TimeMsMedian = times[runs/2]
+	return res, nil
+}
+
+// closedTour reads the stop positions from a route that starts and ends at the depot
+func closedTour(route []models.Location, stops int) ([]int, error) {
+	if len(route) != stops+1 {
+		return nil, fmt.Errorf("route has %d locations, want %d", len(route), stops+1)
+	}
+	tour := make([]int, 0, stops)
+	seen := make([]bool, stops)
+	tour = append(tour, 0)
+	seen[0] = true
+	for _, loc := range route[1 : len(route)-1] {
+		i, err := strconv.Atoi(loc.ID)
+		if err != nil || i < 1 || i >= stops || seen[i] {
+			return nil, fmt.Errorf("route visits stop %q out of place", loc.ID)
+		}
+		seen[i] = true
+		tour = append(tour, i)
+	}
+	return tour, nil
+}
+
+// scoreGaps fills in the gaps of one dataset's results, against the run's shortest
+// tour when no best-known length was given
+func scoreGaps(results []result) {
+	if len(results) > 0 && results[0].BestKnown == 0 {
+		best := slices.MinFunc(results, func(a, b result) int {
+			return cmp.Compare(a.DistanceMin, b.DistanceMin)
+		}).DistanceMin
+		for i := range results {
+			results[i].BestKnown, results[i].BestKnownOfRun = best, true
+		}
+	}
+	for i := range results {
+		if results[i].BestKnown > 0 {
+			results[i].GapPct = (results[i].DistanceMean - results[i].BestKnown) / results[i].BestKnown * 100
+		}
+	}
+}
+
+func printTable(results []result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "dataset\tstops\tsolver\tdistance\tbest\tgap\ttime_ms\titerations\t")
+	ofRun := false
+	for _, r := range results {
+		best := fmt.Sprintf("%.1f", r.BestKnown)
+		if r.BestKnownOfRun {
+			best, ofRun = best+"*", true
+		}
+		distance := fmt.Sprintf("%.1f", r.DistanceMean)
+		if r.Unit != "" {
+			distance += " " + r.Unit
+		}
+		if r.BudgetHit > 0 {
+			distance += fmt.Sprintf(" (budget %d/%d)", r.BudgetHit, r.Runs)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%.2f%%\t%.1f\t%.0f\t\n",
+			r.Dataset, r.Stops, r.Solver, distance, best, r.GapPct, r.TimeMsMedian, r.Iterations)
+	}
+	w.Flush()
+	if ofRun {
+		fmt.Println("* no best-known length: gap to the shortest tour found in this run")
+	}
+}
+
+func fatal(msg string) {
+	fmt.Fprintln(os.Stderr, "bench:", msg)
+	os.Exit(1)
+}
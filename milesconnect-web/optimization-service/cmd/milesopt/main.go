@@ -0,0 +1,232 @@
+// Command milesopt optimizes a route offline, with the service's solvers but without
+// the service. It reads stops from a CSV file or a JSON /optimize request, or from
+// standard input, and writes the route as JSON, CSV or GeoJSON:
+//
+//	milesopt stops.csv                          # round trip from the first stop, JSON out
+//	milesopt -solver tsp-nearest-neighbor -open -format csv stops.csv > route.csv
+//	curl -s https://example.com/request.json | milesopt -format geojson -o route.geojson
+//	milesopt -generate 500 -seed 7 -format request > request.json # a random problem, unsolved
+//	milesopt capture.json                       # replay a request captured by the service
+//	milesopt eil51.tsp                          # a TSPLIB instance, scored against its optimum
+//
+// CSV rows are stops with lat and lng columns (see -help); the first row is the start.
+// Routes use great-circle distances.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"milesconnect-optimization/internal/capture"
+	"milesconnect-optimization/internal/generate"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/pipeline"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/solvers"
+	"milesconnect-optimization/internal/stopfile"
+	"milesconnect-optimization/internal/tsplib"
+	"milesconnect-optimization/internal/validation"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	solverName := flag.String("solver", solver.TwoOptName, "solver to run: "+strings.Join(solvers.RouteNames(), ", "))
+	format := flag.String("format", "json", "output format: json, csv, geojson, or request to write the request unsolved")
+	out := flag.String("o", "", "output file (default: standard output)")
+	open := flag.Bool("open", false, "for stop lists and -generate, end the route at the last stop instead of returning to the first")
+	duplicates := flag.String("duplicates", "", "for stop lists, duplicate handling: keep, merge or reject")
+	duplicateRadius := flag.Float64("duplicate-radius", 0, "for stop lists, metres within which stops are duplicates")
+	timeout := flag.Duration("timeout", 30*time.Second, "solve time budget, unless the request's solver_params give one; the best route found so far is written when it runs out")
+	seed := flag.Int64("seed", 0, "genetic solver and -generate seed; 0 seeds from the clock")
+	gen := generate.DefaultParams()
+	flag.IntVar(&gen.Stops, "generate", 0, "instead of reading input, route this many random stops around -center")
+	flag.IntVar(&gen.Clusters, "clusters", gen.Clusters, "for -generate, neighbourhoods stops gather in; 0 spreads them uniformly")
+	flag.Float64Var(&gen.RadiusKm, "radius-km", gen.RadiusKm, "for -generate, service area radius")
+	center := flag.String("center", "28.6139,77.2090", "for -generate, depot as lat,lng")
+	clusterSize := flag.Int("cluster-size", solver.DefaultHierarchicalParams().ClusterSize, "cluster size of "+solver.HierarchicalName)
+	flag.Usage = func() {
+		w := flag.CommandLine.Output()
+		fmt.Fprintf(w, "usage: milesopt [flags] [stops.csv|request.json|-]\n\n")
+		fmt.Fprintf(w, "Input is read from standard input when no file, or -, is given. JSON input is an\n")
+		fmt.Fprintf(w, "/optimize request body or an array of stops; anything else is CSV with a header\n")
+		fmt.Fprintf(w, "row naming lat/latitude, lng/lon/longitude and optionally id/name columns, or\n")
+		fmt.Fprintf(w, "headerless id,lat,lng or lat,lng rows. A capture from GET /admin/captures/{id}\n")
+		fmt.Fprintf(w, "replays its /optimize request. A TSPLIB instance (.tsp, or input starting with\n")
+		fmt.Fprintf(w, "NAME) is a round trip from its first node, its tour measured in TSPLIB units.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 || (gen.Stops > 0 && flag.NArg() > 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	opts := solvers.DefaultOptions()
+	opts.Genetic.Seed, opts.ClusterSize = *seed, *clusterSize
+	solve, ok := solvers.Route(*solverName, opts)
+	if !ok {
+		fatal(fmt.Sprintf("unknown solver %q", *solverName))
+	}
+	write, ok := writers[*format]
+	if !ok && *format != "request" {
+		fatal(fmt.Sprintf("unknown format %q", *format))
+	}
+
+	var req models.OptimizationRequest
+	var captured *capture.Capture
+	var instance *tsplib.Problem
+	var err error
+	if gen.Stops > 0 {
+		if _, err = fmt.Sscanf(*center, "%g,%g", &gen.Center.Lat, &gen.Center.Lng); err != nil {
+			fatal("-center must be lat,lng")
+		}
+		gen.Seed = *seed
+		req = generate.Route(gen)
+		if *open {
+			req.End = req.Waypoints[len(req.Waypoints)-1]
+			req.Waypoints = req.Waypoints[:len(req.Waypoints)-1]
+		}
+		fmt.Fprintf(os.Stderr, "milesopt: generated %d stops with seed %d\n", gen.Stops, gen.Seed)
+	} else if req, captured, instance, err = readRequest(flag.Arg(0), !*open); err != nil {
+		fatal(err.Error())
+	}
+	if *duplicates != "" {
+		req.Duplicates = models.DuplicateHandling{Mode: *duplicates, RadiusM: *duplicateRadius}
+	}
+	// The same checks as POST /optimize
+	errs := validation.OptimizationRequest(req)
+	if len(errs) == 0 {
+		req, errs = validation.ApplyDuplicates(req)
+	}
+	if len(errs) > 0 {
+		for _, fe := range errs {
+			fmt.Fprintf(os.Stderr, "milesopt: %s: %s\n", fe.Field, fe.Message)
+		}
+		os.Exit(1)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fatal(err.Error())
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	if *format == "request" {
+		enc := json.NewEncoder(bw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(req); err != nil {
+			fatal(err.Error())
+		}
+		if err := bw.Flush(); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+
+	resp := pipeline.Offline(context.Background(), req, solve, *timeout)
+	if err := write(bw, resp); err != nil {
+		fatal(err.Error())
+	}
+	if err := bw.Flush(); err != nil {
+		fatal(err.Error())
+	}
+
+	meta := resp.Metadata
+	note := ""
+	if meta.BudgetExhausted {
+		note = ", time budget exhausted"
+	}
+	fmt.Fprintf(os.Stderr, "milesopt: %s routed %d waypoints, %.2f km in %.1f ms%s\n",
+		meta.Solver, len(req.Waypoints), resp.TotalDistKm, meta.ComputeTimeMs, note)
+	if c := captured; c != nil && c.Result != nil {
+		fmt.Fprintf(os.Stderr, "milesopt: captured %s (%s): %s %s routed %.2f km in %.1f ms\n",
+			c.ID, c.Reason, c.Solver, c.SolverVersion, c.Result.TotalDistKm, c.Result.ComputeTimeMs)
+	}
+	if p := instance; p != nil {
+		tour, ok := p.Tour(resp.Route)
+		if !ok {
+			fatal("the route isn't a tour of the instance")
+		}
+		length := p.TourLength(tour)
+		if best, ok := tsplib.BestKnown(p.Name); ok {
+			fmt.Fprintf(os.Stderr, "milesopt: %s tour length %.0f, best known %.0f, gap %.2f%%\n", p.Name, length, best, (length-best)/best*100)
+		} else {
+			fmt.Fprintf(os.Stderr, "milesopt: %s tour length %.0f\n", p.Name, length)
+		}
+	}
+}
+
+// readRequest reads the route request from path, or standard input for "" and "-".
+// Stop lists, from CSV or a JSON array, start at their first stop. A request captured
+// by the service, as returned by GET /admin/captures/{id}, is returned with its
+// capture, and a TSPLIB instance with the problem it was read from.
+func readRequest(path string, roundTrip bool) (models.OptimizationRequest, *capture.Capture, *tsplib.Problem, error) {
+	var in []byte
+	var err error
+	if path == "" || path == "-" {
+		in, err = io.ReadAll(os.Stdin)
+	} else {
+		in, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return models.OptimizationRequest{}, nil, nil, err
+	}
+
+	var list stopfile.List
+	switch trimmed := bytes.TrimSpace(in); {
+	case strings.EqualFold(filepath.Ext(path), ".tsp") || bytes.HasPrefix(trimmed, []byte("NAME")):
+		p, err := tsplib.Parse(bytes.NewReader(trimmed))
+		if err != nil {
+			return models.OptimizationRequest{}, nil, nil, err
+		}
+		return p.Request(), nil, p, nil
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var c capture.Capture
+		if err := json.Unmarshal(trimmed, &c); err == nil && c.ID != "" && len(c.Request) > 0 {
+			if c.Endpoint != "/optimize" {
+				return models.OptimizationRequest{}, nil, nil, fmt.Errorf("capture %s is of %s; milesopt replays /optimize captures only", c.ID, c.Endpoint)
+			}
+			trimmed = c.Request
+		}
+		var req models.OptimizationRequest
+		if err := json.Unmarshal(trimmed, &req); err != nil {
+			return models.OptimizationRequest{}, nil, nil, fmt.Errorf("invalid request: %w", err)
+		}
+		if c.ID != "" {
+			return req, &c, nil, nil
+		}
+		return req, nil, nil, nil
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &list.Stops); err != nil {
+			return models.OptimizationRequest{}, nil, nil, fmt.Errorf("invalid stop list: %w", err)
+		}
+	default:
+		if list, err = stopfile.ReadCSV(bytes.NewReader(in)); err != nil {
+			return models.OptimizationRequest{}, nil, nil, err
+		}
+	}
+	if len(list.Stops) < 2 {
+		return models.OptimizationRequest{}, nil, nil, errors.New("at least 2 stops required")
+	}
+	return list.Request(roundTrip), nil, nil, nil
+}
+
+func fatal(msg string) {
+	fmt.Fprintln(os.Stderr, "milesopt:", msg)
+	os.Exit(1)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"strconv"
+)
+
+// writers encode a solved route in each -format
+var writers = map[string]func(w io.Writer, resp models.OptimizationResponse) error{
+	"json":    writeJSON,
+	"csv":     writeCSV,
+	"geojson": writeGeoJSON,
+}
+
+// writeJSON writes the response as POST /optimize returns it
+func writeJSON(w io.Writer, resp models.OptimizationResponse) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(resp)
+}
+
+// writeCSV writes one row per route location, in visiting order, with the leg to it
+// and the distance driven so far
+func writeCSV(w io.Writer, resp models.OptimizationResponse) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"seq", "id", "role", "lat", "lng", "leg_km", "cumulative_km"})
+	var total float64
+	for i, loc := range resp.Route {
+		leg := 0.0
+		if i > 0 {
+			leg = geo.HaversineKm(resp.Route[i-1], loc)
+		}
+		total += leg
+		cw.Write([]string{strconv.Itoa(i), loc.ID, role(i, len(resp.Route)), formatFloat(loc.Lat), formatFloat(loc.Lng),
+			strconv.FormatFloat(leg, 'f', 3, 64), strconv.FormatFloat(total, 'f', 3, 64)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeGeoJSON writes a FeatureCollection with the route as a LineString followed by
+// a Point per location
+func writeGeoJSON(w io.Writer, resp models.OptimizationResponse) error {
+	line := make([][2]float64, len(resp.Route))
+	for i, loc := range resp.Route {
+		line[i] = [2]float64{loc.Lng, loc.Lat}
+	}
+	features := []feature{{
+		Type:     "Feature",
+		Geometry: geometry{Type: "LineString", Coordinates: line},
+		Properties: map[string]any{
+			"solver":            resp.Metadata.Solver,
+			"total_distance_km": resp.TotalDistKm,
+		},
+	}}
+	for i, loc := range resp.Route {
+		props := map[string]any{"seq": i, "role": role(i, len(resp.Route))}
+		if loc.ID != "" {
+			props["id"] = loc.ID
+		}
+		if len(loc.MergedIDs) > 0 {
+			props["merged_ids"] = loc.MergedIDs
+		}
+		features = append(features, feature{
+			Type:       "Feature",
+			Geometry:   geometry{Type: "Point", Coordinates: line[i]},
+			Properties: props,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"type": "FeatureCollection", "features": features})
+}
+
+type feature struct {
+	Type       string         `json:"type"`
+	Geometry   geometry       `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+func role(i, n int) string {
+	switch i {
+	case 0:
+		return "start"
+	case n - 1:
+		return "end"
+	}
+	return "stop"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
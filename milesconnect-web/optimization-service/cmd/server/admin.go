@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+)
+
+// pprofMux serves the net/http/pprof handlers under /debug/pprof/
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// startAdminServer serves pprof and the admin endpoints on a separate listener (ADMIN_ADDR),
+// which should be bound to localhost or a private interface since it is not authenticated.
+// It returns nil when no admin address is configured.
+func startAdminServer(addr string, admin map[string]http.Handler) *http.Server {
+	if addr == "" {
+		return nil
+	}
+	mux := pprofMux()
+	for pattern, h := range admin {
+		mux.Handle(pattern, h)
+	}
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("admin server failed", "addr", addr, "error", err)
+		}
+	}()
+	slog.Info("admin server started", "addr", addr)
+	return srv
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"milesconnect-optimization/internal/api"
+	"milesconnect-optimization/internal/config"
+	"milesconnect-optimization/internal/health"
+	"milesconnect-optimization/internal/jobs"
+	"milesconnect-optimization/internal/kafka"
+	"milesconnect-optimization/internal/logging"
+	"milesconnect-optimization/internal/middleware"
+	"milesconnect-optimization/internal/natsrpc"
+	"milesconnect-optimization/internal/objectstore"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/tenant"
+)
+
+// openJobs opens the job store and queue for cfg and returns a runner for them; nil
+// when async jobs are off. Jobs run with their submitting tenant's limits and usage.
+func openJobs(cfg config.JobsConfig, tenants *tenant.Registry) *jobs.Runner {
+	if cfg.Store == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var store jobs.Store = jobs.NewMemoryStore(cfg.MemoryTTL, cfg.MemoryMaxEntries)
+	switch cfg.Store {
+	case "sqlite":
+		lite, err := jobs.OpenSQLite(ctx, cfg.SQLitePath)
+		if err != nil {
+			fatal("opening job store", "error", err)
+		}
+		health.Default.Register("jobs_store", lite.Ping)
+		store = lite
+	case "postgres":
+		pg, err := jobs.OpenPostgres(ctx, cfg.PostgresDSN)
+		if err != nil {
+			fatal("opening job store", "error", err)
+		}
+		health.Default.Register("jobs_store", pg.Ping)
+		store = pg
+	}
+	var queue jobs.Queue = jobs.NewMemoryQueue(cfg.QueueSize)
+	if cfg.Queue == "redis" {
+		rq, err := jobs.OpenRedis(ctx, cfg.RedisURL, cfg.StaleAfter)
+		if err != nil {
+			fatal("opening job queue", "error", err)
+		}
+		health.Default.Register("jobs_queue", rq.Ping)
+		queue = rq
+	}
+
+	exec := func(ctx context.Context, job jobs.Job) ([]byte, error) {
+		ctx = logging.WithRequestID(middleware.WithClient(ctx, job.Client), job.ID)
+		// Memory store checkpoints die with the process they would help recover from
+		if cfg.CheckpointInterval > 0 && cfg.Store != "memory" {
+			var stop context.CancelFunc
+			ctx, stop = context.WithCancel(ctx)
+			defer stop()
+			ctx = solver.WithCheckpoints(ctx, checkpoints(ctx, store, job, cfg.CheckpointInterval, stop))
+		}
+		// Past stale_after the redis queue hands the job to another replica, so it fails
+		// instead of running twice; the config check leaves room for the longest solve
+		if cfg.Queue == "redis" {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cfg.StaleAfter)
+			defer cancel()
+		}
+		result, err := api.Execute(tenant.WithTenant(ctx, tenants.Get(job.Tenant)), job.Endpoint, job.Request)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+			return nil, errors.New("job did not finish within jobs.stale_after")
+		}
+		return result, err
+	}
+	runner := jobs.NewRunner(store, queue, exec, cfg.Workers, cfg.StaleAfter)
+	if o := cfg.Offload; o.Bucket != "" {
+		s3, err := objectstore.NewS3(objectstore.Config{
+			Endpoint: o.Endpoint, Bucket: o.Bucket, Region: o.Region,
+			AccessKey: o.AccessKey, SecretKey: o.SecretKey, UseSSL: o.UseSSL,
+		})
+		if err != nil {
+			fatal("opening result storage", "error", err)
+		}
+		health.Default.Register("objectstore", s3.Ping)
+		runner.OffloadResults(jobs.Offload{Objects: s3, Threshold: o.ThresholdBytes, URLExpiry: o.URLExpiry})
+		slog.Info("offloading large job results", "bucket", o.Bucket, "threshold_bytes", o.ThresholdBytes)
+	}
+	// The memory queue starts empty, so jobs left over in the store are queued again
+	if cfg.Queue == "memory" {
+		if err := runner.Recover(ctx); err != nil {
+			fatal("recovering jobs", "error", err)
+		}
+	}
+	slog.Info("async jobs enabled", "store", cfg.Store, "queue", cfg.Queue, "workers", cfg.Workers)
+	return runner
+}
+
+// checkpoints saves the solver progress of job to store every interval and resumes
+// from the checkpoint a previous worker left behind. A save finding the job no longer
+// running, cancelled from another replica, calls stop.
+func checkpoints(ctx context.Context, store jobs.Store, job jobs.Job, interval time.Duration, stop context.CancelFunc) *solver.Checkpoints {
+	cp := &solver.Checkpoints{Interval: interval}
+	if len(job.Checkpoint) > 0 {
+		var saved solver.Checkpoint
+		if err := json.Unmarshal(job.Checkpoint, &saved); err != nil {
+			slog.WarnContext(ctx, "ignoring unreadable job checkpoint", "error", err)
+		} else {
+			slog.InfoContext(ctx, "resuming job from checkpoint", "solver", saved.Solver, "iterations", saved.Iterations)
+			cp.Resume = &saved
+		}
+	}
+	cp.Save = func(c solver.Checkpoint) {
+		state, err := json.Marshal(c)
+		if err == nil {
+			saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			err = store.SaveCheckpoint(saveCtx, job.ID, state)
+			cancel()
+		}
+		if errors.Is(err, jobs.ErrNotClaimable) {
+			slog.InfoContext(ctx, "job no longer running, stopping its solve")
+			stop()
+		} else if err != nil {
+			slog.WarnContext(ctx, "saving job checkpoint", "error", err)
+		}
+	}
+	return cp
+}
+
+// openKafka returns a consumer serving requests from cfg's topic; nil when Kafka is off.
+// Requests run as the tenant named in their tenant header, or anonymously.
+func openKafka(cfg config.KafkaConfig, tenants *tenant.Registry) *kafka.Consumer {
+	if len(cfg.Brokers) == 0 {
+		return nil
+	}
+	handle := func(ctx context.Context, req kafka.Request) []byte {
+		return reply(ctx, tenants, "kafka", req.Tenant, req.ID, req.Endpoint, req.Body)
+	}
+	consumer := kafka.NewConsumer(kafka.Config(cfg), handle)
+	health.Default.Register("kafka", consumer.Ping)
+	slog.Info("kafka consumer enabled", "brokers", cfg.Brokers, "group", cfg.Group,
+		"request_topic", cfg.RequestTopic, "response_topic", cfg.ResponseTopic)
+	return consumer
+}
+
+// openNATS connects the NATS request-reply server for cfg; nil when NATS is off.
+// Requests run as the tenant named in their X-Tenant-ID header, or anonymously.
+func openNATS(cfg config.NATSConfig, tenants *tenant.Registry) *natsrpc.Server {
+	if cfg.URL == "" {
+		return nil
+	}
+	handle := func(ctx context.Context, req natsrpc.Request) []byte {
+		return reply(ctx, tenants, "nats", req.Tenant, req.ID, req.Endpoint, req.Body)
+	}
+	srv, err := natsrpc.Connect(natsrpc.Config(cfg), handle)
+	if err != nil {
+		fatal("connecting to NATS", "error", err)
+	}
+	health.Default.Register("nats", srv.Ping)
+	slog.Info("NATS request-reply enabled", "url", cfg.URL, "subjects", cfg.SubjectPrefix+".>", "queue", cfg.Queue)
+	return srv
+}
+
+// reply solves a request received over a message transport on behalf of client and
+// tenantName (anonymous when empty) and encodes the api.Reply
+func reply(ctx context.Context, tenants *tenant.Registry, client, tenantName, requestID, endpoint string, body []byte) []byte {
+	ctx = logging.WithRequestID(middleware.WithClient(ctx, client), requestID)
+	if tenantName == "" {
+		tenantName = tenant.Anonymous
+	}
+	result, err := api.Execute(tenant.WithTenant(ctx, tenants.Get(tenantName)), endpoint, body)
+	if err != nil {
+		slog.WarnContext(ctx, "request failed", "transport", client, "endpoint", endpoint, "error", err)
+	}
+	out, _ := json.Marshal(api.NewReply(requestID, result, err))
+	return out
+}
+
+// worker is background processing that drains on shutdown
+type worker interface {
+	Stop()
+	Wait()
+	Close() error
+}
+
+// stopBackground stops every worker taking new work and lets them finish what they
+// have until ctx expires, then cancels it; abandoned work is picked up again after a
+// restart or by another replica
+func stopBackground(ctx context.Context, cancel context.CancelFunc, workers map[string]worker) {
+	for _, w := range workers {
+		w.Stop()
+	}
+	done := make(chan struct{})
+	go func() {
+		for _, w := range workers {
+			w.Wait()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("grace period expired, abandoning background work")
+		cancel()
+		<-done
+	}
+	for name, w := range workers {
+		if err := w.Close(); err != nil {
+			slog.Error("closing background worker", "worker", name, "error", err)
+		}
+	}
+}
@@ -1,10 +1,28 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
 	"milesconnect-optimization/internal/api"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/buildinfo"
+	"milesconnect-optimization/internal/capture"
+	"milesconnect-optimization/internal/config"
+	"milesconnect-optimization/internal/health"
+	"milesconnect-optimization/internal/logging"
+	"milesconnect-optimization/internal/metrics"
+	"milesconnect-optimization/internal/middleware"
+	"milesconnect-optimization/internal/stats"
+	"milesconnect-optimization/internal/tenant"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // CORS middleware to allow cross-origin requests
@@ -13,7 +31,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 		// Allow requests from any origin (for development)
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Service-Version")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -26,25 +45,267 @@ func corsMiddleware(next http.Handler) http.Handler {
 }
 
 func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err == nil {
+		err = checkSolvers(cfg)
+	}
+	if err != nil {
+		fatal("invalid configuration", "error", err)
+	}
+	slog.SetDefault(logging.New(os.Stdout, cfg.Logging.Format, cfg.Logging.Level))
+
 	mux := http.NewServeMux()
 
 	// Register Handlers
 	mux.HandleFunc("/optimize", api.OptimizeRouteHandler)          // Existing TSP
 	mux.HandleFunc("/optimize-load", api.OptimizeLoadHandler)      // New Weight/Load Algo
 	mux.HandleFunc("/optimize-india", api.OptimizeAllIndiaHandler) // GA All India
-	mux.HandleFunc("/health", api.HealthHandler)
+	mux.HandleFunc("/validate", api.ValidateHandler)               // Dry-run feasibility checks
+	mux.HandleFunc("/solvers", api.SolversHandler)                 // Capability discovery
+	mux.HandleFunc("/generate", api.GenerateHandler)               // Random problems for demos and load tests
+	mux.HandleFunc("/jobs", api.JobsHandler)                       // Async /optimize and /optimize-load, job history
+	mux.HandleFunc("/jobs/{id}", api.GetJobHandler)
+	mux.HandleFunc("DELETE /jobs/{id}", api.CancelJobHandler)
+	mux.HandleFunc("/manifest", api.ManifestHandler)
+	mux.HandleFunc("/tsplib", api.TSPLIBHandler)
+	mux.HandleFunc("POST /routes", api.RoutesHandler)
+	mux.HandleFunc("GET /routes/{id}", api.GetRouteHandler)
+	mux.HandleFunc("PATCH /routes/{id}/stops/{stopId}", api.UpdateStopHandler)
+	mux.HandleFunc("/eta", api.ETAHandler)
+	mux.HandleFunc("/scenario", api.ScenarioHandler)
+	mux.HandleFunc("/diff-load", api.LoadDiffHandler)
+	mux.HandleFunc("/optimize-crossdock", api.OptimizeCrossDockHandler)
+	mux.HandleFunc("/plan-days", api.PlanDaysHandler)
+	mux.HandleFunc("/simulate", api.SimulateHandler)
+
+	// Probes and metrics scrapes bypass the per-client middleware so they never get throttled
+	// The limiter is always installed so a reload can switch it on; at rps 0 it lets everything through
+	limiter := middleware.NewRateLimiter(cfg.RateLimit.RPS, cfg.RateLimit.Burst)
+	tenants := tenant.NewRegistry()
+	auditLog := openAudit(cfg.Audit)
+	captures := openCapture(cfg.Capture)
+	runner := openJobs(cfg.Jobs, tenants)
+	consumer := openKafka(cfg.Kafka, tenants)
+	natsSrv := openNATS(cfg.NATS, tenants)
+	reload := newReloader(*configPath, cfg, limiter, tenants, auditLog, runner, captures)
+	reload.watchSIGHUP()
+
+	var handler http.Handler = limiter.Middleware(mux)
+	handler = tenants.Middleware(handler)
+	if rl := cfg.RateLimit; rl.RPS > 0 {
+		slog.Info("rate limiting enabled", "rps", rl.RPS, "burst", rl.Burst)
+	}
+	auth := &middleware.Authenticator{}
+	if keys := loadAPIKeys(cfg.Auth); keys != nil {
+		auth.Keys = keys
+		slog.Info("API key authentication enabled", "keys", len(keys))
+	}
+	if jwt := cfg.Auth.JWT; jwt.Issuer != "" {
+		auth.Tokens = middleware.NewJWTVerifier(middleware.JWTConfig(jwt))
+		health.Default.Register("jwks", auth.Tokens.Ready)
+		slog.Info("bearer token authentication enabled", "issuer", jwt.Issuer)
+	}
+	mtls := cfg.TLS.ClientCAFile != ""
+	if auth.Enabled() {
+		handler = auth.Require(middleware.ScopeOptimize, handler)
+	} else if !mtls {
+		slog.Warn("no API keys, JWT issuer or client CA configured, optimization endpoints are unauthenticated")
+	}
+	if mtls {
+		handler = middleware.RequireClientCert(handler)
+	}
+
+	root := http.NewServeMux()
+	root.HandleFunc("/health", api.HealthHandler) // build and solver versions; always 200 like /live
+	root.HandleFunc("/live", health.LiveHandler)
+	root.HandleFunc("/ready", health.Default.ReadyHandler)
+	root.Handle("/metrics", metrics.Default.Handler())
+	root.Handle("/stats", stats.Default.Handler()) // aggregate solver statistics, in JSON
+	// Recovering inside AccessLog lets the request line and metrics record the 500
+	root.Handle("/", middleware.AccessLog(mux, middleware.Recover(handler)))
+
+	// Profiling on the main port is opt-in and needs admin credentials when auth is on
+	if cfg.Admin.Pprof {
+		var profiler http.Handler = pprofMux()
+		if auth.Enabled() {
+			profiler = auth.Require(middleware.ScopeAdmin, profiler)
+		}
+		root.Handle("/debug/pprof/", profiler)
+		slog.Info("pprof enabled on main listener")
+	}
+	// The map page holds no data, and browsers can't send API keys when navigating to it;
+	// its calls to /optimize and /jobs are authenticated like any other
+	if cfg.Admin.DebugMap {
+		root.HandleFunc("/debug/map", api.DebugMapHandler)
+		slog.Info("route debug map enabled on main listener")
+	}
+	admin := map[string]http.Handler{
+		"/admin/reload":  reload,
+		"/admin/tenants": tenants,
+		"/admin/jobs":    http.HandlerFunc(api.AdminJobsHandler),
+
+		"DELETE /admin/jobs/{id}": http.HandlerFunc(api.AdminCancelJobHandler),
+
+		"/admin/captures":             http.HandlerFunc(api.AdminCapturesHandler),
+		"/admin/captures/{id}":        http.HandlerFunc(api.AdminCaptureHandler),
+		"/admin/captures/{id}/replay": http.HandlerFunc(api.ReplayCaptureHandler),
+	}
+	if auth.Enabled() {
+		for pattern, h := range admin {
+			root.Handle(pattern, auth.Require(middleware.ScopeAdmin, h))
+		}
+	}
+	adminSrv := startAdminServer(cfg.Admin.Addr, admin)
+
+	// Every request context derives from baseCtx, so cancelling it aborts solves still running
+	// once the grace period is over
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	background := map[string]worker{}
+	if runner != nil {
+		runner.Start(baseCtx)
+		background["jobs"] = runner
+	}
+	if consumer != nil {
+		consumer.Start(baseCtx)
+		background["kafka"] = consumer
+	}
+	if saver := openStats(cfg.Stats); saver != nil {
+		background["stats"] = saver
+	}
+	if natsSrv != nil {
+		if err := natsSrv.Start(baseCtx); err != nil {
+			fatal("starting NATS server", "error", err)
+		}
+		background["nats"] = natsSrv
+	}
+
+	srv := &http.Server{
+		Addr:        ":" + cfg.Server.Port,
+		Handler:     corsMiddleware(middleware.ServiceVersion(middleware.RequestID(middleware.Recover(root)))), // Wrap with CORS middleware
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
+	slog.Info("starting optimization service", "port", cfg.Server.Port, "config", *configPath,
+		"version", buildinfo.Get().String(),
+		"solvers", []string{"TSP (Nearest Neighbor)", "FleetAlloc (Best Fit Decreasing)", "TSP (Genetic)"},
+		"cors", "all origins")
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serve := configureTLS(srv, cfg.TLS)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- serve() }()
+
+	select {
+	case err := <-serveErr:
+		fatal("server failed", "error", err)
+	case <-sigCtx.Done():
+	}
+
+	// Fail readiness first so load balancers stop routing here, then let in-flight solves finish
+	health.Default.SetDraining()
+
+	gracePeriod := cfg.Server.ShutdownGracePeriod
+	slog.Info("shutting down, draining in-flight requests", "grace_period", gracePeriod.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	if adminSrv != nil {
+		adminSrv.Close()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("grace period expired, cancelling remaining requests", "error", err)
+		cancelRequests()
+		srv.Close()
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server error", "error", err)
+	}
+	stopBackground(shutdownCtx, cancelRequests, background)
+	if err := auditLog.Close(); err != nil {
+		slog.Error("closing audit log", "error", err)
+	}
+	slog.Info("optimization service stopped")
+}
+
+// fatal logs msg at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// openAudit starts the audit logger for cfg; nil when auditing is off
+func openAudit(cfg config.AuditConfig) *audit.Logger {
+	if cfg.Sink == "" {
+		return nil
 	}
+	sink, err := audit.OpenFile(cfg.Path)
+	if err != nil {
+		fatal("opening audit log", "error", err)
+	}
+	slog.Info("audit log enabled", "sink", cfg.Sink, "path", cfg.Path)
+	return audit.NewLogger(sink, cfg.Buffer)
+}
 
-	log.Printf("Starting Optimization Service on port %s", port)
-	log.Printf("Enabled Solvers: TSP (Nearest Neighbor), FleetAlloc (Best Fit Decreasing)")
-	log.Printf("CORS enabled for all origins")
+// openCapture opens the store of captured requests for cfg; nil when capture is off
+func openCapture(cfg config.CaptureConfig) *capture.Store {
+	if cfg.Dir == "" {
+		return nil
+	}
+	store, err := capture.Open(cfg.Dir, cfg.MaxEntries)
+	if err != nil {
+		fatal("opening capture directory", "error", err)
+	}
+	slog.Info("request capture enabled", "dir", cfg.Dir, "slow_after", cfg.SlowAfter.String())
+	return store
+}
 
-	// Wrap with CORS middleware
-	if err := http.ListenAndServe(":"+port, corsMiddleware(mux)); err != nil {
-		log.Fatal(err)
+// openStats loads the saved solver statistics for cfg and saves them periodically from
+// then on; nil when they aren't kept across restarts
+func openStats(cfg config.StatsConfig) *stats.Saver {
+	if cfg.File == "" {
+		return nil
+	}
+	if err := stats.Default.Load(cfg.File); err != nil {
+		fatal("loading solver statistics", "error", err)
+	}
+	slog.Info("solver statistics persisted", "file", cfg.File, "save_interval", cfg.SaveInterval.String())
+	return stats.Default.SaveEvery(cfg.File, cfg.SaveInterval)
+}
+
+// loadAPIKeys merges the configured client:key entries and key file; nil means API keys are off
+func loadAPIKeys(cfg config.AuthConfig) middleware.StaticKeys {
+	keys := middleware.StaticKeys{}
+	if len(cfg.APIKeys) > 0 {
+		parsed, err := middleware.ParseKeys(strings.Join(cfg.APIKeys, ","))
+		if err != nil {
+			fatal("invalid auth.api_keys", "error", err)
+		}
+		for k, client := range parsed {
+			keys[k] = client
+		}
+	}
+	if cfg.APIKeysFile != "" {
+		parsed, err := middleware.LoadKeyFile(cfg.APIKeysFile)
+		if err != nil {
+			fatal("invalid auth.api_keys_file", "error", err)
+		}
+		for k, client := range parsed {
+			keys[k] = client
+		}
+	}
+	if len(keys) == 0 {
+		return nil
 	}
+	return keys
 }
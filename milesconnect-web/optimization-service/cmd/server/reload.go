@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"milesconnect-optimization/internal/api"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/cache"
+	"milesconnect-optimization/internal/capture"
+	"milesconnect-optimization/internal/config"
+	"milesconnect-optimization/internal/feature"
+	"milesconnect-optimization/internal/geocode"
+	"milesconnect-optimization/internal/jobs"
+	"milesconnect-optimization/internal/logging"
+	"milesconnect-optimization/internal/middleware"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/retry"
+	"milesconnect-optimization/internal/routing"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/solver/genetic"
+	"milesconnect-optimization/internal/tenant"
+	"milesconnect-optimization/internal/tracking"
+	"milesconnect-optimization/internal/weather"
+)
+
+// reloader re-reads the configuration and applies the settings that can change at
+// runtime: rate limits, tenant quotas, solver defaults, the routing and geocoding
+// providers, feature flags, the result cache and the log level. Listener,
+// TLS and auth settings are only read at startup; changes to them are logged and ignored.
+type reloader struct {
+	path    string
+	limiter *middleware.RateLimiter
+	tenants *tenant.Registry
+	audit   *audit.Logger   // opened at startup; audit settings are not reloaded
+	jobs    *jobs.Runner    // likewise for jobs
+	capture *capture.Store  // likewise for capture.dir and max_entries
+	routes  *tracking.Store // likewise for tracking
+
+	writeTimeout time.Duration // the listener's, which server changes need a restart for
+
+	mu       sync.Mutex
+	current  config.Config
+	routing  *routing.Resilient // kept across reloads while its config is unchanged, so breaker state survives
+	cache    *cache.Cache       // likewise, emptied when a setting that shapes results changes
+	geocoder *geocode.Geocoder  // likewise, so the address cache and rate pacing survive
+	weather  *weather.Service   // likewise, for its cache
+}
+
+func newReloader(path string, cfg config.Config, limiter *middleware.RateLimiter, tenants *tenant.Registry, auditLog *audit.Logger, runner *jobs.Runner, captures *capture.Store) *reloader {
+	r := &reloader{path: path, limiter: limiter, tenants: tenants, audit: auditLog, jobs: runner, capture: captures, current: cfg,
+		writeTimeout: cfg.Server.WriteTimeout}
+	if t := cfg.Tracking; t.MaxRoutes > 0 {
+		r.routes = tracking.NewStore(t.TTL, t.MaxRoutes)
+	}
+	r.apply(cfg)
+	return r
+}
+
+func (r *reloader) apply(cfg config.Config) {
+	if r.routing == nil || !reflect.DeepEqual(r.current.Routing, cfg.Routing) {
+		r.routing = newRouting(cfg.Routing)
+	}
+	if r.geocoder == nil || cfg.Geocoding != r.current.Geocoding {
+		r.geocoder = newGeocoder(cfg.Geocoding)
+	}
+	if r.weather == nil || cfg.Weather != r.current.Weather {
+		r.weather = newWeather(cfg.Weather)
+	}
+	if cfg.Cache != r.current.Cache || !reflect.DeepEqual(cfg.Routing, r.current.Routing) ||
+		cfg.Solver.Timeout != r.current.Solver.Timeout {
+		r.cache = nil
+	}
+	if r.cache == nil && cfg.Cache.TTL > 0 {
+		r.cache = cache.New(cfg.Cache.TTL, cfg.Cache.MaxEntries)
+	}
+	api.Configure(api.Settings{
+		Routing:       r.routing,
+		SolverTimeout: cfg.Solver.Timeout,
+		MaxStops:      cfg.Solver.MaxStops,
+		MaxBodyBytes:  int64(cfg.Solver.MaxBodyBytes),
+		WriteTimeout:  r.writeTimeout,
+		Genetic:       genetic.Params(cfg.Solver.Genetic),
+		Hierarchical:  solver.HierarchicalParams(cfg.Solver.Hierarchical),
+		Features:      features(cfg.Features),
+		Shadow: api.ShadowSettings{
+			Solver: cfg.Solver.Shadow.Solver,
+			Sample: feature.Flag{Tenants: cfg.Solver.Shadow.Tenants, Percent: cfg.Solver.Shadow.Percent},
+		},
+		Audit:          r.audit,
+		Jobs:           r.jobs,
+		Cache:          r.cache,
+		CachePrecision: cfg.Cache.Precision,
+		Workers:        cfg.Solver.Workers,
+		QueueSize:      cfg.Solver.QueueSize,
+		QueueTimeout:   cfg.Solver.QueueTimeout,
+
+		Geocoder:             r.geocoder,
+		GeocodeMinConfidence: cfg.Geocoding.MinConfidence,
+
+		TierPenalties: tierPenalties(cfg.Solver.Tiers),
+		Weather:       r.weather,
+
+		EmissionsKgPerKm: cfg.Solver.EmissionsKgPerKm,
+		Currency:         cfg.Solver.Currency,
+		ExchangeRates:    cfg.Solver.ExchangeRates,
+		HolidayCalendars: cfg.Solver.HolidayCalendars,
+
+		Capture:          r.capture,
+		CaptureSlowAfter: cfg.Capture.SlowAfter,
+
+		Routes: r.routes,
+
+		Profiles:       profiles(cfg.Profiles),
+		TenantProfiles: cfg.Tenants.Profiles,
+		DefaultProfile: cfg.Tenants.Profile,
+
+		SpeedClasses: speedClasses(cfg.Routing.SpeedClasses),
+
+		StabilityThresholdPct: cfg.Solver.StabilityThresholdPct,
+		TravelTimeCV:          cfg.Routing.TravelTimeCV,
+
+		SolverLimits: models.SolverParams{
+			TimeBudgetMs:  int(cfg.Solver.Limits.MaxTimeBudget.Milliseconds()),
+			MaxIterations: cfg.Solver.Limits.MaxIterations,
+			Neighborhood:  cfg.Solver.Limits.MaxNeighborhood,
+		},
+	})
+	r.limiter.SetLimits(cfg.RateLimit.RPS, cfg.RateLimit.Burst)
+	overrides := make(map[string]tenant.Limits, len(cfg.Tenants.Overrides))
+	for name, l := range cfg.Tenants.Overrides {
+		overrides[name] = tenant.Limits(l)
+	}
+	r.tenants.Configure(cfg.Tenants.Header, tenant.Limits(cfg.Tenants.Default), overrides)
+	logging.SetLevel(cfg.Logging.Level)
+}
+
+// newRouting builds the provider chain for cfg; nil means great-circle distances only
+func newRouting(cfg config.RoutingConfig) *routing.Resilient {
+	var primary routing.Provider
+	switch cfg.Provider {
+	case "osrm":
+		primary = &routing.OSRM{BaseURL: cfg.OSRM.URL, Profile: cfg.OSRM.Profile}
+	default:
+		return nil
+	}
+	slog.Info("routing provider configured", "provider", primary.Name())
+	return &routing.Resilient{
+		Primary: primary,
+		Breaker: routing.NewBreaker(routing.BreakerConfig(cfg.Breaker)),
+		Retry:   retry.Policy(cfg.Retry),
+		Timeout: cfg.Timeout,
+	}
+}
+
+// newGeocoder builds the geocoder for cfg; nil means stops need coordinates
+func newGeocoder(cfg config.GeocodingConfig) *geocode.Geocoder {
+	var provider geocode.Provider
+	switch cfg.Provider {
+	case "nominatim":
+		n := cfg.Nominatim
+		provider = &geocode.Nominatim{BaseURL: n.URL, UserAgent: n.UserAgent, CountryCodes: n.CountryCodes}
+	case "google":
+		provider = &geocode.Google{APIKey: cfg.Google.APIKey, Region: cfg.Google.Region}
+	default:
+		return nil
+	}
+	slog.Info("geocoding provider configured", "provider", provider.Name(), "rps", cfg.RPS)
+	g := &geocode.Geocoder{
+		Provider:    provider,
+		Retry:       retry.Policy{MaxAttempts: cfg.MaxAttempts, BaseDelay: 200 * time.Millisecond, MaxDelay: 2 * time.Second},
+		Timeout:     cfg.Timeout,
+		RPS:         cfg.RPS,
+		Concurrency: cfg.Concurrency,
+	}
+	if cfg.CacheTTL > 0 {
+		g.Cache = cache.New(cfg.CacheTTL, cfg.CacheEntries)
+	}
+	return g
+}
+
+// newWeather builds the weather service for cfg; without a provider it applies only
+// the weather requests give
+func newWeather(cfg config.WeatherConfig) *weather.Service {
+	w := &weather.Service{
+		Timeout:     cfg.Timeout,
+		Concurrency: cfg.Concurrency,
+		Multipliers: map[string]float64{
+			models.WeatherLight:    cfg.LightMultiplier,
+			models.WeatherModerate: cfg.ModerateMultiplier,
+			models.WeatherSevere:   cfg.SevereMultiplier,
+		},
+	}
+	if cfg.Provider == "open-meteo" {
+		w.Provider = &weather.OpenMeteo{BaseURL: cfg.URL}
+		slog.Info("weather provider configured", "provider", w.Provider.Name())
+	}
+	if w.Provider != nil && cfg.CacheTTL > 0 {
+		w.Cache = cache.New(cfg.CacheTTL, 10000)
+	}
+	return w
+}
+
+func features(flags map[string]config.FeatureFlag) feature.Set {
+	set := make(feature.Set, len(flags))
+	for name, f := range flags {
+		set[name] = feature.Flag(f)
+	}
+	return set
+}
+
+// checkSolvers rejects solver names config can't verify itself
+func checkSolvers(cfg config.Config) error {
+	if name := cfg.Solver.Shadow.Solver; name != "" && !api.IsRouteSolver(name) {
+		return fmt.Errorf("solver.shadow.solver %q is not an /optimize solver", name)
+	}
+	return nil
+}
+
+// Reload loads the configuration again and applies it. An invalid configuration
+// leaves the running settings untouched.
+func (r *reloader) Reload() error {
+	cfg, err := config.Load(r.path)
+	if err != nil {
+		return err
+	}
+	if err := checkSolvers(cfg); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.current
+	if !reflect.DeepEqual(old.Server, cfg.Server) || !reflect.DeepEqual(old.Auth, cfg.Auth) ||
+		!reflect.DeepEqual(old.TLS, cfg.TLS) || !reflect.DeepEqual(old.Admin, cfg.Admin) ||
+		old.Audit != cfg.Audit || old.Jobs != cfg.Jobs || old.Logging.Format != cfg.Logging.Format ||
+		old.Capture.Dir != cfg.Capture.Dir || old.Capture.MaxEntries != cfg.Capture.MaxEntries || old.Stats != cfg.Stats ||
+		old.Tracking != cfg.Tracking {
+		slog.Warn("server, auth, tls, admin, audit, jobs, capture.dir, capture.max_entries, stats, tracking and logging.format changes need a restart and were not applied")
+	}
+	r.apply(cfg)
+	r.current = cfg
+	slog.Info("configuration reloaded", "config", r.path,
+		"rate_limit_rps", cfg.RateLimit.RPS, "solver_timeout", cfg.Solver.Timeout.String())
+	return nil
+}
+
+// watchSIGHUP reloads the configuration every time the process receives SIGHUP
+func (r *reloader) watchSIGHUP() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := r.Reload(); err != nil {
+				slog.Error("configuration reload failed", "error", err)
+			}
+		}
+	}()
+}
+
+// ServeHTTP handles POST /admin/reload
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.Reload(); err != nil {
+		slog.ErrorContext(req.Context(), "configuration reload failed", "error", err)
+		http.Error(w, "Reload failed: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// profiles converts the configured profiles for api.Settings
+func profiles(cfg map[string]config.ProfileConfig) map[string]api.Profile {
+	out := make(map[string]api.Profile, len(cfg))
+	for name, p := range cfg {
+		profile := api.Profile{
+			Solver:           p.Solver,
+			Currency:         p.Currency,
+			Timezone:         p.Timezone,
+			SpeedKmh:         p.SpeedKmh,
+			SpeedClasses:     speedClasses(p.SpeedClasses),
+			EmissionsKgPerKm: p.EmissionsKgPerKm,
+		}
+		if p.Objective != nil {
+			profile.Objective = (*models.ObjectiveWeights)(p.Objective)
+		}
+		out[name] = profile
+	}
+	return out
+}
+
+// speedClasses are the configured speed classes; nil when there are none
+func speedClasses(classes []config.SpeedClass) []models.SpeedClass {
+	var out []models.SpeedClass
+	for _, c := range classes {
+		out = append(out, models.SpeedClass(c))
+	}
+	return out
+}
+
+// tierPenalties is the penalty table of the configured tiers
+func tierPenalties(t config.TiersConfig) map[string]models.TierPenalty {
+	return map[string]models.TierPenalty{
+		models.TierPlatinum: {LatePerMinute: t.PlatinumLate, Unserved: t.PlatinumUnserved},
+		models.TierGold:     {LatePerMinute: t.GoldLate, Unserved: t.GoldUnserved},
+		models.TierStandard: {LatePerMinute: t.StandardLate, Unserved: t.StandardUnserved},
+	}
+}
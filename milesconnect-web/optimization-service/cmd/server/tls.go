@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"milesconnect-optimization/internal/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// configureTLS prepares srv for HTTPS and returns the function that starts serving.
+// cert_file/key_file serve a fixed certificate; autocert.domains obtains certificates
+// from Let's Encrypt instead. With neither set the server speaks plain HTTP.
+// client_ca_file additionally verifies client certificates against that CA.
+func configureTLS(srv *http.Server, cfg config.TLSConfig) func() error {
+	serve := tlsServe(srv, cfg)
+	if caFile := cfg.ClientCAFile; caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			fatal("invalid tls.client_ca_file", "error", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			fatal("no certificates found in tls.client_ca_file", "path", caFile)
+		}
+
+		// Certificates are verified during the handshake when offered; which endpoints
+		// insist on one is decided by middleware.RequireClientCert, so probes still work
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		slog.Info("mutual TLS enabled", "client_ca", caFile)
+	}
+	return serve
+}
+
+func tlsServe(srv *http.Server, cfg config.TLSConfig) func() error {
+	switch {
+	case cfg.CertFile != "":
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		slog.Info("TLS enabled", "certificate", cfg.CertFile)
+		return func() error { return srv.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile) }
+
+	case len(cfg.Autocert.Domains) > 0:
+		ac := cfg.Autocert
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(ac.Domains...),
+			Cache:      autocert.DirCache(ac.CacheDir),
+			Email:      ac.Email,
+		}
+		srv.TLSConfig = m.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+		// tls-alpn-01 works on the HTTPS port alone; HTTP-01 needs a listener on :80
+		if ac.HTTPAddr != "" {
+			go func() {
+				if err := http.ListenAndServe(ac.HTTPAddr, m.HTTPHandler(nil)); err != nil {
+					slog.Error("ACME HTTP challenge listener stopped", "error", err)
+				}
+			}()
+		}
+		slog.Info("TLS enabled with automatic certificates", "domains", ac.Domains)
+		return func() error { return srv.ListenAndServeTLS("", "") }
+
+	default:
+		return srv.ListenAndServe
+	}
+}
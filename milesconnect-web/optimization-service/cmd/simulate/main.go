@@ -0,0 +1,160 @@
+// Command simulate replays historical days of orders and fleets through solver
+// configurations offline and reports each configuration's total distance, vehicles
+// used and on-time rate:
+//
+//	go run ./cmd/simulate history.json                       # the configurations in the file
+//	go run ./cmd/simulate -solvers tsp-2opt,tsp-nearest-neighbor history.json
+//	go run ./cmd/simulate -json history.json > before.json   # compare before/after a change
+//
+// The input is a /simulate request body. Routes go through the service's pipeline with
+// its built-in defaults, as milesopt routes them: great-circle distances, the request's
+// weather regions only and no server profiles or geocoding. Nothing is cached, so every
+// allocation and route is a solve.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/pipeline"
+	"milesconnect-optimization/internal/simulate"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/solvers"
+	"milesconnect-optimization/internal/validation"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	solverList := flag.String("solvers", "", "comma-separated solver names, each replayed as a configuration of its own after the file's")
+	timeout := flag.Duration("timeout", 30*time.Second, "time budget per solve, unless a configuration's solver_params give one")
+	seed := flag.Int64("seed", 1, "genetic solver seed")
+	clusterSize := flag.Int("cluster-size", solver.DefaultHierarchicalParams().ClusterSize, "cluster size of "+solver.HierarchicalName)
+	asJSON := flag.Bool("json", false, "write results as JSON, as POST /simulate returns them")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: simulate [flags] [history.json|-]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	req, err := readRequest(flag.Arg(0))
+	if err != nil {
+		fatal(err.Error())
+	}
+	if *solverList != "" {
+		for _, name := range strings.Split(*solverList, ",") {
+			req.Configs = append(req.Configs, models.SimulationConfig{Name: name, Solver: name})
+		}
+	}
+	if errs := validation.SimulationRequest(req); len(errs) > 0 {
+		invalid(errs)
+	}
+
+	opts := solvers.DefaultOptions()
+	opts.Genetic.Seed, opts.ClusterSize = *seed, *clusterSize
+	resp, err := simulate.Run(context.Background(), req, simulate.Solvers{
+		Load: func(ctx context.Context, req models.LoadRequest) (models.LoadResponse, error) {
+			if errs := validation.LoadRequest(req); len(errs) > 0 {
+				return models.LoadResponse{}, errs
+			}
+			ctx, cancel := context.WithTimeout(ctx, pipeline.Budget(*timeout, req.SolverParams))
+			defer cancel()
+			return solver.OptimizeFleetAllocation(ctx, req), nil
+		},
+		Route: func(ctx context.Context, req models.OptimizationRequest) (models.OptimizationResponse, error) {
+			return route(ctx, req, opts, *timeout)
+		},
+	})
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		invalid(errs)
+	}
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+	printTable(resp)
+}
+
+// route solves req as milesopt does: the checks of validation.OptimizationRequest,
+// then the solver and pipeline.Offline
+func route(ctx context.Context, req models.OptimizationRequest, opts solvers.Options, timeout time.Duration) (models.OptimizationResponse, error) {
+	errs := validation.OptimizationRequest(req)
+	if len(errs) == 0 {
+		req, errs = validation.ApplyDuplicates(req)
+	}
+	if len(errs) > 0 {
+		return models.OptimizationResponse{}, errs
+	}
+	name := req.Solver
+	if name == "" {
+		name = solver.TwoOptName
+	}
+	solve, _ := solvers.Route(name, opts)
+	return pipeline.Offline(ctx, req, solve, timeout), nil
+}
+
+// readRequest reads the /simulate request from path, or standard input for "" and "-"
+func readRequest(path string) (models.SimulationRequest, error) {
+	var req models.SimulationRequest
+	var in io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return req, err
+		}
+		defer f.Close()
+		in = f
+	}
+	if err := json.NewDecoder(in).Decode(&req); err != nil {
+		return req, fmt.Errorf("invalid request: %w", err)
+	}
+	return req, nil
+}
+
+// printTable writes each configuration's totals, one row each
+func printTable(resp models.SimulationResponse) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "config\tdays\tdistance_km\tduration_min\tvehicles\tunassigned\ton_time\tlate_min\ttime_ms\t")
+	for _, r := range resp.Results {
+		t := r.Total
+		onTime := "-"
+		if t.OnTimeRatePct != nil {
+			onTime = fmt.Sprintf("%.1f%% of %d", *t.OnTimeRatePct, t.WindowStops)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.1f\t%d\t%d\t%s\t%.1f\t%.1f\t\n",
+			r.Config, len(r.Days), t.TotalDistKm, t.TotalDurationMin, t.VehiclesUsed, t.Unassigned, onTime, t.LateMinutes, t.ComputeTimeMs)
+	}
+	w.Flush()
+}
+
+// invalid writes each field error and exits
+func invalid(errs validation.Errors) {
+	for _, fe := range errs {
+		fmt.Fprintf(os.Stderr, "simulate: %s: %s\n", fe.Field, fe.Message)
+	}
+	os.Exit(1)
+}
+
+func fatal(msg string) {
+	fmt.Fprintln(os.Stderr, "simulate:", msg)
+	os.Exit(1)
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"math"
+	"milesconnect-optimization/internal/cache"
+	"milesconnect-optimization/internal/logging"
+	"milesconnect-optimization/internal/metrics"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/objective"
+	"milesconnect-optimization/internal/stats"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// noCache reports whether an HTTP caller asked to skip the result cache
+func noCache(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Cache-Control"), "no-cache")
+}
+
+// routeKey is the canonical form of an /optimize request: stops in a fixed order with
+// coordinates rounded to the cache precision, so reordered or re-encoded copies of the
+// same request share a cache entry. Field selections are applied after the cache; the
+// departure time, tier penalties, objective and holidays are in the key because stops
+// are reordered for them.
+type routeKey struct {
+	Tenant     string
+	Solver     string
+	Start, End models.Location
+	Waypoints  []models.Location
+	Duplicates models.DuplicateHandling
+
+	DepartureTime, Timezone string
+	SpeedKmh                float64
+	TierPenalties           map[string]models.TierPenalty
+
+	Objective        models.ObjectiveWeights
+	EmissionsKgPerKm float64
+
+	VehicleCapacityKg, ReloadMinutes, MaxRangeKm float64
+
+	HolidayCalendars map[string][]string
+	HolidayCalendar  string
+	SpeedClasses     []models.SpeedClass
+
+	PreviousRoute         []string
+	StabilityThresholdPct float64
+	InitialRoute          []string
+	RoadLegs              bool
+
+	// The time budget only changes partial results, which aren't cached
+	MaxIterations, Neighborhood int
+	UTurnPenaltyKm              float64
+}
+
+type loadKey struct {
+	Tenant        string
+	Vehicles      []models.VehicleInfo
+	Shipments     []models.ShipmentInfo
+	TierPenalties map[string]models.TierPenalty
+	Objective     models.ObjectiveWeights
+
+	GroupByDestination bool
+	GroupRadiusKm      float64
+}
+
+// routeCacheKey is the cache key for req solved by solverName; empty when caching is off
+func routeCacheKey(ctx context.Context, cfg Settings, req models.OptimizationRequest, solverName string) string {
+	if cfg.Cache == nil {
+		return ""
+	}
+	round := func(l models.Location) models.Location {
+		l.Lat, l.Lng = roundTo(l.Lat, cfg.CachePrecision), roundTo(l.Lng, cfg.CachePrecision)
+		if len(l.MergedIDs) > 0 {
+			l.MergedIDs = slices.Sorted(slices.Values(l.MergedIDs))
+		}
+		return l
+	}
+	key := routeKey{
+		Tenant:     tenantName(ctx),
+		Solver:     solverName,
+		Start:      round(req.Start),
+		End:        round(req.End),
+		Waypoints:  make([]models.Location, len(req.Waypoints)),
+		Duplicates: req.Duplicates,
+
+		DepartureTime: req.DepartureTime,
+		Timezone:      req.Timezone,
+		SpeedKmh:      req.SpeedKmh,
+		TierPenalties: req.TierPenalties,
+
+		Objective:        objective.Weights(req.Objective),
+		EmissionsKgPerKm: req.EmissionsKgPerKm,
+
+		VehicleCapacityKg: req.VehicleCapacityKg,
+		ReloadMinutes:     req.ReloadMinutes,
+		MaxRangeKm:        req.MaxRangeKm,
+
+		HolidayCalendars: req.HolidayCalendars,
+		HolidayCalendar:  req.HolidayCalendar,
+		SpeedClasses:     req.SpeedClasses,
+
+		PreviousRoute:         req.PreviousRoute,
+		StabilityThresholdPct: req.StabilityThresholdPct,
+		InitialRoute:          req.InitialRoute,
+		RoadLegs:              req.RoadLegs,
+	}
+	if p := req.SolverParams; p != nil {
+		key.MaxIterations, key.Neighborhood = p.MaxIterations, p.Neighborhood
+		key.UTurnPenaltyKm = p.UTurnPenaltyKm
+	}
+	for i, w := range req.Waypoints {
+		key.Waypoints[i] = round(w)
+	}
+	slices.SortFunc(key.Waypoints, func(a, b models.Location) int {
+		return cmp.Or(strings.Compare(a.ID, b.ID), cmp.Compare(a.Lat, b.Lat), cmp.Compare(a.Lng, b.Lng))
+	})
+	return cache.Key(key)
+}
+
+// loadCacheKey is the cache key for req; empty when caching is off
+func loadCacheKey(ctx context.Context, cfg Settings, req models.LoadRequest) string {
+	if cfg.Cache == nil {
+		return ""
+	}
+	key := loadKey{
+		Tenant:    tenantName(ctx),
+		Vehicles:  slices.Clone(req.Vehicles),
+		Shipments: slices.Clone(req.Shipments),
+
+		TierPenalties: req.TierPenalties,
+		Objective:     objective.Weights(req.Objective),
+
+		GroupByDestination: req.GroupByDestination,
+		GroupRadiusKm:      req.GroupRadiusKm,
+	}
+	slices.SortFunc(key.Vehicles, func(a, b models.VehicleInfo) int { return strings.Compare(a.ID, b.ID) })
+	slices.SortFunc(key.Shipments, func(a, b models.ShipmentInfo) int { return strings.Compare(a.ID, b.ID) })
+	return cache.Key(key)
+}
+
+// cached returns the response stored under key, unless caching is off or the caller
+// bypassed it. A bypassing request still refreshes the entry once solved.
+func cached[T models.OptimizationResponse | models.LoadResponse](ctx context.Context, cfg Settings, endpoint, key string, bypass bool) (T, bool) {
+	var zero T
+	if key == "" {
+		return zero, false
+	}
+	outcome := "miss"
+	defer func() {
+		metrics.CacheLookups.Inc(endpoint, outcome)
+		stats.Default.RecordCacheLookup(endpoint, outcome)
+		logging.Annotate(ctx, slog.String("cache", outcome))
+	}()
+	if bypass {
+		outcome = "bypass"
+		return zero, false
+	}
+	v, ok := cfg.Cache.Get(key)
+	if !ok {
+		return zero, false
+	}
+	resp, ok := v.(T)
+	if !ok {
+		return zero, false
+	}
+	outcome = "hit"
+	return resp, true
+}
+
+// cacheResult stores resp under key. Partial results cut short by the time budget and
+// ones computed on fallback distances are not cached, so a retry gets a full solve.
+func cacheResult(cfg Settings, key string, resp any, meta models.SolverMetadata) {
+	if key == "" || meta.BudgetExhausted || (meta.Distances != nil && meta.Distances.Fallback) {
+		return
+	}
+	cfg.Cache.Put(key, resp)
+}
+
+func roundTo(v float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Round(v*p) / p
+}
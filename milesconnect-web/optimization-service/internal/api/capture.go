@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/capture"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+	"time"
+)
+
+// CaptureList is the response of GET /admin/captures
+type CaptureList struct {
+	Captures []capture.Capture `json:"captures"`
+}
+
+// ReplayResponse is the response of POST /admin/captures/{id}/replay: the capture, with
+// what the original solve reported, and what the current solvers make of its request,
+// under the capture's ID
+type ReplayResponse struct {
+	Capture capture.Capture `json:"capture"`
+	Replay  Reply           `json:"replay"`
+}
+
+// captureInvalid keeps req, which failed endpoint's checks with errs, when capture is
+// on and the client consented
+func captureInvalid(ctx context.Context, cfg Settings, endpoint string, req any, consent bool, errs validation.Errors) {
+	if cfg.Capture == nil || !consent {
+		return
+	}
+	c := capture.Capture{Reason: capture.Invalid}
+	for _, fe := range errs {
+		c.InvalidFields = append(c.InvalidFields, fe.Field)
+	}
+	saveCapture(ctx, cfg, endpoint, req, c)
+}
+
+// captureSlow keeps req, solved with meta and result, when capture is on, the client
+// consented and the solve ran out of time or took at least CaptureSlowAfter
+func captureSlow(ctx context.Context, cfg Settings, endpoint string, req any, consent bool, meta models.SolverMetadata, result audit.Summary) {
+	if cfg.Capture == nil || !consent || meta.Cached {
+		return
+	}
+	took := time.Duration(meta.ComputeTimeMs * float64(time.Millisecond))
+	if !meta.BudgetExhausted && took < cfg.CaptureSlowAfter {
+		return
+	}
+	result.BudgetExhausted = meta.BudgetExhausted
+	result.ComputeTimeMs = meta.ComputeTimeMs
+	saveCapture(ctx, cfg, endpoint, req, capture.Capture{
+		Reason:        capture.Slow,
+		Solver:        meta.Solver,
+		SolverVersion: meta.Version,
+		Result:        &result,
+	})
+}
+
+// saveCapture stores c with req anonymized; failures are logged, never surfaced to
+// the client
+func saveCapture(ctx context.Context, cfg Settings, endpoint string, req any, c capture.Capture) {
+	body, err := json.Marshal(req)
+	if err == nil {
+		c.Request, err = capture.Anonymize(body)
+	}
+	if err == nil {
+		c.Tenant, c.Endpoint = tenantName(ctx), endpoint
+		c, err = cfg.Capture.Save(c)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "capturing request", "endpoint", endpoint, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "request captured", "capture_id", c.ID, "reason", c.Reason)
+}
+
+// AdminCapturesHandler handles GET /admin/captures, the captured requests newest first
+func AdminCapturesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	store := settings().Capture
+	if store == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Request capture is not enabled"})
+		return
+	}
+	list, err := store.List()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing captures", "error", err)
+		writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Capture store unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, CaptureList{Captures: list})
+}
+
+// AdminCaptureHandler handles GET /admin/captures/{id}, a captured request in full
+func AdminCaptureHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if c, ok := loadCapture(w, r); ok {
+		writeJSON(w, http.StatusOK, c)
+	}
+}
+
+// ReplayCaptureHandler handles POST /admin/captures/{id}/replay, solving the captured
+// request again with the current solvers and settings. The replay waits for a solver
+// slot rather than being rejected, like a background solve, and has no tenant's limits.
+func ReplayCaptureHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := loadCapture(w, r)
+	if !ok {
+		return
+	}
+	result, err := Execute(r.Context(), c.Endpoint, c.Request)
+	if clientGone(r) {
+		return
+	}
+	c.Request = nil
+	writeJSON(w, http.StatusOK, ReplayResponse{Capture: c, Replay: NewReply(c.ID, result, err)})
+}
+
+// loadCapture reads the capture named by the request path, writing the error response
+// when there isn't one
+func loadCapture(w http.ResponseWriter, r *http.Request) (capture.Capture, bool) {
+	store := settings().Capture
+	if store == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Request capture is not enabled"})
+		return capture.Capture{}, false
+	}
+	c, err := store.Get(r.PathValue("id"))
+	if errors.Is(err, capture.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Capture not found"})
+		return c, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "loading capture", "error", err)
+		writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Capture store unavailable"})
+		return c, false
+	}
+	return c, true
+}
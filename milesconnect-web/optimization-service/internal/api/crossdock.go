@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+)
+
+// OptimizeCrossDockHandler assigns the shipments coming off inbound trucks at a
+// cross-dock to outbound trailers, with the fewest handling moves that keep within the
+// trailers' capacities and departure cutoffs
+func OptimizeCrossDockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := settings()
+	limitBody(w, r, cfg)
+	var req models.CrossDockRequest
+	limit := maxStops(r.Context())
+	inbound, n, found, err := decodeCapped(r.Body, &req, "inbound", limit, validation.InboundShipment)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	req.Inbound = inbound
+	errs := validation.MaxItems("inbound", n, limit)
+	if len(errs) == 0 {
+		errs = found
+	}
+	if len(errs) == 0 {
+		errs = validation.CrossDockRequest(req)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	release, ok := acquireWorker(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.SolverTimeout)
+	defer cancel()
+	done := trackSolve(solver.CrossDockName)
+	resp := solver.OptimizeCrossDock(ctx, req)
+	done()
+	release()
+	recordSolve(r.Context(), resp.Metadata, len(req.Inbound))
+	auditSolve(r.Context(), r.URL.Path, req, len(req.Inbound), resp.Metadata, audit.Summary{VehiclesUsed: len(resp.Trailers), Unassigned: len(resp.Unassigned)})
+	if clientGone(r) {
+		return
+	}
+
+	writeResult(w, r, resp, req.Fields)
+}
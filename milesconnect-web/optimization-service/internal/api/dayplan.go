@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+)
+
+// PlanDaysHandler assigns recurring customers to delivery weekdays, zone by zone, so
+// that each day's customers are close together and the week's workload is even. Each
+// day comes with the waypoints to post to /optimize for its route.
+func PlanDaysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := settings()
+	limitBody(w, r, cfg)
+	var req models.DayPlanRequest
+	limit := maxStops(r.Context())
+	customers, n, found, err := decodeCapped(r.Body, &req, "customers", limit, func(field string, c models.DayCustomer) validation.Errors {
+		return validation.Location(field, c.Location)
+	})
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	req.Customers = customers
+	errs := validation.MaxItems("customers", n, limit)
+	if len(errs) == 0 {
+		errs = found
+	}
+	if len(errs) == 0 {
+		errs = validation.DayPlanRequest(req)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	release, ok := acquireWorker(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.SolverTimeout)
+	defer cancel()
+	done := trackSolve(solver.DayPlanName)
+	resp := solver.PlanDeliveryDays(ctx, req)
+	done()
+	release()
+	recordSolve(r.Context(), resp.Metadata, len(req.Customers))
+	auditSolve(r.Context(), r.URL.Path, req, len(req.Customers), resp.Metadata, audit.Summary{})
+	if clientGone(r) {
+		return
+	}
+
+	writeResult(w, r, resp, req.Fields)
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed debugmap.html
+var debugMapPage []byte
+
+// DebugMapHandler serves GET /debug/map, a Leaflet page drawing a pasted request,
+// response or job, or one solved on the spot, to diagnose odd routes. The page is
+// static; it calls /optimize and /jobs with the credentials entered into it.
+func DebugMapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(debugMapPage)
+}
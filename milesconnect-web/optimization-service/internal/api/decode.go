@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+	"strings"
+)
+
+// limitBody caps the request body at the configured size; reads past it fail with
+// *http.MaxBytesError
+func limitBody(w http.ResponseWriter, r *http.Request, cfg Settings) {
+	if cfg.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes)
+	}
+}
+
+// writeDecodeError answers a body that could not be decoded
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("Request body larger than %d bytes", tooLarge.Limit)})
+		return
+	}
+	http.Error(w, "Invalid request body", http.StatusBadRequest)
+}
+
+// decodeRoute decodes an /optimize body, streaming its waypoints so a request over the
+// caller's stop limit, or with stops off the map, fails its checks without every stop
+// being held in memory
+func decodeRoute(ctx context.Context, r io.Reader) (models.OptimizationRequest, validation.Errors, error) {
+	var req models.OptimizationRequest
+	limit := maxStops(ctx)
+	waypoints, n, errs, err := decodeCapped(r, &req, "waypoints", limit, validation.Location)
+	if err != nil {
+		return req, nil, err
+	}
+	if errs := validation.MaxItems("waypoints", n, limit); len(errs) > 0 {
+		return req, errs, nil
+	}
+	if len(errs) > 0 {
+		return req, errs, nil
+	}
+	req.Waypoints = waypoints
+	return req, nil, nil
+}
+
+// decodeLoad is decodeRoute for /optimize-load bodies and their shipments
+func decodeLoad(ctx context.Context, r io.Reader) (models.LoadRequest, validation.Errors, error) {
+	var req models.LoadRequest
+	limit := maxStops(ctx)
+	shipments, n, errs, err := decodeCapped(r, &req, "shipments", limit, validation.Shipment)
+	if err != nil {
+		return req, nil, err
+	}
+	if errs := validation.MaxItems("shipments", n, limit); len(errs) > 0 {
+		return req, errs, nil
+	}
+	if len(errs) > 0 {
+		return req, errs, nil
+	}
+	req.Shipments = shipments
+	return req, nil, nil
+}
+
+// decodeCapped decodes the JSON object in r into dst, except for the array under key,
+// whose elements are decoded one at a time and returned. Past limit (when positive)
+// elements are only counted; n is the array's full length. check, when not nil, is
+// given each element as it is decoded with its field name, key[i]; once one fails,
+// the elements are only checked, and errs holds the failures. The other members are
+// small and decoded as usual.
+func decodeCapped[T any](r io.Reader, dst any, key string, limit int, check func(field string, item T) validation.Errors) (items []T, n int, errs validation.Errors, err error) {
+	return decodeCappedFrom(json.NewDecoder(r), dst, key, limit, check)
+}
+
+// decodeCappedFrom is decodeCapped for the next value in dec, an object nested in a
+// larger body. A null leaves dst as it is, as it would when decoded whole.
+func decodeCappedFrom[T any](dec *json.Decoder, dst any, key string, limit int, check func(field string, item T) validation.Errors) (items []T, n int, errs validation.Errors, err error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if tok == nil {
+		return nil, 0, nil, nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, 0, nil, fmt.Errorf("expected %q", '{')
+	}
+	// The other members keep their order and repeats, so dst decodes them as it would
+	// the whole object: the last of a repeated or case-folded name wins
+	rest := []byte{'{'}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		name, _ := tok.(string)
+		// encoding/json matches member names case-insensitively; so does this
+		if !strings.EqualFold(name, key) {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, 0, nil, err
+			}
+			if len(rest) > 1 {
+				rest = append(rest, ',')
+			}
+			quoted, _ := json.Marshal(name)
+			rest = append(append(append(rest, quoted...), ':'), raw...)
+			continue
+		}
+		// A repeated key replaces the earlier array, as it would when decoded whole
+		items, n, errs = nil, 0, nil
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if tok == nil {
+			continue
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '[' {
+			return nil, 0, nil, fmt.Errorf("%s: expected an array", key)
+		}
+		items = []T{}
+		for dec.More() {
+			n++
+			if limit > 0 && n > limit {
+				var skip json.RawMessage
+				if err := dec.Decode(&skip); err != nil {
+					return nil, 0, nil, err
+				}
+				continue
+			}
+			var item T
+			if err := dec.Decode(&item); err != nil {
+				return nil, 0, nil, fmt.Errorf("%s[%d]: %w", key, n-1, err)
+			}
+			if check != nil {
+				if found := check(fmt.Sprintf("%s[%d]", key, n-1), item); len(found) > 0 {
+					// The request fails its checks, so its elements needn't be kept
+					errs, items = append(errs, found...), nil
+				}
+			}
+			if len(errs) == 0 {
+				items = append(items, item)
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, 0, nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, 0, nil, err
+	}
+
+	return items, n, errs, json.Unmarshal(append(rest, '}'), dst)
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q", want)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/validation"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCappedMatchesUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"plain", `{"start":{"lat":1,"lng":2},"waypoints":[{"id":"a","lat":3},{"id":"b","lat":4}],"solver":"tsp-2opt"}`},
+		{"no waypoints", `{"start":{"lat":1}}`},
+		{"empty", `{"waypoints":[]}`},
+		{"null", `{"waypoints":null,"speed_kmh":40}`},
+		{"null after array", `{"waypoints":[{"id":"a"}],"waypoints":null}`},
+		{"repeated", `{"waypoints":[{"id":"a"},{"id":"b"}],"waypoints":[{"id":"c"}]}`},
+		{"case-folded", `{"Waypoints":[{"id":"a"}],"WAYPOINTS":[{"id":"b"}]}`},
+		{"repeated other", `{"solver":"a","solver":"b","speed_kmh":30}`},
+		{"case-folded other", `{"solver":"a","Solver":"b","SOLVER":"c"}`},
+		{"repeated object", `{"start":{"lat":1},"start":{"lng":2}}`},
+		{"key elsewhere", `{"end":{"id":"waypoints"},"waypoints":[{"id":"a"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want models.OptimizationRequest
+			if err := json.Unmarshal([]byte(tt.body), &want); err != nil {
+				t.Fatal(err)
+			}
+			var got models.OptimizationRequest
+			items, n, _, err := decodeCapped[models.Location](strings.NewReader(tt.body), &got, "waypoints", 0, nil)
+			if err != nil {
+				t.Fatalf("decodeCapped: %v", err)
+			}
+			got.Waypoints = items
+			if n != len(want.Waypoints) {
+				t.Errorf("n = %d, want %d", n, len(want.Waypoints))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decodeCapped = %+v\njson.Unmarshal = %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeCappedLimit(t *testing.T) {
+	body := `{"waypoints":[{"id":"a"},{"id":"b"},{"id":"c"},{"id":"d"}],"solver":"s"}`
+	for _, tt := range []struct {
+		limit int
+		ids   []string
+	}{
+		{0, []string{"a", "b", "c", "d"}},
+		{2, []string{"a", "b"}},
+		{4, []string{"a", "b", "c", "d"}},
+		{9, []string{"a", "b", "c", "d"}},
+	} {
+		var req models.OptimizationRequest
+		items, n, _, err := decodeCapped[models.Location](strings.NewReader(body), &req, "waypoints", tt.limit, nil)
+		if err != nil {
+			t.Fatalf("limit %d: %v", tt.limit, err)
+		}
+		ids := make([]string, len(items))
+		for i, it := range items {
+			ids[i] = it.ID
+		}
+		if n != 4 || !reflect.DeepEqual(ids, tt.ids) || req.Solver != "s" {
+			t.Errorf("limit %d: n = %d, ids %v, solver %q; want 4, %v, \"s\"", tt.limit, n, ids, req.Solver, tt.ids)
+		}
+	}
+}
+
+func TestDecodeCappedErrors(t *testing.T) {
+	for _, body := range []string{
+		`[]`,
+		`{"waypoints":{}}`,
+		`{"waypoints":[{"lat":"x"}]}`,
+		`{"waypoints":[{"id":"a"}`,
+		`{"solver":}`,
+	} {
+		var req models.OptimizationRequest
+		if _, _, _, err := decodeCapped[models.Location](strings.NewReader(body), &req, "waypoints", 0, nil); err == nil {
+			t.Errorf("%s decoded without an error", body)
+		}
+	}
+}
+
+func TestDecodeCappedCheck(t *testing.T) {
+	for _, tt := range []struct {
+		body   string
+		limit  int
+		fields []string
+		ids    []string
+	}{
+		{`{"waypoints":[{"id":"a","lat":1},{"id":"b","lat":2}]}`, 0, nil, []string{"a", "b"}},
+		{`{"waypoints":[{"id":"a","lat":91},{"id":"b","lng":-181},{"id":"c"}]}`, 0, []string{"waypoints[0].lat", "waypoints[1].lng"}, nil},
+		{`{"waypoints":[{"id":"a"},{"id":"b","lat":91}]}`, 0, []string{"waypoints[1].lat"}, nil},
+		// Elements past the limit are only counted
+		{`{"waypoints":[{"id":"a"},{"id":"b","lat":91}]}`, 1, nil, []string{"a"}},
+		// A repeated key replaces the earlier array's failures too
+		{`{"waypoints":[{"lat":91}],"waypoints":[{"id":"a"}]}`, 0, nil, []string{"a"}},
+	} {
+		var req models.OptimizationRequest
+		items, _, errs, err := decodeCapped(strings.NewReader(tt.body), &req, "waypoints", tt.limit, validation.Location)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.body, err)
+		}
+		var fields, ids []string
+		for _, e := range errs {
+			fields = append(fields, e.Field)
+		}
+		for _, it := range items {
+			ids = append(ids, it.ID)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) || !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("%s: failed %v, kept %v; want %v, %v", tt.body, fields, ids, tt.fields, tt.ids)
+		}
+	}
+}
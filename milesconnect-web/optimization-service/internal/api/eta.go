@@ -0,0 +1,80 @@
+package api
+
+import (
+	"log/slog"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/schedule"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+	"slices"
+)
+
+// ETAHandler re-times the stops of a route in progress that are still to be visited,
+// from the vehicle's position and departure time, the way /optimize schedules a route:
+// great-circle legs at the request's speed, slowed by weather, with waits and service
+// times. The order is kept as given. A request naming a route stored with POST /routes
+// re-times the stops its driver hasn't reported completed or failed.
+func ETAHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := settings()
+	limitBody(w, r, cfg)
+	var req models.ETARequest
+	limit := maxStops(r.Context())
+	route, n, found, err := decodeCapped(r.Body, &req, "route", limit, validation.Location)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	req.Route = route
+	errs := validation.MaxItems("route", n, limit)
+	if len(errs) == 0 {
+		errs = found
+	}
+	if len(errs) == 0 && req.RouteID != "" {
+		req, errs = resumeETA(r.Context(), cfg, req)
+	}
+	req.HolidayCalendars = holidayCalendars(cfg, req.HolidayCalendars)
+	if len(errs) == 0 {
+		errs = validation.ETARequest(req)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if req.SpeedKmh == 0 && len(req.SpeedClasses) == 0 {
+		req.SpeedClasses = cfg.SpeedClasses
+	}
+	if req.TravelTimeCV == 0 {
+		req.TravelTimeCV = cfg.TravelTimeCV
+	}
+
+	plan, _, _ := schedule.NewPlan(models.OptimizationRequest{DepartureTime: req.DepartureTime, Timezone: req.Timezone, SpeedKmh: req.SpeedKmh, HolidayCalendars: req.HolidayCalendars, HolidayCalendar: req.HolidayCalendar, SpeedClasses: req.SpeedClasses,
+		LatenessRisk: req.LatenessRisk, TravelTimeCV: req.TravelTimeCV})
+	path := append([]models.Location{req.Position}, remainingStops(req.Route, req.Completed)...)
+	legs, err := cfg.Weather.Legs(r.Context(), path, req.Weather)
+	if err != nil {
+		slog.WarnContext(r.Context(), "weather lookup incomplete; affected legs are timed as clear", "error", err)
+	}
+	resp := models.ETAResponse{Schedule: plan.Route(path, legs)[1:]}
+	for i := 1; i < len(path); i++ {
+		resp.RemainingDistKm += geo.HaversineKm(path[i-1], path[i])
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// remainingStops is route without the completed stops; each completed ID takes out the
+// first stop left with that ID
+func remainingStops(route []models.Location, completed []string) []models.Location {
+	left := slices.Clone(route)
+	for _, id := range completed {
+		if i := slices.IndexFunc(left, func(l models.Location) bool { return l.ID == id }); i >= 0 {
+			left = slices.Delete(left, i, i+1)
+		}
+	}
+	return left
+}
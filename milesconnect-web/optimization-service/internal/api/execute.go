@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/tenant"
+	"milesconnect-optimization/internal/validation"
+	"time"
+)
+
+// backgroundRetryDelay is how long a background solve waits before asking again for a
+// saturated solver pool
+const backgroundRetryDelay = time.Second
+
+// ErrInvalidRequest wraps decoding failures of Execute's request body
+var ErrInvalidRequest = errors.New("invalid request body")
+
+// endpointPath maps the endpoint names accepted by /jobs and the message transports
+// to the synchronous endpoint's path
+func endpointPath(name string) (string, bool) {
+	switch name {
+	case "", "optimize", "/optimize":
+		return "/optimize", true
+	case "optimize-load", "/optimize-load":
+		return "/optimize-load", true
+	}
+	return "", false
+}
+
+// Execute solves a request for endpoint outside an HTTP exchange: async jobs and the
+// message transports. ctx must carry the caller's tenant and client so limits, usage
+// and the audit log apply as they would over HTTP. Requests failing the endpoint's
+// checks return validation.Errors. The result is the endpoint's response, trimmed to
+// the fields the request selected.
+//
+// Unlike the HTTP handlers it never rejects for capacity: it waits for a solver slot
+// until ctx ends.
+func Execute(ctx context.Context, endpoint string, body []byte) ([]byte, error) {
+	path, ok := endpointPath(endpoint)
+	if !ok {
+		return nil, fmt.Errorf("unknown endpoint %q", endpoint)
+	}
+
+	cfg := settings()
+	var resp any
+	var fields []string
+	switch path {
+	case "/optimize":
+		req, errs, err := decodeRoute(ctx, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+		if len(errs) == 0 {
+			if req, errs, err = checkRoute(ctx, req); err != nil {
+				return nil, err
+			}
+		}
+		if len(errs) > 0 {
+			captureInvalid(ctx, cfg, path, req, req.CaptureConsent, errs)
+			return nil, errs
+		}
+		fields = req.Fields
+		solve, name := routeSolver(ctx, cfg, req)
+		key := routeCacheKey(ctx, cfg, req, name)
+		if route, ok := cached[models.OptimizationResponse](ctx, cfg, path, key, req.NoCache); ok {
+			route.Metadata.Cached = true
+			auditSolve(ctx, path, req, len(req.Waypoints), route.Metadata, audit.Summary{TotalDistKm: route.TotalDistKm})
+			resp = finishRoute(ctx, cfg, req, route)
+			break
+		}
+		release, err := acquireBackground(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		solveCtx, cancel := context.WithTimeout(ctx, solveTimeout(cfg, req.SolverParams))
+		defer cancel()
+		route, matrix := solveRoute(solveCtx, cfg, req, solve, name)
+		release()
+		recordSolve(ctx, route.Metadata, len(req.Waypoints))
+		auditSolve(ctx, path, req, len(req.Waypoints), route.Metadata, audit.Summary{TotalDistKm: route.TotalDistKm})
+		captureSlow(ctx, cfg, path, req, req.CaptureConsent, route.Metadata, audit.Summary{TotalDistKm: route.TotalDistKm})
+		cacheResult(cfg, key, route, route.Metadata)
+		shadowSolve(ctx, cfg, req, matrix, route)
+		resp = finishRoute(ctx, cfg, req, route)
+	case "/optimize-load":
+		req, errs, err := decodeLoad(ctx, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+		if len(errs) == 0 {
+			req, errs = checkLoad(ctx, req)
+		}
+		if len(errs) > 0 {
+			captureInvalid(ctx, cfg, path, req, req.CaptureConsent, errs)
+			return nil, errs
+		}
+		fields = req.Fields
+		key := loadCacheKey(ctx, cfg, req)
+		if load, ok := cached[models.LoadResponse](ctx, cfg, path, key, req.NoCache); ok {
+			load.Metadata.Cached = true
+			auditSolve(ctx, path, req, len(req.Shipments), load.Metadata, loadSummary(load))
+			resp = finishLoad(req, load)
+			break
+		}
+		release, err := acquireBackground(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		solveCtx, cancel := context.WithTimeout(ctx, solveTimeout(cfg, req.SolverParams))
+		defer cancel()
+		load := solveLoad(solveCtx, req)
+		release()
+		recordSolve(ctx, load.Metadata, len(req.Shipments))
+		auditSolve(ctx, path, req, len(req.Shipments), load.Metadata, loadSummary(load))
+		captureSlow(ctx, cfg, path, req, req.CaptureConsent, load.Metadata, loadSummary(load))
+		cacheResult(cfg, key, load, load.Metadata)
+		resp = finishLoad(req, load)
+	}
+
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	if tree := parseFields(fields); len(tree) > 0 {
+		raw = filterFields(raw, tree)
+	}
+	return raw, nil
+}
+
+// acquireBackground takes a tenant and a solver slot for a background solve. Unlike
+// acquireWorker it never rejects: it waits, polling, until there is room or ctx ends.
+func acquireBackground(ctx context.Context) (release func(), err error) {
+	t := tenant.From(ctx)
+	for {
+		if releaseTenant, ok := t.Acquire(); ok {
+			releaseWorker, err := solverPool.Acquire(ctx)
+			if err == nil {
+				return func() { releaseWorker(); releaseTenant() }, nil
+			}
+			releaseTenant()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backgroundRetryDelay):
+		}
+	}
+}
+
+// Reply is the message the transports send back for a request: the response in
+// Result, or an error with the failing fields for requests that didn't pass the checks
+type Reply struct {
+	RequestID string            `json:"request_id"`
+	Result    json.RawMessage   `json:"result,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Fields    validation.Errors `json:"fields,omitempty"`
+}
+
+// NewReply wraps Execute's outcome for the request with the given ID
+func NewReply(requestID string, result []byte, err error) Reply {
+	reply := Reply{RequestID: requestID, Result: result}
+	var fields validation.Errors
+	switch {
+	case err == nil:
+	case errors.As(err, &fields):
+		reply.Error, reply.Fields = "Invalid request", fields
+	default:
+		reply.Error = err.Error()
+	}
+	return reply
+}
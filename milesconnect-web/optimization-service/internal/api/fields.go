@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// fieldTree is a parsed field selection; a nil subtree keeps the whole value
+type fieldTree map[string]fieldTree
+
+// requestedFields returns the field selection from ?fields=a,b.c or, failing that, the request body
+func requestedFields(r *http.Request, bodyFields []string) []string {
+	if q := r.URL.Query().Get("fields"); q != "" {
+		return strings.Split(q, ",")
+	}
+	return bodyFields
+}
+
+func parseFields(fields []string) fieldTree {
+	tree := fieldTree{}
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		node := tree
+		parts := strings.Split(f, ".")
+		for i, p := range parts {
+			child, seen := node[p]
+			if i == len(parts)-1 {
+				// A shorter path always wins: "route" keeps all of route even with "route.id"
+				node[p] = nil
+				break
+			}
+			if seen && child == nil {
+				break
+			}
+			if child == nil {
+				child = fieldTree{}
+				node[p] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// writeFields writes v as JSON, keeping only the selected fields when a selection was made.
+// Dotted paths select into nested objects; arrays are filtered element by element.
+func writeFields(w http.ResponseWriter, status int, v any, fields []string) {
+	tree := parseFields(fields)
+	if len(tree) == 0 {
+		writeJSON(w, status, v)
+		return
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status, filterFields(raw, tree))
+}
+
+func filterFields(raw json.RawMessage, tree fieldTree) json.RawMessage {
+	if tree == nil {
+		return raw
+	}
+
+	switch strings.TrimSpace(string(raw))[0] {
+	case '{':
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return raw
+		}
+		out := make(map[string]json.RawMessage, len(tree))
+		for key, sub := range tree {
+			if val, ok := obj[key]; ok {
+				out[key] = filterFields(val, sub)
+			}
+		}
+		filtered, _ := json.Marshal(out)
+		return filtered
+	case '[':
+		var arr []json.RawMessage
+		if err := json.Unmarshal(raw, &arr); err != nil {
+			return raw
+		}
+		for i := range arr {
+			arr[i] = filterFields(arr[i], tree)
+		}
+		filtered, _ := json.Marshal(arr)
+		return filtered
+	default:
+		return raw
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"milesconnect-optimization/internal/generate"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxGenerated caps generated stops and shipments when MaxStops is unlimited
+const maxGenerated = 100000
+
+// GenerateHandler returns a random request body for the endpoint named by ?endpoint=,
+// shaped by ?stops=, ?clusters=, ?lat=, ?lng= and ?radius_km= for optimize and
+// ?vehicles= and ?shipments= for optimize-load. ?seed= makes it reproducible; without
+// one a seed is picked. Either way the X-Generate-Seed header reports it.
+func GenerateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	p := generate.DefaultParams()
+	p.Seed = time.Now().UnixNano()
+	limit := maxStops(r.Context())
+	if limit <= 0 || limit > maxGenerated {
+		limit = maxGenerated
+	}
+	var errs validation.Errors
+	if v := q.Get("seed"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, validation.FieldError{Field: "seed", Message: "must be an integer"})
+		}
+		p.Seed = n
+	}
+	for _, f := range []struct {
+		name     string
+		into     *int
+		min, max int
+	}{
+		{"stops", &p.Stops, 1, limit},
+		{"clusters", &p.Clusters, 0, 1000},
+		{"vehicles", &p.Vehicles, 1, 1000},
+		{"shipments", &p.Shipments, 1, limit},
+	} {
+		if v := q.Get(f.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < f.min || n > f.max {
+				errs = append(errs, validation.FieldError{Field: f.name, Message: "must be between " + strconv.Itoa(f.min) + " and " + strconv.Itoa(f.max)})
+			}
+			*f.into = n
+		}
+	}
+	for _, f := range []struct {
+		name     string
+		into     *float64
+		min, max float64
+	}{
+		{"lat", &p.Center.Lat, -90, 90},
+		{"lng", &p.Center.Lng, -180, 180},
+		{"radius_km", &p.RadiusKm, 0.1, 2000},
+	} {
+		if v := q.Get(f.name); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || !(n >= f.min && n <= f.max) {
+				errs = append(errs, validation.FieldError{Field: f.name, Message: "must be between " +
+					strconv.FormatFloat(f.min, 'g', -1, 64) + " and " + strconv.FormatFloat(f.max, 'g', -1, 64)})
+			}
+			*f.into = n
+		}
+	}
+
+	var gen func(generate.Params) any
+	switch q.Get("endpoint") {
+	case "", "optimize":
+		gen = func(p generate.Params) any { return generate.Route(p) }
+	case "optimize-load":
+		gen = func(p generate.Params) any { return generate.Load(p) }
+	default:
+		errs = append(errs, validation.FieldError{Field: "endpoint", Message: "must be optimize or optimize-load"})
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	w.Header().Set("X-Generate-Seed", strconv.FormatInt(p.Seed, 10))
+	writeJSON(w, http.StatusOK, gen(p))
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"milesconnect-optimization/internal/geocode"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// errGeocoding is returned by checkRoute when the geocoding provider failed, as opposed
+// to finding no match for an address
+var errGeocoding = errors.New("geocoding provider unavailable")
+
+// needsGeocoding reports whether loc is given by address only
+func needsGeocoding(loc models.Location) bool {
+	return loc.Address != "" && loc.Lat == 0 && loc.Lng == 0
+}
+
+// geocodeRoute fills in the coordinates of locations given by address only. Each
+// distinct address is looked up once. Addresses without a match, or whose match is
+// below the minimum confidence, are field errors; provider failures return
+// errGeocoding.
+func geocodeRoute(ctx context.Context, cfg Settings, req models.OptimizationRequest) (models.OptimizationRequest, validation.Errors, error) {
+	type stop struct {
+		field string
+		loc   *models.Location
+	}
+	if req.ReverseGeocode && cfg.Geocoder == nil {
+		return req, validation.Errors{{Field: "reverse_geocode", Message: "geocoding is not configured"}}, nil
+	}
+	var stops []stop
+	if needsGeocoding(req.Start) {
+		stops = append(stops, stop{"start", &req.Start})
+	}
+	if needsGeocoding(req.End) {
+		stops = append(stops, stop{"end", &req.End})
+	}
+	if slices.ContainsFunc(req.Waypoints, needsGeocoding) {
+		req.Waypoints = slices.Clone(req.Waypoints) // the caller's slice stays as it was
+		for i := range req.Waypoints {
+			if needsGeocoding(req.Waypoints[i]) {
+				stops = append(stops, stop{"waypoints[" + strconv.Itoa(i) + "]", &req.Waypoints[i]})
+			}
+		}
+	}
+	if len(stops) == 0 {
+		return req, nil, nil
+	}
+
+	var errs validation.Errors
+	if cfg.Geocoder == nil {
+		for _, s := range stops {
+			errs = append(errs, validation.FieldError{Field: s.field + ".address", Message: "geocoding is not configured; give lat and lng"})
+		}
+		return req, errs, nil
+	}
+
+	index := make(map[string]int)
+	var addresses []string
+	for _, s := range stops {
+		if _, ok := index[s.loc.Address]; !ok {
+			index[s.loc.Address] = len(addresses)
+			addresses = append(addresses, s.loc.Address)
+		}
+	}
+	matches, failures := cfg.Geocoder.Resolve(ctx, addresses)
+	for _, err := range failures {
+		if err != nil && !errors.Is(err, geocode.ErrNotFound) {
+			slog.WarnContext(ctx, "geocoding failed", "provider", cfg.Geocoder.Provider.Name(), "error", err)
+			return req, nil, errGeocoding
+		}
+	}
+	for _, s := range stops {
+		i := index[s.loc.Address]
+		m := matches[i]
+		switch {
+		case failures[i] != nil:
+			errs = append(errs, validation.FieldError{Field: s.field + ".address", Message: "no match found"})
+		case m.Confidence < cfg.GeocodeMinConfidence:
+			errs = append(errs, validation.FieldError{Field: s.field + ".address",
+				Message: "best match " + strconv.Quote(m.Formatted) + " has confidence " + strconv.FormatFloat(m.Confidence, 'f', 2, 64) +
+					", below " + strconv.FormatFloat(cfg.GeocodeMinConfidence, 'f', 2, 64)})
+		default:
+			s.loc.Lat, s.loc.Lng = m.Lat, m.Lng
+			s.loc.Geocode = &models.GeocodeMatch{Provider: cfg.Geocoder.Provider.Name(), Confidence: m.Confidence, FormattedAddress: m.Formatted}
+		}
+	}
+	return req, errs, nil
+}
+
+// addAddresses fills in the address of route locations given by coordinates only, for
+// requests asking for reverse geocoding. It is best effort: locations whose lookup
+// fails, or isn't done within the solver timeout, are left without one.
+func addAddresses(ctx context.Context, cfg Settings, req models.OptimizationRequest, resp models.OptimizationResponse) models.OptimizationResponse {
+	if !req.ReverseGeocode || cfg.Geocoder == nil {
+		return resp
+	}
+	index := make(map[[2]float64]int)
+	var points []models.Location
+	for _, loc := range resp.Route {
+		p := [2]float64{loc.Lat, loc.Lng}
+		if _, ok := index[p]; loc.Address == "" && !ok {
+			index[p] = len(points)
+			points = append(points, loc)
+		}
+	}
+	if len(points) == 0 {
+		return resp
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.SolverTimeout)
+	defer cancel()
+	matches, failures := cfg.Geocoder.ResolveReverse(ctx, points)
+	resp.Route = slices.Clone(resp.Route) // cached responses are shared
+	for i, loc := range resp.Route {
+		j, ok := index[[2]float64{loc.Lat, loc.Lng}]
+		if !ok || loc.Address != "" {
+			continue
+		}
+		if failures[j] != nil {
+			continue
+		}
+		m := matches[j]
+		resp.Route[i].Address = m.Formatted
+		resp.Route[i].Geocode = &models.GeocodeMatch{Provider: cfg.Geocoder.Provider.Name(), Confidence: m.Confidence, FormattedAddress: m.Formatted, Reverse: true}
+	}
+	// Points with no address nearby are expected; anything else is worth a look
+	if i := slices.IndexFunc(failures, func(err error) bool { return err != nil && !errors.Is(err, geocode.ErrNotFound) }); i >= 0 {
+		slog.WarnContext(ctx, "reverse geocoding incomplete", "provider", cfg.Geocoder.Provider.Name(), "error", failures[i])
+	}
+	return resp
+}
+
+// writeGeocodingError answers a request whose addresses could not be looked up
+func writeGeocodingError(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "5")
+	writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Geocoding provider unavailable, retry later"})
+}
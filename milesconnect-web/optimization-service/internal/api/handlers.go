@@ -1,30 +1,108 @@
 package api
 
 import (
-	"encoding/json"
+	"cmp"
+	"context"
+	"maps"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/buildinfo"
+	"milesconnect-optimization/internal/catalog"
 	"milesconnect-optimization/internal/data"
+	"milesconnect-optimization/internal/explain"
+	"milesconnect-optimization/internal/geo"
 	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/objective"
+	"milesconnect-optimization/internal/pipeline"
+	"milesconnect-optimization/internal/priority"
 	"milesconnect-optimization/internal/solver"
 	"milesconnect-optimization/internal/solver/genetic"
+	"milesconnect-optimization/internal/solvers"
+	"milesconnect-optimization/internal/validation"
 	"net/http"
+	"time"
 )
 
 func OptimizeRouteHandler(w http.ResponseWriter, r *http.Request) {
+	if req, resp, ok := routeResponse(w, r); ok {
+		writeResult(w, r, resp, req.Fields)
+	}
+}
+
+// routeResponse solves the /optimize request in r's body, or returns it from the cache,
+// and finishes it for writing. Solves are recorded as /optimize ones whichever endpoint
+// asked. ok is false when the response is already written: an error, or nothing for a
+// client that has gone.
+func routeResponse(w http.ResponseWriter, r *http.Request) (req models.OptimizationRequest, resp models.OptimizationResponse, ok bool) {
+	if req, ok = checkedRoute(w, r, nil); !ok {
+		return req, resp, false
+	}
+	resp, ok = solveChecked(w, r, settings(), req)
+	return req, resp, ok
+}
+
+// checkedRoute decodes the /optimize request in r's body and runs checkRoute and then
+// check, when set, on it. ok is false when the request failed and the error is written.
+func checkedRoute(w http.ResponseWriter, r *http.Request, check func(models.OptimizationRequest) validation.Errors) (req models.OptimizationRequest, ok bool) {
+	const path = "/optimize"
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		return req, false
 	}
 
-	var req models.OptimizationRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+	limitBody(w, r, settings())
+	req, errs, err := decodeRoute(r.Context(), r.Body)
+	if err != nil {
+		writeDecodeError(w, err)
+		return req, false
 	}
+	if len(errs) == 0 {
+		if req, errs, err = checkRoute(r.Context(), req); err != nil {
+			writeGeocodingError(w)
+			return req, false
+		}
+	}
+	if len(errs) == 0 && check != nil {
+		errs = check(req)
+	}
+	if len(errs) > 0 {
+		captureInvalid(r.Context(), settings(), path, req, req.CaptureConsent, errs)
+		writeValidationErrors(w, errs)
+		return req, false
+	}
+	return req, true
+}
 
-	resp := solver.SolveTSPNearestNeighbor(req)
+// solveChecked is routeResponse for req, a request that has passed checkRoute, solved
+// under cfg
+func solveChecked(w http.ResponseWriter, r *http.Request, cfg Settings, req models.OptimizationRequest) (resp models.OptimizationResponse, ok bool) {
+	const path = "/optimize"
+	solve, name := routeSolver(r.Context(), cfg, req)
+	key := routeCacheKey(r.Context(), cfg, req, name)
+	if resp, ok := cached[models.OptimizationResponse](r.Context(), cfg, path, key, req.NoCache || noCache(r)); ok {
+		resp.Metadata.Cached = true
+		auditSolve(r.Context(), path, req, len(req.Waypoints), resp.Metadata, audit.Summary{TotalDistKm: resp.TotalDistKm})
+		return finishRoute(r.Context(), cfg, req, resp), true
+	}
+
+	release, ok := acquireWorker(w, r)
+	if !ok {
+		return resp, false
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(r.Context(), solveTimeout(cfg, req.SolverParams))
+	defer cancel()
+	resp, matrix := solveRoute(ctx, cfg, req, solve, name)
+	release() // the worker is free as soon as the solve is done
+	recordSolve(r.Context(), resp.Metadata, len(req.Waypoints))
+	auditSolve(r.Context(), path, req, len(req.Waypoints), resp.Metadata, audit.Summary{TotalDistKm: resp.TotalDistKm})
+	captureSlow(r.Context(), cfg, path, req, req.CaptureConsent, resp.Metadata, audit.Summary{TotalDistKm: resp.TotalDistKm})
+	cacheResult(cfg, key, resp, resp.Metadata)
+	if clientGone(r) {
+		return resp, false
+	}
+	shadowSolve(r.Context(), cfg, req, matrix, resp)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	return finishRoute(r.Context(), cfg, req, resp), true
 }
 
 func OptimizeLoadHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,24 +111,50 @@ func OptimizeLoadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req models.LoadRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	limitBody(w, r, settings())
+	req, errs, err := decodeLoad(r.Context(), r.Body)
+	if err != nil {
+		writeDecodeError(w, err)
 		return
 	}
 
-	// Validation: Ensure valid weights
-	for _, s := range req.Shipments {
-		if s.WeightKg <= 0 {
-			http.Error(w, "Shipment weight must be positive", http.StatusBadRequest)
-			return
-		}
+	// Validation: Ensure valid weights and capacities
+	if len(errs) == 0 {
+		req, errs = checkLoad(r.Context(), req)
+	}
+	cfg := settings()
+	if len(errs) > 0 {
+		captureInvalid(r.Context(), cfg, r.URL.Path, req, req.CaptureConsent, errs)
+		writeValidationErrors(w, errs)
+		return
 	}
 
-	resp := solver.OptimizeFleetAllocation(req)
+	key := loadCacheKey(r.Context(), cfg, req)
+	if resp, ok := cached[models.LoadResponse](r.Context(), cfg, r.URL.Path, key, req.NoCache || noCache(r)); ok {
+		resp.Metadata.Cached = true
+		auditSolve(r.Context(), r.URL.Path, req, len(req.Shipments), resp.Metadata, loadSummary(resp))
+		writeResult(w, r, finishLoad(req, resp), req.Fields)
+		return
+	}
+
+	release, ok := acquireWorker(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(r.Context(), solveTimeout(cfg, req.SolverParams))
+	defer cancel()
+	resp := solveLoad(ctx, req)
+	release()
+	recordSolve(r.Context(), resp.Metadata, len(req.Shipments))
+	auditSolve(r.Context(), r.URL.Path, req, len(req.Shipments), resp.Metadata, loadSummary(resp))
+	captureSlow(r.Context(), cfg, r.URL.Path, req, req.CaptureConsent, resp.Metadata, loadSummary(resp))
+	cacheResult(cfg, key, resp, resp.Metadata)
+	if clientGone(r) {
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	writeResult(w, r, finishLoad(req, resp), req.Fields)
 }
 
 func OptimizeAllIndiaHandler(w http.ResponseWriter, r *http.Request) {
@@ -72,13 +176,343 @@ func OptimizeAllIndiaHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2. Solve using Genetic Algorithm
-	resp := genetic.SolveTSPGenetic(req)
+	release, ok := acquireWorker(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	cfg := settings()
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.SolverTimeout)
+	defer cancel()
+	done := trackSolve(genetic.Name)
+	resp := genetic.SolveTSPGenetic(ctx, req, cfg.Genetic)
+	done()
+	release()
+	recordSolve(r.Context(), resp.Metadata, len(req.Waypoints))
+	auditSolve(r.Context(), r.URL.Path, req, len(req.Waypoints), resp.Metadata, audit.Summary{TotalDistKm: resp.TotalDistKm})
+	if clientGone(r) {
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	writeResult(w, r, resp, nil)
+}
+
+// checkRoute applies the /optimize request checks, returning req resumed from the
+// tracked route its route_id names, if any, with addresses geocoded, duplicate
+// waypoints handled as requested and its profile's and the server's defaults filled
+// in. err is errGeocoding when the geocoding provider failed.
+func checkRoute(ctx context.Context, req models.OptimizationRequest) (models.OptimizationRequest, validation.Errors, error) {
+	if req.RouteID != "" {
+		var errs validation.Errors
+		if req, errs = resumeRoute(ctx, settings(), req); len(errs) > 0 {
+			return req, errs, nil
+		}
+	}
+	req, errs := prepareRoute(ctx, settings(), req)
+	if len(errs) > 0 {
+		return req, errs, nil
+	}
+	req, errs, err := geocodeRoute(ctx, settings(), req)
+	if err != nil || len(errs) > 0 {
+		return req, errs, err
+	}
+	if errs := validation.OptimizationRequest(req); len(errs) > 0 {
+		return req, errs, nil
+	}
+	if req, errs = serverRouteChecks(settings(), req); len(errs) > 0 {
+		return req, errs, nil
+	}
+	req, errs = validation.ApplyDuplicates(req)
+	if req.EmissionsKgPerKm == 0 {
+		req.EmissionsKgPerKm = settings().EmissionsKgPerKm
+	}
+	if req.SpeedKmh == 0 && len(req.SpeedClasses) == 0 {
+		req.SpeedClasses = settings().SpeedClasses
+	}
+	if req.StabilityThresholdPct == 0 {
+		req.StabilityThresholdPct = settings().StabilityThresholdPct
+	}
+	if req.TravelTimeCV == 0 {
+		req.TravelTimeCV = settings().TravelTimeCV
+	}
+	return req, errs, nil
+}
+
+// prepareRoute checks req against the tenant's stop limit and fills in its profile's
+// defaults and the server's holiday calendars, the checks of /optimize before the
+// request's own
+func prepareRoute(ctx context.Context, cfg Settings, req models.OptimizationRequest) (models.OptimizationRequest, validation.Errors) {
+	if errs := validation.MaxItems("waypoints", len(req.Waypoints), maxStops(ctx)); len(errs) > 0 {
+		return req, errs
+	}
+	req, errs := applyProfile(ctx, cfg, req)
+	if len(errs) > 0 {
+		return req, errs
+	}
+	if req.RoadLegs && cfg.Routing == nil {
+		return req, validation.Errors{{Field: "road_legs", Message: "road routing is not configured"}}
+	}
+	req.HolidayCalendars = holidayCalendars(cfg, req.HolidayCalendars)
+	return req, nil
+}
+
+// serverRouteChecks are the checks of /optimize after the request's own: tier
+// penalties in the server's currency and solver parameters within its limits
+func serverRouteChecks(cfg Settings, req models.OptimizationRequest) (models.OptimizationRequest, validation.Errors) {
+	var errs validation.Errors
+	if req.Currency, req.TierPenalties, errs = tierPenalties(cfg, req.Currency, req.TierPenalties); len(errs) > 0 {
+		return req, errs
+	}
+	req.SolverParams, errs = solverParams(cfg, req.SolverParams)
+	return req, errs
+}
+
+// checkLoad applies the /optimize-load request checks, returning req with its
+// profile's defaults and the server's tier penalties filled in
+func checkLoad(ctx context.Context, req models.LoadRequest) (models.LoadRequest, validation.Errors) {
+	req, errs := prepareLoad(ctx, settings(), req)
+	if len(errs) > 0 {
+		return req, errs
+	}
+	if errs := validation.LoadRequest(req); len(errs) > 0 {
+		return req, errs
+	}
+	return serverLoadChecks(settings(), req)
+}
+
+// prepareLoad is prepareRoute for allocations
+func prepareLoad(ctx context.Context, cfg Settings, req models.LoadRequest) (models.LoadRequest, validation.Errors) {
+	if errs := validation.MaxItems("shipments", len(req.Shipments), maxStops(ctx)); len(errs) > 0 {
+		return req, errs
+	}
+	return applyLoadProfile(ctx, cfg, req)
+}
+
+// serverLoadChecks is serverRouteChecks for allocations
+func serverLoadChecks(cfg Settings, req models.LoadRequest) (models.LoadRequest, validation.Errors) {
+	var errs validation.Errors
+	if req.Currency, req.TierPenalties, errs = tierPenalties(cfg, req.Currency, req.TierPenalties); len(errs) > 0 {
+		return req, errs
+	}
+	return req, validation.SolverParams(req.SolverParams, cfg.SolverLimits)
+}
+
+// solverParams checks a route request's solver parameters against the server's limits
+// and returns them with the limits in place of the iteration and neighborhood caps
+// they leave unset; nil when nothing is set or capped
+func solverParams(cfg Settings, p *models.SolverParams) (*models.SolverParams, validation.Errors) {
+	if errs := validation.SolverParams(p, cfg.SolverLimits); len(errs) > 0 {
+		return p, errs
+	}
+	limits := cfg.SolverLimits
+	if p == nil && limits.MaxIterations == 0 && limits.Neighborhood == 0 {
+		return nil, nil
+	}
+	var filled models.SolverParams
+	if p != nil {
+		filled = *p
+	}
+	filled.MaxIterations = cmp.Or(filled.MaxIterations, limits.MaxIterations)
+	filled.Neighborhood = cmp.Or(filled.Neighborhood, limits.Neighborhood)
+	return &filled, nil
+}
+
+// solveTimeout is how long a solve with solver parameters p may take: their time
+// budget, or else the server's solver timeout
+func solveTimeout(cfg Settings, p *models.SolverParams) time.Duration {
+	if p != nil && p.TimeBudgetMs > 0 {
+		return time.Duration(p.TimeBudgetMs) * time.Millisecond
+	}
+	return cfg.SolverTimeout
+}
+
+// holidayCalendars returns a request's holiday calendars, own, with the server's for the
+// names it doesn't define
+func holidayCalendars(cfg Settings, own map[string][]string) map[string][]string {
+	if len(cfg.HolidayCalendars) == 0 {
+		return own
+	}
+	merged := maps.Clone(cfg.HolidayCalendars)
+	maps.Copy(merged, own)
+	return merged
+}
+
+// tierPenalties returns the currency of a request naming currency, the server's when it
+// names none, with the request's tier penalties: overrides, and the server's for the
+// other tiers converted to the currency at the server's exchange rate. Servers without
+// a currency have unitless penalties, taken to be in any currency.
+func tierPenalties(cfg Settings, currency string, overrides map[string]models.TierPenalty) (string, map[string]models.TierPenalty, validation.Errors) {
+	if currency == "" {
+		currency = cfg.Currency
+	}
+	rate := 1.0
+	if cfg.Currency != "" && currency != cfg.Currency {
+		var ok bool
+		if rate, ok = cfg.ExchangeRates[currency]; !ok {
+			return currency, overrides, validation.Errors{{Field: "currency", Message: "no exchange rate from " + cfg.Currency + " to " + currency + " is configured"}}
+		}
+	}
+	return currency, priority.Merge(priority.Convert(cfg.TierPenalties, rate), overrides), nil
+}
+
+// routeSolver picks the /optimize solver: the one the request names, or else by the
+// features on for this request's tenant and request ID. Very large 2-opt requests on
+// great-circle distances are solved cluster by cluster; nearest-neighbor construction
+// alone scales to them as it is.
+func routeSolver(ctx context.Context, cfg Settings, req models.OptimizationRequest) (routeSolveFunc, string) {
+	if req.Solver != "" {
+		if solve, ok := solvers.Route(req.Solver, solverOptions(cfg)); ok {
+			return routeSolveFunc(solve), req.Solver
+		}
+	}
+	if !featureOn(ctx, cfg, featureTwoOpt) {
+		return solver.SolveTSPNearestNeighbor, solver.NearestNeighborName
+	}
+	if h := cfg.Hierarchical; h.Applies(len(req.Waypoints)) && (cfg.Routing == nil || req.RoadLegs) {
+		return func(ctx context.Context, req models.OptimizationRequest, _ geo.Matrix) models.OptimizationResponse {
+			return solver.SolveTSPHierarchical(ctx, req, solver.SolveTSPTwoOpt, h.ClusterSize)
+		}, solver.HierarchicalName
+	}
+	return solver.SolveTSPTwoOpt, solver.TwoOptName
+}
+
+// solveRoute runs solve, keeps the previous route when the solved one doesn't save
+// enough over it, then moves stops to cut time window penalties, leaves out the
+// ones beyond the vehicle's range and adds the reloads a capacity calls for,
+// returning the distance matrix it used so a shadow run can share it. Solvers that
+// only route on great circles get no matrix.
+func solveRoute(ctx context.Context, cfg Settings, req models.OptimizationRequest, solve routeSolveFunc, name string) (models.OptimizationResponse, geo.Matrix) {
+	done := trackSolve(name)
+	defer done()
+	var matrix geo.Matrix
+	var source *models.DistanceSource
+	if solvers.AcceptsMatrix(name) {
+		matrix, source = distances(ctx, cfg, req)
+	}
+	resp := pipeline.Solve(ctx, req, solvers.Func(solve), matrix)
+	resp.Metadata.Distances = source
+	return resp, matrix
+}
+
+// finishRoute adds what a solved route is annotated with on the way out: addresses, road
+// legs, the schedule, penalties, the cost breakdown and the explanation. It runs on cached
+// responses too, which are stored without them.
+func finishRoute(ctx context.Context, cfg Settings, req models.OptimizationRequest, resp models.OptimizationResponse) models.OptimizationResponse {
+	resp = pipeline.Annotate(req, addSchedule(ctx, cfg, req, addRoadLegs(ctx, cfg, req, addAddresses(ctx, cfg, req, resp))))
+	if req.Explain {
+		resp.Explanation = explain.Route(req, resp)
+	}
+	return resp
+}
+
+func solveLoad(ctx context.Context, req models.LoadRequest) models.LoadResponse {
+	done := trackSolve(solver.FleetAllocationName)
+	defer done()
+	return solver.OptimizeFleetAllocation(ctx, req)
+}
+
+// finishLoad is finishRoute for allocations
+func finishLoad(req models.LoadRequest, resp models.LoadResponse) models.LoadResponse {
+	resp.Penalties, resp.PenaltyCost = priority.LoadPenalties(req, resp)
+	resp.UnassignedShipments = solver.UnassignedShipments(req, resp)
+	resp.Cost = objective.Load(req, resp)
+	resp.Currency = req.Currency
+	if req.Explain {
+		resp.Explanation = explain.Load(req, resp)
+	}
+	return resp
+}
+
+func loadSummary(resp models.LoadResponse) audit.Summary {
+	return audit.Summary{VehiclesUsed: int(resp.Metadata.ObjectiveValue), Unassigned: len(resp.Unassigned)}
+}
+
+// HealthResponse describes the running build and the solver versions it serves
+type HealthResponse struct {
+	Status string `json:"status"`
+	buildinfo.Info
+	Solvers map[string]string `json:"solvers"` // solver name -> version, as reported in response metadata
 }
 
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	solvers := map[string]string{}
+	for _, d := range catalog.All() {
+		solvers[d.Name] = d.Version
+	}
+	writeJSON(w, http.StatusOK, HealthResponse{Status: "ok", Info: buildinfo.Get(), Solvers: solvers})
+}
+
+// SolversHandler lists the registered solvers with their capabilities, parameters and the
+// size limits that apply to the calling tenant
+func SolversHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := maxStops(r.Context())
+	solvers := catalog.All()
+	for i, d := range solvers {
+		// /optimize-india solves a fixed dataset, so only the request-driven endpoints are capped
+		if d.Endpoint == "/optimize" || d.Endpoint == "/optimize-load" || d.Endpoint == "/optimize-crossdock" || d.Endpoint == "/plan-days" {
+			solvers[i].Limits.MaxStops = limit
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"solvers": solvers})
+}
+
+// ValidateHandler dry-runs the checks of the endpoint named by ?endpoint= without solving:
+// the same limits, profiles and solver parameter caps, but no geocoding
+func ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := settings()
+	limitBody(w, r, cfg)
+	var report validation.Report
+	switch r.URL.Query().Get("endpoint") {
+	case "", "optimize":
+		req, errs, err := decodeRoute(r.Context(), r.Body)
+		if err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		if len(errs) == 0 {
+			req, errs = prepareRoute(r.Context(), cfg, req)
+		}
+		if len(errs) > 0 {
+			report = validation.Report{Errors: errs}
+			break
+		}
+		report = validation.CheckOptimizationRequest(req)
+		if report.Valid {
+			_, errs = serverRouteChecks(cfg, req)
+			report.Errors, report.Valid = errs, len(errs) == 0
+		}
+	case "optimize-load":
+		req, errs, err := decodeLoad(r.Context(), r.Body)
+		if err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		if len(errs) == 0 {
+			req, errs = prepareLoad(r.Context(), cfg, req)
+		}
+		if len(errs) > 0 {
+			report = validation.Report{Errors: errs}
+			break
+		}
+		report = validation.CheckLoadRequest(req)
+		if report.Valid {
+			_, errs = serverLoadChecks(cfg, req)
+			report.Errors, report.Valid = errs, len(errs) == 0
+		}
+	default:
+		http.Error(w, "Unknown endpoint", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
 }
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"milesconnect-optimization/internal/jobs"
+	"milesconnect-optimization/internal/middleware"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Page sizes for job listings
+const (
+	defaultJobsLimit = 50
+	maxJobsLimit     = 500
+)
+
+// JobsHandler handles /jobs: POST submits a job, GET lists the caller's tenant's jobs
+func JobsHandler(w http.ResponseWriter, r *http.Request) {
+	runner := settings().Jobs
+	switch {
+	case r.Method != http.MethodPost && r.Method != http.MethodGet:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case runner == nil:
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Async jobs are not enabled"})
+	case r.Method == http.MethodGet:
+		listJobs(w, r, runner, tenantName(r.Context()))
+	default:
+		submitJob(w, r, runner)
+	}
+}
+
+// AdminJobsHandler handles GET /admin/jobs, the job listing across tenants; ?tenant=
+// narrows it to one
+func AdminJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	runner := settings().Jobs
+	if runner == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Async jobs are not enabled"})
+		return
+	}
+	listJobs(w, r, runner, r.URL.Query().Get("tenant"))
+}
+
+// listJobs writes a page of tenant's jobs (all tenants when empty), newest first,
+// filtered by ?status=, ?endpoint= and the ?from= and ?to= creation times. Results are
+// left out; GET /jobs/{id} returns them. next_cursor, when set, is passed as ?cursor=
+// for the following page.
+func listJobs(w http.ResponseWriter, r *http.Request, runner *jobs.Runner, tenant string) {
+	q := r.URL.Query()
+	f := jobs.Filter{Tenant: tenant, Status: jobs.Status(q.Get("status")), Limit: defaultJobsLimit}
+	var errs validation.Errors
+	switch f.Status {
+	case "", jobs.Queued, jobs.Running, jobs.Succeeded, jobs.Failed, jobs.Cancelled:
+	default:
+		errs = append(errs, validation.FieldError{Field: "status", Message: "must be one of queued, running, succeeded, failed, cancelled"})
+	}
+	if ep := q.Get("endpoint"); ep != "" {
+		path, ok := endpointPath(ep)
+		if !ok {
+			errs = append(errs, validation.FieldError{Field: "endpoint", Message: "must be optimize or optimize-load"})
+		}
+		f.Endpoint = path
+	}
+	for _, p := range []struct {
+		name string
+		into *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := parseTime(v)
+			if err != nil {
+				errs = append(errs, validation.FieldError{Field: p.name, Message: "must be an RFC 3339 time or a YYYY-MM-DD date"})
+			}
+			*p.into = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxJobsLimit {
+			errs = append(errs, validation.FieldError{Field: "limit", Message: "must be between 1 and " + strconv.Itoa(maxJobsLimit)})
+		}
+		f.Limit = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		c, err := jobs.ParseCursor(v)
+		if err != nil {
+			errs = append(errs, validation.FieldError{Field: "cursor", Message: "is not a cursor from a previous page"})
+		}
+		f.Before = &c
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	limit := f.Limit
+	f.Limit++ // one extra tells whether there is another page
+	list, err := runner.Store().List(r.Context(), f)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing jobs", "error", err)
+		writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Job store unavailable"})
+		return
+	}
+	page := struct {
+		Jobs       []jobs.Job `json:"jobs"`
+		NextCursor string     `json:"next_cursor,omitempty"`
+	}{Jobs: list}
+	if len(list) > limit {
+		page.Jobs = list[:limit]
+		page.NextCursor = jobs.CursorOf(list[limit-1]).Encode()
+	}
+	if page.Jobs == nil {
+		page.Jobs = []jobs.Job{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseTime accepts an RFC 3339 time or a UTC date
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// submitJob handles POST /jobs?endpoint=optimize|optimize-load. The body is checked as
+// the synchronous endpoint would check it, then stored and solved in the background;
+// the 202 response points at GET /jobs/{id}.
+func submitJob(w http.ResponseWriter, r *http.Request, runner *jobs.Runner) {
+
+	ctx := r.Context()
+	endpoint, ok := endpointPath(r.URL.Query().Get("endpoint"))
+	if !ok {
+		http.Error(w, "Unknown endpoint", http.StatusBadRequest)
+		return
+	}
+	limitBody(w, r, settings())
+	var stored any
+	switch endpoint {
+	case "/optimize":
+		req, errs, err := decodeRoute(ctx, r.Body)
+		if err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		if len(errs) == 0 {
+			if req, errs, err = checkRoute(ctx, req); err != nil {
+				writeGeocodingError(w)
+				return
+			}
+		}
+		if len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		stored = req
+	case "/optimize-load":
+		req, errs, err := decodeLoad(ctx, r.Body)
+		if err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		if len(errs) == 0 {
+			req, errs = checkLoad(ctx, req)
+		}
+		if len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		stored = req
+	}
+
+	body, err := json.Marshal(stored)
+	if err != nil {
+		http.Error(w, "Failed to encode request", http.StatusInternalServerError)
+		return
+	}
+	job := jobs.Job{
+		ID:        jobs.NewID(),
+		Tenant:    tenantName(ctx),
+		Client:    middleware.ClientFrom(ctx),
+		Endpoint:  endpoint,
+		Request:   body,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := runner.Submit(ctx, job); err != nil {
+		if errors.Is(err, jobs.ErrQueueFull) {
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Job queue full, retry later"})
+			return
+		}
+		slog.ErrorContext(ctx, "submitting job", "error", err)
+		writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Job store or queue unavailable"})
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": job.ID, "status": string(jobs.Queued)})
+}
+
+// GetJobHandler handles GET /jobs/{id}, with the stored request when ?include=request.
+// Jobs are only visible to the tenant that submitted them; any other tenant gets the
+// same 404 as for an unknown ID.
+func GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	runner := settings().Jobs
+	if runner == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Async jobs are not enabled"})
+		return
+	}
+
+	job, err := runner.Store().Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) || (err == nil && job.Tenant != tenantName(r.Context())) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Job not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "loading job", "error", err)
+		writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Job store unavailable"})
+		return
+	}
+	if r.URL.Query().Get("include") != "request" {
+		job.Request = nil // the caller usually has it already
+	}
+	if job.ResultKey != "" {
+		if job.ResultURL, err = runner.ResultURL(r.Context(), job); err != nil {
+			slog.ErrorContext(r.Context(), "presigning job result", "job_id", job.ID, "error", err)
+			writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Result storage unavailable"})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// CancelJobHandler handles DELETE /jobs/{id}, cancelling a queued or running job of the
+// caller's tenant
+func CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	cancelJob(w, r, tenantName(r.Context()))
+}
+
+// AdminCancelJobHandler handles DELETE /admin/jobs/{id}, cancelling any tenant's job
+func AdminCancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	cancelJob(w, r, "")
+}
+
+// cancelJob cancels job {id} of tenant (any when empty) and writes it, now cancelled;
+// 409 when it has already finished. The routes only match DELETE.
+func cancelJob(w http.ResponseWriter, r *http.Request, tenant string) {
+	runner := settings().Jobs
+	if runner == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Async jobs are not enabled"})
+		return
+	}
+
+	ctx := r.Context()
+	job, err := runner.Store().Get(ctx, r.PathValue("id"))
+	if err == nil && tenant != "" && job.Tenant != tenant {
+		err = jobs.ErrNotFound
+	}
+	if err == nil {
+		job, err = runner.Cancel(ctx, job.ID)
+	}
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Job not found"})
+	case errors.Is(err, jobs.ErrFinished):
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Job already finished"})
+	case err != nil:
+		slog.ErrorContext(ctx, "cancelling job", "error", err)
+		writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Job store unavailable"})
+	default:
+		slog.InfoContext(ctx, "job cancelled on request", "job_id", job.ID, "tenant", job.Tenant)
+		job.Request, job.Checkpoint = nil, nil
+		writeJSON(w, http.StatusOK, job)
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/scenario"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+	"strings"
+)
+
+// LoadDiffHandler compares two /optimize-load results the way /scenario compares its
+// allocations: the shipments that moved vehicles or in or out of the unassigned, each
+// vehicle's change in load and utilization, and the change in vehicles and cost.
+// Nothing is solved, so the answer comes back at once and can gate automated checks on
+// its identical flag.
+func LoadDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limitBody(w, r, settings())
+	req, errs, err := decodeLoadDiff(r.Context(), r.Body)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if len(errs) == 0 {
+		errs = validation.LoadDiffRequest(req)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	writeJSON(w, http.StatusOK, scenario.Diff(req.Baseline, req.Scenario))
+}
+
+// decodeLoadDiff decodes a /diff-load body, streaming each side's allocations as
+// decodeLoad streams shipments. Every allocation holds at least one shipment, so
+// neither side may have more allocations, or unassigned shipments, than the caller's
+// stop limit.
+func decodeLoadDiff(ctx context.Context, r io.Reader) (models.LoadDiffRequest, validation.Errors, error) {
+	var req models.LoadDiffRequest
+	limit := maxStops(ctx)
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return req, nil, err
+	}
+	var errs validation.Errors
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return req, nil, err
+		}
+		name, _ := tok.(string)
+		var side *models.LoadResponse
+		var field string
+		switch {
+		case strings.EqualFold(name, "baseline"):
+			side, field = &req.Baseline, "baseline"
+		case strings.EqualFold(name, "scenario"):
+			side, field = &req.Scenario, "scenario"
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return req, nil, err
+			}
+			continue
+		}
+		allocations, n, found, err := decodeCappedFrom(dec, side, "allocations", limit, func(f string, a models.Allocation) validation.Errors {
+			return validation.MaxItems(field+"."+f+".shipment_ids", len(a.ShipmentIDs), limit)
+		})
+		if err != nil {
+			return req, nil, fmt.Errorf("%s: %w", field, err)
+		}
+		if allocations != nil {
+			side.Allocations = allocations
+		}
+		errs = append(errs, validation.MaxItems(field+".allocations", n, limit)...)
+		errs = append(errs, found...)
+		errs = append(errs, validation.MaxItems(field+".unassigned_shipment_ids", len(side.Unassigned), limit)...)
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return req, nil, err
+	}
+	return req, errs, nil
+}
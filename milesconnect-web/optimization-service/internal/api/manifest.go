@@ -0,0 +1,42 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"milesconnect-optimization/internal/manifest"
+	"net/http"
+)
+
+// ManifestHandler handles POST /manifest?format=html|pdf: it solves the /optimize
+// request in the body as /optimize does and returns the route as a printable driver
+// manifest, HTML laid out for printing by default
+func ManifestHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "html" && format != "pdf" {
+		http.Error(w, "Unknown format; must be html or pdf", http.StatusBadRequest)
+		return
+	}
+	req, resp, ok := routeResponse(w, r)
+	if !ok {
+		return
+	}
+
+	m := manifest.Build(req, resp)
+	var body bytes.Buffer
+	var err error
+	if format == "pdf" {
+		err = m.PDF(&body)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `inline; filename="manifest.pdf"`)
+	} else {
+		err = m.HTML(&body)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rendering manifest", "format", format, "error", err)
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Failed to render manifest", http.StatusInternalServerError)
+		return
+	}
+	w.Write(body.Bytes())
+}
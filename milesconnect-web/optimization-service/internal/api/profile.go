@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/validation"
+)
+
+// profileFor is the profile of a request naming name: that one, else its tenant's,
+// else the server's default. ok is false when none applies; errs when no profile is
+// called name.
+func profileFor(ctx context.Context, cfg Settings, name string) (p Profile, ok bool, errs validation.Errors) {
+	if name != "" {
+		if p, ok = cfg.Profiles[name]; !ok {
+			return p, false, validation.Errors{{Field: "profile", Message: "no such profile"}}
+		}
+		return p, true, nil
+	}
+	name, ok = cfg.TenantProfiles[tenantName(ctx)]
+	if !ok {
+		name = cfg.DefaultProfile
+	}
+	p, ok = cfg.Profiles[name]
+	return p, ok, nil
+}
+
+// applyProfile fills in the options req leaves unset from its profile. A speed given
+// either way, a single one or classes, keeps the profile's speeds out.
+func applyProfile(ctx context.Context, cfg Settings, req models.OptimizationRequest) (models.OptimizationRequest, validation.Errors) {
+	p, ok, errs := profileFor(ctx, cfg, req.Profile)
+	if !ok {
+		return req, errs
+	}
+	if req.Solver == "" {
+		req.Solver = p.Solver
+	}
+	if req.Currency == "" {
+		req.Currency = p.Currency
+	}
+	if req.Timezone == "" {
+		req.Timezone = p.Timezone
+	}
+	if req.SpeedKmh == 0 && len(req.SpeedClasses) == 0 {
+		req.SpeedKmh, req.SpeedClasses = p.SpeedKmh, p.SpeedClasses
+	}
+	if req.Objective == nil {
+		req.Objective = p.Objective
+	}
+	if req.EmissionsKgPerKm == 0 {
+		req.EmissionsKgPerKm = p.EmissionsKgPerKm
+	}
+	return req, nil
+}
+
+// applyLoadProfile fills in the currency and objective req leaves unset from its profile
+func applyLoadProfile(ctx context.Context, cfg Settings, req models.LoadRequest) (models.LoadRequest, validation.Errors) {
+	p, ok, errs := profileFor(ctx, cfg, req.Profile)
+	if !ok {
+		return req, errs
+	}
+	if req.Currency == "" {
+		req.Currency = p.Currency
+	}
+	if req.Objective == nil {
+		req.Objective = p.Objective
+	}
+	return req, nil
+}
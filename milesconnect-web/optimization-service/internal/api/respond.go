@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/logging"
+	"milesconnect-optimization/internal/metrics"
+	"milesconnect-optimization/internal/middleware"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/stats"
+	"milesconnect-optimization/internal/tenant"
+	"milesconnect-optimization/internal/validation"
+	"milesconnect-optimization/internal/workpool"
+	"net/http"
+	"time"
+)
+
+// ErrorResponse is the JSON body returned for rejected requests
+type ErrorResponse struct {
+	Error  string            `json:"error"`
+	Fields validation.Errors `json:"fields,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeValidationErrors(w http.ResponseWriter, errs validation.Errors) {
+	writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Fields: errs})
+}
+
+// clientGone reports whether the request was cancelled (client disconnect or server
+// shutdown), in which case the solver's result is dropped instead of written
+func clientGone(r *http.Request) bool {
+	if err := r.Context().Err(); err != nil {
+		slog.InfoContext(r.Context(), "dropping result of cancelled request", "endpoint", r.URL.Path, "error", err)
+		return true
+	}
+	return false
+}
+
+// acquireWorker waits for a solver slot. When the tenant is at its concurrency cap it
+// answers 429, and when the pool is saturated 503, both with Retry-After, and returns
+// false. The caller must call release once the solve is done; extra calls are no-ops.
+func acquireWorker(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	// The tenant's own cap is checked first so one tenant can't fill the shared queue
+	releaseTenant, ok := tenant.From(r.Context()).Acquire()
+	if !ok {
+		metrics.SolverRejected.Inc("tenant_concurrency")
+		logging.Annotate(r.Context(), slog.String("rejected", "tenant_concurrency"))
+		w.Header().Set("Retry-After", "1")
+		writeJSON(w, http.StatusTooManyRequests, ErrorResponse{Error: "Tenant concurrency limit reached, retry later"})
+		return nil, false
+	}
+
+	metrics.SolverQueued.Add(1)
+	releaseWorker, err := solverPool.Acquire(r.Context())
+	metrics.SolverQueued.Add(-1)
+	if err == nil {
+		return func() { releaseWorker(); releaseTenant() }, true
+	}
+	releaseTenant()
+
+	reason := "queue_full"
+	switch {
+	case errors.Is(err, workpool.ErrQueueTimeout):
+		reason = "queue_timeout"
+	case r.Context().Err() != nil:
+		// The client left while queued; nobody is listening for a response
+		clientGone(r)
+		return nil, false
+	}
+	metrics.SolverRejected.Inc(reason)
+	logging.Annotate(r.Context(), slog.String("rejected", reason))
+	w.Header().Set("Retry-After", "1")
+	writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Solver capacity exhausted, retry later"})
+	return nil, false
+}
+
+// trackSolve counts a solve as in flight until the returned func is called
+func trackSolve(solverName string) func() {
+	metrics.SolvesInFlight.Add(1, solverName)
+	return func() { metrics.SolvesInFlight.Add(-1, solverName) }
+}
+
+// recordSolve adds the solver run to the request's access log line, the solver metrics
+// and the tenant's usage
+func recordSolve(ctx context.Context, meta models.SolverMetadata, stops int) {
+	metrics.SolverDuration.Observe(meta.ComputeTimeMs/1000, meta.Solver)
+	metrics.SolverStops.Observe(float64(stops), meta.Solver)
+	if meta.InitialValue > 0 {
+		metrics.SolverImprovement.Observe((meta.InitialValue-meta.ObjectiveValue)/meta.InitialValue, meta.Solver)
+	}
+	if meta.BudgetExhausted {
+		metrics.SolverBudgetExhausted.Inc(meta.Solver)
+	}
+	improvement := math.NaN()
+	if meta.InitialValue > 0 {
+		improvement = (meta.InitialValue - meta.ObjectiveValue) / meta.InitialValue
+	}
+	stats.Default.RecordSolve(meta.Solver, stops, meta.ComputeTimeMs, improvement, meta.BudgetExhausted)
+
+	tenant.From(ctx).RecordSolve(stops, meta.ComputeTimeMs)
+
+	logging.Annotate(ctx,
+		slog.String("solver", meta.Solver),
+		slog.Int("stops", stops),
+		slog.Float64("solve_ms", meta.ComputeTimeMs),
+		slog.Bool("budget_exhausted", meta.BudgetExhausted),
+	)
+}
+
+// maxStops is the smaller of the instance-wide and the tenant's problem size limit
+func maxStops(ctx context.Context) int {
+	limit := settings().MaxStops
+	if t := tenant.From(ctx).Limits().MaxStops; t > 0 && (limit <= 0 || t < limit) {
+		limit = t
+	}
+	return limit
+}
+
+// auditSolve records the solve of endpoint in the audit log, if one is configured
+func auditSolve(ctx context.Context, endpoint string, req any, stops int, meta models.SolverMetadata, result audit.Summary) {
+	log := settings().Audit
+	if log == nil {
+		return
+	}
+	result.BudgetExhausted = meta.BudgetExhausted
+	result.ComputeTimeMs = meta.ComputeTimeMs
+	log.Log(audit.Record{
+		Time:          time.Now().UTC(),
+		RequestID:     logging.RequestID(ctx),
+		Tenant:        tenantName(ctx),
+		Client:        middleware.ClientFrom(ctx),
+		Endpoint:      endpoint,
+		InputHash:     audit.Hash(req),
+		Stops:         stops,
+		Solver:        meta.Solver,
+		SolverVersion: meta.Version,
+		Result:        result,
+		Cached:        meta.Cached,
+		Delivered:     ctx.Err() == nil,
+	})
+}
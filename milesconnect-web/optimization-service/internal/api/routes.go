@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/tracking"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+	"time"
+)
+
+// RoutesHandler handles POST /routes: it solves the /optimize request in the body as
+// /optimize does and stores the route for its driver to report progress on, answering
+// 201 with the tracked route and its Location
+func RoutesHandler(w http.ResponseWriter, r *http.Request) {
+	store := settings().Routes
+	if store == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Route tracking is not enabled"})
+		return
+	}
+	req, ok := checkedRoute(w, r, validation.TrackedRoute)
+	if !ok {
+		return
+	}
+	resp, ok := solveChecked(w, r, settings(), req)
+	if !ok {
+		return
+	}
+	route := store.Save(tracking.New(tenantName(r.Context()), req, resp))
+	w.Header().Set("Location", "/routes/"+route.ID)
+	writeJSON(w, http.StatusCreated, route)
+}
+
+// GetRouteHandler handles GET /routes/{id}: the tracked route with each stop's status
+func GetRouteHandler(w http.ResponseWriter, r *http.Request) {
+	store := settings().Routes
+	if store == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Route tracking is not enabled"})
+		return
+	}
+	route, err := store.Get(tenantName(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Route not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, route)
+}
+
+// UpdateStopHandler handles PATCH /routes/{id}/stops/{stopId}: a driver marking a stop
+// arrived, completed or failed. It answers with the updated route, 404 for an unknown
+// route or stop and 409 for a stop already completed or failed.
+func UpdateStopHandler(w http.ResponseWriter, r *http.Request) {
+	store := settings().Routes
+	if store == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Route tracking is not enabled"})
+		return
+	}
+	limitBody(w, r, settings())
+	var rep models.StopReport
+	if err := json.NewDecoder(r.Body).Decode(&rep); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if errs := validation.StopReport(rep); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	at := time.Now()
+	if rep.Time != "" {
+		at, _ = time.Parse(time.RFC3339, rep.Time)
+	}
+
+	route, err := store.Report(tenantName(r.Context()), r.PathValue("id"), r.PathValue("stopId"),
+		tracking.Report{Status: rep.Status, Time: at, Position: rep.Position, Reason: rep.Reason})
+	switch {
+	case errors.Is(err, tracking.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Route not found"})
+	case errors.Is(err, tracking.ErrUnknownStop):
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Route has no such stop"})
+	case errors.Is(err, tracking.ErrFinalStatus):
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Stop already completed or failed"})
+	default:
+		writeJSON(w, http.StatusOK, route)
+	}
+}
+
+// trackedRoute is the route of the request's route_id, or the field error to answer
+// with
+func trackedRoute(ctx context.Context, cfg Settings, id string) (tracking.Route, validation.Errors) {
+	if cfg.Routes == nil {
+		return tracking.Route{}, validation.Errors{{Field: "route_id", Message: "route tracking is not enabled"}}
+	}
+	route, err := cfg.Routes.Get(tenantName(ctx), id)
+	if err != nil {
+		return tracking.Route{}, validation.Errors{{Field: "route_id", Message: "no such route"}}
+	}
+	if len(route.Remaining()) == 0 {
+		return tracking.Route{}, validation.Errors{{Field: "route_id", Message: "every stop of the route has been visited"}}
+	}
+	return route, nil
+}
+
+// resumeRoute is the /optimize request for the stops left on the tracked route body
+// names, from the vehicle's last known position unless body gives a start
+func resumeRoute(ctx context.Context, cfg Settings, body models.OptimizationRequest) (models.OptimizationRequest, validation.Errors) {
+	route, errs := trackedRoute(ctx, cfg, body.RouteID)
+	if len(errs) > 0 {
+		return body, errs
+	}
+	req := route.Request
+	req.Start = route.Position
+	if s := body.Start; s.Lat != 0 || s.Lng != 0 || s.Address != "" {
+		req.Start = s
+	}
+	req.Waypoints = route.Remaining()
+	req.PreviousRoute = make([]string, len(req.Waypoints))
+	for i, wp := range req.Waypoints {
+		req.PreviousRoute[i] = wp.ID
+	}
+	if body.DepartureTime != "" {
+		req.DepartureTime = body.DepartureTime
+	} else if req.DepartureTime != "" {
+		req.DepartureTime = time.Now().UTC().Format(time.RFC3339)
+	}
+	if body.Solver != "" {
+		req.Solver = body.Solver
+	}
+	req.Fields = body.Fields
+	return req, nil
+}
+
+// resumeETA fills in req, an /eta request naming a tracked route, from the route
+func resumeETA(ctx context.Context, cfg Settings, req models.ETARequest) (models.ETARequest, validation.Errors) {
+	route, errs := trackedRoute(ctx, cfg, req.RouteID)
+	if len(errs) > 0 {
+		return req, errs
+	}
+	stored := route.Request
+	req.Route = append(route.Remaining(), route.Plan.Route[len(route.Plan.Route)-1])
+	req.Completed = nil
+	if p := req.Position; p.Lat == 0 && p.Lng == 0 {
+		req.Position = route.Position
+	}
+	if req.DepartureTime == "" {
+		req.DepartureTime = time.Now().UTC().Format(time.RFC3339)
+	}
+	if req.Timezone == "" {
+		req.Timezone = stored.Timezone
+	}
+	if req.SpeedKmh == 0 && len(req.SpeedClasses) == 0 {
+		req.SpeedKmh, req.SpeedClasses = stored.SpeedKmh, stored.SpeedClasses
+	}
+	if len(req.HolidayCalendars) == 0 && req.HolidayCalendar == "" {
+		req.HolidayCalendars, req.HolidayCalendar = stored.HolidayCalendars, stored.HolidayCalendar
+	}
+	return req, nil
+}
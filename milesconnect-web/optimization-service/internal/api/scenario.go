@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/scenario"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+)
+
+// ScenarioHandler allocates an /optimize-load fleet twice, as given and with the
+// request's changes, and returns both allocations with their diff. Either solve may
+// come from the cache, so a baseline already solved by /optimize-load costs nothing;
+// the others share one worker, each with the request's time budget or else the full
+// solver timeout.
+func ScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limitBody(w, r, settings())
+	var req models.ScenarioRequest
+	limit := maxStops(r.Context())
+	shipments, n, found, err := decodeCapped(r.Body, &req, "shipments", limit, validation.Shipment)
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	req.Shipments = shipments
+	errs := validation.MaxItems("shipments", n, limit)
+	if len(errs) == 0 {
+		errs = found
+	}
+	if len(errs) == 0 {
+		req.LoadRequest, errs = applyLoadProfile(r.Context(), settings(), req.LoadRequest)
+	}
+	if len(errs) == 0 {
+		errs = validation.ScenarioRequest(req)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if req.LoadRequest, errs = serverLoadChecks(settings(), req.LoadRequest); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	cfg := settings()
+	reqs := [2]models.LoadRequest{req.LoadRequest, scenario.Apply(req)}
+	var resps [2]models.LoadResponse
+	var keys [2]string
+	var solved [2]bool
+	for i := range reqs {
+		keys[i] = loadCacheKey(r.Context(), cfg, reqs[i])
+		var ok bool
+		if resps[i], ok = cached[models.LoadResponse](r.Context(), cfg, r.URL.Path, keys[i], req.NoCache || noCache(r)); ok {
+			resps[i].Metadata.Cached = true
+			solved[i] = true
+		}
+	}
+	if !solved[0] || !solved[1] {
+		release, ok := acquireWorker(w, r)
+		if !ok {
+			return
+		}
+		defer release()
+		for i := range reqs {
+			if solved[i] {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), solveTimeout(cfg, reqs[i].SolverParams))
+			resps[i] = solveLoad(ctx, reqs[i])
+			cancel()
+			recordSolve(r.Context(), resps[i].Metadata, len(reqs[i].Shipments))
+			cacheResult(cfg, keys[i], resps[i], resps[i].Metadata)
+		}
+		release()
+	}
+	auditSolve(r.Context(), r.URL.Path, req, len(req.Shipments), resps[1].Metadata, loadSummary(resps[1]))
+	if clientGone(r) {
+		return
+	}
+
+	resp := models.ScenarioResponse{Baseline: finishLoad(reqs[0], resps[0]), Scenario: finishLoad(reqs[1], resps[1])}
+	resp.Diff = scenario.Diff(resp.Baseline, resp.Scenario)
+	writeResult(w, r, resp, req.Fields)
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/pipeline"
+)
+
+// addSchedule times the route for requests with a departure time, slowing legs through
+// bad weather, and checks the unassigned stops' insertions against their windows
+func addSchedule(ctx context.Context, cfg Settings, req models.OptimizationRequest, resp models.OptimizationResponse) models.OptimizationResponse {
+	resp, err := pipeline.Schedule(ctx, req, resp, cfg.Weather)
+	if err != nil {
+		slog.WarnContext(ctx, "weather lookup incomplete; affected legs are timed as clear", "error", err)
+	}
+	return resp
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/cache"
+	"milesconnect-optimization/internal/capture"
+	"milesconnect-optimization/internal/feature"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/geocode"
+	"milesconnect-optimization/internal/jobs"
+	"milesconnect-optimization/internal/logging"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/objective"
+	"milesconnect-optimization/internal/priority"
+	"milesconnect-optimization/internal/routing"
+	"milesconnect-optimization/internal/schedule"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/solver/genetic"
+	"milesconnect-optimization/internal/stability"
+	"milesconnect-optimization/internal/tenant"
+	"milesconnect-optimization/internal/tracking"
+	"milesconnect-optimization/internal/weather"
+	"milesconnect-optimization/internal/workpool"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Settings are the solver tunables and collaborators handlers read at the start of every request
+type Settings struct {
+	SolverTimeout time.Duration // bounds a single solve; the best partial result is returned after it
+	MaxStops      int           // waypoints or shipments accepted per request; 0 means unlimited
+	MaxBodyBytes  int64         // request body size accepted by the POST endpoints; 0 means unlimited
+	WriteTimeout  time.Duration // the server's; /simulate stops short of it. 0 means none
+	Genetic       genetic.Params
+	Hierarchical  solver.HierarchicalParams // /optimize requests solved cluster by cluster
+	Routing       *routing.Resilient        // road distances for /optimize; nil uses great-circle distances
+
+	Geocoder             *geocode.Geocoder // resolves /optimize stops given by address; nil rejects them
+	GeocodeMinConfidence float64           // matches below this confidence are rejected
+
+	// TierPenalties are by customer tier, for tiers the request doesn't override; must
+	// not be modified after Configure
+	TierPenalties map[string]models.TierPenalty
+
+	Weather *weather.Service // slows schedule legs through bad weather; nil uses request regions only
+
+	EmissionsKgPerKm float64 // CO2 of the vehicles, for requests that don't give theirs
+
+	// Currency is what TierPenalties are in and the currency of requests naming none;
+	// ExchangeRates are what one unit of it is worth in others. Must not be modified
+	// after Configure.
+	Currency      string
+	ExchangeRates map[string]float64
+
+	// HolidayCalendars are holiday dates by calendar name, for requests that don't
+	// define the calendars they name. Must not be modified after Configure.
+	HolidayCalendars map[string][]string
+
+	// SpeedClasses time the legs of requests that give no speed of their own
+	SpeedClasses []models.SpeedClass
+
+	// StabilityThresholdPct is how much shorter, in percent, a solved route must be to
+	// replace a previous route, for requests that give one without a threshold
+	StabilityThresholdPct float64
+
+	// TravelTimeCV is the spread of leg driving times, as a fraction of them, that
+	// on-time probabilities assume for requests that don't give theirs
+	TravelTimeCV float64
+
+	// SolverLimits are the most requests may set their solver_params to, and the
+	// iteration and neighborhood caps of requests that set none; zero fields are unlimited
+	SolverLimits models.SolverParams
+
+	// Workers solves run at once; up to QueueSize more wait at most QueueTimeout for a slot
+	Workers      int
+	QueueSize    int
+	QueueTimeout time.Duration
+
+	Features feature.Set // must not be modified after Configure
+	Shadow   ShadowSettings
+	Audit    *audit.Logger // nil disables the audit log
+	Jobs     *jobs.Runner  // nil disables /jobs
+
+	Cache          *cache.Cache // results by canonical request; nil disables caching
+	CachePrecision int          // decimal places coordinates are rounded to in cache keys
+
+	// Capture keeps consented requests that fail their checks or take CaptureSlowAfter
+	// or longer to solve; nil disables capture
+	Capture          *capture.Store
+	CaptureSlowAfter time.Duration
+
+	// Routes keeps the routes drivers report their progress on through /routes; nil
+	// disables route tracking
+	Routes *tracking.Store
+
+	// Profiles are request defaults by name. Requests naming none get their tenant's
+	// in TenantProfiles, else DefaultProfile, else none.
+	Profiles       map[string]Profile
+	TenantProfiles map[string]string
+	DefaultProfile string
+}
+
+// Profile is what a request leaves unset of these options is filled in from
+type Profile struct {
+	Solver           string
+	Currency         string
+	Timezone         string
+	SpeedKmh         float64
+	SpeedClasses     []models.SpeedClass
+	Objective        *models.ObjectiveWeights
+	EmissionsKgPerKm float64
+}
+
+var current atomic.Pointer[Settings]
+
+// solverPool is shared by all solver endpoints; Configure resizes it in place
+var solverPool = workpool.New(1, 0, 0)
+
+func init() {
+	Configure(Settings{
+		SolverTimeout: 30 * time.Second,
+		MaxStops:      5000,
+		MaxBodyBytes:  10 << 20,
+		Genetic:       genetic.DefaultParams(),
+		Hierarchical:  solver.DefaultHierarchicalParams(),
+		TierPenalties: priority.Defaults(),
+		Workers:       runtime.NumCPU(),
+		QueueSize:     100,
+		QueueTimeout:  10 * time.Second,
+
+		EmissionsKgPerKm: objective.DefaultEmissionsKgPerKm,
+
+		StabilityThresholdPct: stability.DefaultThresholdPct,
+		TravelTimeCV:          schedule.DefaultTravelTimeCV,
+
+		SolverLimits: models.SolverParams{TimeBudgetMs: 120000},
+	})
+}
+
+// Configure replaces the settings used by subsequent requests. Requests already
+// running keep the settings they started with.
+func Configure(s Settings) {
+	current.Store(&s)
+	solverPool.SetLimits(s.Workers, s.QueueSize, s.QueueTimeout)
+}
+
+func settings() Settings {
+	return *current.Load()
+}
+
+// Feature flags consulted by the handlers
+const (
+	featureTwoOpt = "two_opt" // improve /optimize routes with 2-opt
+)
+
+// featureOn reports whether the named feature is on for this request's tenant and request ID
+func featureOn(ctx context.Context, cfg Settings, name string) bool {
+	return cfg.Features.Enabled(name, tenantName(ctx), logging.RequestID(ctx))
+}
+
+// tenantName is the request's tenant, or tenant.Anonymous outside the tenant middleware
+func tenantName(ctx context.Context) string {
+	if t := tenant.From(ctx); t != nil {
+		return t.Name
+	}
+	return tenant.Anonymous
+}
+
+// distances fetches the routing provider's matrix for req when one is configured and
+// the request doesn't leave roads to its final legs
+func distances(ctx context.Context, cfg Settings, req models.OptimizationRequest) (geo.Matrix, *models.DistanceSource) {
+	if cfg.Routing == nil || req.RoadLegs {
+		return nil, nil
+	}
+	matrix, source := cfg.Routing.Matrix(ctx, geo.RequestPoints(req))
+	return matrix, &source
+}
+
+// addRoadLegs measures the legs of resp's route on roads for requests that ask for it
+func addRoadLegs(ctx context.Context, cfg Settings, req models.OptimizationRequest, resp models.OptimizationResponse) models.OptimizationResponse {
+	if !req.RoadLegs || cfg.Routing == nil || len(resp.Route) < 2 {
+		return resp
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.SolverTimeout)
+	defer cancel()
+	road, source := cfg.Routing.Legs(ctx, resp.Route)
+	legs := &models.RoadLegs{Source: source, Legs: make([]models.RoadLeg, len(resp.Route)-1)}
+	for i := range legs.Legs {
+		from, to := resp.Route[i], resp.Route[i+1]
+		leg := models.RoadLeg{From: from.ID, To: to.ID, StraightKm: geo.HaversineKm(from, to)}
+		if road != nil {
+			leg.RoadKm = &road[i]
+			legs.RoadKm += road[i]
+		}
+		legs.StraightKm += leg.StraightKm
+		legs.Legs[i] = leg
+	}
+	resp.RoadLegs = legs
+	return resp
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"milesconnect-optimization/internal/feature"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/logging"
+	"milesconnect-optimization/internal/maxrange"
+	"milesconnect-optimization/internal/metrics"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/reload"
+	"milesconnect-optimization/internal/solvers"
+	"time"
+)
+
+// routeSolveFunc is the signature shared by the /optimize solvers
+type routeSolveFunc func(ctx context.Context, req models.OptimizationRequest, matrix geo.Matrix) models.OptimizationResponse
+
+// IsRouteSolver reports whether name is a solver /optimize can shadow: one that routes
+// on the primary solve's distances, whatever they are
+func IsRouteSolver(name string) bool {
+	return solvers.AcceptsMatrix(name)
+}
+
+// solverOptions configures the solvers that take parameters from cfg
+func solverOptions(cfg Settings) solvers.Options {
+	return solvers.Options{Genetic: cfg.Genetic, ClusterSize: cfg.Hierarchical.ClusterSize}
+}
+
+// ShadowSettings run a second /optimize solver on sampled requests for comparison
+type ShadowSettings struct {
+	Solver string       // a solver IsRouteSolver accepts; empty disables shadow runs
+	Sample feature.Flag // which requests are shadowed
+}
+
+// shadowSolve runs the configured shadow solver on req in the background when the
+// request is sampled and a worker is idle. Its result is only logged and measured
+// against primary, never returned, and it never queues behind live traffic.
+func shadowSolve(reqCtx context.Context, cfg Settings, req models.OptimizationRequest, matrix geo.Matrix, primary models.OptimizationResponse) {
+	sh := cfg.Shadow
+	solve, ok := solvers.Route(sh.Solver, solverOptions(cfg))
+	if !ok || !IsRouteSolver(sh.Solver) || sh.Solver == primary.Metadata.Solver {
+		return
+	}
+	requestID := logging.RequestID(reqCtx)
+	if !sh.Sample.On("shadow", tenantName(reqCtx), requestID) {
+		return
+	}
+	release, ok := solverPool.TryAcquire()
+	if !ok {
+		metrics.ShadowSkipped.Inc(sh.Solver)
+		return
+	}
+
+	go func() {
+		defer release()
+		ctx, cancel := context.WithTimeout(logging.WithRequestID(context.Background(), requestID), cfg.SolverTimeout)
+		defer cancel()
+
+		done := trackSolve(sh.Solver)
+		started := time.Now()
+		resp := reload.Split(req, maxrange.Trim(req, solve(ctx, req, matrix), matrix), matrix)
+		elapsed := time.Since(started)
+		done()
+
+		p, s := primary.TotalDistKm, resp.TotalDistKm
+		delta := 0.0
+		if p > 0 {
+			delta = (s - p) / p
+		}
+		metrics.ShadowRuns.Inc(primary.Metadata.Solver, sh.Solver)
+		metrics.ShadowDistanceDelta.Observe(delta, primary.Metadata.Solver, sh.Solver)
+		metrics.ShadowDuration.Observe(elapsed.Seconds(), sh.Solver)
+		slog.InfoContext(ctx, "shadow solve",
+			"primary", primary.Metadata.Solver, "shadow", sh.Solver, "stops", len(req.Waypoints),
+			"primary_km", p, "shadow_km", s, "delta_ratio", delta,
+			"primary_ms", primary.Metadata.ComputeTimeMs, "shadow_ms", resp.Metadata.ComputeTimeMs,
+			"shadow_budget_exhausted", resp.Metadata.BudgetExhausted)
+	}()
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"milesconnect-optimization/internal/audit"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/simulate"
+	"milesconnect-optimization/internal/validation"
+	"net/http"
+)
+
+// SimulateHandler replays the historical days in the body through each of its solver
+// configurations, allocating and routing every day as /optimize-load and /optimize
+// would with the server's defaults, and answers with each configuration's KPIs. The
+// solves share one worker, one after another with the full solver timeout each, and
+// come from the cache when an earlier run or request already made them. A replay that
+// isn't done shortly before the write timeout is stopped and answered with a 503.
+func SimulateHandler(w http.ResponseWriter, r *http.Request) {
+	const path = "/simulate"
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := settings()
+	// The write timeout runs from the request's headers; stop with time left to answer
+	ctx := r.Context()
+	if cfg.WriteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.WriteTimeout*9/10)
+		defer cancel()
+	}
+
+	limitBody(w, r, cfg)
+	var req models.SimulationRequest
+	limit := maxStops(r.Context())
+	// Each day is checked against the stop limit as it is decoded, like a body's stops
+	days, _, errs, err := decodeCapped(r.Body, &req, "days", 0, func(field string, d models.SimulationDay) validation.Errors {
+		if errs := validation.MaxItems(field+".shipments", len(d.Shipments), limit); len(errs) > 0 {
+			return errs
+		}
+		var found validation.Errors
+		for k, s := range d.Shipments {
+			found = append(found, validation.Shipment(fmt.Sprintf("%s.shipments[%d]", field, k), s)...)
+		}
+		return found
+	})
+	if err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	req.Days = days
+	shipments := 0
+	for _, d := range req.Days {
+		shipments += len(d.Shipments)
+	}
+	if len(errs) == 0 {
+		errs = validation.SimulationRequest(req)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	req.NoCache = req.NoCache || noCache(r)
+
+	release, ok := acquireWorker(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	resp, err := simulate.Run(ctx, req, simulate.Solvers{
+		Load: func(ctx context.Context, req models.LoadRequest) (models.LoadResponse, error) {
+			return simulateLoad(ctx, cfg, path, req)
+		},
+		Route: func(ctx context.Context, req models.OptimizationRequest) (models.OptimizationResponse, error) {
+			return simulateRoute(ctx, cfg, path, req)
+		},
+	})
+	release()
+	if clientGone(r) {
+		return
+	}
+	var invalid validation.Errors
+	switch {
+	case errors.Is(err, errGeocoding):
+		writeGeocodingError(w)
+		return
+	case errors.As(err, &invalid):
+		writeValidationErrors(w, invalid)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Simulation did not finish within the write timeout; replay fewer days or configurations"})
+		return
+	case err != nil:
+		http.Error(w, "Simulation failed", http.StatusInternalServerError)
+		return
+	}
+
+	var meta models.SolverMetadata
+	for _, res := range resp.Results {
+		meta.ComputeTimeMs += res.Total.ComputeTimeMs
+	}
+	auditSolve(r.Context(), path, req, shipments, meta, audit.Summary{})
+	writeResult(w, r, resp, req.Fields)
+}
+
+// simulateLoad allocates a simulated day's shipments as /optimize-load does
+func simulateLoad(ctx context.Context, cfg Settings, path string, req models.LoadRequest) (models.LoadResponse, error) {
+	req, errs := checkLoad(ctx, req)
+	if len(errs) > 0 {
+		return models.LoadResponse{}, errs
+	}
+	key := loadCacheKey(ctx, cfg, req)
+	if resp, ok := cached[models.LoadResponse](ctx, cfg, path, key, req.NoCache); ok {
+		return finishLoad(req, resp), nil
+	}
+	solveCtx, cancel := context.WithTimeout(ctx, solveTimeout(cfg, req.SolverParams))
+	resp := solveLoad(solveCtx, req)
+	cancel()
+	recordSolve(ctx, resp.Metadata, len(req.Shipments))
+	cacheResult(cfg, key, resp, resp.Metadata)
+	return finishLoad(req, resp), nil
+}
+
+// simulateRoute routes a simulated vehicle as /optimize does
+func simulateRoute(ctx context.Context, cfg Settings, path string, req models.OptimizationRequest) (models.OptimizationResponse, error) {
+	req, errs, err := checkRoute(ctx, req)
+	if err != nil {
+		return models.OptimizationResponse{}, err
+	}
+	if len(errs) > 0 {
+		return models.OptimizationResponse{}, errs
+	}
+	solve, name := routeSolver(ctx, cfg, req)
+	key := routeCacheKey(ctx, cfg, req, name)
+	if resp, ok := cached[models.OptimizationResponse](ctx, cfg, path, key, req.NoCache); ok {
+		return finishRoute(ctx, cfg, req, resp), nil
+	}
+	solveCtx, cancel := context.WithTimeout(ctx, solveTimeout(cfg, req.SolverParams))
+	resp, _ := solveRoute(solveCtx, cfg, req, solve, name)
+	cancel()
+	recordSolve(ctx, resp.Metadata, len(req.Waypoints))
+	cacheResult(cfg, key, resp, resp.Metadata)
+	return finishRoute(ctx, cfg, req, resp), nil
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ndjsonType is the media type of streamed responses; clients ask for them in Accept
+const ndjsonType = "application/x-ndjson"
+
+// streamFlushEvery is how many lines a streamed response writes between flushes
+const streamFlushEvery = 200
+
+// StreamLine is one line of a streamed response. The first is the summary: the
+// response without its lists. Then each list element is an item, list by list in the
+// order of the response's fields. The last line is the end, with how many items each
+// list had; a stream without it was cut short.
+type StreamLine struct {
+	Kind   string          `json:"kind"` // summary, item or end
+	Field  string          `json:"field,omitempty"`
+	Index  *int            `json:"index,omitempty"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Counts map[string]int  `json:"counts,omitempty"`
+}
+
+// Kinds of StreamLine
+const (
+	streamSummary = "summary"
+	streamItem    = "item"
+	streamEnd     = "end"
+)
+
+// writeResult writes a solver endpoint's successful response v with the fields the
+// request selected, falling back to bodyFields, streamed as newline-delimited JSON when
+// the client accepts it
+func writeResult(w http.ResponseWriter, r *http.Request, v any, bodyFields []string) {
+	fields := requestedFields(r, bodyFields)
+	if !strings.Contains(r.Header.Get("Accept"), ndjsonType) {
+		writeFields(w, http.StatusOK, v, fields)
+		return
+	}
+	writeStream(w, r, v, parseFields(fields))
+}
+
+// writeStream writes v, a response struct, as StreamLines, keeping the fields in tree
+// when it is not empty. Only one list element is encoded at a time, and the output is
+// flushed as it goes, so clients can start on a large response before it is all
+// written. Values that aren't structs are written as plain JSON.
+func writeStream(w http.ResponseWriter, r *http.Request, v any, tree fieldTree) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		writeFields(w, http.StatusOK, v, nil)
+		return
+	}
+	var summary []jsonField
+	var lists []jsonField
+	for _, f := range jsonFields(rv) {
+		sub, selected := tree[f.name]
+		if len(tree) > 0 && !selected {
+			continue
+		}
+		f.tree = sub
+		if f.value.Kind() == reflect.Slice && f.value.Len() > 0 {
+			lists = append(lists, f)
+		} else {
+			summary = append(summary, f)
+		}
+	}
+
+	w.Header().Set("Content-Type", ndjsonType)
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	lines := 0
+	write := func(line StreamLine) bool {
+		if err := enc.Encode(line); err != nil {
+			slog.WarnContext(r.Context(), "streaming response", "endpoint", r.URL.Path, "error", err)
+			return false
+		}
+		if lines++; lines%streamFlushEvery == 0 {
+			if bw.Flush() != nil {
+				return false
+			}
+			rc.Flush()
+		}
+		return true
+	}
+
+	var obj bytes.Buffer
+	obj.WriteByte('{')
+	for i, f := range summary {
+		raw, err := json.Marshal(f.value.Interface())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "encoding streamed summary", "field", f.name, "error", err)
+			return
+		}
+		if i > 0 {
+			obj.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name)
+		obj.Write(name)
+		obj.WriteByte(':')
+		obj.Write(filterFields(raw, f.tree))
+	}
+	obj.WriteByte('}')
+	if !write(StreamLine{Kind: streamSummary, Value: obj.Bytes()}) {
+		return
+	}
+
+	counts := map[string]int{}
+	for _, f := range lists {
+		for i := range f.value.Len() {
+			if r.Context().Err() != nil {
+				return // the client is gone
+			}
+			raw, err := json.Marshal(f.value.Index(i).Interface())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "encoding streamed item", "field", f.name, "error", err)
+				return
+			}
+			if !write(StreamLine{Kind: streamItem, Field: f.name, Index: &i, Value: filterFields(raw, f.tree)}) {
+				return
+			}
+		}
+		counts[f.name] = f.value.Len()
+	}
+	if write(StreamLine{Kind: streamEnd, Counts: counts}) && bw.Flush() == nil {
+		rc.Flush()
+	}
+}
+
+// jsonField is a struct field as encoding/json would write it
+type jsonField struct {
+	name  string
+	value reflect.Value
+	tree  fieldTree
+}
+
+// jsonFields lists the fields of struct value v encoding/json would write, in order,
+// with embedded structs' fields in place of them
+func jsonFields(v reflect.Value) []jsonField {
+	var fields []jsonField
+	for i := range v.NumField() {
+		sf, fv := v.Type().Field(i), v.Field(i)
+		tag := sf.Tag.Get("json")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && fv.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(fv)...)
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if strings.Contains(opts, "omitempty") && emptyValue(fv) {
+			continue
+		}
+		fields = append(fields, jsonField{name: name, value: fv})
+	}
+	return fields
+}
+
+// emptyValue reports whether omitempty leaves v out
+func emptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
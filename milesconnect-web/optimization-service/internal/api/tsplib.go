@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/tsplib"
+	"net/http"
+)
+
+// TSPLIBHandler handles POST /tsplib?solver=: it solves the TSPLIB instance in the body
+// as /optimize solves a round trip from its first node, and measures the tour with the
+// instance's distance function, against its published optimum when it has one. Road
+// distances are never used, and results are never cached, so every call is a solve.
+func TSPLIBHandler(w http.ResponseWriter, r *http.Request) {
+	const path = "/tsplib"
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limitBody(w, r, settings())
+	p, err := tsplib.Parse(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeDecodeError(w, tooLarge)
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	req := p.Request()
+	req.Solver, req.NoCache = r.URL.Query().Get("solver"), true
+	req, errs, err := checkRoute(r.Context(), req)
+	if err != nil {
+		writeGeocodingError(w)
+		return
+	}
+	cfg := settings()
+	if len(errs) > 0 {
+		captureInvalid(r.Context(), cfg, path, req, req.CaptureConsent, errs)
+		writeValidationErrors(w, errs)
+		return
+	}
+	cfg.Routing = nil
+	resp, ok := solveChecked(w, r, cfg, req)
+	if !ok {
+		return
+	}
+
+	tour, ok := p.Tour(resp.Route)
+	if !ok {
+		http.Error(w, "Solver returned a route that isn't a tour of the instance", http.StatusInternalServerError)
+		return
+	}
+	out := models.TSPLIBResponse{
+		Instance:       p.Name,
+		Dimension:      len(p.Nodes),
+		EdgeWeightType: p.EdgeWeightType,
+		Tour:           make([]int, len(tour)),
+		Length:         p.TourLength(tour),
+		Route:          resp,
+	}
+	for i, n := range tour {
+		out.Tour[i] = p.Nodes[n].ID
+	}
+	if best, ok := tsplib.BestKnown(p.Name); ok {
+		out.BestKnown = best
+		out.GapPct = math.Round((out.Length-best)/best*10000) / 100
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,111 @@
+// Package audit records who asked for which optimization and what they got back,
+// for settling billing disputes over routed mileage.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"milesconnect-optimization/internal/metrics"
+)
+
+// Record is one audited solve
+type Record struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"request_id"`
+	Tenant        string    `json:"tenant"`
+	Client        string    `json:"client,omitempty"`
+	Endpoint      string    `json:"endpoint"`
+	InputHash     string    `json:"input_hash"` // sha256 of the decoded request re-encoded as JSON
+	Stops         int       `json:"stops"`
+	Solver        string    `json:"solver"`
+	SolverVersion string    `json:"solver_version"`
+	Result        Summary   `json:"result"`
+	Cached        bool      `json:"cached,omitempty"` // served from the result cache without solving
+	Delivered     bool      `json:"delivered"`        // false when the client was gone before the result could be sent
+}
+
+// Summary is the part of the result worth keeping
+type Summary struct {
+	TotalDistKm     float64 `json:"total_distance_km,omitempty"`
+	VehiclesUsed    int     `json:"vehicles_used,omitempty"`
+	Unassigned      int     `json:"unassigned,omitempty"`
+	BudgetExhausted bool    `json:"time_budget_exhausted"`
+	ComputeTimeMs   float64 `json:"compute_time_ms"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(ctx context.Context, rec Record) error
+	Close() error
+}
+
+// Hash fingerprints a request so identical inputs can be matched across records
+func Hash(req any) string {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Logger hands records to a Sink on a background goroutine so a slow sink doesn't
+// hold up responses. When the buffer is full records are dropped and counted in
+// optimizer_audit_dropped_total.
+type Logger struct {
+	sink    Sink
+	records chan Record
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewLogger starts writing to sink with room for buffer pending records
+func NewLogger(sink Sink, buffer int) *Logger {
+	l := &Logger{sink: sink, records: make(chan Record, buffer), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+// Log queues rec. It is safe to call on a nil *Logger, which discards the record.
+func (l *Logger) Log(rec Record) {
+	if l == nil {
+		return
+	}
+	select {
+	case l.records <- rec:
+	default:
+		metrics.AuditDropped.Inc()
+		slog.Warn("audit buffer full, record dropped", "request_id", rec.RequestID, "tenant", rec.Tenant)
+	}
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+	for rec := range l.records {
+		if err := l.sink.Write(context.Background(), rec); err != nil {
+			metrics.AuditDropped.Inc()
+			slog.Error("audit write failed", "request_id", rec.RequestID, "error", err)
+		}
+	}
+}
+
+// Close writes the records still queued and closes the sink. Log must not be
+// called after Close.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	var err error
+	l.once.Do(func() {
+		close(l.records)
+		<-l.done
+		err = l.sink.Close()
+	})
+	return err
+}
@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileSink appends records to a file as JSON lines
+type FileSink struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+// OpenFile appends to path, creating it if needed. "-" writes to stdout.
+func OpenFile(path string) (*FileSink, error) {
+	var w io.WriteCloser = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &FileSink{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(rec)
+}
+
+func (s *FileSink) Close() error {
+	if s.w == os.Stdout {
+		return nil
+	}
+	return s.w.Close()
+}
@@ -0,0 +1,37 @@
+// Package bufpool recycles large slices between solves, so sustained traffic of big
+// requests reuses memory instead of churning the garbage collector
+package bufpool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Pool holds slices of T in power-of-two capacity classes. The zero value is ready to use.
+type Pool[T any] struct {
+	classes [bits.UintSize]sync.Pool
+}
+
+// Get returns a slice of length n. Its contents are unspecified: callers overwrite or
+// clear it.
+func (p *Pool[T]) Get(n int) []T {
+	if n <= 0 {
+		return nil
+	}
+	class := bits.Len(uint(n - 1))
+	if s, ok := p.classes[class].Get().(*[]T); ok {
+		return (*s)[:n]
+	}
+	return make([]T, n, 1<<class)
+}
+
+// Put makes s available to later Gets. s must not be used afterwards; slices not
+// from Get are dropped.
+func (p *Pool[T]) Put(s []T) {
+	c := cap(s)
+	if c == 0 || c&(c-1) != 0 {
+		return
+	}
+	s = s[:c]
+	p.classes[bits.Len(uint(c-1))].Put(&s)
+}
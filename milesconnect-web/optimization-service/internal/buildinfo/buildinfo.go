@@ -0,0 +1,67 @@
+// Package buildinfo reports what build of the service is running. The values are
+// set at link time:
+//
+//	go build -ldflags "-X milesconnect-optimization/internal/buildinfo.Version=1.4.0 \
+//	  -X milesconnect-optimization/internal/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//	  -X milesconnect-optimization/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+//
+// Commit and BuildTime fall back to the VCS stamp Go embeds when building from a checkout.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info is the build description served by /health
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"` // built from a checkout with uncommitted changes
+}
+
+var info = load()
+
+// Get returns the build information
+func Get() Info {
+	return info
+}
+
+func load() Info {
+	i := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return i
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if i.Commit == "" {
+				i.Commit = s.Value
+			}
+		case "vcs.time":
+			if i.BuildTime == "" {
+				i.BuildTime = s.Value
+			}
+		case "vcs.modified":
+			i.Modified = s.Value == "true"
+		}
+	}
+	return i
+}
+
+// String is the value of the X-Service-Version header: version, plus the short commit when known
+func (i Info) String() string {
+	if len(i.Commit) >= 7 {
+		return i.Version + "+" + i.Commit[:7]
+	}
+	return i.Version
+}
@@ -0,0 +1,216 @@
+// Package capture keeps anonymized copies of requests that failed their checks or were
+// slow to solve, from clients that consented, so they can be replayed against the
+// current solver while debugging.
+package capture
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"milesconnect-optimization/internal/audit"
+)
+
+// Why a request was captured, in Capture.Reason
+const (
+	Slow    = "slow"    // the solve took longer than the capture threshold or ran out of time
+	Invalid = "invalid" // the request failed the endpoint's checks
+)
+
+// ErrNotFound is returned by Get for an unknown capture ID
+var ErrNotFound = errors.New("capture not found")
+
+// Capture is one captured request
+type Capture struct {
+	ID       string          `json:"id"`
+	Time     time.Time       `json:"time"`
+	Tenant   string          `json:"tenant"`
+	Endpoint string          `json:"endpoint"`
+	Reason   string          `json:"reason"`
+	Request  json.RawMessage `json:"request,omitempty"` // anonymized; left out of List
+
+	// InvalidFields are the fields that failed the checks, for Invalid. Their messages
+	// can quote IDs, so they aren't kept; a replay gives them again.
+	InvalidFields []string `json:"invalid_fields,omitempty"`
+
+	// The solve that was captured, for Slow
+	Solver        string         `json:"solver,omitempty"`
+	SolverVersion string         `json:"solver_version,omitempty"`
+	Result        *audit.Summary `json:"result,omitempty"`
+}
+
+// idPattern matches the IDs Save assigns, so Get never reads outside the directory
+var idPattern = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}\.[0-9]{3}Z-[0-9a-f]{8}$`)
+
+// Store keeps captures as one JSON file each in a directory, dropping the oldest
+// beyond its limit
+type Store struct {
+	dir string
+	max int
+	mu  sync.Mutex
+}
+
+// Open stores captures in dir, creating it if needed, keeping at most max of them
+func Open(dir string, max int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, max: max}, nil
+}
+
+// Save stores c under a new ID, time-ordered, and returns it with the ID and time set
+func (s *Store) Save(c Capture) (Capture, error) {
+	if c.Time.IsZero() {
+		c.Time = time.Now()
+	}
+	c.Time = c.Time.UTC()
+	var suffix [4]byte
+	rand.Read(suffix[:])
+	c.ID = c.Time.Format("20060102T150405.000Z") + "-" + hex.EncodeToString(suffix[:])
+	b, err := json.Marshal(c)
+	if err != nil {
+		return c, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := filepath.Join(s.dir, c.ID+".json")
+	if err := os.WriteFile(path+".tmp", b, 0o640); err != nil {
+		return c, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return c, err
+	}
+	ids, err := s.ids()
+	if err != nil {
+		return c, err
+	}
+	for _, id := range ids[:max(len(ids)-s.max, 0)] {
+		os.Remove(filepath.Join(s.dir, id+".json"))
+	}
+	return c, nil
+}
+
+// Get returns the capture with the given ID
+func (s *Store) Get(id string) (Capture, error) {
+	if !idPattern.MatchString(id) {
+		return Capture{}, ErrNotFound
+	}
+	b, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Capture{}, ErrNotFound
+	}
+	if err != nil {
+		return Capture{}, err
+	}
+	var c Capture
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Capture{}, fmt.Errorf("capture %s: %w", id, err)
+	}
+	return c, nil
+}
+
+// List returns the stored captures, newest first, without their requests
+func (s *Store) List() ([]Capture, error) {
+	s.mu.Lock()
+	ids, err := s.ids()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Capture, 0, len(ids))
+	for _, id := range slices.Backward(ids) {
+		c, err := s.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			continue // pruned since
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.Request = nil
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// ids are the stored capture IDs, oldest first
+func (s *Store) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok && idPattern.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// Anonymize returns a copy of the JSON request body body with what identifies the
+// client's customers taken out: addresses and geocoding matches are dropped, and stop,
+// shipment and vehicle IDs, and the stop IDs of after lists, replaced by hashes, the
+// same ID always by the same hash, so references between them still hold. Coordinates
+// are kept; they are what the solvers work from. The copy asks for a fresh solve of
+// the whole response and no longer consents to capture.
+func Anonymize(body []byte) (json.RawMessage, error) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	if top, ok := v.(map[string]any); ok {
+		delete(top, "capture_consent")
+		delete(top, "fields")
+		top["no_cache"] = true
+	}
+	return json.Marshal(anonymize(v))
+}
+
+func anonymize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			switch {
+			case k == "address" || k == "formatted_address" || k == "geocode":
+				delete(v, k)
+			case k == "id" || strings.HasSuffix(k, "_id"):
+				if s, ok := e.(string); ok && s != "" {
+					v[k] = pseudonym(s)
+				}
+			case strings.HasSuffix(k, "_ids") || k == "after":
+				if ids, ok := e.([]any); ok {
+					for i, id := range ids {
+						if s, ok := id.(string); ok {
+							ids[i] = pseudonym(s)
+						}
+					}
+				}
+			default:
+				v[k] = anonymize(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = anonymize(e)
+		}
+	}
+	return v
+}
+
+// pseudonym stands in for id in anonymized requests
+func pseudonym(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return "anon-" + hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,89 @@
+// Package catalog describes the solvers compiled into the service, for capability
+// discovery. Solver packages register their descriptors from init.
+package catalog
+
+import (
+	"sort"
+	"sync"
+)
+
+// Capabilities lists the constraints and behaviours a solver supports
+type Capabilities struct {
+	TimeWindows    bool `json:"time_windows"`
+	Capacities     bool `json:"capacities"`
+	Precedence     bool `json:"precedence"`
+	FixedEndpoints bool `json:"fixed_start_end"`    // route starts and ends at given locations
+	Duplicates     bool `json:"duplicate_handling"` // honours the duplicates keep/merge/reject option
+	TimeBudget     bool `json:"time_budget"`        // returns its best partial result when the solver timeout hits
+}
+
+// Param is a tunable solver parameter
+type Param struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"` // integer, number, boolean or string
+	Description string   `json:"description"`
+	Default     any      `json:"default"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Scope       string   `json:"scope"` // "server" for configuration-only parameters, "request" for per-request ones
+}
+
+// Limits bound the problem size a solver accepts; zero means unlimited
+type Limits struct {
+	MaxStops int `json:"max_stops,omitempty"`
+}
+
+// Descriptor is what /solvers reports about one solver
+type Descriptor struct {
+	Name         string       `json:"name"`
+	Version      string       `json:"version"`
+	Problem      string       `json:"problem"` // tsp or fleet-allocation
+	Endpoint     string       `json:"endpoint"`
+	Description  string       `json:"description"`
+	Capabilities Capabilities `json:"capabilities"`
+	Params       []Param      `json:"params"`
+	Limits       Limits       `json:"limits"`
+}
+
+var (
+	mu          sync.RWMutex
+	descriptors = map[string]Descriptor{}
+)
+
+// Register adds d to the catalog. Registering the same name twice panics.
+func Register(d Descriptor) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := descriptors[d.Name]; dup {
+		panic("catalog: solver " + d.Name + " registered twice")
+	}
+	if d.Params == nil {
+		d.Params = []Param{}
+	}
+	descriptors[d.Name] = d
+}
+
+// All returns every registered solver ordered by name
+func All() []Descriptor {
+	mu.RLock()
+	defer mu.RUnlock()
+	all := make([]Descriptor, 0, len(descriptors))
+	for _, d := range descriptors {
+		all = append(all, d)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Lookup returns the descriptor registered under name
+func Lookup(name string) (Descriptor, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := descriptors[name]
+	return d, ok
+}
+
+// Bound is a helper for Param.Min and Param.Max
+func Bound(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,784 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete service configuration. Values come from the built-in
+// defaults, then the YAML file (if any), then the environment variables named in
+// the env tags, each layer overriding the previous one.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Solver    SolverConfig    `yaml:"solver"`
+	Routing   RoutingConfig   `yaml:"routing"`
+	Geocoding GeocodingConfig `yaml:"geocoding"`
+	Weather   WeatherConfig   `yaml:"weather"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Tenants   TenantsConfig   `yaml:"tenants"`
+	Auth      AuthConfig      `yaml:"auth"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Audit     AuditConfig     `yaml:"audit"`
+	Capture   CaptureConfig   `yaml:"capture"`
+	Stats     StatsConfig     `yaml:"stats"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Jobs      JobsConfig      `yaml:"jobs"`
+	Tracking  TrackingConfig  `yaml:"tracking"`
+	Kafka     KafkaConfig     `yaml:"kafka"`
+	NATS      NATSConfig      `yaml:"nats"`
+	Admin     AdminConfig     `yaml:"admin"`
+
+	// Features toggles optional behaviour by name; FEATURE_<NAME>=true|false overrides an
+	// entry's enabled switch
+	Features map[string]FeatureFlag `yaml:"features"`
+
+	// Profiles are named request defaults, chosen by a request's profile field or for
+	// its tenant by tenants.profiles
+	Profiles map[string]ProfileConfig `yaml:"profiles"`
+}
+
+// ProfileConfig is a named set of defaults for one kind of customer, each filling in
+// the request option of the same name when a request leaves it unset
+type ProfileConfig struct {
+	Solver           string           `yaml:"solver"`
+	Currency         string           `yaml:"currency"`
+	Timezone         string           `yaml:"timezone"`
+	SpeedKmh         float64          `yaml:"average_speed_kmh"`
+	SpeedClasses     []SpeedClass     `yaml:"speed_classes"`
+	Objective        *ObjectiveConfig `yaml:"objective"`
+	EmissionsKgPerKm float64          `yaml:"emissions_kg_per_km"`
+}
+
+// ObjectiveConfig weighs the parts of a solution's cost, as a request's objective does
+type ObjectiveConfig struct {
+	Distance  float64 `yaml:"distance"`
+	Duration  float64 `yaml:"duration"`
+	Vehicles  float64 `yaml:"vehicles"`
+	Lateness  float64 `yaml:"lateness"`
+	Emissions float64 `yaml:"emissions"`
+	Unserved  float64 `yaml:"unserved"`
+}
+
+// FeatureFlag enables a feature for everyone, for the listed tenants, or for a
+// percentage of requests. A plain boolean is shorthand for enabled.
+type FeatureFlag struct {
+	Enabled bool     `yaml:"enabled"`
+	Tenants []string `yaml:"tenants"`
+	Percent float64  `yaml:"percent"`
+}
+
+func (f *FeatureFlag) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*f = FeatureFlag{}
+		return node.Decode(&f.Enabled)
+	}
+	type plain FeatureFlag
+	return node.Decode((*plain)(f))
+}
+
+type ServerConfig struct {
+	Port                string        `yaml:"port" env:"PORT"`
+	ReadTimeout         time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout        time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout         time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period" env:"SHUTDOWN_GRACE_PERIOD"`
+}
+
+type SolverConfig struct {
+	Timeout      time.Duration      `yaml:"timeout" env:"SOLVER_TIMEOUT"`
+	MaxStops     int                `yaml:"max_stops" env:"SOLVER_MAX_STOPS"`           // per request; 0 means unlimited
+	MaxBodyBytes int                `yaml:"max_body_bytes" env:"SOLVER_MAX_BODY_BYTES"` // request body size; 0 means unlimited
+	Workers      int                `yaml:"workers" env:"SOLVER_WORKERS"`               // concurrent solves
+	QueueSize    int                `yaml:"queue_size" env:"SOLVER_QUEUE_SIZE"`         // requests waiting beyond that get 503
+	QueueTimeout time.Duration      `yaml:"queue_timeout" env:"SOLVER_QUEUE_TIMEOUT"`   // longest wait for a worker
+	Genetic      GeneticConfig      `yaml:"genetic"`
+	Shadow       ShadowConfig       `yaml:"shadow"`
+	Hierarchical HierarchicalConfig `yaml:"hierarchical"`
+	Tiers        TiersConfig        `yaml:"tiers"`
+
+	// EmissionsKgPerKm is the vehicles' CO2, for objectives that weigh emissions;
+	// requests can override it
+	EmissionsKgPerKm float64 `yaml:"emissions_kg_per_km" env:"EMISSIONS_KG_PER_KM"`
+
+	// Currency is the ISO 4217 code the tier penalties are in, and the currency of
+	// requests that name none; empty leaves costs unitless. ExchangeRates gives, for the
+	// other currencies requests may name, what one unit of Currency is worth in each.
+	Currency      string             `yaml:"currency" env:"SOLVER_CURRENCY"`
+	ExchangeRates map[string]float64 `yaml:"exchange_rates"`
+
+	// HolidayCalendars are public holiday dates (2006-01-02) by calendar name, which
+	// stops and requests name to be closed on them; requests can add their own
+	HolidayCalendars map[string][]string `yaml:"holiday_calendars"`
+
+	// StabilityThresholdPct is how much shorter, in percent, a solved route must be to
+	// replace the previous route a request gives; requests can set their own
+	StabilityThresholdPct float64 `yaml:"stability_threshold_pct" env:"STABILITY_THRESHOLD_PCT"`
+
+	// Limits caps the solver_params requests may give
+	Limits SolverLimitsConfig `yaml:"limits"`
+}
+
+// SolverLimitsConfig is the most requests may set each solver parameter to; 0 means
+// unlimited. MaxIterations and MaxNeighborhood also cap the 2-opt search of requests
+// that don't set them.
+type SolverLimitsConfig struct {
+	MaxTimeBudget   time.Duration `yaml:"max_time_budget" env:"SOLVER_MAX_TIME_BUDGET"`
+	MaxIterations   int           `yaml:"max_iterations" env:"SOLVER_MAX_ITERATIONS"`
+	MaxNeighborhood int           `yaml:"max_neighborhood" env:"SOLVER_MAX_NEIGHBORHOOD"`
+}
+
+// TiersConfig sets what failing a customer of each tier costs, in km of driving or in
+// solver.currency when that is set: late penalties are per minute past a stop's
+// window, unserved ones per shipment left unassigned. Requests can override them with
+// tier_penalties.
+type TiersConfig struct {
+	PlatinumLate     float64 `yaml:"platinum_late_per_minute" env:"TIER_PLATINUM_LATE_PENALTY"`
+	PlatinumUnserved float64 `yaml:"platinum_unserved" env:"TIER_PLATINUM_UNSERVED_PENALTY"`
+	GoldLate         float64 `yaml:"gold_late_per_minute" env:"TIER_GOLD_LATE_PENALTY"`
+	GoldUnserved     float64 `yaml:"gold_unserved" env:"TIER_GOLD_UNSERVED_PENALTY"`
+	StandardLate     float64 `yaml:"standard_late_per_minute" env:"TIER_STANDARD_LATE_PENALTY"`
+	StandardUnserved float64 `yaml:"standard_unserved" env:"TIER_STANDARD_UNSERVED_PENALTY"`
+}
+
+// HierarchicalConfig has 2-opt solve very large great-circle requests cluster by cluster
+type HierarchicalConfig struct {
+	Threshold   int `yaml:"threshold" env:"SOLVER_HIERARCHICAL_THRESHOLD"` // waypoints above which it applies; 0 disables
+	ClusterSize int `yaml:"cluster_size" env:"SOLVER_CLUSTER_SIZE"`        // most waypoints per cluster
+}
+
+// ShadowConfig runs a second /optimize solver on sampled requests; results are only logged and measured
+type ShadowConfig struct {
+	Solver  string   `yaml:"solver" env:"SHADOW_SOLVER"`   // e.g. tsp-2opt; empty disables
+	Percent float64  `yaml:"percent" env:"SHADOW_PERCENT"` // share of requests, 0-100
+	Tenants []string `yaml:"tenants" env:"SHADOW_TENANTS"` // always shadow these tenants
+}
+
+// GeneticConfig tunes the genetic TSP solver
+type GeneticConfig struct {
+	PopulationSize int     `yaml:"population_size" env:"GA_POPULATION_SIZE"`
+	Generations    int     `yaml:"generations" env:"GA_GENERATIONS"`
+	MutationRate   float64 `yaml:"mutation_rate" env:"GA_MUTATION_RATE"`
+	TournamentSize int     `yaml:"tournament_size" env:"GA_TOURNAMENT_SIZE"`
+	Seed           int64   `yaml:"seed" env:"GA_SEED"` // 0 seeds every solve from the clock
+}
+
+// RoutingConfig selects where /optimize gets leg distances from
+type RoutingConfig struct {
+	Provider string        `yaml:"provider" env:"ROUTING_PROVIDER"` // haversine or osrm
+	Timeout  time.Duration `yaml:"timeout" env:"ROUTING_TIMEOUT"`   // per matrix request
+	OSRM     OSRMConfig    `yaml:"osrm"`
+	Breaker  BreakerConfig `yaml:"breaker"`
+	Retry    RetryConfig   `yaml:"retry"`
+
+	// SpeedClasses time great-circle legs by their length for schedules and durations,
+	// for requests that give no speed; empty drives every leg at 40 km/h
+	SpeedClasses []SpeedClass `yaml:"speed_classes"`
+
+	// TravelTimeCV is the standard deviation of leg driving times as a fraction of
+	// them, for the on-time probabilities of requests that ask for lateness risk
+	TravelTimeCV float64 `yaml:"travel_time_cv" env:"TRAVEL_TIME_CV"`
+}
+
+// SpeedClass is the speed legs up to UpToKm are driven at, as in the request's
+// speed_classes: in increasing UpToKm, with 0 only on the last class, for no bound
+type SpeedClass struct {
+	UpToKm   float64 `yaml:"up_to_km"`
+	SpeedKmh float64 `yaml:"speed_kmh"`
+}
+
+type OSRMConfig struct {
+	URL     string `yaml:"url" env:"OSRM_URL"`
+	Profile string `yaml:"profile" env:"OSRM_PROFILE"`
+}
+
+// BreakerConfig trips the provider's circuit breaker; while open, great-circle distances are used
+type BreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold" env:"ROUTING_BREAKER_FAILURES"` // consecutive failures
+	SlowCall         time.Duration `yaml:"slow_call" env:"ROUTING_BREAKER_SLOW_CALL"`        // slower calls count as failures
+	Cooldown         time.Duration `yaml:"cooldown" env:"ROUTING_BREAKER_COOLDOWN"`          // before a probe call
+}
+
+// RetryConfig retries transient provider failures with exponential backoff and jitter.
+// Budget caps the time spent on one request's attempts; retries also stop short of the solver deadline.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts" env:"ROUTING_RETRY_ATTEMPTS"`
+	BaseDelay   time.Duration `yaml:"base_delay" env:"ROUTING_RETRY_BASE_DELAY"`
+	MaxDelay    time.Duration `yaml:"max_delay" env:"ROUTING_RETRY_MAX_DELAY"`
+	Budget      time.Duration `yaml:"budget" env:"ROUTING_RETRY_BUDGET"`
+}
+
+// GeocodingConfig resolves /optimize stops given by address instead of coordinates
+type GeocodingConfig struct {
+	Provider      string          `yaml:"provider" env:"GEOCODING_PROVIDER"`             // "" (off), nominatim or google
+	Timeout       time.Duration   `yaml:"timeout" env:"GEOCODING_TIMEOUT"`               // per lookup attempt
+	MaxAttempts   int             `yaml:"max_attempts" env:"GEOCODING_RETRY_ATTEMPTS"`   // per address, for transient failures
+	RPS           float64         `yaml:"rps" env:"GEOCODING_RPS"`                       // lookups a second across requests; 0 is unlimited
+	Concurrency   int             `yaml:"concurrency" env:"GEOCODING_CONCURRENCY"`       // lookups one request runs at once
+	MinConfidence float64         `yaml:"min_confidence" env:"GEOCODING_MIN_CONFIDENCE"` // matches below it are rejected
+	CacheTTL      time.Duration   `yaml:"cache_ttl" env:"GEOCODING_CACHE_TTL"`           // 0 disables the address cache
+	CacheEntries  int             `yaml:"cache_entries" env:"GEOCODING_CACHE_ENTRIES"`
+	Nominatim     NominatimConfig `yaml:"nominatim"`
+	Google        GoogleConfig    `yaml:"google"`
+}
+
+type NominatimConfig struct {
+	URL          string `yaml:"url" env:"NOMINATIM_URL"`
+	UserAgent    string `yaml:"user_agent" env:"NOMINATIM_USER_AGENT"`       // required by the public server's usage policy
+	CountryCodes string `yaml:"country_codes" env:"NOMINATIM_COUNTRY_CODES"` // e.g. in; empty searches everywhere
+}
+
+type GoogleConfig struct {
+	APIKey string `yaml:"api_key" env:"GOOGLE_GEOCODING_API_KEY"`
+	Region string `yaml:"region" env:"GOOGLE_GEOCODING_REGION"` // ccTLD code results are biased towards, e.g. in
+}
+
+// WeatherConfig slows schedule legs through bad weather, looked up from a provider for
+// the parts of a route the request gives no weather for
+type WeatherConfig struct {
+	Provider           string        `yaml:"provider" env:"WEATHER_PROVIDER"`                 // "" (request regions only) or open-meteo
+	URL                string        `yaml:"url" env:"WEATHER_URL"`                           // provider base URL; empty for its public API
+	Timeout            time.Duration `yaml:"timeout" env:"WEATHER_TIMEOUT"`                   // for all of one route's lookups
+	Concurrency        int           `yaml:"concurrency" env:"WEATHER_CONCURRENCY"`           // lookups one route runs at once
+	CacheTTL           time.Duration `yaml:"cache_ttl" env:"WEATHER_CACHE_TTL"`               // 0 disables the cache of conditions by 0.1 degree cell
+	LightMultiplier    float64       `yaml:"light_multiplier" env:"WEATHER_LIGHT_MULTIPLIER"` // travel-time factors by severity
+	ModerateMultiplier float64       `yaml:"moderate_multiplier" env:"WEATHER_MODERATE_MULTIPLIER"`
+	SevereMultiplier   float64       `yaml:"severe_multiplier" env:"WEATHER_SEVERE_MULTIPLIER"`
+}
+
+type RateLimitConfig struct {
+	RPS   float64 `yaml:"rps" env:"RATE_LIMIT_RPS"` // 0 disables rate limiting
+	Burst int     `yaml:"burst" env:"RATE_LIMIT_BURST"`
+}
+
+// TenantsConfig sets per-tenant quotas and profiles. A request's tenant is the Header
+// value when configured and present, else the authenticated client, else "anonymous".
+// Requests naming no profile get their tenant's in Profiles, else Profile; empty for
+// none.
+type TenantsConfig struct {
+	Header    string                  `yaml:"header" env:"TENANT_HEADER"` // only set behind a gateway that controls it
+	Default   TenantLimits            `yaml:"default"`
+	Overrides map[string]TenantLimits `yaml:"overrides"`
+	Profile   string                  `yaml:"profile" env:"TENANT_PROFILE"`
+	Profiles  map[string]string       `yaml:"profiles"`
+}
+
+// TenantLimits caps one tenant; zero values mean unlimited
+type TenantLimits struct {
+	RPS           float64 `yaml:"rps" env:"TENANT_RPS"`
+	Burst         int     `yaml:"burst" env:"TENANT_BURST"`
+	MaxConcurrent int     `yaml:"max_concurrent" env:"TENANT_MAX_CONCURRENT"`
+	MaxStops      int     `yaml:"max_stops" env:"TENANT_MAX_STOPS"`
+}
+
+type AuthConfig struct {
+	APIKeys     []string  `yaml:"api_keys" env:"API_KEYS"` // client:key entries
+	APIKeysFile string    `yaml:"api_keys_file" env:"API_KEYS_FILE"`
+	JWT         JWTConfig `yaml:"jwt"`
+}
+
+type JWTConfig struct {
+	Issuer   string        `yaml:"issuer" env:"JWT_ISSUER"`
+	JWKSURL  string        `yaml:"jwks_url" env:"JWT_JWKS_URL"`
+	Audience string        `yaml:"audience" env:"JWT_AUDIENCE"`
+	Leeway   time.Duration `yaml:"leeway" env:"JWT_LEEWAY"`
+}
+
+type TLSConfig struct {
+	CertFile     string         `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile      string         `yaml:"key_file" env:"TLS_KEY_FILE"`
+	ClientCAFile string         `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	Autocert     AutocertConfig `yaml:"autocert"`
+}
+
+type AutocertConfig struct {
+	Domains  []string `yaml:"domains" env:"AUTOCERT_DOMAINS"`
+	Email    string   `yaml:"email" env:"AUTOCERT_EMAIL"`
+	CacheDir string   `yaml:"cache_dir" env:"AUTOCERT_CACHE_DIR"`
+	HTTPAddr string   `yaml:"http_addr" env:"AUTOCERT_HTTP_ADDR"`
+}
+
+type LoggingConfig struct {
+	Format string `yaml:"format" env:"LOG_FORMAT"` // json or text
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+// AuditConfig selects where the audit log of solves goes
+type AuditConfig struct {
+	Sink   string `yaml:"sink" env:"AUDIT_SINK"` // "" (off) or file
+	Path   string `yaml:"path" env:"AUDIT_PATH"` // file to append JSON lines to; "-" for stdout
+	Buffer int    `yaml:"buffer" env:"AUDIT_BUFFER"`
+}
+
+// CaptureConfig keeps anonymized copies of requests from clients that set
+// capture_consent, when they fail validation or take SlowAfter or longer to solve, for
+// replay through the admin endpoints
+type CaptureConfig struct {
+	Dir        string        `yaml:"dir" env:"CAPTURE_DIR"` // one file per capture; "" disables capture
+	SlowAfter  time.Duration `yaml:"slow_after" env:"CAPTURE_SLOW_AFTER"`
+	MaxEntries int           `yaml:"max_entries" env:"CAPTURE_MAX_ENTRIES"` // the oldest are removed beyond this
+}
+
+// StatsConfig keeps the GET /stats statistics across restarts in File, saved every
+// SaveInterval and on shutdown
+type StatsConfig struct {
+	File         string        `yaml:"file" env:"STATS_FILE"` // "" counts from startup only
+	SaveInterval time.Duration `yaml:"save_interval" env:"STATS_SAVE_INTERVAL"`
+}
+
+// CacheConfig enables caching of /optimize and /optimize-load results by canonical request
+type CacheConfig struct {
+	TTL        time.Duration `yaml:"ttl" env:"CACHE_TTL"` // 0 disables the cache
+	MaxEntries int           `yaml:"max_entries" env:"CACHE_MAX_ENTRIES"`
+	Precision  int           `yaml:"precision" env:"CACHE_PRECISION"` // coordinate decimals that tell requests apart
+}
+
+// JobsConfig enables asynchronous jobs and selects where they are kept and queued
+type JobsConfig struct {
+	Store       string `yaml:"store" env:"JOBS_STORE"`             // "" (off), memory, sqlite or postgres
+	SQLitePath  string `yaml:"sqlite_path" env:"JOBS_SQLITE_PATH"` // database file for the sqlite store
+	PostgresDSN string `yaml:"postgres_dsn" env:"DATABASE_URL"`    // for the postgres store
+	Queue       string `yaml:"queue" env:"JOBS_QUEUE"`             // memory or redis (shared by replicas)
+	RedisURL    string `yaml:"redis_url" env:"REDIS_URL"`          // for the redis queue
+	Workers     int    `yaml:"workers" env:"JOBS_WORKERS"`         // jobs run at once; they still share the solver pool
+	QueueSize   int    `yaml:"queue_size" env:"JOBS_QUEUE_SIZE"`   // memory queue only: waiting jobs before submissions get 503
+	// MemoryTTL is how long the memory store keeps a finished job, and MemoryMaxEntries
+	// how many jobs it holds before evicting the longest finished; 0 disables either
+	MemoryTTL        time.Duration `yaml:"memory_ttl" env:"JOBS_MEMORY_TTL"`
+	MemoryMaxEntries int           `yaml:"memory_max_entries" env:"JOBS_MEMORY_MAX_ENTRIES"`
+	// StaleAfter is how long a job may run before it is presumed abandoned by a dead
+	// worker and run again; it is also the redis queue's visibility timeout
+	StaleAfter time.Duration `yaml:"stale_after" env:"JOBS_STALE_AFTER"`
+	// CheckpointInterval is how often iterative solves save their progress to the sqlite
+	// or postgres store so a recovered job resumes instead of starting over; 0 disables it
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval" env:"JOBS_CHECKPOINT_INTERVAL"`
+	Offload            OffloadConfig `yaml:"offload"`
+}
+
+// TrackingConfig keeps routes stored with POST /routes in memory for drivers to report
+// their progress on
+type TrackingConfig struct {
+	TTL       time.Duration `yaml:"ttl" env:"TRACKING_TTL"`               // since the route's last report; 0 keeps routes until MaxRoutes pushes them out
+	MaxRoutes int           `yaml:"max_routes" env:"TRACKING_MAX_ROUTES"` // the least recently updated go beyond this; 0 disables /routes
+}
+
+// OffloadConfig keeps job results above a size threshold in S3-compatible storage;
+// GET /jobs/{id} then links to them with a presigned URL
+type OffloadConfig struct {
+	Bucket    string `yaml:"bucket" env:"S3_BUCKET"`     // empty keeps every result in the job store
+	Endpoint  string `yaml:"endpoint" env:"S3_ENDPOINT"` // host[:port], e.g. s3.amazonaws.com or minio:9000
+	Region    string `yaml:"region" env:"S3_REGION"`
+	AccessKey string `yaml:"access_key" env:"S3_ACCESS_KEY_ID"` // empty uses AWS_* variables or the instance role
+	SecretKey string `yaml:"secret_key" env:"S3_SECRET_ACCESS_KEY"`
+	UseSSL    bool   `yaml:"use_ssl" env:"S3_USE_SSL"`
+
+	ThresholdBytes int           `yaml:"threshold_bytes" env:"JOBS_OFFLOAD_THRESHOLD_BYTES"` // results larger than this are offloaded
+	URLExpiry      time.Duration `yaml:"url_expiry" env:"JOBS_OFFLOAD_URL_EXPIRY"`           // lifetime of the presigned URLs
+}
+
+// KafkaConfig enables serving requests from a Kafka topic alongside HTTP
+type KafkaConfig struct {
+	Brokers       []string `yaml:"brokers" env:"KAFKA_BROKERS"` // empty disables the consumer
+	Group         string   `yaml:"group" env:"KAFKA_GROUP"`
+	RequestTopic  string   `yaml:"request_topic" env:"KAFKA_REQUEST_TOPIC"`
+	ResponseTopic string   `yaml:"response_topic" env:"KAFKA_RESPONSE_TOPIC"`
+	Workers       int      `yaml:"workers" env:"KAFKA_WORKERS"`
+}
+
+// NATSConfig enables serving the optimize endpoints over NATS request-reply alongside HTTP
+type NATSConfig struct {
+	URL           string `yaml:"url" env:"NATS_URL"` // empty disables NATS
+	SubjectPrefix string `yaml:"subject_prefix" env:"NATS_SUBJECT_PREFIX"`
+	Queue         string `yaml:"queue" env:"NATS_QUEUE"`
+	Workers       int    `yaml:"workers" env:"NATS_WORKERS"`
+}
+
+type AdminConfig struct {
+	Addr     string `yaml:"addr" env:"ADMIN_ADDR"` // separate unauthenticated pprof listener
+	Pprof    bool   `yaml:"pprof" env:"PPROF_ENABLED"`
+	DebugMap bool   `yaml:"debug_map" env:"DEBUG_MAP_ENABLED"` // GET /debug/map route viewer on the main port
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:                "8081",
+			ReadTimeout:         15 * time.Second,
+			WriteTimeout:        60 * time.Second,
+			IdleTimeout:         120 * time.Second,
+			ShutdownGracePeriod: 30 * time.Second,
+		},
+		Solver: SolverConfig{
+			Timeout:      30 * time.Second,
+			MaxStops:     5000,
+			MaxBodyBytes: 10 << 20,
+			Workers:      runtime.NumCPU(),
+			QueueSize:    100,
+			QueueTimeout: 10 * time.Second,
+			Genetic: GeneticConfig{
+				PopulationSize: 100,
+				Generations:    500,
+				MutationRate:   0.05,
+				TournamentSize: 5,
+			},
+			Hierarchical: HierarchicalConfig{Threshold: 2000, ClusterSize: 500},
+			Tiers: TiersConfig{
+				PlatinumLate: 10, PlatinumUnserved: 1000,
+				GoldLate: 3, GoldUnserved: 300,
+				StandardLate: 1, StandardUnserved: 100,
+			},
+			EmissionsKgPerKm: 0.25,
+
+			StabilityThresholdPct: 5,
+
+			Limits: SolverLimitsConfig{MaxTimeBudget: 2 * time.Minute},
+		},
+		Routing: RoutingConfig{
+			Provider: "haversine",
+			Timeout:  5 * time.Second,
+			OSRM:     OSRMConfig{Profile: "driving"},
+			Breaker:  BreakerConfig{FailureThreshold: 5, SlowCall: 3 * time.Second, Cooldown: 30 * time.Second},
+			Retry:    RetryConfig{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Budget: 5 * time.Second},
+
+			TravelTimeCV: 0.15,
+		},
+		Geocoding: GeocodingConfig{
+			Timeout:      5 * time.Second,
+			MaxAttempts:  2,
+			RPS:          1,
+			Concurrency:  4,
+			CacheTTL:     24 * time.Hour,
+			CacheEntries: 100000,
+			Nominatim:    NominatimConfig{URL: "https://nominatim.openstreetmap.org", UserAgent: "milesconnect-optimization"},
+		},
+		Weather: WeatherConfig{
+			Timeout:            3 * time.Second,
+			Concurrency:        8,
+			CacheTTL:           15 * time.Minute,
+			LightMultiplier:    1.1,
+			ModerateMultiplier: 1.25,
+			SevereMultiplier:   1.5,
+		},
+		RateLimit: RateLimitConfig{Burst: 10},
+		Auth:      AuthConfig{JWT: JWTConfig{Leeway: 30 * time.Second}},
+		TLS:       TLSConfig{Autocert: AutocertConfig{CacheDir: "autocert-cache"}},
+		Logging:   LoggingConfig{Format: "json", Level: "info"},
+		Audit:     AuditConfig{Path: "audit.log", Buffer: 1024},
+		Capture:   CaptureConfig{SlowAfter: 5 * time.Second, MaxEntries: 500},
+		Stats:     StatsConfig{SaveInterval: time.Minute},
+		Cache:     CacheConfig{MaxEntries: 10000, Precision: 6},
+		Jobs: JobsConfig{
+			SQLitePath:         "jobs.db",
+			Queue:              "memory",
+			Workers:            2,
+			QueueSize:          1000,
+			MemoryTTL:          24 * time.Hour,
+			MemoryMaxEntries:   10000,
+			StaleAfter:         10 * time.Minute,
+			CheckpointInterval: 30 * time.Second,
+			Offload:            OffloadConfig{Endpoint: "s3.amazonaws.com", UseSSL: true, ThresholdBytes: 1 << 20, URLExpiry: time.Hour},
+		},
+		Tracking: TrackingConfig{TTL: 24 * time.Hour, MaxRoutes: 10000},
+		Kafka: KafkaConfig{
+			Group:         "optimization-service",
+			RequestTopic:  "optimization.requests",
+			ResponseTopic: "optimization.responses",
+			Workers:       1,
+		},
+		NATS:     NATSConfig{SubjectPrefix: "optimization", Queue: "optimization-service", Workers: 4},
+		Features: map[string]FeatureFlag{},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path (skipped
+// when path is empty) and the environment
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("reading config: %w", err)
+		}
+		if err := yaml.Unmarshal(raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(&cfg, os.Environ()); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Validate rejects settings the service can't run with
+func (c Config) Validate() error {
+	var errs []error
+	if c.Server.Port == "" {
+		errs = append(errs, errors.New("server.port must be set"))
+	}
+	if c.Solver.Timeout <= 0 {
+		errs = append(errs, errors.New("solver.timeout must be positive"))
+	}
+	if c.Solver.Workers < 1 || c.Solver.QueueSize < 0 || c.Solver.QueueTimeout < 0 || c.Solver.MaxStops < 0 ||
+		c.Solver.MaxBodyBytes < 0 {
+		errs = append(errs, errors.New("solver: workers >= 1, queue_size >= 0, queue_timeout >= 0, max_stops >= 0 and max_body_bytes >= 0 required"))
+	}
+	if g := c.Solver.Genetic; g.PopulationSize < 2 || g.Generations < 0 || g.TournamentSize < 1 ||
+		g.MutationRate < 0 || g.MutationRate > 1 {
+		errs = append(errs, errors.New("solver.genetic: population_size >= 2, generations >= 0, tournament_size >= 1 and 0 <= mutation_rate <= 1 required"))
+	}
+	if h := c.Solver.Hierarchical; h.Threshold < 0 || h.ClusterSize < 2 {
+		errs = append(errs, errors.New("solver.hierarchical: threshold >= 0 and cluster_size >= 2 required"))
+	}
+	if t := c.Solver.Tiers; min(t.PlatinumLate, t.PlatinumUnserved, t.GoldLate, t.GoldUnserved, t.StandardLate, t.StandardUnserved) < 0 {
+		errs = append(errs, errors.New("solver.tiers: penalties must not be negative"))
+	}
+	if c.Solver.EmissionsKgPerKm < 0 {
+		errs = append(errs, errors.New("solver.emissions_kg_per_km must not be negative"))
+	}
+	if t := c.Solver.StabilityThresholdPct; t < 0 || t > 100 {
+		errs = append(errs, errors.New("solver.stability_threshold_pct must be between 0 and 100"))
+	}
+	if l := c.Solver.Limits; l.MaxTimeBudget < 0 || l.MaxIterations < 0 || l.MaxNeighborhood < 0 {
+		errs = append(errs, errors.New("solver.limits must not be negative"))
+	}
+	if cur := c.Solver.Currency; cur != "" && !isCurrency(cur) {
+		errs = append(errs, fmt.Errorf("solver.currency %q is not a three-letter ISO 4217 code", cur))
+	}
+	if len(c.Solver.ExchangeRates) > 0 && c.Solver.Currency == "" {
+		errs = append(errs, errors.New("solver.exchange_rates need solver.currency"))
+	}
+	for _, code := range slices.Sorted(maps.Keys(c.Solver.ExchangeRates)) {
+		if rate := c.Solver.ExchangeRates[code]; !isCurrency(code) || !(rate > 0) || math.IsInf(rate, 0) {
+			errs = append(errs, fmt.Errorf("solver.exchange_rates.%s: a three-letter ISO 4217 code with a positive rate required", code))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Solver.HolidayCalendars)) {
+		for _, d := range c.Solver.HolidayCalendars[name] {
+			if _, err := time.Parse("2006-01-02", d); err != nil {
+				errs = append(errs, fmt.Errorf("solver.holiday_calendars.%s: %q is not a date like 2006-01-02", name, d))
+			}
+		}
+	}
+	errs = append(errs, checkSpeedClasses("routing.speed_classes", c.Routing.SpeedClasses)...)
+	if cv := c.Routing.TravelTimeCV; !(cv >= 0 && cv <= 1) {
+		errs = append(errs, errors.New("routing.travel_time_cv must be between 0 and 1"))
+	}
+	switch c.Routing.Provider {
+	case "haversine":
+	case "osrm":
+		if c.Routing.OSRM.URL == "" {
+			errs = append(errs, errors.New("routing.osrm.url is required for the osrm provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("routing.provider %q is not one of haversine, osrm", c.Routing.Provider))
+	}
+	switch g := c.Geocoding; g.Provider {
+	case "":
+	case "nominatim":
+		if g.Nominatim.URL == "" {
+			errs = append(errs, errors.New("geocoding.nominatim.url is required for the nominatim provider"))
+		}
+	case "google":
+		if g.Google.APIKey == "" {
+			errs = append(errs, errors.New("geocoding.google.api_key is required for the google provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("geocoding.provider %q is not one of nominatim, google or empty", g.Provider))
+	}
+	if g := c.Geocoding; g.Timeout < 0 || g.MaxAttempts < 1 || g.RPS < 0 || g.Concurrency < 1 ||
+		g.MinConfidence < 0 || g.MinConfidence > 1 || g.CacheTTL < 0 || g.CacheEntries < 1 {
+		errs = append(errs, errors.New("geocoding: timeout >= 0, max_attempts >= 1, rps >= 0, concurrency >= 1, 0 <= min_confidence <= 1, cache_ttl >= 0 and cache_entries >= 1 required"))
+	}
+	switch c.Weather.Provider {
+	case "", "open-meteo":
+	default:
+		errs = append(errs, fmt.Errorf("weather.provider %q is not one of open-meteo or empty", c.Weather.Provider))
+	}
+	if w := c.Weather; w.Timeout < 0 || w.Concurrency < 1 || w.CacheTTL < 0 ||
+		min(w.LightMultiplier, w.ModerateMultiplier, w.SevereMultiplier) < 1 {
+		errs = append(errs, errors.New("weather: timeout >= 0, concurrency >= 1, cache_ttl >= 0 and multipliers >= 1 required"))
+	}
+	for name, l := range c.Tenants.Overrides {
+		if l.RPS < 0 || l.Burst < 0 || l.MaxConcurrent < 0 || l.MaxStops < 0 {
+			errs = append(errs, fmt.Errorf("tenants.overrides.%s: limits must not be negative", name))
+		}
+	}
+	if l := c.Tenants.Default; l.RPS < 0 || l.Burst < 0 || l.MaxConcurrent < 0 || l.MaxStops < 0 {
+		errs = append(errs, errors.New("tenants.default: limits must not be negative"))
+	}
+	if p := c.Tenants.Profile; p != "" {
+		if _, ok := c.Profiles[p]; !ok {
+			errs = append(errs, fmt.Errorf("tenants.profile: no profile %q", p))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Tenants.Profiles)) {
+		if _, ok := c.Profiles[c.Tenants.Profiles[name]]; !ok {
+			errs = append(errs, fmt.Errorf("tenants.profiles.%s: no profile %q", name, c.Tenants.Profiles[name]))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Profiles)) {
+		errs = append(errs, c.checkProfile("profiles."+name, c.Profiles[name])...)
+	}
+	switch c.Audit.Sink {
+	case "", "file":
+	default:
+		errs = append(errs, fmt.Errorf("audit.sink %q is not one of file or empty", c.Audit.Sink))
+	}
+	if c.Capture.SlowAfter <= 0 || c.Capture.MaxEntries < 1 {
+		errs = append(errs, errors.New("capture: slow_after > 0 and max_entries >= 1 required"))
+	}
+	if c.Stats.SaveInterval <= 0 {
+		errs = append(errs, errors.New("stats.save_interval must be positive"))
+	}
+	if c.Cache.TTL < 0 || c.Cache.MaxEntries < 1 || c.Cache.Precision < 0 || c.Cache.Precision > 10 {
+		errs = append(errs, errors.New("cache: ttl >= 0, max_entries >= 1 and 0 <= precision <= 10 required"))
+	}
+	if c.Tracking.TTL < 0 || c.Tracking.MaxRoutes < 0 {
+		errs = append(errs, errors.New("tracking.ttl and tracking.max_routes must not be negative"))
+	}
+	if c.Jobs.MemoryTTL < 0 || c.Jobs.MemoryMaxEntries < 0 {
+		errs = append(errs, errors.New("jobs.memory_ttl and jobs.memory_max_entries must not be negative"))
+	}
+	switch c.Jobs.Store {
+	case "", "memory":
+	case "sqlite":
+		if c.Jobs.SQLitePath == "" {
+			errs = append(errs, errors.New("jobs.sqlite_path is required for the sqlite store"))
+		}
+	case "postgres":
+		if c.Jobs.PostgresDSN == "" {
+			errs = append(errs, errors.New("jobs.postgres_dsn is required for the postgres store"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("jobs.store %q is not one of memory, sqlite, postgres or empty", c.Jobs.Store))
+	}
+	switch c.Jobs.Queue {
+	case "memory":
+	case "redis":
+		if c.Jobs.RedisURL == "" {
+			errs = append(errs, errors.New("jobs.redis_url is required for the redis queue"))
+		}
+		// Other replicas can only run the jobs they dequeue if they share the store
+		if c.Jobs.Store != "postgres" {
+			errs = append(errs, errors.New("jobs.queue redis requires the postgres store"))
+		}
+		// A job still running past stale_after is delivered to another replica and run
+		// twice, so it must cover the longest solve a request can ask for and a wait
+		// for a solver slot
+		if c.Solver.Limits.MaxTimeBudget == 0 {
+			errs = append(errs, errors.New("jobs.queue redis requires a solver.limits.max_time_budget"))
+		} else if c.Jobs.StaleAfter <= max(c.Solver.Timeout, c.Solver.Limits.MaxTimeBudget)+c.Solver.QueueTimeout {
+			errs = append(errs, errors.New("jobs.stale_after must exceed the longer of solver.timeout and solver.limits.max_time_budget plus solver.queue_timeout with the redis queue"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("jobs.queue %q is not one of memory, redis", c.Jobs.Queue))
+	}
+	if c.Jobs.Workers < 1 || c.Jobs.QueueSize < 1 || c.Jobs.StaleAfter < 0 || c.Jobs.CheckpointInterval < 0 {
+		errs = append(errs, errors.New("jobs: workers >= 1, queue_size >= 1, stale_after >= 0 and checkpoint_interval >= 0 required"))
+	}
+	if o := c.Jobs.Offload; o.Bucket != "" {
+		if o.Endpoint == "" || o.ThresholdBytes < 0 || o.URLExpiry <= 0 || (o.AccessKey == "") != (o.SecretKey == "") {
+			errs = append(errs, errors.New("jobs.offload: endpoint, threshold_bytes >= 0, url_expiry > 0 and both or neither of access_key and secret_key required"))
+		}
+		// Presigned URLs are signed with the credentials in hand; SigV4 caps them at a week
+		if o.URLExpiry > 7*24*time.Hour {
+			errs = append(errs, errors.New("jobs.offload.url_expiry must not exceed 168h"))
+		}
+	}
+	if k := c.Kafka; len(k.Brokers) > 0 && (k.Group == "" || k.RequestTopic == "" || k.ResponseTopic == "" || k.Workers < 1) {
+		errs = append(errs, errors.New("kafka: group, request_topic and response_topic must be set and workers >= 1"))
+	}
+	if n := c.NATS; n.URL != "" && (n.SubjectPrefix == "" || n.Queue == "" || n.Workers < 1) {
+		errs = append(errs, errors.New("nats: subject_prefix and queue must be set and workers >= 1"))
+	}
+	if p := c.Solver.Shadow.Percent; p < 0 || p > 100 {
+		errs = append(errs, errors.New("solver.shadow.percent must be between 0 and 100"))
+	}
+	for name, f := range c.Features {
+		if f.Percent < 0 || f.Percent > 100 {
+			errs = append(errs, fmt.Errorf("features.%s.percent must be between 0 and 100", name))
+		}
+	}
+	if c.RateLimit.RPS < 0 {
+		errs = append(errs, errors.New("rate_limit.rps must not be negative"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls.cert_file and tls.key_file must be set together"))
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" && len(c.TLS.Autocert.Domains) == 0 {
+		errs = append(errs, errors.New("tls.client_ca_file requires tls.cert_file/key_file or tls.autocert.domains"))
+	}
+	return errors.Join(errs...)
+}
+
+// checkProfile checks the profile at field holds the values a request could give, in a
+// currency the server can convert its tier penalties to
+func (c Config) checkProfile(field string, p ProfileConfig) []error {
+	var errs []error
+	if cur := p.Currency; cur != "" {
+		if _, ok := c.Solver.ExchangeRates[cur]; !isCurrency(cur) || (c.Solver.Currency != "" && cur != c.Solver.Currency && !ok) {
+			errs = append(errs, fmt.Errorf("%s.currency %q is not solver.currency or one of solver.exchange_rates", field, cur))
+		}
+	}
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			errs = append(errs, fmt.Errorf("%s.timezone %q is not an IANA time zone", field, p.Timezone))
+		}
+	}
+	if s := p.SpeedKmh; s != 0 && (!(s >= 1) || math.IsInf(s, 0)) {
+		errs = append(errs, fmt.Errorf("%s.average_speed_kmh must be at least 1", field))
+	}
+	errs = append(errs, checkSpeedClasses(field+".speed_classes", p.SpeedClasses)...)
+	if o := p.Objective; o != nil && !(min(o.Distance, o.Duration, o.Vehicles, o.Lateness, o.Emissions, o.Unserved) >= 0) {
+		errs = append(errs, fmt.Errorf("%s.objective: weights must not be negative", field))
+	}
+	if !(p.EmissionsKgPerKm >= 0) {
+		errs = append(errs, fmt.Errorf("%s.emissions_kg_per_km must not be negative", field))
+	}
+	return errs
+}
+
+// checkSpeedClasses checks the speed classes at field increase to an unbounded last one
+func checkSpeedClasses(field string, classes []SpeedClass) []error {
+	var errs []error
+	for i, sc := range classes {
+		last := i == len(classes)-1
+		if !(sc.SpeedKmh >= 1) || math.IsInf(sc.SpeedKmh, 0) || sc.UpToKm < 0 || math.IsInf(sc.UpToKm, 0) ||
+			(sc.UpToKm == 0 && !last) || (i > 0 && sc.UpToKm > 0 && sc.UpToKm <= classes[i-1].UpToKm) {
+			errs = append(errs, fmt.Errorf("%s[%d]: speed_kmh >= 1 and up_to_km above the previous class's, or 0 on the last, required", field, i))
+		}
+	}
+	return errs
+}
+
+// Feature reports whether the named feature flag is on for everyone
+func (c Config) Feature(name string) bool {
+	return c.Features[name].Enabled
+}
+
+// isCurrency reports whether code has the form of an ISO 4217 currency code
+func isCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv overrides every field carrying an env tag whose variable is set in environ
+// (KEY=value entries, as from os.Environ), and feature flags from FEATURE_<NAME> variables
+func applyEnv(cfg *Config, environ []string) error {
+	vars := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		key, val, _ := strings.Cut(kv, "=")
+		vars[key] = val
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+
+	if err := applyEnvStruct(reflect.ValueOf(cfg).Elem(), lookup); err != nil {
+		return err
+	}
+
+	for key, val := range vars {
+		name, ok := strings.CutPrefix(key, "FEATURE_")
+		if !ok || name == "" {
+			continue
+		}
+		on, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if cfg.Features == nil {
+			cfg.Features = map[string]FeatureFlag{}
+		}
+		name = strings.ToLower(name)
+		flag := cfg.Features[name]
+		flag.Enabled = on
+		cfg.Features[name] = flag
+	}
+	return nil
+}
+
+func applyEnvStruct(v reflect.Value, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, fv := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			if err := applyEnvStruct(fv, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw, ok := lookup(name)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setField(fv, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(fv reflect.Value, raw string) error {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", fv.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+// Package explain annotates solved routes and fleet allocations with the reasons behind
+// them, for requests with explain set. Explanations are worked out from the request and
+// the response, so cached responses can be explained too.
+package explain
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/priority"
+	"milesconnect-optimization/internal/schedule"
+	"milesconnect-optimization/internal/solver"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Reason codes
+const (
+	FixedEndpoints   = "fixed_endpoints"
+	TimeBudget       = "time_budget_exhausted"
+	DistanceSource   = "distance_source"
+	DistanceFallback = "distance_fallback"
+	Hierarchical     = "hierarchical"
+	TimeWindows      = "time_windows"
+	RouteStart       = "route_start"
+	RouteEnd         = "route_end"
+	Detour           = "detour"
+	Merged           = "merged_duplicates"
+	Geocoded         = "geocoded"
+	WaitsForWindow   = "waits_for_window"
+	MissesWindow     = "misses_window"
+	InWindow         = "in_window"
+	WaitsForOpening  = "waits_for_opening"
+	Closed           = "closed"
+	CapacityFit      = "capacity_fit"
+	BestFit          = "best_fit"
+	OnlyFit          = "only_fit"
+	TooHeavy         = "too_heavy"
+	NoRoomLeft       = "no_room_left"
+	PlacementOrder   = "placement_order"
+	FullVehicles     = "vehicles_full"
+	UnusedVehicles   = "vehicles_unused"
+	Unassigned       = "unassigned"
+	Reloads          = "reloads"
+	OutOfRange       = "out_of_range"
+	Reload           = "reload"
+	NoCompartment    = "no_compartment"
+	PreviousRoute    = "previous_route"
+	NearDestinations = "near_destinations"
+	NewArea          = "new_area"
+	NearestArea      = "nearest_area"
+)
+
+// fullPct is the utilisation from which a vehicle counts as full
+const fullPct = 95
+
+// Route explains resp, the solution to req. Stop reasons line up with resp.Route;
+// window reasons need resp.Schedule.
+func Route(req models.OptimizationRequest, resp models.OptimizationResponse) *models.Explanation {
+	ex := &models.Explanation{Constraints: []models.Reason{
+		because(FixedEndpoints, "The route starts at the request's start and ends at its end; only the waypoints are ordered."),
+	}}
+	meta := resp.Metadata
+	if meta.BudgetExhausted {
+		ex.Constraints = append(ex.Constraints, because(TimeBudget, "The solver ran out of time before finishing, so the route may be longer than it could be."))
+	}
+	if d := meta.Distances; d != nil {
+		if d.Fallback {
+			ex.Constraints = append(ex.Constraints, because(DistanceFallback, "%s could not be reached (%s), so the stops were ordered by straight-line distance.", d.Provider, d.FallbackReason))
+		} else {
+			ex.Constraints = append(ex.Constraints, because(DistanceSource, "Stops were ordered by %s road distances.", d.Provider))
+		}
+	}
+	if meta.Clusters > 0 {
+		ex.Constraints = append(ex.Constraints, because(Hierarchical, "The waypoints were split into %d clusters, each routed on its own and then joined, which can cost distance at the seams.", meta.Clusters))
+	}
+	if s := resp.Stability; s != nil {
+		switch {
+		case s.KeptPrevious && s.SavingPct <= 0:
+			ex.Constraints = append(ex.Constraints, because(PreviousRoute, "The previous route's order was kept, new stops inserted where they add the least distance: the solver found no shorter order."))
+		case s.KeptPrevious:
+			ex.Constraints = append(ex.Constraints, because(PreviousRoute, "The previous route's order was kept, new stops inserted where they add the least distance: the solved order was only %g%% shorter, within the %g%% threshold.", s.SavingPct, s.ThresholdPct))
+		default:
+			ex.Constraints = append(ex.Constraints, because(PreviousRoute, "The previous route's order was replaced: the solved order is %g%% shorter, beyond the %g%% threshold.", s.SavingPct, s.ThresholdPct))
+		}
+	}
+
+	if n := len(resp.Unassigned); n > 0 {
+		ex.Constraints = append(ex.Constraints, because(OutOfRange, "%d %s left out: with %s the route would be longer than the vehicle's range of %g km. Waypoints are left out by the least unserved penalty for the distance they save.", n, plural(n, "waypoint is", "waypoints are"), plural(n, "it", "them"), req.MaxRangeKm))
+	}
+	reloads := reloadPositions(resp.Trips)
+	if len(reloads) > 0 {
+		var demand float64
+		for _, t := range resp.Trips {
+			demand += t.LoadKg
+		}
+		ex.Constraints = append(ex.Constraints, because(Reloads, "The stops need %g kg and the vehicle carries %g kg, so it goes back to the start to reload %d %s, where that adds the least distance.", demand, req.VehicleCapacityKg, len(reloads), plural(len(reloads), "time", "times")))
+	}
+
+	windowed, late := 0, 0
+	for i, loc := range resp.Route {
+		stop := models.StopReasons{ID: loc.ID, Position: i}
+		switch {
+		case i == 0:
+			stop.Reasons = append(stop.Reasons, because(RouteStart, "The request's start."))
+		case i == len(resp.Route)-1:
+			stop.Reasons = append(stop.Reasons, because(RouteEnd, "The request's end."))
+		case reloads[i] > 0:
+			stop.Reasons = append(stop.Reasons, because(Reload, "Back at the start to reload for the next %d stops, taking %g minutes.", len(resp.Trips[reloads[i]].StopIDs), req.ReloadMinutes))
+		default:
+			prev, next := resp.Route[i-1], resp.Route[i+1]
+			extra := geo.HaversineKm(prev, loc) + geo.HaversineKm(loc, next) - geo.HaversineKm(prev, next)
+			stop.Reasons = append(stop.Reasons, because(Detour, "Visited between %s and %s, %.1f km out of the way of going straight from one to the other (straight-line distances).", name(prev, i-1), name(next, i+1), max(extra, 0)))
+		}
+		if len(loc.MergedIDs) > 0 {
+			stop.Reasons = append(stop.Reasons, because(Merged, "Stands in for duplicate stops %s at the same place.", strings.Join(loc.MergedIDs, ", ")))
+		}
+		if g := loc.Geocode; g != nil && !g.Reverse {
+			stop.Reasons = append(stop.Reasons, because(Geocoded, "Placed at the coordinates %s gave for its address, with confidence %.2f.", g.Provider, g.Confidence))
+		}
+		if loc.TimeWindow != nil && i < len(resp.Schedule) {
+			windowed++
+			eta := resp.Schedule[i]
+			switch {
+			case eta.LateMinutes > 0:
+				late++
+				stop.Reasons = append(stop.Reasons, because(MissesWindow, "Reached %.0f minutes after its window closes. %s", eta.LateMinutes, lateWhy(req, loc)))
+			case eta.WaitMinutes > 0:
+				stop.Reasons = append(stop.Reasons, because(WaitsForWindow, "Reached %.0f minutes before its window opens, and waits.", eta.WaitMinutes))
+			default:
+				stop.Reasons = append(stop.Reasons, because(InWindow, "Reached within its window."))
+			}
+		}
+		if i < len(resp.Schedule) {
+			switch eta := resp.Schedule[i]; {
+			case eta.Closed:
+				stop.Reasons = append(stop.Reasons, because(Closed, "Doesn't open within %d days of being reached, given its opening hours and holidays, so it can't be served on this route.", schedule.OpeningHorizonDays))
+			case loc.TimeWindow == nil && eta.WaitMinutes > 0:
+				stop.Reasons = append(stop.Reasons, because(WaitsForOpening, "Reached %.0f minutes before it opens, and waits.", eta.WaitMinutes))
+			}
+		}
+		ex.Stops = append(ex.Stops, stop)
+	}
+	if windowed > 0 {
+		how := "Stops were reordered to trade each tier's late penalty against distance."
+		if len(req.Waypoints) > priority.MaxReorderWaypoints {
+			how = fmt.Sprintf("With more than %d waypoints, stops are ordered by distance alone.", priority.MaxReorderWaypoints)
+		}
+		ex.Constraints = append(ex.Constraints, because(TimeWindows, "%d of %d stops with time windows are reached late. %s", late, windowed, how))
+	}
+	return ex
+}
+
+// reloadPositions maps the route positions of the reload stops between trips to the
+// trip each starts
+func reloadPositions(trips []models.Trip) map[int]int {
+	at := map[int]int{}
+	pos := 1
+	for t := 1; t < len(trips); t++ {
+		pos += len(trips[t-1].StopIDs)
+		at[pos] = t
+		pos++
+	}
+	return at
+}
+
+// lateWhy says why a late stop wasn't moved earlier
+func lateWhy(req models.OptimizationRequest, loc models.Location) string {
+	if len(req.Waypoints) > priority.MaxReorderWaypoints {
+		return "Routes this large are ordered by distance, not to meet windows."
+	}
+	tier := loc.Tier
+	if tier == "" {
+		tier = models.TierStandard
+	}
+	return fmt.Sprintf("Reaching it earlier would cost more in distance or other stops' lateness than its %s late penalty of %g a minute.",
+		tier, priority.Lookup(req.TierPenalties, tier).LatePerMinute)
+}
+
+// name is how stop reasons refer to the route location at position i
+func name(loc models.Location, i int) string {
+	if loc.ID != "" {
+		return loc.ID
+	}
+	return fmt.Sprintf("the stop at position %d", i)
+}
+
+// Load explains resp, the allocation for req, by replaying the allocation shipment by
+// shipment
+func Load(req models.LoadRequest, resp models.LoadResponse) *models.Explanation {
+	ex := &models.Explanation{Constraints: []models.Reason{}}
+	trace := solver.TraceFleetAllocation(req, resp.Metadata.Iterations)
+	steps, unplaced := trace.Steps, trace.Unplaced
+	if trace.ByTier {
+		ex.Constraints = append(ex.Constraints, because(PlacementOrder,
+			"Capacity was short, so shipments were placed highest tier first, heaviest first within a tier, which costs less in unserved penalty and vehicles used, as the request weighs them, than placing them by weight alone."))
+	} else {
+		ex.Constraints = append(ex.Constraints, because(PlacementOrder, "Shipments were placed heaviest first, which packs the vehicles tightest."))
+	}
+
+	var unassignedKg float64
+	for _, step := range steps {
+		s := step.Shipment
+		sr := models.ShipmentReasons{ShipmentID: s.ID}
+		switch {
+		case step.Vehicle >= 0:
+			v := req.Vehicles[step.Vehicle]
+			sr.VehicleID = v.ID
+			if c := step.Compartment; c >= 0 {
+				comp := v.Compartments[c]
+				sr.Reasons = append(sr.Reasons, because(CapacityFit, "%s kg fits in the %s compartment of %s, which had %s kg free within its %s kg and the vehicle's %s kg.", kg(s.WeightKg), comp.Name, v.ID, kg(step.FreeKg), kg(comp.CapacityKg), kg(v.CapacityKg)))
+			} else {
+				sr.Reasons = append(sr.Reasons, because(CapacityFit, "%s kg fits in %s, which had %s kg of its %s kg capacity free.", kg(s.WeightKg), v.ID, kg(step.FreeKg), kg(v.CapacityKg)))
+			}
+			switch {
+			case step.Fits == 1:
+				sr.Reasons = append(sr.Reasons, because(OnlyFit, "%s was the only vehicle with room for it when its turn came.", v.ID))
+			case step.Group == solver.GroupedNear:
+				sr.Reasons = append(sr.Reasons, because(NearDestinations, "Its destination is %.1f km from the centre of the shipments already on %s, the nearest of the %d vehicles with room.", step.AreaKm, v.ID, step.Fits))
+			case step.Group == solver.GroupedNew:
+				sr.Reasons = append(sr.Reasons, because(NewArea, "No vehicle with room was carrying shipments within %g km of its destination, so it starts a new area on %s, of the vehicles carrying none the one left with the least to spare (%s kg).", groupRadiusKm(req), v.ID, kg(step.FreeKg-s.WeightKg)))
+			case step.Group == solver.GroupedNearest:
+				sr.Reasons = append(sr.Reasons, because(NearestArea, "No vehicle with room was carrying shipments within %g km of its destination, and none with room was free of them, so it joins the nearest, on %s, %.1f km away.", groupRadiusKm(req), v.ID, step.AreaKm))
+			default:
+				sr.Reasons = append(sr.Reasons, because(BestFit, "Of the %d vehicles with room, %s is left with the least to spare (%s kg), keeping larger gaps for the shipments after it.", step.Fits, v.ID, kg(step.FreeKg-s.WeightKg)))
+			}
+		case !slices.ContainsFunc(req.Vehicles, func(v models.VehicleInfo) bool { return solver.InRange(v, s) }):
+			unassignedKg += s.WeightKg
+			sr.Reasons = append(sr.Reasons, because(OutOfRange, "Its destination is farther from every vehicle's depot than the vehicle's max_range_km allows there and back."))
+		case !slices.ContainsFunc(req.Vehicles, func(v models.VehicleInfo) bool { return solver.InRange(v, s) && hasCompartment(v, s) }):
+			unassignedKg += s.WeightKg
+			sr.Reasons = append(sr.Reasons, because(NoCompartment, "It needs a %s compartment, and no vehicle in range has one.", s.Compartment))
+		case s.WeightKg > maxFreeKg(req.Vehicles, s):
+			unassignedKg += s.WeightKg
+			sr.Reasons = append(sr.Reasons, because(TooHeavy, "%s kg is more than any vehicle can take; the most free capacity was %s kg.", kg(s.WeightKg), kg(maxFreeKg(req.Vehicles, s))))
+		default:
+			unassignedKg += s.WeightKg
+			sr.Reasons = append(sr.Reasons, because(NoRoomLeft, "A vehicle could have taken %s kg, but the shipments placed before it left at most %s kg free.", kg(s.WeightKg), kg(step.MostFreeKg)))
+		}
+		ex.Shipments = append(ex.Shipments, sr)
+	}
+	for _, s := range unplaced {
+		unassignedKg += s.WeightKg
+		ex.Shipments = append(ex.Shipments, models.ShipmentReasons{ShipmentID: s.ID, Reasons: []models.Reason{because(TimeBudget, "The time budget ran out before this shipment's turn.")}})
+	}
+
+	if resp.Metadata.BudgetExhausted {
+		ex.Constraints = append(ex.Constraints, because(TimeBudget, "The solver ran out of time with %d shipments still to place.", len(unplaced)))
+	}
+	var full []string
+	for _, a := range resp.Allocations {
+		if a.UtilizationPct >= fullPct {
+			full = append(full, a.VehicleID)
+		}
+	}
+	if len(full) > 0 {
+		ex.Constraints = append(ex.Constraints, because(FullVehicles, "Capacity limited the allocation: %s %s at least %d%% full.", strings.Join(full, ", "), plural(len(full), "is", "are"), fullPct))
+	}
+	if n := len(resp.Unassigned); n > 0 {
+		ex.Constraints = append(ex.Constraints, because(Unassigned, "%d %s (%s kg) could not be placed.", n, plural(n, "shipment", "shipments"), kg(unassignedKg)))
+	}
+	if unused := len(req.Vehicles) - len(resp.Allocations); unused > 0 && len(resp.Unassigned) == 0 {
+		ex.Constraints = append(ex.Constraints, because(UnusedVehicles, "Every shipment fit without %d of the vehicles.", unused))
+	}
+	return ex
+}
+
+// groupRadiusKm is the radius req groups shipments by destination within
+func groupRadiusKm(req models.LoadRequest) float64 {
+	return cmp.Or(req.GroupRadiusKm, solver.DefaultGroupRadiusKm)
+}
+
+// maxFreeKg is the most any single vehicle of the fleet could take of s, in the
+// compartment it needs
+func maxFreeKg(vehicles []models.VehicleInfo, s models.ShipmentInfo) float64 {
+	var most float64
+	for _, v := range vehicles {
+		if len(v.Compartments) == 0 {
+			most = max(most, v.CapacityKg-v.CurrentLoad)
+			continue
+		}
+		for _, c := range v.Compartments {
+			if s.Compartment == "" || c.Name == s.Compartment {
+				most = max(most, min(v.CapacityKg-v.CurrentLoad, c.CapacityKg-c.CurrentLoad))
+			}
+		}
+	}
+	return most
+}
+
+// hasCompartment reports whether v has a compartment s can go in
+func hasCompartment(v models.VehicleInfo, s models.ShipmentInfo) bool {
+	if len(v.Compartments) == 0 {
+		return s.Compartment == ""
+	}
+	return s.Compartment == "" || slices.ContainsFunc(v.Compartments, func(c models.Compartment) bool { return c.Name == s.Compartment })
+}
+
+func because(code, format string, args ...any) models.Reason {
+	return models.Reason{Code: code, Detail: fmt.Sprintf(format, args...)}
+}
+
+// kg formats a weight to at most two decimals
+func kg(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,46 @@
+// Package feature decides whether optional behaviour is on for a request, so new
+// solvers and constraints can be rolled out to chosen tenants or a share of traffic.
+package feature
+
+import (
+	"hash/fnv"
+	"slices"
+)
+
+// Flag turns a feature on for everyone, for listed tenants, or for a percentage of requests
+type Flag struct {
+	Enabled bool     `json:"enabled"`
+	Tenants []string `json:"tenants,omitempty"`
+	Percent float64  `json:"percent,omitempty"` // 0-100
+}
+
+// Set holds flags by name. It must not be modified once in use.
+type Set map[string]Flag
+
+// Enabled reports whether the named feature is on for tenant. Percentage rollout
+// buckets on key (normally the request ID), so the same key always gets the same answer.
+func (s Set) Enabled(name, tenant, key string) bool {
+	f, ok := s[name]
+	return ok && f.On(name, tenant, key)
+}
+
+// On reports whether f is on for tenant and key; name salts the percentage bucket
+func (f Flag) On(name, tenant, key string) bool {
+	if f.Enabled || slices.Contains(f.Tenants, tenant) {
+		return true
+	}
+	if f.Percent <= 0 {
+		return false
+	}
+	return bucket(name, key) < f.Percent
+}
+
+// bucket maps name and key to [0, 100); hashing the name too keeps rollouts of
+// different features from hitting the same requests
+func bucket(name, key string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return float64(h.Sum64()%10000) / 100
+}
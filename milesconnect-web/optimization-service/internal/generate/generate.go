@@ -0,0 +1,150 @@
+// Package generate builds seeded random problems for demos, load tests and solver
+// benchmarks. Stops gather in clusters around a depot the way deliveries gather in
+// neighbourhoods, with a few scattered across the service area; fleets mix vehicle
+// sizes and shipment weights are skewed towards small parcels. The same Params always
+// give the same problem.
+//
+// No solver supports time windows yet, so none are generated.
+package generate
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"milesconnect-optimization/internal/models"
+)
+
+// Params describe the problem to generate
+type Params struct {
+	Seed      int64
+	Center    models.Location // the depot, in the middle of the service area
+	RadiusKm  float64         // stops fall within about this distance of Center
+	Clusters  int             // neighbourhoods stops gather in; 0 spreads them uniformly
+	Stops     int
+	Vehicles  int
+	Shipments int
+}
+
+// DefaultParams are a day of city deliveries out of a depot in New Delhi
+func DefaultParams() Params {
+	return Params{
+		Center:    models.Location{Lat: 28.6139, Lng: 77.2090},
+		RadiusKm:  30,
+		Clusters:  5,
+		Stops:     100,
+		Vehicles:  5,
+		Shipments: 50,
+	}
+}
+
+// scatteredShare of stops fall anywhere in the service area instead of in a cluster
+const scatteredShare = 0.1
+
+// Route generates a round trip from Center through p.Stops waypoints
+func Route(p Params) models.OptimizationRequest {
+	rng := rand.New(rand.NewSource(p.Seed))
+	depot := models.Location{ID: "depot", Lat: round(p.Center.Lat), Lng: round(p.Center.Lng)}
+
+	type cluster struct {
+		center  models.Location
+		sigmaKm float64
+	}
+	clusters := make([]cluster, p.Clusters)
+	weights := make([]float64, p.Clusters)
+	var total float64
+	for i := range clusters {
+		// Clusters differ in size and density; sparse ones spread wider
+		clusters[i] = cluster{
+			center:  inDisk(rng, p.Center, 0.8*p.RadiusKm),
+			sigmaKm: p.RadiusKm / (2 * math.Sqrt(float64(p.Clusters))) * (0.5 + rng.Float64()),
+		}
+		weights[i] = 0.3 + rng.ExpFloat64()
+		total += weights[i]
+	}
+
+	req := models.OptimizationRequest{Start: depot, End: depot, Waypoints: make([]models.Location, p.Stops)}
+	for i := range req.Waypoints {
+		var loc models.Location
+		if len(clusters) == 0 || rng.Float64() < scatteredShare {
+			loc = inDisk(rng, p.Center, p.RadiusKm)
+		} else {
+			c := clusters[pick(rng, weights, total)]
+			loc = offset(c.center, rng.NormFloat64()*c.sigmaKm, rng.NormFloat64()*c.sigmaKm)
+		}
+		req.Waypoints[i] = models.Location{ID: fmt.Sprintf("stop-%d", i+1), Lat: round(loc.Lat), Lng: round(loc.Lng)}
+	}
+	return req
+}
+
+// vehicleTypes are the fleet's vehicle sizes and how common each is
+var vehicleTypes = []struct {
+	capacityKg, share float64
+}{
+	{1000, 0.4},  // van
+	{3500, 0.3},  // light truck
+	{7500, 0.2},  // medium truck
+	{16000, 0.1}, // heavy truck
+}
+
+// Load generates a fleet of p.Vehicles, some already part loaded, and p.Shipments
+// shipments. Weights have a median of 120 kg and a long tail, capped at the largest
+// vehicle's capacity.
+func Load(p Params) models.LoadRequest {
+	rng := rand.New(rand.NewSource(p.Seed))
+	shares := make([]float64, len(vehicleTypes))
+	for i, t := range vehicleTypes {
+		shares[i] = t.share
+	}
+
+	req := models.LoadRequest{Vehicles: make([]models.VehicleInfo, p.Vehicles), Shipments: make([]models.ShipmentInfo, p.Shipments)}
+	var maxCapacity float64
+	for i := range req.Vehicles {
+		capacity := vehicleTypes[pick(rng, shares, 1)].capacityKg
+		v := models.VehicleInfo{ID: fmt.Sprintf("vehicle-%d", i+1), CapacityKg: capacity}
+		if rng.Float64() < 0.3 {
+			v.CurrentLoad = math.Round(capacity * 0.25 * rng.Float64())
+		}
+		req.Vehicles[i] = v
+		maxCapacity = math.Max(maxCapacity, capacity)
+	}
+	for i := range req.Shipments {
+		weight := math.Round(120*math.Exp(0.9*rng.NormFloat64())*10) / 10
+		req.Shipments[i] = models.ShipmentInfo{ID: fmt.Sprintf("shipment-%d", i+1), WeightKg: math.Min(math.Max(weight, 1), maxCapacity)}
+	}
+	return req
+}
+
+// pick returns an index drawn in proportion to weights, which sum to total
+func pick(rng *rand.Rand, weights []float64, total float64) int {
+	r := rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	return len(weights) - 1
+}
+
+// inDisk is a uniformly random point within radiusKm of center
+func inDisk(rng *rand.Rand, center models.Location, radiusKm float64) models.Location {
+	r := radiusKm * math.Sqrt(rng.Float64())
+	theta := 2 * math.Pi * rng.Float64()
+	return offset(center, r*math.Cos(theta), r*math.Sin(theta))
+}
+
+// kmPerDegree is the length of a degree of latitude
+const kmPerDegree = 111.32
+
+// offset moves loc northKm and eastKm, on a flat approximation good for city-sized areas
+func offset(loc models.Location, northKm, eastKm float64) models.Location {
+	lat := math.Max(-89.9, math.Min(89.9, loc.Lat+northKm/kmPerDegree))
+	lng := loc.Lng + eastKm/(kmPerDegree*math.Cos(loc.Lat*math.Pi/180))
+	lng = math.Mod(lng+540, 360) - 180
+	return models.Location{Lat: lat, Lng: lng}
+}
+
+// round keeps six decimal places, about 10 cm, so generated JSON stays compact
+func round(f float64) float64 {
+	return math.Round(f*1e6) / 1e6
+}
@@ -0,0 +1,116 @@
+package geo
+
+import (
+	"math"
+	"milesconnect-optimization/internal/models"
+)
+
+// EarthRadiusKm is the mean Earth radius used for great-circle distances
+const EarthRadiusKm = 6371
+
+// HaversineKm calculates the great-circle distance between two points in km. It works
+// from the coordinates directly, without the per-point terms Prepare computes for
+// repeated queries, and agrees with Prepared.Km to rounding.
+func HaversineKm(p1, p2 models.Location) float64 {
+	lat1, lat2 := p1.Lat*(math.Pi/180.0), p2.Lat*(math.Pi/180.0)
+	sinLat := math.Sin((lat2 - lat1) / 2)
+	sinLon := math.Sin((p2.Lng - p1.Lng) * (math.Pi / 180.0) / 2)
+	a := sinLat*sinLat + sinLon*sinLon*math.Cos(lat1)*math.Cos(lat2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return EarthRadiusKm * c
+}
+
+// radians is a point in radians with the parts of the haversine formula that depend on
+// one point only: the cosine of its latitude, and the sines and cosines of half its
+// latitude and longitude, which give the sines of half the differences to any other
+// point without calling math.Sin per pair
+type radians struct {
+	lat, lng, cosLat       float64
+	sinHalfLat, cosHalfLat float64
+	sinHalfLng, cosHalfLng float64
+}
+
+func toRadians(p models.Location) radians {
+	lat, lng := p.Lat*(math.Pi/180.0), p.Lng*(math.Pi/180.0)
+	r := radians{lat: lat, lng: lng, cosLat: math.Cos(lat)}
+	r.sinHalfLat, r.cosHalfLat = math.Sincos(lat / 2)
+	r.sinHalfLng, r.cosHalfLng = math.Sincos(lng / 2)
+	return r
+}
+
+func haversine(p1, p2 radians) float64 {
+	// sin((b-a)/2) = sin(b/2)cos(a/2) - cos(b/2)sin(a/2)
+	sinLat := p2.sinHalfLat*p1.cosHalfLat - p2.cosHalfLat*p1.sinHalfLat
+	sinLon := p2.sinHalfLng*p1.cosHalfLng - p2.cosHalfLng*p1.sinHalfLng
+	a := sinLat*sinLat + sinLon*sinLon*p1.cosLat*p2.cosLat
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return EarthRadiusKm * c
+}
+
+// Prepared holds points converted once for repeated great-circle distance queries
+type Prepared []radians
+
+// Prepare converts points for Prepared.Km
+func Prepare(points []models.Location) Prepared {
+	p := make(Prepared, len(points))
+	for i, pt := range points {
+		p[i] = toRadians(pt)
+	}
+	return p
+}
+
+// Set replaces point i with loc
+func (p Prepared) Set(i int, loc models.Location) {
+	p[i] = toRadians(loc)
+}
+
+// Km is the great-circle distance between points i and j
+func (p Prepared) Km(i, j int) float64 {
+	return haversine(p[i], p[j])
+}
+
+// KmFrom sets out[j] to the great-circle distance from point i to targets[j], a slice
+// of p or of other prepared points, in one pass with the source loaded once; the
+// distances are those Km gives. out must be at least as long as targets.
+func (p Prepared) KmFrom(i int, targets Prepared, out []float64) {
+	from := p[i]
+	out = out[:len(targets)]
+	for j := range targets {
+		out[j] = haversine(from, targets[j])
+	}
+}
+
+// TurnDeg is the heading change at point m on the way from point a through m to point b,
+// from 0 driving straight on to 180 turning back the way it came; 0 when a or b is at m
+func (p Prepared) TurnDeg(a, m, b int) float64 {
+	if p[a] == p[m] || p[b] == p[m] {
+		return 0
+	}
+	// The angle between the legs as seen from m, which reversing the path leaves alone
+	diff := math.Abs(bearing(p[m], p[a]) - bearing(p[m], p[b]))
+	if diff > math.Pi {
+		diff = 2*math.Pi - diff
+	}
+	return 180 - diff*(180/math.Pi)
+}
+
+// bearing is the initial great-circle bearing from p1 to p2 in radians, clockwise from north
+func bearing(p1, p2 radians) float64 {
+	dLng := p2.lng - p1.lng
+	y := math.Sin(dLng) * p2.cosLat
+	x := p1.cosLat*math.Sin(p2.lat) - math.Sin(p1.lat)*p2.cosLat*math.Cos(dLng)
+	return math.Atan2(y, x)
+}
+
+// RouteKm is the length of the path start -> waypoints (in order) -> end
+func RouteKm(start models.Location, waypoints []models.Location, end models.Location) float64 {
+	dist := 0.0
+	current := start
+	for _, wp := range waypoints {
+		dist += HaversineKm(current, wp)
+		current = wp
+	}
+	return dist + HaversineKm(current, end)
+}
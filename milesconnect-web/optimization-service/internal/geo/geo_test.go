@@ -0,0 +1,92 @@
+package geo
+
+import (
+	"math"
+	"milesconnect-optimization/internal/models"
+	"testing"
+)
+
+// referenceKm is the haversine formula as first written, with a sine per pair
+func referenceKm(p1, p2 models.Location) float64 {
+	lat1, lat2 := p1.Lat*math.Pi/180, p2.Lat*math.Pi/180
+	sinLat := math.Sin((lat2 - lat1) / 2)
+	sinLon := math.Sin((p2.Lng - p1.Lng) * math.Pi / 180 / 2)
+	a := sinLat*sinLat + sinLon*sinLon*math.Cos(lat1)*math.Cos(lat2)
+	return EarthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func TestDistancesMatchReference(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []models.Location
+		km     float64 // from the first point to the second, when set
+	}{
+		{"delhi-mumbai", []models.Location{{Lat: 28.6139, Lng: 77.2090}, {Lat: 19.0760, Lng: 72.8777}}, 1148.09},
+		{"same point", []models.Location{{Lat: 12.97, Lng: 77.59}, {Lat: 12.97, Lng: 77.59}}, 0},
+		{"antimeridian", []models.Location{{Lat: 10, Lng: 179.9}, {Lat: 10, Lng: -179.9}}, 21.90},
+		{"poles", []models.Location{{Lat: 90, Lng: 0}, {Lat: -90, Lng: 0}}, math.Pi * EarthRadiusKm},
+		{"random", randomPoints(5, 60, 40), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.km != 0 || tt.name == "same point" {
+				if got := HaversineKm(tt.points[0], tt.points[1]); math.Abs(got-tt.km) > 0.01 {
+					t.Errorf("HaversineKm = %.4f, want %.2f", got, tt.km)
+				}
+			}
+			p := Prepare(tt.points)
+			row := make([]float64, len(p))
+			for i, a := range tt.points {
+				p.KmFrom(i, p, row)
+				for j, b := range tt.points {
+					want := referenceKm(a, b)
+					for _, got := range []struct {
+						how string
+						km  float64
+					}{{"HaversineKm", HaversineKm(a, b)}, {"Km", p.Km(i, j)}, {"KmFrom", row[j]}} {
+						if math.Abs(got.km-want) > 1e-9*max(want, 1) {
+							t.Fatalf("%s(%d, %d) = %.12f, reference %.12f", got.how, i, j, got.km, want)
+						}
+					}
+					if row[j] != p.Km(i, j) {
+						t.Fatalf("KmFrom(%d)[%d] = %v, Km = %v", i, j, row[j], p.Km(i, j))
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkKm(b *testing.B) {
+	p := Prepare(randomPoints(6, 1000, 2))
+	row := make([]float64, len(p))
+	for b.Loop() {
+		for i := range p {
+			for j := range p {
+				row[j] = p.Km(i, j)
+			}
+		}
+	}
+}
+
+func BenchmarkKmFrom(b *testing.B) {
+	p := Prepare(randomPoints(6, 1000, 2))
+	row := make([]float64, len(p))
+	for b.Loop() {
+		for i := range p {
+			p.KmFrom(i, p, row)
+		}
+	}
+}
+
+func BenchmarkHaversineKm(b *testing.B) {
+	points := randomPoints(6, 1000, 2)
+	row := make([]float64, len(points))
+	for b.Loop() {
+		for _, a := range points {
+			for j, c := range points {
+				row[j] = HaversineKm(a, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package geo
+
+import (
+	"math"
+	"milesconnect-optimization/internal/models"
+	"sort"
+)
+
+// Index is a k-d tree over points for nearest-neighbor queries by great-circle
+// distance, from which found points can be removed. Points are placed on the unit
+// sphere, where the straight-line distance orders pairs as the great-circle one does.
+//
+// The tree is implicit: the subtree over order[lo:hi] has its root at the middle
+// position, split on axis depth%3.
+type Index struct {
+	xyz   [][3]float64
+	order []int // point indices in tree order
+	pos   []int // position of each point in order
+	live  []int // live points in the subtree rooted at each position
+	gone  []bool
+}
+
+// NewIndex builds an index over points in O(n log² n)
+func NewIndex(points []models.Location) *Index {
+	n := len(points)
+	ix := &Index{
+		xyz:   make([][3]float64, n),
+		order: make([]int, n),
+		pos:   make([]int, n),
+		live:  make([]int, n),
+		gone:  make([]bool, n),
+	}
+	for i, p := range points {
+		ix.xyz[i] = unitVector(p)
+		ix.order[i] = i
+	}
+	ix.build(0, n, 0)
+	for at, i := range ix.order {
+		ix.pos[i] = at
+	}
+	return ix
+}
+
+func unitVector(p models.Location) [3]float64 {
+	lat, lng := p.Lat*math.Pi/180, p.Lng*math.Pi/180
+	return [3]float64{math.Cos(lat) * math.Cos(lng), math.Cos(lat) * math.Sin(lng), math.Sin(lat)}
+}
+
+func (ix *Index) build(lo, hi, depth int) {
+	if lo >= hi {
+		return
+	}
+	axis := depth % 3
+	sub := ix.order[lo:hi]
+	sort.Slice(sub, func(a, b int) bool { return ix.xyz[sub[a]][axis] < ix.xyz[sub[b]][axis] })
+	mid := (lo + hi) / 2
+	ix.live[mid] = hi - lo
+	ix.build(lo, mid, depth+1)
+	ix.build(mid+1, hi, depth+1)
+}
+
+// Remove takes point i out of later queries
+func (ix *Index) Remove(i int) {
+	if ix.gone[i] {
+		return
+	}
+	ix.gone[i] = true
+	target := ix.pos[i]
+	for lo, hi := 0, len(ix.order); lo < hi; {
+		mid := (lo + hi) / 2
+		ix.live[mid]--
+		switch {
+		case target == mid:
+			return
+		case target < mid:
+			hi = mid
+		default:
+			lo = mid + 1
+		}
+	}
+}
+
+// Nearest returns the remaining point closest to p, the lowest index among equally
+// close ones, or -1 when none remain
+func (ix *Index) Nearest(p models.Location) int {
+	s := search{ix: ix, q: unitVector(p), best: -1, bestDist: math.Inf(1)}
+	s.visit(0, len(ix.order), 0)
+	return s.best
+}
+
+type search struct {
+	ix       *Index
+	q        [3]float64
+	best     int
+	bestDist float64 // squared chord length to best
+}
+
+func (s *search) visit(lo, hi, depth int) {
+	if lo >= hi {
+		return
+	}
+	mid := (lo + hi) / 2
+	if s.ix.live[mid] == 0 {
+		return
+	}
+	i := s.ix.order[mid]
+	if !s.ix.gone[i] {
+		v := s.ix.xyz[i]
+		dx, dy, dz := v[0]-s.q[0], v[1]-s.q[1], v[2]-s.q[2]
+		if d := dx*dx + dy*dy + dz*dz; d < s.bestDist || (d == s.bestDist && i < s.best) {
+			s.best, s.bestDist = i, d
+		}
+	}
+	axis := depth % 3
+	diff := s.q[axis] - s.ix.xyz[i][axis]
+	near, far := [2]int{lo, mid}, [2]int{mid + 1, hi}
+	if diff > 0 {
+		near, far = far, near
+	}
+	s.visit(near[0], near[1], depth+1)
+	// Equal distances are still searched so ties go to the lowest index
+	if diff*diff <= s.bestDist {
+		s.visit(far[0], far[1], depth+1)
+	}
+}
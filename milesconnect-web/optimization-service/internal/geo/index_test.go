@@ -0,0 +1,91 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"milesconnect-optimization/internal/models"
+	"testing"
+)
+
+// nearestLinear is Index.Nearest by a scan over every remaining point
+func nearestLinear(points []models.Location, gone []bool, p models.Location) int {
+	q := unitVector(p)
+	best, bestDist := -1, math.Inf(1)
+	for i, pt := range points {
+		if gone[i] {
+			continue
+		}
+		v := unitVector(pt)
+		dx, dy, dz := v[0]-q[0], v[1]-q[1], v[2]-q[2]
+		if d := dx*dx + dy*dy + dz*dz; d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+func randomPoints(seed int64, n int, spreadDeg float64) []models.Location {
+	rng := rand.New(rand.NewSource(seed))
+	points := make([]models.Location, n)
+	for i := range points {
+		points[i] = models.Location{Lat: 28.6 + (rng.Float64()-0.5)*spreadDeg, Lng: 77.2 + (rng.Float64()-0.5)*spreadDeg}
+	}
+	return points
+}
+
+func TestIndexMatchesLinearScan(t *testing.T) {
+	grid := make([]models.Location, 0, 49)
+	for i := range 7 {
+		for j := range 7 {
+			grid = append(grid, models.Location{Lat: float64(i), Lng: float64(j)})
+		}
+	}
+	dupes := randomPoints(2, 40, 1)
+	dupes = append(dupes, dupes...) // every point twice: ties need the lower index
+
+	tests := []struct {
+		name   string
+		points []models.Location
+	}{
+		{"empty", nil},
+		{"one", []models.Location{{Lat: 1, Lng: 2}}},
+		{"random", randomPoints(1, 500, 2)},
+		{"global", randomPoints(3, 300, 170)},
+		{"duplicates", dupes},
+		{"grid", grid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ix := NewIndex(tt.points)
+			gone := make([]bool, len(tt.points))
+			queries := append(randomPoints(4, 50, 3), tt.points...)
+			for q := range queries {
+				// Query from grid corners and between points too, then remove the answer
+				p := queries[q]
+				got, want := ix.Nearest(p), nearestLinear(tt.points, gone, p)
+				if got != want {
+					t.Fatalf("query %d at %v: Nearest = %d, linear scan = %d", q, p, got, want)
+				}
+				if got >= 0 && q%2 == 0 {
+					ix.Remove(got)
+					ix.Remove(got) // removing twice changes nothing
+					gone[got] = true
+				}
+			}
+			for range tt.points {
+				got := ix.Nearest(models.Location{})
+				if want := nearestLinear(tt.points, gone, models.Location{}); got != want {
+					t.Fatalf("draining: Nearest = %d, linear scan = %d", got, want)
+				}
+				if got < 0 {
+					return
+				}
+				ix.Remove(got)
+				gone[got] = true
+			}
+			if got := ix.Nearest(models.Location{}); got != -1 {
+				t.Fatalf("Nearest with every point removed = %d, want -1", got)
+			}
+		})
+	}
+}
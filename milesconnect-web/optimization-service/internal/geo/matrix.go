@@ -0,0 +1,110 @@
+package geo
+
+import (
+	"milesconnect-optimization/internal/bufpool"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/parallel"
+)
+
+// Matrix holds pairwise distances in km; Matrix[i][j] is the distance from point i to point j
+type Matrix [][]float64
+
+// matrixRows is the fewest rows worth computing on a goroutine of their own
+const matrixRows = 64
+
+// MatrixMaxPoints bounds the great-circle matrices GreatCircle precomputes; one over
+// 2,000 points takes 32MB
+const MatrixMaxPoints = 2000
+
+// HaversineMatrix computes the great-circle distance matrix for points, spreading the
+// rows of large matrices across CPUs
+func HaversineMatrix(points []models.Location) Matrix {
+	m := make(Matrix, len(points))
+	prepared := Prepare(points)
+	parallel.Do(parallel.Split(len(points), matrixRows), func(_ int, rows parallel.Range) {
+		for i := rows.Lo; i < rows.Hi; i++ {
+			m[i] = make([]float64, len(points))
+			prepared.KmFrom(i, prepared, m[i])
+			m[i][i] = 0
+		}
+	})
+	return m
+}
+
+// matrixBuffers recycles the matrices of GreatCircle
+var matrixBuffers bufpool.Pool[float64]
+
+// Distances are the great-circle distances between a fixed set of points
+type Distances struct {
+	n        int
+	matrix   []float64 // row-major; nil when computed on each call
+	prepared Prepared
+}
+
+// GreatCircle prepares the distances between points for solvers that look up the same
+// pairs many times. Up to MatrixMaxPoints they are computed once into a pooled matrix;
+// call Release when done with them.
+func GreatCircle(points []models.Location) *Distances {
+	d := &Distances{n: len(points), prepared: Prepare(points)}
+	if d.n > MatrixMaxPoints {
+		return d
+	}
+	d.matrix = matrixBuffers.Get(d.n * d.n)
+	parallel.Do(parallel.Split(d.n, matrixRows), func(_ int, rows parallel.Range) {
+		for i := rows.Lo; i < rows.Hi; i++ {
+			row := d.matrix[i*d.n : (i+1)*d.n]
+			d.prepared.KmFrom(i, d.prepared, row)
+			row[i] = 0
+		}
+	})
+	return d
+}
+
+// Km is the distance between points i and j
+func (d *Distances) Km(i, j int) float64 {
+	if d.matrix != nil {
+		return d.matrix[i*d.n+j]
+	}
+	return d.prepared.Km(i, j)
+}
+
+// Release hands the matrix back for reuse by later solves; d must not be used after
+func (d *Distances) Release() {
+	matrixBuffers.Put(d.matrix)
+	d.matrix = nil
+}
+
+// RequestPoints lists the points of a routing request in matrix order:
+// start, then the waypoints, then end
+func RequestPoints(req models.OptimizationRequest) []models.Location {
+	points := make([]models.Location, 0, len(req.Waypoints)+2)
+	points = append(points, req.Start)
+	points = append(points, req.Waypoints...)
+	return append(points, req.End)
+}
+
+// RouteIndices maps route, a permutation of points with the start first and the end
+// last, back to point indices. Identical copies of a stop are interchangeable.
+func RouteIndices(points, route []models.Location) ([]int, bool) {
+	type pointKey struct {
+		id       string
+		lat, lng float64
+	}
+	key := func(l models.Location) pointKey { return pointKey{l.ID, l.Lat, l.Lng} }
+	free := make(map[pointKey][]int, len(points))
+	for p := 1; p < len(points)-1; p++ {
+		k := key(points[p])
+		free[k] = append(free[k], p)
+	}
+	index := make([]int, len(route))
+	index[len(route)-1] = len(points) - 1
+	for i := 1; i < len(route)-1; i++ {
+		k := key(route[i])
+		ps := free[k]
+		if len(ps) == 0 {
+			return nil, false
+		}
+		index[i], free[k] = ps[0], ps[1:]
+	}
+	return index, true
+}
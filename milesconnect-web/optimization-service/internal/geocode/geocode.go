@@ -0,0 +1,177 @@
+// Package geocode resolves street addresses to coordinates, and coordinates back to
+// addresses, through an external provider, so /optimize stops can be given by address
+// and routes can be shown with them.
+package geocode
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"milesconnect-optimization/internal/cache"
+	"milesconnect-optimization/internal/metrics"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/retry"
+)
+
+// Match is the provider's best match for an address
+type Match struct {
+	Lat, Lng   float64
+	Confidence float64 // 0 to 1, from the provider's own quality signals
+	Formatted  string  // the address as the provider knows it
+}
+
+// ErrNotFound is returned for addresses, or points, the provider has no match for
+var ErrNotFound = errors.New("no match for address")
+
+// Provider looks up a single address, or the address at a point. Lookups without a
+// match fail with ErrNotFound.
+type Provider interface {
+	Name() string
+	Geocode(ctx context.Context, address string) (Match, error)
+	Reverse(ctx context.Context, lat, lng float64) (Match, error)
+}
+
+// Geocoder calls Provider with retries, at most RPS lookups a second across all
+// requests, and remembers matches in Cache
+type Geocoder struct {
+	Provider    Provider
+	Retry       retry.Policy
+	Timeout     time.Duration // per-attempt limit on top of the caller's deadline; 0 means none
+	RPS         float64       // 0 means unlimited
+	Concurrency int           // lookups one Resolve call runs at once
+	Cache       *cache.Cache  // matches by normalised address and by point; nil disables caching
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next lookup under RPS
+}
+
+// Geocode returns the match for address
+func (g *Geocoder) Geocode(ctx context.Context, address string) (Match, error) {
+	key := "address:" + strings.ToLower(strings.Join(strings.Fields(address), " "))
+	return g.lookup(ctx, key, func(ctx context.Context) (Match, error) {
+		return g.Provider.Geocode(ctx, address)
+	})
+}
+
+// Reverse returns the address at lat, lng
+func (g *Geocoder) Reverse(ctx context.Context, lat, lng float64) (Match, error) {
+	key := "point:" + strconv.FormatFloat(lat, 'f', 6, 64) + "," + strconv.FormatFloat(lng, 'f', 6, 64)
+	return g.lookup(ctx, key, func(ctx context.Context) (Match, error) {
+		return g.Provider.Reverse(ctx, lat, lng)
+	})
+}
+
+func (g *Geocoder) lookup(ctx context.Context, key string, call func(ctx context.Context) (Match, error)) (Match, error) {
+	if g.Cache != nil {
+		if m, ok := g.Cache.Get(key); ok {
+			metrics.GeocodingCalls.Inc(g.Provider.Name(), "cached")
+			return m.(Match), nil
+		}
+	}
+
+	var m Match
+	attempt := 0
+	err := g.Retry.Do(ctx, func(ctx context.Context) error {
+		if attempt++; attempt > 1 {
+			metrics.GeocodingRetries.Inc(g.Provider.Name())
+		}
+		if err := g.wait(ctx); err != nil {
+			return retry.Permanent(err)
+		}
+		if g.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+			defer cancel()
+		}
+		var err error
+		m, err = call(ctx)
+		return err
+	})
+	switch {
+	case err == nil:
+		metrics.GeocodingCalls.Inc(g.Provider.Name(), "ok")
+		if g.Cache != nil {
+			g.Cache.Put(key, m)
+		}
+	case errors.Is(err, ErrNotFound):
+		metrics.GeocodingCalls.Inc(g.Provider.Name(), "not_found")
+	default:
+		metrics.GeocodingCalls.Inc(g.Provider.Name(), "error")
+	}
+	return m, err
+}
+
+// Resolve geocodes every address, up to Concurrency at a time. errs[i] is set for
+// addresses that failed; the first error other than ErrNotFound stops the lookups
+// not yet started.
+func (g *Geocoder) Resolve(ctx context.Context, addresses []string) (matches []Match, errs []error) {
+	return g.each(ctx, len(addresses), func(ctx context.Context, i int) (Match, error) {
+		return g.Geocode(ctx, addresses[i])
+	})
+}
+
+// ResolveReverse looks up the address at every point, as Resolve does for addresses
+func (g *Geocoder) ResolveReverse(ctx context.Context, points []models.Location) (matches []Match, errs []error) {
+	return g.each(ctx, len(points), func(ctx context.Context, i int) (Match, error) {
+		return g.Reverse(ctx, points[i].Lat, points[i].Lng)
+	})
+}
+
+func (g *Geocoder) each(ctx context.Context, n int, fn func(ctx context.Context, i int) (Match, error)) (matches []Match, errs []error) {
+	matches, errs = make([]Match, n), make([]error, n)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	sem := make(chan struct{}, max(g.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range n {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = context.Cause(ctx)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			matches[i], errs[i] = fn(ctx, i)
+			if errs[i] != nil && !errors.Is(errs[i], ErrNotFound) {
+				cancel(errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return matches, errs
+}
+
+// wait blocks until the next lookup may start under RPS
+func (g *Geocoder) wait(ctx context.Context) error {
+	if g.RPS <= 0 {
+		return nil
+	}
+	g.mu.Lock()
+	now := time.Now()
+	start := g.next
+	if start.Before(now) {
+		start = now
+	}
+	g.next = start.Add(time.Duration(float64(time.Second) / g.RPS))
+	g.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
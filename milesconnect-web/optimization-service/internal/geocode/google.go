@@ -0,0 +1,119 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"milesconnect-optimization/internal/retry"
+)
+
+// GoogleName identifies the Google Geocoding API provider in responses and metrics
+const GoogleName = "google"
+
+// Google looks addresses up with the Google Maps Geocoding API
+type Google struct {
+	BaseURL string // https://maps.googleapis.com when empty
+	APIKey  string
+	Region  string // ccTLD region code biasing results, e.g. in; empty for none
+	Client  *http.Client
+}
+
+func (g *Google) Name() string { return GoogleName }
+
+type googleResponse struct {
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message"`
+	Results      []struct {
+		FormattedAddress string `json:"formatted_address"`
+		PartialMatch     bool   `json:"partial_match"`
+		Geometry         struct {
+			Location struct {
+				Lat float64 `json:"lat"`
+				Lng float64 `json:"lng"`
+			} `json:"location"`
+			LocationType string `json:"location_type"`
+		} `json:"geometry"`
+	} `json:"results"`
+}
+
+// googleConfidence maps a result's location_type, from an exact rooftop fix to an
+// approximate area, to a confidence
+var googleConfidence = map[string]float64{
+	"ROOFTOP":            1,
+	"RANGE_INTERPOLATED": 0.8,
+	"GEOMETRIC_CENTER":   0.6,
+	"APPROXIMATE":        0.4,
+}
+
+// Geocode returns the first result. Partial matches, where Google matched only part
+// of the address, get half the confidence of their location type.
+func (g *Google) Geocode(ctx context.Context, address string) (Match, error) {
+	return g.first(ctx, url.Values{"address": {address}})
+}
+
+// Reverse returns the most precise address Google has for the point
+func (g *Google) Reverse(ctx context.Context, lat, lng float64) (Match, error) {
+	return g.first(ctx, url.Values{"latlng": {strconv.FormatFloat(lat, 'f', 6, 64) + "," + strconv.FormatFloat(lng, 'f', 6, 64)}})
+}
+
+func (g *Google) first(ctx context.Context, q url.Values) (Match, error) {
+	base := g.BaseURL
+	if base == "" {
+		base = "https://maps.googleapis.com"
+	}
+	q.Set("key", g.APIKey)
+	if g.Region != "" {
+		q.Set("region", g.Region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+"/maps/api/geocode/json?"+q.Encode(), nil)
+	if err != nil {
+		return Match{}, retry.Permanent(err)
+	}
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL carries the API key; keep it out of errors that get logged
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return Match{}, fmt.Errorf("google: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body googleResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		err = fmt.Errorf("google: decoding response (HTTP %d): %w", resp.StatusCode, err)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			err = retry.Permanent(err)
+		}
+		return Match{}, err
+	}
+	switch body.Status {
+	case "OK":
+	case "ZERO_RESULTS":
+		return Match{}, retry.Permanent(ErrNotFound)
+	case "OVER_QUERY_LIMIT", "UNKNOWN_ERROR":
+		return Match{}, fmt.Errorf("google: %s %s", body.Status, body.ErrorMessage)
+	default:
+		return Match{}, retry.Permanent(fmt.Errorf("google: %s %s", body.Status, body.ErrorMessage))
+	}
+	if len(body.Results) == 0 {
+		return Match{}, retry.Permanent(ErrNotFound)
+	}
+	r := body.Results[0]
+	confidence := googleConfidence[r.Geometry.LocationType]
+	if r.PartialMatch {
+		confidence /= 2
+	}
+	return Match{Lat: r.Geometry.Location.Lat, Lng: r.Geometry.Location.Lng, Confidence: confidence, Formatted: r.FormattedAddress}, nil
+}
@@ -0,0 +1,113 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"milesconnect-optimization/internal/retry"
+)
+
+// NominatimName identifies the Nominatim provider in responses and metrics
+const NominatimName = "nominatim"
+
+// Nominatim looks addresses up with an OpenStreetMap Nominatim server's search API.
+// The public server at nominatim.openstreetmap.org requires a UserAgent identifying
+// the application and allows one request a second.
+type Nominatim struct {
+	BaseURL      string // e.g. https://nominatim.openstreetmap.org
+	UserAgent    string
+	CountryCodes string // comma-separated ISO 3166-1 codes results are limited to; empty for any
+	Client       *http.Client
+}
+
+func (n *Nominatim) Name() string { return NominatimName }
+
+type nominatimPlace struct {
+	Lat         string  `json:"lat"`
+	Lon         string  `json:"lon"`
+	DisplayName string  `json:"display_name"`
+	Importance  float64 `json:"importance"`
+}
+
+// Geocode returns the top search result. Nominatim has no match-quality score, so
+// Confidence is the result's importance, which ranks well-known places above obscure
+// ones and is lowest for house-level matches in sparsely mapped areas.
+func (n *Nominatim) Geocode(ctx context.Context, address string) (Match, error) {
+	q := url.Values{"q": {address}, "format": {"jsonv2"}, "limit": {"1"}}
+	if n.CountryCodes != "" {
+		q.Set("countrycodes", n.CountryCodes)
+	}
+	var places []nominatimPlace
+	if err := n.get(ctx, "/search", q, &places); err != nil {
+		return Match{}, err
+	}
+	if len(places) == 0 {
+		return Match{}, retry.Permanent(ErrNotFound)
+	}
+	return places[0].match()
+}
+
+// Reverse returns the nearest address Nominatim knows, down to building level
+func (n *Nominatim) Reverse(ctx context.Context, lat, lng float64) (Match, error) {
+	q := url.Values{
+		"lat":    {strconv.FormatFloat(lat, 'f', 6, 64)},
+		"lon":    {strconv.FormatFloat(lng, 'f', 6, 64)},
+		"format": {"jsonv2"},
+	}
+	var place struct {
+		nominatimPlace
+		Error string `json:"error"` // "Unable to geocode" far from anything mapped
+	}
+	if err := n.get(ctx, "/reverse", q, &place); err != nil {
+		return Match{}, err
+	}
+	if place.Error != "" {
+		return Match{}, retry.Permanent(ErrNotFound)
+	}
+	return place.match()
+}
+
+func (n *Nominatim) get(ctx context.Context, path string, q url.Values, into any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(n.BaseURL, "/")+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return retry.Permanent(err)
+	}
+	if n.UserAgent != "" {
+		req.Header.Set("User-Agent", n.UserAgent)
+	}
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("nominatim: HTTP %d", resp.StatusCode)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			err = retry.Permanent(err)
+		}
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("nominatim: decoding results: %w", err)
+	}
+	return nil
+}
+
+func (p nominatimPlace) match() (Match, error) {
+	lat, err1 := strconv.ParseFloat(p.Lat, 64)
+	lng, err2 := strconv.ParseFloat(p.Lon, 64)
+	if err1 != nil || err2 != nil {
+		return Match{}, retry.Permanent(fmt.Errorf("nominatim: invalid coordinates %q, %q", p.Lat, p.Lon))
+	}
+	return Match{Lat: lat, Lng: lng, Confidence: min(max(p.Importance, 0), 1), Formatted: p.DisplayName}, nil
+}
@@ -0,0 +1,124 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds each dependency check so a hung dependency can't hang the probe
+const checkTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable; a nil error means healthy
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of one dependency check
+type CheckResult struct {
+	Status    string  `json:"status"` // "ok" or "fail"
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the body served by the readiness probe
+type Report struct {
+	Status string                 `json:"status"` // "ready" or "not_ready"
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Registry holds the readiness checks of the service's configured dependencies
+type Registry struct {
+	mu       sync.RWMutex
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+// Default is the registry the server's probes report on
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]Check)}
+}
+
+// Register adds (or replaces) the readiness check for a named dependency
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	r.checks[name] = check
+	r.mu.Unlock()
+}
+
+// SetDraining marks the instance as shutting down so readiness fails and traffic moves away
+func (r *Registry) SetDraining() {
+	r.draining.Store(true)
+}
+
+// Ready runs every check concurrently and collects the results
+func (r *Registry) Ready(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make(map[string]Check, len(r.checks))
+	for name, c := range r.checks {
+		checks[name] = c
+	}
+	r.mu.RUnlock()
+
+	if r.draining.Load() {
+		checks["shutdown"] = func(context.Context) error { return errors.New("instance is draining") }
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	report := Report{Status: "ready", Checks: make(map[string]CheckResult, len(checks))}
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			started := time.Now()
+			err := check(cctx)
+			res := CheckResult{Status: "ok", LatencyMs: float64(time.Since(started).Microseconds()) / 1000}
+			if err != nil {
+				res.Status, res.Error = "fail", err.Error()
+			}
+
+			mu.Lock()
+			report.Checks[name] = res
+			if err != nil {
+				report.Status = "not_ready"
+			}
+			mu.Unlock()
+		}(name, checks[name])
+	}
+	wg.Wait()
+	return report
+}
+
+// LiveHandler reports that the process is up and serving; it checks no dependencies
+func LiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// ReadyHandler serves the readiness report, with 503 when any dependency check fails
+func (r *Registry) ReadyHandler(w http.ResponseWriter, req *http.Request) {
+	report := r.Ready(req.Context())
+	status := http.StatusOK
+	if report.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,157 @@
+// Package jobs runs optimization requests asynchronously and keeps their requests,
+// statuses and results in a Store so they outlive the process that accepted them.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Status is where a job is in its lifecycle
+type Status string
+
+const (
+	Queued    Status = "queued"
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Cancelled Status = "cancelled"
+)
+
+// Job is one asynchronous optimization
+type Job struct {
+	ID       string          `json:"id"`
+	Tenant   string          `json:"tenant"`
+	Client   string          `json:"client,omitempty"`
+	Endpoint string          `json:"endpoint"` // optimize or optimize-load
+	Status   Status          `json:"status"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	// ResultKey is the object holding a result too large for the store; Result is
+	// empty then and ResultURL, filled in when the job is fetched, links to it
+	ResultKey string `json:"-"`
+	ResultURL string `json:"result_url,omitempty"`
+	// Checkpoint is the saved progress of a running solve, for a worker picking the
+	// job up again after its previous one died
+	Checkpoint json.RawMessage `json:"-"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+var (
+	// ErrNotFound is returned for unknown job IDs
+	ErrNotFound = errors.New("jobs: not found")
+	// ErrNotClaimable is returned by Claim when the job is finished or running elsewhere
+	ErrNotClaimable = errors.New("jobs: job is not queued")
+	// ErrFinished is returned by Cancel for jobs that have already finished
+	ErrFinished = errors.New("jobs: job has finished")
+)
+
+// Store persists jobs. Implementations must be safe for concurrent use, and Claim
+// must be atomic so that replicas sharing a store never run the same job twice.
+type Store interface {
+	Create(ctx context.Context, job Job) error
+	Get(ctx context.Context, id string) (Job, error)
+	// Claim moves a queued job to running and returns it. A job that started running
+	// before staleBefore is claimed again, its worker presumed dead; the zero time only
+	// claims queued jobs.
+	Claim(ctx context.Context, id string, staleBefore time.Time) (Job, error)
+	// SaveCheckpoint stores the progress of a running job, replacing any earlier
+	// checkpoint. It returns ErrNotClaimable once the job is no longer running.
+	SaveCheckpoint(ctx context.Context, id string, state json.RawMessage) error
+	// Finish records the final status, result and error of a running job and drops
+	// its checkpoint. It returns ErrNotClaimable for a job cancelled meanwhile, leaving
+	// it cancelled.
+	Finish(ctx context.Context, job Job) error
+	// Cancel marks a queued or running job cancelled and returns it; ErrFinished when
+	// it had already finished
+	Cancel(ctx context.Context, id string) (Job, error)
+	// Queued lists queued jobs, oldest first
+	Queued(ctx context.Context) ([]Job, error)
+	// List returns the jobs matching f, newest first, without their requests and results
+	List(ctx context.Context, f Filter) ([]Job, error)
+	// RequeueStale puts jobs that started running before cutoff back in the queue,
+	// recovering work from processes that died mid-solve
+	RequeueStale(ctx context.Context, cutoff time.Time) (int, error)
+	Close() error
+}
+
+// Filter selects jobs for Store.List. Zero fields match everything.
+type Filter struct {
+	Tenant   string
+	Status   Status
+	Endpoint string
+	From, To time.Time // created at or after From and before To
+	// Before continues a listing after the last job of the previous page
+	Before *Cursor
+	Limit  int
+}
+
+// Cursor is a position in the newest-first job order
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the cursor as an opaque URL-safe token
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+// ParseCursor decodes a token from Cursor.Encode
+func ParseCursor(token string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrBadCursor
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return Cursor{}, ErrBadCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return Cursor{}, ErrBadCursor
+	}
+	return Cursor{CreatedAt: t, ID: id}, nil
+}
+
+// ErrBadCursor is returned for tokens that didn't come from Cursor.Encode
+var ErrBadCursor = errors.New("jobs: invalid cursor")
+
+// CursorOf is the position of job, to continue a listing after it
+func CursorOf(job Job) Cursor {
+	return Cursor{CreatedAt: job.CreatedAt, ID: job.ID}
+}
+
+// matches reports whether job passes every filter except the limit
+func (f Filter) matches(job Job) bool {
+	return (f.Tenant == "" || job.Tenant == f.Tenant) &&
+		(f.Status == "" || job.Status == f.Status) &&
+		(f.Endpoint == "" || job.Endpoint == f.Endpoint) &&
+		(f.From.IsZero() || !job.CreatedAt.Before(f.From)) &&
+		(f.To.IsZero() || job.CreatedAt.Before(f.To)) &&
+		(f.Before == nil || f.Before.after(job))
+}
+
+// after reports whether job comes after c in newest-first order
+func (c Cursor) after(job Job) bool {
+	if !job.CreatedAt.Equal(c.CreatedAt) {
+		return job.CreatedAt.Before(c.CreatedAt)
+	}
+	return job.ID < c.ID
+}
+
+// NewID returns a random job ID
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
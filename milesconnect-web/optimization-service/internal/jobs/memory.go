@@ -0,0 +1,241 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"milesconnect-optimization/internal/metrics"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryShards is how many independently locked parts a MemoryStore is split into, so
+// workers finishing jobs don't queue behind listings and submissions
+const memoryShards = 16
+
+// MemoryStore keeps jobs in process memory; they are lost on restart. Finished jobs are
+// evicted ttl after they finish, and the oldest finished ones once the store holds
+// about maxEntries; queued and running jobs are never evicted.
+type MemoryStore struct {
+	ttl      time.Duration // 0 keeps finished jobs until capacity evicts them
+	perShard int           // 0 is unbounded
+	shards   [memoryShards]memoryShard
+}
+
+type memoryShard struct {
+	mu        sync.Mutex
+	jobs      map[string]Job
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store keeping finished jobs for ttl, and
+// holding up to maxEntries jobs; zero disables either limit
+func NewMemoryStore(ttl time.Duration, maxEntries int) *MemoryStore {
+	s := &MemoryStore{ttl: ttl}
+	if maxEntries > 0 {
+		s.perShard = (maxEntries + memoryShards - 1) / memoryShards
+	}
+	for i := range s.shards {
+		s.shards[i].jobs = map[string]Job{}
+	}
+	return s
+}
+
+// shard locks and returns the shard holding id
+func (s *MemoryStore) shard(id string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	sh := &s.shards[h.Sum32()%memoryShards]
+	sh.mu.Lock()
+	return sh
+}
+
+// expired reports whether job is finished and past the store's TTL at now
+func (s *MemoryStore) expired(job Job, now time.Time) bool {
+	return s.ttl > 0 && job.FinishedAt != nil && now.Sub(*job.FinishedAt) > s.ttl
+}
+
+// evict drops what sh holds beyond the store's limits after adding a job: expired
+// jobs, at most once a TTL, then the longest-finished jobs while it is over capacity
+func (s *MemoryStore) evict(sh *memoryShard, now time.Time) {
+	if s.ttl > 0 && now.Sub(sh.lastSweep) >= s.ttl {
+		for id, job := range sh.jobs {
+			if s.expired(job, now) {
+				delete(sh.jobs, id)
+				metrics.JobsEvicted.Inc("expired")
+			}
+		}
+		sh.lastSweep = now
+	}
+	for s.perShard > 0 && len(sh.jobs) > s.perShard {
+		var oldest string
+		var oldestAt time.Time
+		for id, job := range sh.jobs {
+			if job.FinishedAt != nil && (oldest == "" || job.FinishedAt.Before(oldestAt)) {
+				oldest, oldestAt = id, *job.FinishedAt
+			}
+		}
+		if oldest == "" {
+			return // every job is still queued or running
+		}
+		delete(sh.jobs, oldest)
+		metrics.JobsEvicted.Inc("capacity")
+	}
+}
+
+// lookup returns the job with id from sh, evicting it instead when it has expired
+func (s *MemoryStore) lookup(sh *memoryShard, id string) (Job, bool) {
+	job, ok := sh.jobs[id]
+	if ok && s.expired(job, time.Now()) {
+		delete(sh.jobs, id)
+		metrics.JobsEvicted.Inc("expired")
+		return Job{}, false
+	}
+	return job, ok
+}
+
+// each calls fn with every job, one shard locked at a time, evicting expired ones on
+// the way
+func (s *MemoryStore) each(fn func(Job)) {
+	now := time.Now()
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for id, job := range sh.jobs {
+			if s.expired(job, now) {
+				delete(sh.jobs, id)
+				metrics.JobsEvicted.Inc("expired")
+				continue
+			}
+			fn(job)
+		}
+		sh.mu.Unlock()
+	}
+}
+
+func (s *MemoryStore) Create(_ context.Context, job Job) error {
+	sh := s.shard(job.ID)
+	defer sh.mu.Unlock()
+	sh.jobs[job.ID] = job
+	s.evict(sh, time.Now())
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (Job, error) {
+	sh := s.shard(id)
+	defer sh.mu.Unlock()
+	job, ok := s.lookup(sh, id)
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+func (s *MemoryStore) Claim(_ context.Context, id string, staleBefore time.Time) (Job, error) {
+	sh := s.shard(id)
+	defer sh.mu.Unlock()
+	job, ok := s.lookup(sh, id)
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	stale := job.Status == Running && job.StartedAt != nil && job.StartedAt.Before(staleBefore)
+	if job.Status != Queued && !stale {
+		return Job{}, ErrNotClaimable
+	}
+	now := time.Now().UTC()
+	job.Status, job.StartedAt = Running, &now
+	sh.jobs[id] = job
+	return job, nil
+}
+
+func (s *MemoryStore) SaveCheckpoint(_ context.Context, id string, state json.RawMessage) error {
+	sh := s.shard(id)
+	defer sh.mu.Unlock()
+	job, ok := s.lookup(sh, id)
+	if !ok {
+		return ErrNotFound
+	}
+	if job.Status != Running {
+		return ErrNotClaimable
+	}
+	job.Checkpoint = state
+	sh.jobs[id] = job
+	return nil
+}
+
+func (s *MemoryStore) Finish(_ context.Context, job Job) error {
+	sh := s.shard(job.ID)
+	defer sh.mu.Unlock()
+	stored, ok := s.lookup(sh, job.ID)
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Status == Cancelled {
+		return ErrNotClaimable
+	}
+	job.Checkpoint = nil
+	sh.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryStore) Cancel(_ context.Context, id string) (Job, error) {
+	sh := s.shard(id)
+	defer sh.mu.Unlock()
+	job, ok := s.lookup(sh, id)
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if job.Status != Queued && job.Status != Running {
+		return Job{}, ErrFinished
+	}
+	now := time.Now().UTC()
+	job.Status, job.FinishedAt, job.Checkpoint = Cancelled, &now, nil
+	sh.jobs[id] = job
+	return job, nil
+}
+
+func (s *MemoryStore) Queued(_ context.Context) ([]Job, error) {
+	var queued []Job
+	s.each(func(job Job) {
+		if job.Status == Queued {
+			queued = append(queued, job)
+		}
+	})
+	sort.Slice(queued, func(i, j int) bool { return queued[i].CreatedAt.Before(queued[j].CreatedAt) })
+	return queued, nil
+}
+
+func (s *MemoryStore) List(_ context.Context, f Filter) ([]Job, error) {
+	var jobs []Job
+	s.each(func(job Job) {
+		if f.matches(job) {
+			job.Request, job.Result = nil, nil
+			jobs = append(jobs, job)
+		}
+	})
+	sort.Slice(jobs, func(i, j int) bool { return CursorOf(jobs[i]).after(jobs[j]) })
+	if f.Limit > 0 && len(jobs) > f.Limit {
+		jobs = jobs[:f.Limit]
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) RequeueStale(_ context.Context, cutoff time.Time) (int, error) {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for id, job := range sh.jobs {
+			if job.Status == Running && job.StartedAt != nil && job.StartedAt.Before(cutoff) {
+				job.Status, job.StartedAt = Queued, nil
+				sh.jobs[id] = job
+				n++
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) Close() error { return nil }
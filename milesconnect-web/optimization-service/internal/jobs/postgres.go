@@ -0,0 +1,242 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS optimization_jobs (
+	id          text PRIMARY KEY,
+	tenant      text NOT NULL,
+	client      text NOT NULL DEFAULT '',
+	endpoint    text NOT NULL,
+	status      text NOT NULL,
+	request     jsonb NOT NULL,
+	result      jsonb,
+	error       text NOT NULL DEFAULT '',
+	created_at  timestamptz NOT NULL,
+	started_at  timestamptz,
+	finished_at timestamptz
+);
+ALTER TABLE optimization_jobs ADD COLUMN IF NOT EXISTS result_key text NOT NULL DEFAULT '';
+ALTER TABLE optimization_jobs ADD COLUMN IF NOT EXISTS checkpoint jsonb;
+CREATE INDEX IF NOT EXISTS optimization_jobs_status ON optimization_jobs (status, created_at);
+CREATE INDEX IF NOT EXISTS optimization_jobs_tenant ON optimization_jobs (tenant, created_at);
+CREATE INDEX IF NOT EXISTS optimization_jobs_created ON optimization_jobs (created_at, id);
+`
+
+const columns = `id, tenant, client, endpoint, status, request, result, result_key, error, created_at, started_at, finished_at, checkpoint`
+
+// listColumns leaves out the request and result, which can be large
+const listColumns = `id, tenant, client, endpoint, status, NULL::jsonb, NULL::jsonb, result_key, error, created_at, started_at, finished_at, NULL::jsonb`
+
+// PostgresStore keeps jobs in a Postgres table shared by every replica
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// OpenPostgres connects to dsn and creates the jobs table if it doesn't exist
+func OpenPostgres(ctx context.Context, dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: open postgres: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("jobs: create schema: %w", err)
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+// Ping checks the database is reachable, for readiness probes
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *PostgresStore) Create(ctx context.Context, job Job) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO optimization_jobs (`+columns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		job.ID, job.Tenant, job.Client, job.Endpoint, job.Status, []byte(job.Request), nullJSON(job.Result),
+		job.ResultKey, job.Error, job.CreatedAt, job.StartedAt, job.FinishedAt, nullJSON(job.Checkpoint))
+	return err
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (Job, error) {
+	return scanJob(s.db.QueryRowContext(ctx, `SELECT `+columns+` FROM optimization_jobs WHERE id = $1`, id))
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, id string, staleBefore time.Time) (Job, error) {
+	job, err := scanJob(s.db.QueryRowContext(ctx,
+		`UPDATE optimization_jobs SET status = $2, started_at = now()
+		 WHERE id = $1 AND (status = $3 OR (status = $2 AND started_at < $4)) RETURNING `+columns,
+		id, Running, Queued, staleBefore))
+	if errors.Is(err, ErrNotFound) {
+		// Tell a missing job apart from one another replica already claimed
+		if _, getErr := s.Get(ctx, id); getErr == nil {
+			return Job{}, ErrNotClaimable
+		}
+	}
+	return job, err
+}
+
+func (s *PostgresStore) SaveCheckpoint(ctx context.Context, id string, state json.RawMessage) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE optimization_jobs SET checkpoint = $2 WHERE id = $1 AND status = $3`, id, []byte(state), Running)
+	return checkpointSaved(ctx, res, err, s.Get, id)
+}
+
+func (s *PostgresStore) Finish(ctx context.Context, job Job) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE optimization_jobs SET status = $2, result = $3, result_key = $4, error = $5, finished_at = $6, checkpoint = NULL
+		 WHERE id = $1 AND status <> $7`,
+		job.ID, job.Status, nullJSON(job.Result), job.ResultKey, job.Error, job.FinishedAt, Cancelled)
+	return checkpointSaved(ctx, res, err, s.Get, job.ID)
+}
+
+func (s *PostgresStore) Cancel(ctx context.Context, id string) (Job, error) {
+	job, err := scanJob(s.db.QueryRowContext(ctx,
+		`UPDATE optimization_jobs SET status = $2, finished_at = now(), checkpoint = NULL
+		 WHERE id = $1 AND status IN ($3, $4) RETURNING `+columns,
+		id, Cancelled, Queued, Running))
+	if errors.Is(err, ErrNotFound) {
+		if _, getErr := s.Get(ctx, id); getErr == nil {
+			return Job{}, ErrFinished
+		}
+	}
+	return job, err
+}
+
+func (s *PostgresStore) Queued(ctx context.Context) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+columns+` FROM optimization_jobs WHERE status = $1 ORDER BY created_at`, Queued)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows, scanJob)
+}
+
+func (s *PostgresStore) List(ctx context.Context, f Filter) ([]Job, error) {
+	query, args := listQuery(f, listColumns, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows, scanJob)
+}
+
+// listQuery builds the List query for f; param renders the driver's nth placeholder
+func listQuery(f Filter, columns string, param func(n int) string) (string, []any) {
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(cond, "?", param(len(args))))
+	}
+	if f.Tenant != "" {
+		add("tenant = ?", f.Tenant)
+	}
+	if f.Status != "" {
+		add("status = ?", f.Status)
+	}
+	if f.Endpoint != "" {
+		add("endpoint = ?", f.Endpoint)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < ?", f.To)
+	}
+	if f.Before != nil {
+		args = append(args, f.Before.CreatedAt, f.Before.ID)
+		where = append(where, fmt.Sprintf("(created_at, id) < (%s, %s)", param(len(args)-1), param(len(args))))
+	}
+	query := `SELECT ` + columns + ` FROM optimization_jobs`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ` + strconv.Itoa(f.Limit)
+	}
+	return query, args
+}
+
+func scanJobs(rows *sql.Rows, scan func(scanner) (Job, error)) ([]Job, error) {
+	defer rows.Close()
+	var jobs []Job
+	for rows.Next() {
+		job, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *PostgresStore) RequeueStale(ctx context.Context, cutoff time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE optimization_jobs SET status = $1, started_at = NULL WHERE status = $2 AND started_at < $3`,
+		Queued, Running, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row scanner) (Job, error) {
+	var job Job
+	var request, result, checkpoint []byte
+	err := row.Scan(&job.ID, &job.Tenant, &job.Client, &job.Endpoint, &job.Status, &request, &result,
+		&job.ResultKey, &job.Error, &job.CreatedAt, &job.StartedAt, &job.FinishedAt, &checkpoint)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	job.Request, job.Result, job.Checkpoint = request, result, checkpoint
+	return job, nil
+}
+
+// checkpointSaved turns the outcome of a SaveCheckpoint or Finish update into its
+// error, telling a job that is no longer running apart from a missing one
+func checkpointSaved(ctx context.Context, res sql.Result, err error, get func(context.Context, string) (Job, error), id string) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	if _, err := get(ctx, id); err != nil {
+		return err
+	}
+	return ErrNotClaimable
+}
+
+// nullJSON stores an empty result as SQL NULL rather than invalid jsonb
+func nullJSON(raw []byte) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
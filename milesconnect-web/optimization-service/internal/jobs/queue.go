@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrQueueFull is returned by Enqueue when the queue has no room
+var ErrQueueFull = errors.New("jobs: queue full")
+
+// Delivery is a job ID handed to one worker
+type Delivery struct {
+	JobID string
+	// Redelivered is set when an earlier delivery was never acknowledged, so the job
+	// may have been left running by a worker that died
+	Redelivered bool
+
+	ref string // queue-specific handle for Ack
+}
+
+// Queue hands job IDs from the API to the workers. Deliveries are at least once:
+// one that isn't acknowledged may be handed out again, so workers rely on Store.Claim
+// to avoid running a job twice.
+type Queue interface {
+	Enqueue(ctx context.Context, jobID string) error
+	// Dequeue blocks until a job is available or ctx ends
+	Dequeue(ctx context.Context) (Delivery, error)
+	// Ack marks the delivery done once the job's outcome is stored
+	Ack(ctx context.Context, d Delivery) error
+	Close() error
+}
+
+// MemoryQueue is a bounded in-process queue. It never redelivers; jobs lost with the
+// process are recovered from the store by Runner.Recover.
+type MemoryQueue struct {
+	ch chan string
+}
+
+// NewMemoryQueue returns a queue holding up to size job IDs
+func NewMemoryQueue(size int) *MemoryQueue {
+	return &MemoryQueue{ch: make(chan string, size)}
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, jobID string) error {
+	select {
+	case q.ch <- jobID:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (q *MemoryQueue) Dequeue(ctx context.Context) (Delivery, error) {
+	select {
+	case id := <-q.ch:
+		return Delivery{JobID: id}, nil
+	case <-ctx.Done():
+		return Delivery{}, ctx.Err()
+	}
+}
+
+func (q *MemoryQueue) Ack(context.Context, Delivery) error { return nil }
+
+func (q *MemoryQueue) Close() error { return nil }
@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisStream = "optimization:jobs"
+	redisGroup  = "solvers"
+	// redisBlock bounds each blocking read so Dequeue notices cancellation promptly
+	redisBlock = 2 * time.Second
+)
+
+// RedisQueue is a Redis Streams queue shared by every replica through one consumer
+// group. A delivery that isn't acknowledged within the visibility timeout, because
+// its worker crashed or stalled, is claimed by the next worker to ask for a job.
+type RedisQueue struct {
+	client     *redis.Client
+	consumer   string
+	visibility time.Duration
+}
+
+// OpenRedis connects to the Redis at url and creates the stream and consumer group
+// if they don't exist
+func OpenRedis(ctx context.Context, url string, visibility time.Duration) (*RedisQueue, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: redis url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	err = client.XGroupCreateMkStream(ctx, redisStream, redisGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		client.Close()
+		return nil, fmt.Errorf("jobs: create consumer group: %w", err)
+	}
+	host, _ := os.Hostname()
+	return &RedisQueue{
+		client:     client,
+		consumer:   host + "-" + strconv.Itoa(os.Getpid()),
+		visibility: visibility,
+	}, nil
+}
+
+// Ping checks Redis is reachable, for readiness probes
+func (q *RedisQueue) Ping(ctx context.Context) error {
+	return q.client.Ping(ctx).Err()
+}
+
+func (q *RedisQueue) Enqueue(ctx context.Context, jobID string) error {
+	return q.client.XAdd(ctx, &redis.XAddArgs{Stream: redisStream, Values: map[string]any{"job_id": jobID}}).Err()
+}
+
+func (q *RedisQueue) Dequeue(ctx context.Context) (Delivery, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return Delivery{}, err
+		}
+		// Abandoned deliveries come first so a crashed worker's jobs don't wait behind new ones
+		claimed, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream: redisStream, Group: redisGroup, Consumer: q.consumer,
+			MinIdle: q.visibility, Start: "0-0", Count: 1,
+		}).Result()
+		if err != nil && ctx.Err() == nil {
+			return Delivery{}, err
+		}
+		if len(claimed) > 0 {
+			return delivery(claimed[0], true), nil
+		}
+
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group: redisGroup, Consumer: q.consumer,
+			Streams: []string{redisStream, ">"}, Count: 1, Block: redisBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return Delivery{}, ctx.Err()
+			}
+			return Delivery{}, err
+		}
+		if len(streams) > 0 && len(streams[0].Messages) > 0 {
+			return delivery(streams[0].Messages[0], false), nil
+		}
+	}
+}
+
+func (q *RedisQueue) Ack(ctx context.Context, d Delivery) error {
+	_, err := q.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.XAck(ctx, redisStream, redisGroup, d.ref)
+		p.XDel(ctx, redisStream, d.ref)
+		return nil
+	})
+	return err
+}
+
+func (q *RedisQueue) Close() error {
+	return q.client.Close()
+}
+
+func delivery(msg redis.XMessage, redelivered bool) Delivery {
+	id, _ := msg.Values["job_id"].(string)
+	return Delivery{JobID: id, Redelivered: redelivered, ref: msg.ID}
+}
@@ -0,0 +1,252 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Executor solves a claimed job, returning its JSON result or an error message
+// suitable for the job's caller
+type Executor func(ctx context.Context, job Job) (result []byte, err error)
+
+// Runner has a fixed set of workers take job IDs from a queue, claim the jobs in the
+// store, execute them and record the outcome
+type Runner struct {
+	store   Store
+	queue   Queue
+	exec    Executor
+	workers int
+	// staleAfter is how long a job may run before a redelivery or Recover assumes its
+	// worker is gone
+	staleAfter time.Duration
+
+	offload *Offload
+
+	// running holds the cancel funcs of the jobs this runner's workers are executing
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+
+	stopFetch context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewRunner returns a runner with the given number of workers
+func NewRunner(store Store, queue Queue, exec Executor, workers int, staleAfter time.Duration) *Runner {
+	return &Runner{
+		store: store, queue: queue, exec: exec, workers: max(workers, 1), staleAfter: staleAfter,
+		running: map[string]context.CancelFunc{},
+	}
+}
+
+// Store is where the runner keeps its jobs
+func (r *Runner) Store() Store { return r.store }
+
+// Objects is S3-compatible object storage
+type Objects interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Offload keeps results larger than Threshold bytes in object storage instead of the
+// job store; callers download them through presigned URLs valid for URLExpiry
+type Offload struct {
+	Objects   Objects
+	Threshold int
+	URLExpiry time.Duration
+}
+
+// OffloadResults enables result offloading for jobs finished from now on
+func (r *Runner) OffloadResults(o Offload) {
+	r.offload = &o
+}
+
+// ResultURL returns a fresh presigned download URL for an offloaded result
+func (r *Runner) ResultURL(ctx context.Context, job Job) (string, error) {
+	if r.offload == nil {
+		return "", errors.New("jobs: result offloading is not configured")
+	}
+	return r.offload.Objects.PresignGet(ctx, job.ResultKey, r.offload.URLExpiry)
+}
+
+// Submit persists job as queued and enqueues it. A job the queue refuses is marked
+// failed so it isn't left queued forever.
+func (r *Runner) Submit(ctx context.Context, job Job) error {
+	job.Status = Queued
+	if err := r.store.Create(ctx, job); err != nil {
+		return err
+	}
+	err := r.queue.Enqueue(ctx, job.ID)
+	if err == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	job.Status, job.Error, job.FinishedAt = Failed, "job could not be queued", &now
+	if ferr := r.store.Finish(context.WithoutCancel(ctx), job); ferr != nil {
+		slog.ErrorContext(ctx, "finish unqueued job", "job_id", job.ID, "error", ferr)
+	}
+	return err
+}
+
+// Cancel marks a queued or running job cancelled and returns it. A job running here has
+// its solve's context cancelled; one running on another replica sharing the store
+// stops at its next checkpoint save, or has its result discarded when it finishes.
+// Queued jobs are skipped when their delivery comes up.
+func (r *Runner) Cancel(ctx context.Context, id string) (Job, error) {
+	job, err := r.store.Cancel(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	r.mu.Lock()
+	if cancel := r.running[id]; cancel != nil {
+		cancel()
+	}
+	r.mu.Unlock()
+	return job, nil
+}
+
+// Recover requeues stale jobs and enqueues every queued job in the store. It is for
+// queues that don't survive restarts; a durable queue still holds those jobs.
+func (r *Runner) Recover(ctx context.Context) error {
+	if r.staleAfter > 0 {
+		n, err := r.store.RequeueStale(ctx, time.Now().Add(-r.staleAfter))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			slog.Info("requeued stale jobs", "count", n)
+		}
+	}
+	queued, err := r.store.Queued(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range queued {
+		if err := r.queue.Enqueue(ctx, job.ID); err != nil {
+			// The rest stay queued in the store for the next start
+			slog.Warn("recovering queued jobs", "recovered", len(queued), "error", err)
+			break
+		}
+	}
+	return nil
+}
+
+// Start starts the workers. Jobs run under ctx; cancelling it aborts them unacknowledged,
+// leaving them to be redelivered or recovered as stale.
+func (r *Runner) Start(ctx context.Context) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	r.stopFetch = cancel
+	for i := 0; i < r.workers; i++ {
+		r.wg.Add(1)
+		go r.work(ctx, fetchCtx)
+	}
+}
+
+// Stop makes the workers exit once their current job is done
+func (r *Runner) Stop() {
+	if r.stopFetch != nil {
+		r.stopFetch()
+	}
+}
+
+// Wait blocks until the workers have exited after Stop
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Close closes the queue and the store
+func (r *Runner) Close() error {
+	return errors.Join(r.queue.Close(), r.store.Close())
+}
+
+func (r *Runner) work(ctx, fetchCtx context.Context) {
+	defer r.wg.Done()
+	for {
+		d, err := r.queue.Dequeue(fetchCtx)
+		if fetchCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("dequeue job", "error", err)
+			select {
+			case <-time.After(time.Second):
+			case <-fetchCtx.Done():
+				return
+			}
+			continue
+		}
+		r.run(ctx, d)
+	}
+}
+
+func (r *Runner) run(ctx context.Context, d Delivery) {
+	var staleBefore time.Time
+	if d.Redelivered {
+		staleBefore = time.Now().Add(-r.staleAfter)
+	}
+	job, err := r.store.Claim(ctx, d.JobID, staleBefore)
+	if errors.Is(err, ErrNotClaimable) || errors.Is(err, ErrNotFound) {
+		r.ack(ctx, d) // finished, or running on a live worker
+		return
+	}
+	if err != nil {
+		// Left unacknowledged so it is delivered again
+		slog.Error("claim job", "job_id", d.JobID, "error", err)
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.running[job.ID] = cancel
+	r.mu.Unlock()
+	result, err := r.exec(jobCtx, job)
+	r.mu.Lock()
+	delete(r.running, job.ID)
+	r.mu.Unlock()
+	cancelled := jobCtx.Err() != nil
+	cancel()
+	if ctx.Err() != nil {
+		// Shutting down mid-solve: leave the job running and unacknowledged
+		return
+	}
+	if cancelled {
+		// Cancel already recorded it
+		slog.Info("job cancelled", "job_id", job.ID)
+		r.ack(ctx, d)
+		return
+	}
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status, job.Error = Failed, err.Error()
+	} else {
+		job.Status, job.Result = Succeeded, result
+	}
+	// The solve is done, so record it even if shutdown starts now
+	ctx = context.WithoutCancel(ctx)
+	if o := r.offload; o != nil && len(job.Result) > o.Threshold {
+		key := "jobs/" + job.ID + ".json"
+		if err := o.Objects.Put(ctx, key, job.Result, "application/json"); err != nil {
+			slog.Error("offload job result", "job_id", job.ID, "bytes", len(job.Result), "error", err)
+			job.Status, job.Error = Failed, "storing result: "+err.Error()
+			key = ""
+		}
+		job.Result, job.ResultKey = nil, key
+	}
+	err = r.store.Finish(ctx, job)
+	if errors.Is(err, ErrNotClaimable) {
+		slog.Info("discarding result of cancelled job", "job_id", job.ID)
+	} else if err != nil {
+		slog.Error("finish job", "job_id", job.ID, "error", err)
+		return
+	}
+	r.ack(ctx, d)
+}
+
+func (r *Runner) ack(ctx context.Context, d Delivery) {
+	if err := r.queue.Ack(ctx, d); err != nil {
+		slog.Error("ack job", "job_id", d.JobID, "error", err)
+	}
+}
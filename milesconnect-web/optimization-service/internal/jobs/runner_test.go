@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// ackQueue records the deliveries acknowledged to it
+type ackQueue struct {
+	MemoryQueue
+	acked []string
+}
+
+func (q *ackQueue) Ack(_ context.Context, d Delivery) error {
+	q.acked = append(q.acked, d.JobID)
+	return nil
+}
+
+func TestRunnerClaimsStaleRedeliveries(t *testing.T) {
+	const staleAfter = time.Minute
+	for _, tt := range []struct {
+		name        string
+		startedAgo  time.Duration // 0 leaves the job queued
+		redelivered bool
+		runs        bool
+	}{
+		{"queued", 0, false, true},
+		{"running", time.Second, false, false},
+		// A worker still within stale_after keeps its job
+		{"redelivered live", time.Second, true, false},
+		{"redelivered stale", 2 * staleAfter, true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryStore(0, 0)
+			job := newTestJob()
+			if tt.startedAgo > 0 {
+				started := time.Now().Add(-tt.startedAgo)
+				job.Status, job.StartedAt = Running, &started
+			}
+			if err := store.Create(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+			runs := 0
+			queue := &ackQueue{}
+			r := NewRunner(store, queue, func(context.Context, Job) ([]byte, error) {
+				runs++
+				return []byte(`{"total_distance_km":1}`), nil
+			}, 1, staleAfter)
+
+			r.run(ctx, Delivery{JobID: job.ID, Redelivered: tt.redelivered})
+
+			if ran := runs == 1; ran != tt.runs {
+				t.Fatalf("ran %d times, want ran = %v", runs, tt.runs)
+			}
+			if len(queue.acked) != 1 {
+				t.Errorf("acknowledged %v, want the delivery", queue.acked)
+			}
+			got, _ := store.Get(ctx, job.ID)
+			want := job.Status
+			if tt.runs {
+				want = Succeeded
+			}
+			if got.Status != want {
+				t.Errorf("status %s, want %s", got.Status, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the pure-Go "sqlite" database/sql driver
+)
+
+// Times are unix nanoseconds so they order and compare as integers
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS optimization_jobs (
+	id          TEXT PRIMARY KEY,
+	tenant      TEXT NOT NULL,
+	client      TEXT NOT NULL DEFAULT '',
+	endpoint    TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	request     BLOB NOT NULL,
+	result      BLOB,
+	result_key  TEXT NOT NULL DEFAULT '',
+	error       TEXT NOT NULL DEFAULT '',
+	created_at  INTEGER NOT NULL,
+	started_at  INTEGER,
+	finished_at INTEGER,
+	checkpoint  BLOB
+);
+CREATE INDEX IF NOT EXISTS optimization_jobs_status ON optimization_jobs (status, created_at);
+CREATE INDEX IF NOT EXISTS optimization_jobs_tenant ON optimization_jobs (tenant, created_at);
+CREATE INDEX IF NOT EXISTS optimization_jobs_created ON optimization_jobs (created_at, id);
+`
+
+// sqliteAddedColumns are columns added to sqliteSchema since its first release
+var sqliteAddedColumns = []string{"checkpoint BLOB"}
+
+const sqliteListColumns = `id, tenant, client, endpoint, status, NULL, NULL, result_key, error, created_at, started_at, finished_at, NULL`
+
+// SQLiteStore keeps jobs in a local SQLite file, for single-instance installs that
+// want durable jobs without running a database server
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the database file at path and its jobs table
+func OpenSQLite(ctx context.Context, path string) (*SQLiteStore, error) {
+	// WAL lets GET /jobs read while a worker writes; the busy timeout covers the rest
+	dsn := "file:" + path + "?" + url.Values{"_pragma": {"journal_mode(WAL)", "busy_timeout(5000)", "synchronous(NORMAL)"}}.Encode()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: open sqlite: %w", err)
+	}
+	// SQLite has a single writer; one connection queues writes here instead of failing them as busy
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("jobs: create schema: %w", err)
+	}
+	for _, column := range sqliteAddedColumns {
+		// SQLite has no ADD COLUMN IF NOT EXISTS; tables created with the column refuse it
+		_, err := db.ExecContext(ctx, `ALTER TABLE optimization_jobs ADD COLUMN `+column)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			db.Close()
+			return nil, fmt.Errorf("jobs: migrate schema: %w", err)
+		}
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Ping checks the database file is usable, for readiness probes
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, job Job) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO optimization_jobs (`+columns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Tenant, job.Client, job.Endpoint, job.Status, []byte(job.Request), nullJSON(job.Result),
+		job.ResultKey, job.Error, job.CreatedAt.UnixNano(), unixNano(job.StartedAt), unixNano(job.FinishedAt), nullJSON(job.Checkpoint))
+	return err
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Job, error) {
+	return scanSQLiteJob(s.db.QueryRowContext(ctx, `SELECT `+columns+` FROM optimization_jobs WHERE id = ?`, id))
+}
+
+func (s *SQLiteStore) Claim(ctx context.Context, id string, staleBefore time.Time) (Job, error) {
+	job, err := scanSQLiteJob(s.db.QueryRowContext(ctx,
+		`UPDATE optimization_jobs SET status = ?2, started_at = ?4
+		 WHERE id = ?1 AND (status = ?3 OR (status = ?2 AND started_at < ?5)) RETURNING `+columns,
+		id, Running, Queued, time.Now().UnixNano(), staleBefore.UnixNano()))
+	if errors.Is(err, ErrNotFound) {
+		if _, getErr := s.Get(ctx, id); getErr == nil {
+			return Job{}, ErrNotClaimable
+		}
+	}
+	return job, err
+}
+
+func (s *SQLiteStore) SaveCheckpoint(ctx context.Context, id string, state json.RawMessage) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE optimization_jobs SET checkpoint = ? WHERE id = ? AND status = ?`, []byte(state), id, Running)
+	return checkpointSaved(ctx, res, err, s.Get, id)
+}
+
+func (s *SQLiteStore) Finish(ctx context.Context, job Job) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE optimization_jobs SET status = ?, result = ?, result_key = ?, error = ?, finished_at = ?, checkpoint = NULL
+		 WHERE id = ? AND status <> ?`,
+		job.Status, nullJSON(job.Result), job.ResultKey, job.Error, unixNano(job.FinishedAt), job.ID, Cancelled)
+	return checkpointSaved(ctx, res, err, s.Get, job.ID)
+}
+
+func (s *SQLiteStore) Cancel(ctx context.Context, id string) (Job, error) {
+	job, err := scanSQLiteJob(s.db.QueryRowContext(ctx,
+		`UPDATE optimization_jobs SET status = ?2, finished_at = ?5, checkpoint = NULL
+		 WHERE id = ?1 AND status IN (?3, ?4) RETURNING `+columns,
+		id, Cancelled, Queued, Running, time.Now().UnixNano()))
+	if errors.Is(err, ErrNotFound) {
+		if _, getErr := s.Get(ctx, id); getErr == nil {
+			return Job{}, ErrFinished
+		}
+	}
+	return job, err
+}
+
+func (s *SQLiteStore) Queued(ctx context.Context) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+columns+` FROM optimization_jobs WHERE status = ? ORDER BY created_at`, Queued)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows, scanSQLiteJob)
+}
+
+func (s *SQLiteStore) List(ctx context.Context, f Filter) ([]Job, error) {
+	query, args := listQuery(f, sqliteListColumns, func(int) string { return "?" })
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			args[i] = t.UnixNano()
+		}
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows, scanSQLiteJob)
+}
+
+func (s *SQLiteStore) RequeueStale(ctx context.Context, cutoff time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE optimization_jobs SET status = ?, started_at = NULL WHERE status = ? AND started_at < ?`,
+		Queued, Running, cutoff.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func scanSQLiteJob(row scanner) (Job, error) {
+	var job Job
+	var request, result, checkpoint []byte
+	var created int64
+	var started, finished sql.NullInt64
+	err := row.Scan(&job.ID, &job.Tenant, &job.Client, &job.Endpoint, &job.Status, &request, &result,
+		&job.ResultKey, &job.Error, &created, &started, &finished, &checkpoint)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	job.Request, job.Result, job.Checkpoint = request, result, checkpoint
+	job.CreatedAt = time.Unix(0, created).UTC()
+	job.StartedAt, job.FinishedAt = fromUnixNano(started), fromUnixNano(finished)
+	return job, nil
+}
+
+func unixNano(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n sql.NullInt64) *time.Time {
+	if !n.Valid {
+		return nil
+	}
+	t := time.Unix(0, n.Int64).UTC()
+	return &t
+}
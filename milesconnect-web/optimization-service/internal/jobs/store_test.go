@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openStores returns each store the tests can reach: memory and sqlite always, and
+// postgres when JOBS_TEST_POSTGRES_DSN names a database the tests may write to
+func openStores(t *testing.T) map[string]Store {
+	t.Helper()
+	ctx := context.Background()
+	stores := map[string]Store{"memory": NewMemoryStore(0, 0)}
+	lite, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores["sqlite"] = lite
+	if dsn := os.Getenv("JOBS_TEST_POSTGRES_DSN"); dsn != "" {
+		pg, err := OpenPostgres(ctx, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores["postgres"] = pg
+	}
+	for _, s := range stores {
+		t.Cleanup(func() { s.Close() })
+	}
+	return stores
+}
+
+func newTestJob() Job {
+	return Job{
+		ID: NewID(), Tenant: "acme", Client: "dispatch", Endpoint: "optimize", Status: Queued,
+		Request: json.RawMessage(`{"waypoints":[]}`), CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+func TestStoreLifecycle(t *testing.T) {
+	for name, store := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			job := newTestJob()
+			if err := store.Create(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+
+			claimed, err := store.Claim(ctx, job.ID, time.Time{})
+			if err != nil {
+				t.Fatalf("claim: %v", err)
+			}
+			if claimed.Status != Running || claimed.StartedAt == nil || string(claimed.Request) != string(job.Request) {
+				t.Fatalf("claimed %+v, want it running with a start time and its request", claimed)
+			}
+			// A running job is only claimed again once its start is before staleBefore
+			if _, err := store.Claim(ctx, job.ID, time.Time{}); !errors.Is(err, ErrNotClaimable) {
+				t.Errorf("second claim: %v, want ErrNotClaimable", err)
+			}
+			if _, err := store.Claim(ctx, job.ID, time.Now().Add(-time.Minute)); !errors.Is(err, ErrNotClaimable) {
+				t.Errorf("claim of a live job: %v, want ErrNotClaimable", err)
+			}
+			reclaimed, err := store.Claim(ctx, job.ID, time.Now().Add(time.Minute))
+			if err != nil {
+				t.Fatalf("claim of a stale job: %v", err)
+			}
+			if reclaimed.Status != Running || reclaimed.StartedAt == nil || reclaimed.StartedAt.Before(*claimed.StartedAt) {
+				t.Errorf("reclaimed %+v, want it running and started again", reclaimed)
+			}
+
+			if err := store.SaveCheckpoint(ctx, job.ID, json.RawMessage(`{"iterations":3}`)); err != nil {
+				t.Fatalf("checkpoint: %v", err)
+			}
+			if got, _ := store.Get(ctx, job.ID); string(got.Checkpoint) != `{"iterations":3}` {
+				t.Errorf("checkpoint = %s, want the one saved", got.Checkpoint)
+			}
+
+			done := time.Now().UTC().Truncate(time.Microsecond)
+			reclaimed.Status, reclaimed.Result, reclaimed.FinishedAt = Succeeded, json.RawMessage(`{"total_distance_km":1}`), &done
+			if err := store.Finish(ctx, reclaimed); err != nil {
+				t.Fatalf("finish: %v", err)
+			}
+			got, err := store.Get(ctx, job.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != Succeeded || string(got.Result) != `{"total_distance_km":1}` || got.FinishedAt == nil || got.Checkpoint != nil {
+				t.Errorf("finished %+v, want it succeeded with its result and no checkpoint", got)
+			}
+
+			if _, err := store.Claim(ctx, job.ID, time.Now().Add(time.Minute)); !errors.Is(err, ErrNotClaimable) {
+				t.Errorf("claim of a finished job: %v, want ErrNotClaimable", err)
+			}
+			if err := store.SaveCheckpoint(ctx, job.ID, json.RawMessage(`{}`)); !errors.Is(err, ErrNotClaimable) {
+				t.Errorf("checkpoint of a finished job: %v, want ErrNotClaimable", err)
+			}
+			if _, err := store.Cancel(ctx, job.ID); !errors.Is(err, ErrFinished) {
+				t.Errorf("cancel of a finished job: %v, want ErrFinished", err)
+			}
+			if _, err := store.Claim(ctx, NewID(), time.Time{}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("claim of an unknown job: %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStoreCancelledWhileRunning(t *testing.T) {
+	for name, store := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			job := newTestJob()
+			if err := store.Create(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+			claimed, err := store.Claim(ctx, job.ID, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cancelled, err := store.Cancel(ctx, job.ID); err != nil || cancelled.Status != Cancelled {
+				t.Fatalf("cancel: %+v, %v", cancelled, err)
+			}
+			// The worker's result is discarded and the job stays cancelled
+			now := time.Now().UTC()
+			claimed.Status, claimed.FinishedAt = Succeeded, &now
+			if err := store.Finish(ctx, claimed); !errors.Is(err, ErrNotClaimable) {
+				t.Errorf("finish: %v, want ErrNotClaimable", err)
+			}
+			if got, _ := store.Get(ctx, job.ID); got.Status != Cancelled {
+				t.Errorf("status %s, want cancelled", got.Status)
+			}
+			if _, err := store.Claim(ctx, job.ID, time.Now().Add(time.Minute)); !errors.Is(err, ErrNotClaimable) {
+				t.Errorf("claim: %v, want ErrNotClaimable", err)
+			}
+		})
+	}
+}
+
+func TestStoreRequeueStale(t *testing.T) {
+	for name, store := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			job := newTestJob()
+			if err := store.Create(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Claim(ctx, job.ID, time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+			// A shared postgres may hold other jobs, so only this one's status is checked
+			if _, err := store.RequeueStale(ctx, time.Now().Add(-time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := store.Get(ctx, job.ID); got.Status != Running {
+				t.Errorf("live job %s after requeueing, want running", got.Status)
+			}
+			if n, err := store.RequeueStale(ctx, time.Now().Add(time.Minute)); err != nil || n < 1 {
+				t.Fatalf("requeued %d stale jobs (%v), want this one", n, err)
+			}
+			queued, err := store.Queued(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, q := range queued {
+				found = found || q.ID == job.ID
+			}
+			if !found {
+				t.Errorf("requeued job missing from Queued")
+			}
+			if _, err := store.Claim(ctx, job.ID, time.Time{}); err != nil {
+				t.Errorf("claim of a requeued job: %v", err)
+			}
+		})
+	}
+}
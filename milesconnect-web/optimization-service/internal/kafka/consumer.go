@@ -0,0 +1,189 @@
+// Package kafka serves optimization requests from a Kafka topic, publishing each
+// result to a response topic under the request's key.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Message headers read from requests and set on responses
+const (
+	HeaderEndpoint = "endpoint" // optimize (default) or optimize-load
+	HeaderTenant   = "tenant"
+)
+
+// Config selects the brokers, topics and consumer group
+type Config struct {
+	Brokers       []string
+	Group         string
+	RequestTopic  string
+	ResponseTopic string
+	Workers       int // group members in this process; each handles its partitions in order
+}
+
+// Request is one consumed message. ID is the message key, used as the request ID;
+// unkeyed messages get one from their topic, partition and offset.
+type Request struct {
+	ID       string
+	Endpoint string
+	Tenant   string
+	Body     []byte
+}
+
+// Handler solves a request and returns the response message value
+type Handler func(ctx context.Context, req Request) []byte
+
+// Consumer reads requests in a consumer group and publishes the handler's responses.
+// A request's offset is committed only after its response is published, so requests
+// are processed at least once; consumers should deduplicate responses by key.
+type Consumer struct {
+	cfg    Config
+	handle Handler
+	writer *kafka.Writer
+
+	stopFetch context.CancelFunc
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	readers   []*kafka.Reader
+}
+
+// NewConsumer returns a consumer for cfg; it connects once started
+func NewConsumer(cfg Config, handle Handler) *Consumer {
+	return &Consumer{
+		cfg:    cfg,
+		handle: handle,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.ResponseTopic,
+			Balancer:     &kafka.Hash{}, // keeps a request's responses on one partition
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+// Ping checks a broker is reachable, for readiness probes
+func (c *Consumer) Ping(ctx context.Context) error {
+	var errs []error
+	for _, broker := range c.cfg.Brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Start joins the consumer group. Requests are solved under ctx; cancelling it aborts
+// them uncommitted, so they are consumed again.
+func (c *Consumer) Start(ctx context.Context) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	c.stopFetch = cancel
+	for i := 0; i < max(c.cfg.Workers, 1); i++ {
+		r := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: c.cfg.Brokers,
+			GroupID: c.cfg.Group,
+			Topic:   c.cfg.RequestTopic,
+		})
+		c.mu.Lock()
+		c.readers = append(c.readers, r)
+		c.mu.Unlock()
+		c.wg.Add(1)
+		go c.consume(ctx, fetchCtx, r)
+	}
+}
+
+// Stop makes the workers exit once their current request is done
+func (c *Consumer) Stop() {
+	if c.stopFetch != nil {
+		c.stopFetch()
+	}
+}
+
+// Wait blocks until the workers have exited after Stop
+func (c *Consumer) Wait() {
+	c.wg.Wait()
+}
+
+// Close leaves the consumer group and flushes the producer
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	errs := []error{c.writer.Close()}
+	for _, r := range c.readers {
+		errs = append(errs, r.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Consumer) consume(ctx, fetchCtx context.Context, r *kafka.Reader) {
+	defer c.wg.Done()
+	for {
+		msg, err := r.FetchMessage(fetchCtx)
+		if fetchCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("kafka fetch", "topic", c.cfg.RequestTopic, "error", err)
+			if !sleep(fetchCtx, time.Second) {
+				return
+			}
+			continue
+		}
+
+		req := Request{ID: string(msg.Key), Body: msg.Value}
+		if req.ID == "" {
+			req.ID = fmt.Sprintf("%s-%d-%d", msg.Topic, msg.Partition, msg.Offset)
+		}
+		for _, h := range msg.Headers {
+			switch h.Key {
+			case HeaderEndpoint:
+				req.Endpoint = string(h.Value)
+			case HeaderTenant:
+				req.Tenant = string(h.Value)
+			}
+		}
+		resp := c.handle(ctx, req)
+		if ctx.Err() != nil {
+			return
+		}
+
+		out := kafka.Message{
+			Key:     []byte(req.ID),
+			Value:   resp,
+			Headers: []kafka.Header{{Key: HeaderEndpoint, Value: []byte(req.Endpoint)}},
+		}
+		// The response must be out before the offset moves past the request, so keep
+		// trying; the partition waits meanwhile
+		for {
+			err := c.writer.WriteMessages(context.WithoutCancel(ctx), out)
+			if err == nil {
+				break
+			}
+			slog.Error("kafka publish", "topic", c.cfg.ResponseTopic, "request_id", req.ID, "error", err)
+			if !sleep(ctx, time.Second) {
+				return
+			}
+		}
+		if err := r.CommitMessages(context.WithoutCancel(ctx), msg); err != nil {
+			slog.Error("kafka commit", "topic", c.cfg.RequestTopic, "request_id", req.ID, "error", err)
+		}
+	}
+}
+
+// sleep waits for d, reporting false if ctx ended first
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// level is shared by every logger from New so SetLevel takes effect without rebuilding them
+var level slog.LevelVar
+
+// New builds the service logger. format is "json" (default) or "text"; lvl is one
+// of debug, info, warn or error. Records logged with a request context carry its request ID.
+func New(w io.Writer, format, lvl string) *slog.Logger {
+	SetLevel(lvl)
+	opts := &slog.HandlerOptions{Level: &level}
+
+	var h slog.Handler
+	if strings.EqualFold(format, "text") {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// SetLevel changes the minimum level of loggers built by New; unknown values mean info
+func SetLevel(lvl string) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(lvl)); err != nil {
+		l = slog.LevelInfo
+	}
+	level.Set(l)
+}
+
+type requestIDKey struct{}
+type fieldsKey struct{}
+
+// WithRequestID attaches the request ID to ctx
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID from the record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Fields collects attributes that handlers attach to the request's access log line
+type Fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// Attrs returns the collected attributes
+func (f *Fields) Attrs() []slog.Attr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slog.Attr(nil), f.attrs...)
+}
+
+// WithFields starts collecting access log attributes for a request
+func WithFields(ctx context.Context) (context.Context, *Fields) {
+	f := &Fields{}
+	return context.WithValue(ctx, fieldsKey{}, f), f
+}
+
+// Annotate adds attributes to the request's access log line; it is a no-op outside a request
+func Annotate(ctx context.Context, attrs ...slog.Attr) {
+	f, ok := ctx.Value(fieldsKey{}).(*Fields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	f.attrs = append(f.attrs, attrs...)
+	f.mu.Unlock()
+}
@@ -0,0 +1,121 @@
+// Package manifest renders a solved route as a driver manifest, the stop list with
+// addresses, times and what to unload at each stop, for depots that hand drivers paper.
+package manifest
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"milesconnect-optimization/internal/models"
+	"strings"
+	"time"
+)
+
+// Manifest is a route as printed for its driver
+type Manifest struct {
+	Departure   string // date and time the route starts; empty without a schedule
+	DistanceKm  float64
+	DurationMin float64
+	Stops       []Stop
+	TotalKg     float64  // delivered over the route
+	Unassigned  []string // waypoints left off the route
+}
+
+// Stop is one line of the manifest. Seq numbers the deliveries; the start, end and
+// reloads at the start have none.
+type Stop struct {
+	Seq       int
+	Kind      string // start, stop, reload or end
+	ID        string
+	Address   string // coordinates when the stop has no address
+	Window    string
+	Arrival   string
+	Departure string
+	LoadKg    float64
+	Items     []string // stops merged into this one, each a delivery of its own
+	Notes     []string
+}
+
+// Kinds of Stop
+const (
+	KindStart  = "start"
+	KindStop   = "stop"
+	KindReload = "reload"
+	KindEnd    = "end"
+)
+
+// Build lays out resp, a finished route for req, as a manifest. Times are local to each
+// stop and written without their date when it is the departure's.
+func Build(req models.OptimizationRequest, resp models.OptimizationResponse) Manifest {
+	m := Manifest{DistanceKm: resp.TotalDistKm, DurationMin: resp.TotalDurationMin}
+	var day string
+	if len(resp.Schedule) > 0 {
+		if t, err := time.Parse(time.RFC3339, resp.Schedule[0].Departure); err == nil {
+			m.Departure, day = t.Format("Mon 2 Jan 2006 15:04"), t.Format(time.DateOnly)
+		}
+	}
+	clock := func(v string) string {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return v
+		}
+		if t.Format(time.DateOnly) == day {
+			return t.Format("15:04")
+		}
+		return t.Format("2 Jan 15:04")
+	}
+
+	seq := 0
+	for i, loc := range resp.Route {
+		s := Stop{ID: loc.ID, Address: loc.Address, Items: loc.MergedIDs}
+		if s.Address == "" {
+			s.Address = fmt.Sprintf("%.5f, %.5f", loc.Lat, loc.Lng)
+		}
+		switch {
+		case i == 0:
+			s.Kind = KindStart
+		case i == len(resp.Route)-1:
+			s.Kind = KindEnd
+		case loc.ID == req.Start.ID && loc.Lat == req.Start.Lat && loc.Lng == req.Start.Lng:
+			s.Kind = KindReload
+		default:
+			seq++
+			s.Seq, s.Kind, s.LoadKg = seq, KindStop, loc.DemandKg
+			m.TotalKg += loc.DemandKg
+		}
+		if w := loc.TimeWindow; w != nil && (w.Start != "" || w.End != "") {
+			s.Window = clock(w.Start) + "–" + clock(w.End)
+		}
+		if i < len(resp.Schedule) {
+			eta := resp.Schedule[i]
+			s.Arrival, s.Departure = clock(eta.Arrival), clock(eta.Departure)
+			switch {
+			case eta.Closed:
+				s.Notes = append(s.Notes, "closed")
+			case eta.LateMinutes > 0:
+				s.Notes = append(s.Notes, fmt.Sprintf("%.0f min late", eta.LateMinutes))
+			}
+			if eta.WaitMinutes > 0 {
+				s.Notes = append(s.Notes, fmt.Sprintf("wait %.0f min", eta.WaitMinutes))
+			}
+		}
+		m.Stops = append(m.Stops, s)
+	}
+	for _, loc := range resp.Unassigned {
+		m.Unassigned = append(m.Unassigned, loc.ID)
+	}
+	return m
+}
+
+//go:embed manifest.html
+var htmlSource string
+
+var page = template.Must(template.New("manifest").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(htmlSource))
+
+// HTML writes m as a page laid out for printing
+func (m Manifest) HTML(w io.Writer) error {
+	return page.Execute(w, m)
+}
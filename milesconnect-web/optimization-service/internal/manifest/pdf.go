@@ -0,0 +1,179 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Page layout, in points: A4 landscape
+const (
+	pageWidth, pageHeight = 842, 595
+	margin                = 36
+	fontSize              = 8.5
+	rowHeight             = 15
+)
+
+// column is a manifest table column: where it starts and how many characters of
+// Helvetica at fontSize fit before the next one
+type column struct {
+	title string
+	x     float64
+	chars int
+	cell  func(Stop) string
+}
+
+var columns = []column{
+	{"#", margin, 6, func(s Stop) string {
+		if s.Seq > 0 {
+			return strconv.Itoa(s.Seq)
+		}
+		return s.Kind
+	}},
+	{"Stop", 70, 16, func(s Stop) string { return s.ID }},
+	{"Address", 150, 48, func(s Stop) string { return s.Address }},
+	{"Window", 370, 14, func(s Stop) string { return s.Window }},
+	{"Arrive", 440, 11, func(s Stop) string { return s.Arrival }},
+	{"Leave", 495, 11, func(s Stop) string { return s.Departure }},
+	{"Kg", 550, 8, func(s Stop) string {
+		if s.LoadKg == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(s.LoadKg, 'f', 1, 64)
+	}},
+	{"Items", 590, 22, func(s Stop) string { return strings.Join(s.Items, ", ") }},
+	{"Notes", 690, 14, func(s Stop) string { return strings.Join(s.Notes, ", ") }},
+	{"Signature", 750, 0, func(Stop) string { return "" }},
+}
+
+// PDF writes m as a PDF document, the stops in a table continued over as many pages as
+// it takes with its header repeated. It uses the standard Helvetica fonts, so text
+// outside their Windows-1252 character set prints as '?'.
+func (m Manifest) PDF(w io.Writer) error {
+	perPage := int((pageHeight - 2*margin - 60) / rowHeight)
+	var pages []string
+	for first := 0; first == 0 || first < len(m.Stops); first += perPage {
+		last := min(first+perPage, len(m.Stops))
+		pages = append(pages, m.pageContent(m.Stops[first:last], len(pages)+1, last == len(m.Stops)))
+	}
+
+	doc := pdfWriter{}
+	pageRefs := make([]string, len(pages))
+	for i := range pages {
+		pageRefs[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	doc.object("<< /Type /Catalog /Pages 2 0 R >>")
+	doc.object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageRefs, " "), len(pages)))
+	doc.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	doc.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range pages {
+		doc.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Contents %d 0 R /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> >>",
+			pageWidth, pageHeight, 6+2*i))
+		doc.object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+	_, err := w.Write(doc.finish())
+	return err
+}
+
+// pageContent is the content stream of the page numbered n showing stops; the last
+// page also lists the unassigned waypoints
+func (m Manifest) pageContent(stops []Stop, n int, last bool) string {
+	var c strings.Builder
+	text := func(font string, size, x, y float64, s string) {
+		fmt.Fprintf(&c, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+	}
+	y := float64(pageHeight - margin - 14)
+	text("F2", 14, margin, y, "Driver manifest")
+	summary := fmt.Sprintf("%d locations  ·  %.1f km  ·  %.0f min", len(m.Stops), m.DistanceKm, m.DurationMin)
+	if m.Departure != "" {
+		summary = "Departs " + m.Departure + "  ·  " + summary
+	}
+	if m.TotalKg > 0 {
+		summary += fmt.Sprintf("  ·  %.1f kg to deliver", m.TotalKg)
+	}
+	text("F1", 9, margin, y-16, summary)
+	text("F1", 8, pageWidth-margin-40, y, "Page "+strconv.Itoa(n))
+
+	y -= 40
+	for _, col := range columns {
+		text("F2", fontSize, col.x, y, col.title)
+	}
+	fmt.Fprintf(&c, "0.5 w %d %.1f m %d %.1f l S\n", margin, y-4, pageWidth-margin, y-4)
+	for _, s := range stops {
+		y -= rowHeight
+		for _, col := range columns {
+			if v := col.cell(s); v != "" {
+				text("F1", fontSize, col.x, y, truncate(v, col.chars))
+			}
+		}
+		// A line to sign on at deliveries, a rule under every row
+		if s.Kind == KindStop {
+			fmt.Fprintf(&c, "0.3 w %d %.1f m %d %.1f l S\n", 755, y-1, pageWidth-margin, y-1)
+		}
+		fmt.Fprintf(&c, "0.2 w %d %.1f m %d %.1f l S\n", margin, y-5, pageWidth-margin, y-5)
+	}
+	if last && len(m.Unassigned) > 0 {
+		text("F1", 9, margin, y-rowHeight-6, truncate("Not on this route: "+strings.Join(m.Unassigned, ", "), 160))
+	}
+	return c.String()
+}
+
+// truncate shortens s to n characters, marking the cut
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:max(n-3, 0)]) + "..."
+}
+
+// winAnsi maps the characters of Windows-1252 above Latin-1's control range that
+// manifests use to their codes
+var winAnsi = map[rune]byte{'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '–': 0x96, '—': 0x97}
+
+// pdfString encodes s as the body of a PDF literal string in WinAnsiEncoding
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch code, ok := winAnsi[r]; {
+		case ok:
+			b.WriteByte(code)
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r >= 0x20 && r < 0x7f || r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfWriter assembles a PDF file of numbered objects and their cross-reference table
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+// object appends the next object, numbered from 1
+func (p *pdfWriter) object(body string) {
+	if p.buf.Len() == 0 {
+		p.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	}
+	p.offsets = append(p.offsets, p.buf.Len())
+	fmt.Fprintf(&p.buf, "%d 0 obj\n%s\nendobj\n", len(p.offsets), body)
+}
+
+// finish appends the cross-reference table and trailer and returns the file
+func (p *pdfWriter) finish() []byte {
+	xref := p.buf.Len()
+	fmt.Fprintf(&p.buf, "xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, off := range p.offsets {
+		fmt.Fprintf(&p.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&p.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, xref)
+	return p.buf.Bytes()
+}
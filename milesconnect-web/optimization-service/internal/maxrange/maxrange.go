@@ -0,0 +1,136 @@
+// Package maxrange keeps a solved route within its vehicle's range, leaving out the
+// waypoints it can least afford to drive to.
+package maxrange
+
+import (
+	"math"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/priority"
+	"milesconnect-optimization/internal/reload"
+	"slices"
+)
+
+// Trim returns resp, a solved route for req, with waypoints taken out until the route
+// is no longer than req.MaxRangeKm, the reloads for req.VehicleCapacityKg included.
+// Each waypoint taken out is the one whose tier's unserved penalty is least per km its
+// detour costs; the rest keep their order. Taken-out waypoints that fit back in at their
+// cheapest position once the route is short enough are put back, the most penalty per
+// km first, and the others go to resp.Unassigned, with where it would cost least to put
+// them back in resp.UnassignedStops. Distances come from matrix (see
+// geo.RequestPoints) when set, otherwise great circles. resp is returned as it is when
+// the request has no range or its route isn't one of the request's points.
+func Trim(req models.OptimizationRequest, resp models.OptimizationResponse, matrix geo.Matrix) models.OptimizationResponse {
+	if req.MaxRangeKm <= 0 {
+		return resp
+	}
+	points := geo.RequestPoints(req)
+	index, ok := geo.RouteIndices(points, resp.Route)
+	if !ok || len(index) < 2 {
+		return resp
+	}
+	gc := geo.Prepare(points)
+	km := func(a, b int) float64 {
+		if matrix != nil {
+			return matrix[a][b]
+		}
+		return gc.Km(a, b)
+	}
+	stops := index[1 : len(index)-1]
+	dist := reload.Distance(points, stops, req.VehicleCapacityKg, km)
+	if dist <= req.MaxRangeKm {
+		return resp
+	}
+
+	var dropped []int
+	for len(stops) > 0 && dist > req.MaxRangeKm {
+		drop, best := 0, math.Inf(1)
+		for k, p := range stops {
+			prev, next := 0, len(points)-1
+			if k > 0 {
+				prev = stops[k-1]
+			}
+			if k+1 < len(stops) {
+				next = stops[k+1]
+			}
+			detour := km(prev, p) + km(p, next) - km(prev, next)
+			if cost := priority.Lookup(req.TierPenalties, points[p].Tier).Unserved / max(detour, 1e-9); cost < best {
+				drop, best = k, cost
+			}
+		}
+		dropped = append(dropped, stops[drop])
+		stops = slices.Delete(slices.Clone(stops), drop, drop+1)
+		dist = reload.Distance(points, stops, req.VehicleCapacityKg, km)
+	}
+
+	// Dropping a later stop can leave room for an earlier one
+	for {
+		back, at, best := -1, 0, -1.0
+		for k, p := range dropped {
+			ins := insertion(req, points, stops, p, dist, km)
+			if len(ins.BlockedBy) > 0 {
+				continue
+			}
+			if value := priority.Lookup(req.TierPenalties, points[p].Tier).Unserved / max(ins.ExtraKm, 1e-9); value > best {
+				back, at, best = k, ins.AfterStops, value
+			}
+		}
+		if back < 0 {
+			break
+		}
+		stops = slices.Insert(slices.Clone(stops), at, dropped[back])
+		dropped = slices.Delete(dropped, back, back+1)
+		dist = reload.Distance(points, stops, req.VehicleCapacityKg, km)
+	}
+
+	route := []models.Location{points[0]}
+	for _, p := range stops {
+		route = append(route, points[p])
+	}
+	resp.Route = append(route, points[len(points)-1])
+	slices.Sort(dropped)
+	for _, p := range dropped {
+		resp.Unassigned = append(resp.Unassigned, points[p])
+		resp.UnassignedStops = append(resp.UnassignedStops, models.UnassignedStop{
+			ID:        points[p].ID,
+			Reason:    models.ConstraintMaxRange,
+			Insertion: insertion(req, points, stops, p, dist, km),
+		})
+	}
+	// The distance without reloads, which reload.Split adds to the route afterwards
+	resp.TotalDistKm = reload.Distance(points, stops, 0, km)
+	resp.Metadata.ObjectiveValue = resp.TotalDistKm
+	return resp
+}
+
+// insertion puts p back into stops, whose route is dist long, where its detour is
+// shortest, and measures how far past req.MaxRangeKm that takes the route
+func insertion(req models.OptimizationRequest, points []models.Location, stops []int, p int, dist float64, km func(a, b int) float64) models.Insertion {
+	at, best := 0, math.Inf(1)
+	for k := 0; k <= len(stops); k++ {
+		prev, next := 0, len(points)-1
+		if k > 0 {
+			prev = stops[k-1]
+		}
+		if k < len(stops) {
+			next = stops[k]
+		}
+		if detour := km(prev, p) + km(p, next) - km(prev, next); detour < best {
+			at, best = k, detour
+		}
+	}
+	ins := models.Insertion{AfterStops: at, AfterID: points[0].ID, BeforeID: points[len(points)-1].ID, BlockedBy: []string{}}
+	if at > 0 {
+		ins.AfterID = points[stops[at-1]].ID
+	}
+	if at < len(stops) {
+		ins.BeforeID = points[stops[at]].ID
+	}
+	total := reload.Distance(points, slices.Insert(slices.Clone(stops), at, p), req.VehicleCapacityKg, km)
+	ins.ExtraKm = math.Round((total-dist)*100) / 100
+	if over := total - req.MaxRangeKm; over > 0 {
+		ins.BlockedBy = append(ins.BlockedBy, models.ConstraintMaxRange)
+		ins.RangeExceededKm = math.Round(over*100) / 100
+	}
+	return ins
+}
@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector is anything that can write itself in the Prometheus text format
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds the metrics exposed on /metrics
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// Default is the registry the service's metrics are registered with
+var Default = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+}
+
+// Handler serves the registry in the Prometheus text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.mu.Lock()
+		collectors := append([]collector(nil), r.collectors...)
+		r.mu.Unlock()
+		for _, c := range collectors {
+			c.write(w)
+		}
+	})
+}
+
+// vec holds one value per label combination
+type vec[T any] struct {
+	name, help, kind string
+	labels           []string
+
+	mu     sync.Mutex
+	values map[string]T
+	newT   func() T
+}
+
+func (v *vec[T]) get(labelValues []string) T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	t, ok := v.values[key]
+	if !ok {
+		t = v.newT()
+		v.values[key] = t
+	}
+	return t
+}
+
+// each calls fn for every label combination in a stable order
+func (v *vec[T]) each(fn func(labels string, t T)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]T, len(keys))
+	for i, k := range keys {
+		values[i] = v.values[k]
+	}
+	v.mu.Unlock()
+
+	for i, k := range keys {
+		fn(v.formatLabels(strings.Split(k, "\xff")), values[i])
+	}
+}
+
+func (v *vec[T]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+}
+
+func (v *vec[T]) formatLabels(values []string) string {
+	if len(v.labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(v.labels))
+	for i, l := range v.labels {
+		pairs[i] = l + "=" + strconv.Quote(values[i])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+// CounterVec is a monotonically increasing value per label combination
+type CounterVec struct {
+	vec[*value]
+}
+
+// NewCounterVec creates and registers a counter
+func NewCounterVec(r *Registry, name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec[*value]{name: name, help: help, kind: "counter", labels: labels,
+		values: map[string]*value{}, newT: func() *value { return &value{} }}}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the counter for labelValues
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta (which must not be negative) to the counter for labelValues
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	v := c.get(labelValues)
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.header(w)
+	c.each(func(labels string, v *value) {
+		v.mu.Lock()
+		fmt.Fprintf(w, "%s%s %s\n", c.name, braces(labels), formatFloat(v.v))
+		v.mu.Unlock()
+	})
+}
+
+// GaugeVec is a value per label combination that can go up and down
+type GaugeVec struct {
+	vec[*value]
+}
+
+// NewGaugeVec creates and registers a gauge
+func NewGaugeVec(r *Registry, name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec[*value]{name: name, help: help, kind: "gauge", labels: labels,
+		values: map[string]*value{}, newT: func() *value { return &value{} }}}
+	r.register(g)
+	return g
+}
+
+// Add adds delta to the gauge for labelValues
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	v := g.get(labelValues)
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+// Set sets the gauge for labelValues
+func (g *GaugeVec) Set(val float64, labelValues ...string) {
+	v := g.get(labelValues)
+	v.mu.Lock()
+	v.v = val
+	v.mu.Unlock()
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.header(w)
+	g.each(func(labels string, v *value) {
+		v.mu.Lock()
+		fmt.Fprintf(w, "%s%s %s\n", g.name, braces(labels), formatFloat(v.v))
+		v.mu.Unlock()
+	})
+}
+
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec counts observations into fixed buckets per label combination
+type HistogramVec struct {
+	vec[*histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a histogram with the given upper bounds
+func NewHistogramVec(r *Registry, name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{buckets: sorted}
+	h.vec = vec[*histogram]{name: name, help: help, kind: "histogram", labels: labels,
+		values: map[string]*histogram{}, newT: func() *histogram {
+			return &histogram{counts: make([]uint64, len(sorted))}
+		}}
+	r.register(h)
+	return h
+}
+
+// Observe records v for labelValues
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	hist := h.get(labelValues)
+	hist.mu.Lock()
+	defer hist.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hist.counts[i]++
+			break
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.header(w)
+	h.each(func(labels string, hist *histogram) {
+		sep := ""
+		if labels != "" {
+			sep = ","
+		}
+		hist.mu.Lock()
+		defer hist.mu.Unlock()
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s%sle=%q} %d\n", h.name, labels, sep, formatFloat(upper), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", h.name, labels, sep, hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, braces(labels), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, braces(labels), hist.count)
+	})
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
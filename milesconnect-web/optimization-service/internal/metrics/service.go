@@ -0,0 +1,64 @@
+package metrics
+
+// Bucket layouts shared by the service metrics
+var (
+	latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	stopBuckets    = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+	ratioBuckets   = []float64{0, 0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+)
+
+// Service metrics
+var (
+	HTTPRequests = NewCounterVec(Default, "optimizer_http_requests_total",
+		"HTTP requests by endpoint, status code and authenticated client.", "endpoint", "status", "client")
+	HTTPDuration = NewHistogramVec(Default, "optimizer_http_request_duration_seconds",
+		"HTTP request latency by endpoint.", latencyBuckets, "endpoint")
+	AuditDropped = NewCounterVec(Default, "optimizer_audit_dropped_total",
+		"Audit records lost because the buffer was full or the sink failed.")
+	Panics = NewCounterVec(Default, "optimizer_panics_recovered_total",
+		"Handler panics recovered and answered with a 500.")
+
+	SolverDuration = NewHistogramVec(Default, "optimizer_solver_duration_seconds",
+		"Solver compute time.", latencyBuckets, "solver")
+	SolverStops = NewHistogramVec(Default, "optimizer_solver_stops",
+		"Number of stops (or shipments) per solve.", stopBuckets, "solver")
+	SolverImprovement = NewHistogramVec(Default, "optimizer_solver_improvement_ratio",
+		"Relative objective improvement over the initial (as given) solution.", ratioBuckets, "solver")
+	SolverBudgetExhausted = NewCounterVec(Default, "optimizer_solver_budget_exhausted_total",
+		"Solves that ran out of time and returned a partial result.", "solver")
+	SolvesInFlight = NewGaugeVec(Default, "optimizer_solves_in_flight",
+		"Solves currently running.", "solver")
+	ShadowRuns = NewCounterVec(Default, "optimizer_shadow_runs_total",
+		"Shadow solves run for comparison against the primary solver.", "primary", "shadow")
+	ShadowSkipped = NewCounterVec(Default, "optimizer_shadow_skipped_total",
+		"Sampled shadow solves skipped because no worker was idle.", "shadow")
+	ShadowDistanceDelta = NewHistogramVec(Default, "optimizer_shadow_distance_delta_ratio",
+		"Shadow route distance relative to the primary's: (shadow - primary) / primary.",
+		[]float64{-0.5, -0.2, -0.1, -0.05, -0.01, 0, 0.01, 0.05, 0.1, 0.2, 0.5}, "primary", "shadow")
+	ShadowDuration = NewHistogramVec(Default, "optimizer_shadow_duration_seconds",
+		"Shadow solve compute time.", latencyBuckets, "shadow")
+	SolverQueued = NewGaugeVec(Default, "optimizer_solver_queue_depth",
+		"Requests waiting for a solver worker.")
+	SolverRejected = NewCounterVec(Default, "optimizer_solver_rejected_total",
+		"Requests turned away because the solver pool was saturated, by reason.", "reason")
+
+	CacheLookups = NewCounterVec(Default, "optimizer_cache_lookups_total",
+		"Result cache lookups by endpoint and outcome (hit, miss, bypass).", "endpoint", "outcome")
+	JobsEvicted = NewCounterVec(Default, "optimizer_jobs_evicted_total",
+		"Finished jobs dropped from the memory job store, by reason (expired, capacity).", "reason")
+
+	RoutingCalls = NewCounterVec(Default, "optimizer_routing_calls_total",
+		"Distance matrix requests to the routing provider by outcome (ok, error, short_circuited).", "provider", "outcome")
+	RoutingRetries = NewCounterVec(Default, "optimizer_routing_retries_total",
+		"Retried distance matrix requests.", "provider")
+	RoutingBreakerState = NewGaugeVec(Default, "optimizer_routing_breaker_state",
+		"Routing provider circuit breaker state: 0 closed, 1 half-open, 2 open.", "provider")
+
+	GeocodingCalls = NewCounterVec(Default, "optimizer_geocoding_calls_total",
+		"Address lookups by provider and outcome (ok, cached, not_found, error).", "provider", "outcome")
+	GeocodingRetries = NewCounterVec(Default, "optimizer_geocoding_retries_total",
+		"Retried address lookups.", "provider")
+
+	WeatherLookups = NewCounterVec(Default, "optimizer_weather_lookups_total",
+		"Weather lookups by provider and outcome (ok, cached, error).", "provider", "outcome")
+)
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"milesconnect-optimization/internal/logging"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type clientKey struct{}
+
+// WithClient attaches the authenticated client name to ctx and the request's access log
+func WithClient(ctx context.Context, client string) context.Context {
+	logging.Annotate(ctx, slog.String("client", client))
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFrom returns the authenticated client name, or "" for anonymous requests
+func ClientFrom(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+// KeyStore resolves an API key to the name of the client it was issued to
+type KeyStore interface {
+	Lookup(key string) (client string, ok bool)
+}
+
+// StaticKeys is an in-memory KeyStore. Keys are stored hashed so lookups don't
+// compare secrets byte by byte.
+type StaticKeys map[[32]byte]string
+
+func (k StaticKeys) Lookup(key string) (string, bool) {
+	client, ok := k[sha256.Sum256([]byte(key))]
+	return client, ok
+}
+
+// Add registers key for client
+func (k StaticKeys) Add(client, key string) {
+	k[sha256.Sum256([]byte(key))] = client
+}
+
+// ParseKeys reads a comma-separated list of client:key pairs
+func ParseKeys(spec string) (StaticKeys, error) {
+	keys := StaticKeys{}
+	for _, pair := range strings.Split(spec, ",") {
+		if err := addPair(keys, pair); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// LoadKeyFile reads client:key pairs, one per line; blank lines and # comments are skipped
+func LoadKeyFile(path string) (StaticKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := StaticKeys{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := addPair(keys, line); err != nil {
+			return nil, err
+		}
+	}
+	return keys, scanner.Err()
+}
+
+func addPair(keys StaticKeys, pair string) error {
+	pair = strings.TrimSpace(pair)
+	if pair == "" {
+		return nil
+	}
+	client, key, ok := strings.Cut(pair, ":")
+	if !ok || client == "" || key == "" {
+		return fmt.Errorf("invalid API key entry %q, want client:key", pair)
+	}
+	keys.Add(client, key)
+	return nil
+}
+
+// Scopes required from bearer tokens for each class of endpoint
+const (
+	ScopeOptimize = "optimize"
+	ScopeAdmin    = "admin"
+)
+
+// Authenticator accepts either an X-API-Key from Keys or a bearer token verified by
+// Tokens. API keys are trusted for every scope; bearer tokens must carry the scope the
+// endpoint requires. A nil field disables that method.
+type Authenticator struct {
+	Keys   KeyStore
+	Tokens *JWTVerifier
+}
+
+// Enabled reports whether any authentication method is configured
+func (a *Authenticator) Enabled() bool {
+	return a.Keys != nil || a.Tokens != nil
+}
+
+// Require rejects unauthenticated requests and records the client name on the context
+func (a *Authenticator) Require(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && a.Tokens != nil {
+			claims, err := a.Tokens.Verify(r.Context(), strings.TrimSpace(token))
+			if err != nil {
+				slog.WarnContext(r.Context(), "rejected bearer token",
+					"remote_ip", remoteIP(r), "endpoint", r.URL.Path, "error", err)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "Invalid bearer token")
+				return
+			}
+			if !claims.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+				writeError(w, http.StatusForbidden, "Token lacks required scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithClient(r.Context(), claims.Subject)))
+			return
+		}
+
+		key := r.Header.Get(APIKeyHeader)
+		if key == "" || a.Keys == nil {
+			if a.Tokens != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			writeError(w, http.StatusUnauthorized, "Missing credentials")
+			return
+		}
+
+		client, ok := a.Keys.Lookup(key)
+		if !ok {
+			slog.WarnContext(r.Context(), "rejected invalid API key", "remote_ip", remoteIP(r), "endpoint", r.URL.Path)
+			writeError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithClient(r.Context(), client)))
+	})
+}
@@ -0,0 +1,351 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWKS refresh policy: keys are cached for jwksTTL, and an unknown kid triggers a
+// refetch at most once per jwksMinRefresh so forged kids can't hammer the IdP
+const (
+	jwksTTL        = time.Hour
+	jwksMinRefresh = time.Minute
+)
+
+var (
+	errTokenInvalid = errors.New("invalid token")
+	errTokenExpired = errors.New("token expired")
+)
+
+// JWTConfig describes the OIDC issuer whose tokens are accepted
+type JWTConfig struct {
+	Issuer   string        // required "iss" value
+	JWKSURL  string        // discovered from the issuer's openid-configuration when empty
+	Audience string        // required "aud" value; not checked when empty
+	Leeway   time.Duration // clock skew tolerated on exp/nbf
+}
+
+// Claims are the registered and scope claims the service looks at
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Scope     string   `json:"scope"` // space separated (RFC 8693)
+	Scp       []string `json:"scp"`   // array form used by some IdPs
+}
+
+// HasScope reports whether the token grants scope
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope) || slices.Contains(c.Scp, scope)
+}
+
+// audience accepts both the string and array forms of "aud"
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// JWTVerifier validates bearer tokens against an issuer's JWKS
+type JWTVerifier struct {
+	cfg    JWTConfig
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWTVerifier creates a verifier; keys are fetched lazily on first use
+func NewJWTVerifier(cfg JWTConfig) *JWTVerifier {
+	return &JWTVerifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Verify checks the token's signature, issuer, audience and validity window
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errTokenInvalid
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errTokenInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errTokenInvalid
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errTokenInvalid
+	}
+
+	now := time.Now()
+	if claims.Issuer != v.cfg.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", errTokenInvalid)
+	}
+	if v.cfg.Audience != "" && !slices.Contains(claims.Audience, v.cfg.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", errTokenInvalid)
+	}
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(v.cfg.Leeway)) {
+		return nil, errTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Add(v.cfg.Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, fmt.Errorf("%w: not yet valid", errTokenInvalid)
+	}
+
+	return &claims, nil
+}
+
+// Ready reports whether a signing key set is available, fetching it if none is cached yet
+func (v *JWTVerifier) Ready(ctx context.Context) error {
+	v.mu.RLock()
+	loaded := v.keys != nil
+	v.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	keys, err := v.fetchKeys(ctx)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.keys, v.fetchedAt, v.lastAttempt = keys, time.Now(), time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var h hash.Hash
+	var hashID crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		h, hashID = sha256.New(), crypto.SHA256
+	case "RS384", "ES384":
+		h, hashID = sha512.New384(), crypto.SHA384
+	case "RS512", "ES512":
+		h, hashID = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported alg %q", errTokenInvalid, alg)
+	}
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' || rsa.VerifyPKCS1v15(pub, hashID, digest, sig) != nil {
+			return fmt.Errorf("%w: bad signature", errTokenInvalid)
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(sig) != 2*size {
+			return fmt.Errorf("%w: bad signature", errTokenInvalid)
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", errTokenInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key type", errTokenInvalid)
+	}
+	return nil
+}
+
+// key returns the verification key for kid, refreshing the JWKS when it is stale or kid is unknown
+func (v *JWTVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	fresh := time.Since(v.fetchedAt) < jwksTTL
+	v.mu.RUnlock()
+	if ok && fresh {
+		return key, nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if time.Since(v.lastAttempt) >= jwksMinRefresh || v.keys == nil {
+		v.lastAttempt = time.Now()
+		keys, err := v.fetchKeys(ctx)
+		if err != nil {
+			// Keep serving with the cached set if the IdP is briefly unreachable
+			if v.keys == nil {
+				return nil, fmt.Errorf("fetching JWKS: %w", err)
+			}
+		} else {
+			v.keys, v.fetchedAt = keys, time.Now()
+		}
+	}
+
+	key, ok = v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", errTokenInvalid, kid)
+	}
+	return key, nil
+}
+
+func (v *JWTVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	jwksURL := v.cfg.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		wellKnown := strings.TrimSuffix(v.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := v.getJSON(ctx, wellKnown, &discovery); err != nil {
+			return nil, err
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, jwksURL, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue // skip key types we can't use rather than rejecting the whole set
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (v *JWTVerifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return parseECKey(k.Crv, x, y)
+	default:
+		return nil, fmt.Errorf("unsupported kty %q", k.Kty)
+	}
+}
+
+func parseECKey(crv string, x, y []byte) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported crv %q", crv)
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+	if len(x) > size || len(y) > size {
+		return nil, fmt.Errorf("invalid %s point", crv)
+	}
+	point := make([]byte, 1+2*size)
+	point[0] = 4 // uncompressed
+	copy(point[1+size-len(x):1+size], x)
+	copy(point[1+2*size-len(y):], y)
+	return ecdsa.ParseUncompressedPublicKey(curve, point)
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIssuer = "https://idp.example.com"
+
+// testKeys are the issuer's signing keys, published on a JWKS endpoint, and a key the
+// issuer doesn't know
+type testKeys struct {
+	ec, other *ecdsa.PrivateKey
+	rsa       *rsa.PrivateKey
+	jwks      *httptest.Server
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	k := &testKeys{}
+	var err error
+	if k.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if k.other, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if k.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	point, err := k.ec.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	set := map[string]any{"keys": []jwk{
+		{Kty: "EC", Kid: "ec", Use: "sig", Crv: "P-256", X: b64(point[1:33]), Y: b64(point[33:])},
+		{Kty: "RSA", Kid: "rsa", N: b64(k.rsa.N.Bytes()), E: b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+	}}
+	k.jwks = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(k.jwks.Close)
+	return k
+}
+
+// token signs claims with alg under kid: ES256 with key, RS256 with the issuer's RSA
+// key, and no signature at all for "none"
+func (k *testKeys) token(t *testing.T, alg, kid string, key *ecdsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	seg := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := seg(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + seg(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch alg {
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case "RS256":
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestAuthenticatorBearerTokens(t *testing.T) {
+	k := newTestKeys(t)
+	now := time.Now()
+	claims := func(edit func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss": testIssuer, "sub": "dispatch", "aud": "optimization",
+			"exp": now.Add(time.Hour).Unix(), "scope": "read " + ScopeOptimize,
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	tests := []struct {
+		name   string
+		header string // Authorization; empty sends none
+		status int
+		client string
+	}{
+		{"valid", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(nil)), http.StatusOK, "dispatch"},
+		{"valid RSA", "Bearer " + k.token(t, "RS256", "rsa", nil, claims(nil)), http.StatusOK, "dispatch"},
+		{"audience list", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(func(c map[string]any) {
+			c["aud"] = []string{"billing", "optimization"}
+		})), http.StatusOK, "dispatch"},
+		{"scp array", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(func(c map[string]any) {
+			delete(c, "scope")
+			c["scp"] = []string{ScopeOptimize}
+		})), http.StatusOK, "dispatch"},
+		{"within leeway", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(func(c map[string]any) {
+			c["exp"] = now.Add(-10 * time.Second).Unix()
+		})), http.StatusOK, "dispatch"},
+		{"bad signature", "Bearer " + k.token(t, "ES256", "ec", k.other, claims(nil)), http.StatusUnauthorized, ""},
+		{"unknown kid", "Bearer " + k.token(t, "ES256", "gone", k.ec, claims(nil)), http.StatusUnauthorized, ""},
+		{"expired", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(func(c map[string]any) {
+			c["exp"] = now.Add(-time.Hour).Unix()
+		})), http.StatusUnauthorized, ""},
+		{"no exp", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(func(c map[string]any) {
+			delete(c, "exp")
+		})), http.StatusUnauthorized, ""},
+		{"not yet valid", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(func(c map[string]any) {
+			c["nbf"] = now.Add(time.Hour).Unix()
+		})), http.StatusUnauthorized, ""},
+		{"wrong audience", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(func(c map[string]any) {
+			c["aud"] = "billing"
+		})), http.StatusUnauthorized, ""},
+		{"wrong issuer", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(func(c map[string]any) {
+			c["iss"] = "https://evil.example.com"
+		})), http.StatusUnauthorized, ""},
+		{"alg none", "Bearer " + k.token(t, "none", "ec", nil, claims(nil)), http.StatusUnauthorized, ""},
+		// An RSA signature under the EC key's kid must not pass as the EC key's
+		{"alg swapped", "Bearer " + k.token(t, "RS256", "ec", nil, claims(nil)), http.StatusUnauthorized, ""},
+		{"malformed", "Bearer not.a-token", http.StatusUnauthorized, ""},
+		{"missing scope", "Bearer " + k.token(t, "ES256", "ec", k.ec, claims(func(c map[string]any) {
+			c["scope"] = "read"
+		})), http.StatusForbidden, ""},
+		{"missing header", "", http.StatusUnauthorized, ""},
+	}
+
+	auth := &Authenticator{Tokens: NewJWTVerifier(JWTConfig{
+		Issuer: testIssuer, JWKSURL: k.jwks.URL, Audience: "optimization", Leeway: time.Minute,
+	})}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client string
+			h := auth.Require(ScopeOptimize, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				client = ClientFrom(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/optimize", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status || client != tt.client {
+				t.Fatalf("status %d, client %q; want %d, %q (body %s)", rec.Code, client, tt.status, tt.client, strings.TrimSpace(rec.Body.String()))
+			}
+			if rec.Code != http.StatusOK && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer") {
+				t.Errorf("WWW-Authenticate = %q, want a Bearer challenge", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
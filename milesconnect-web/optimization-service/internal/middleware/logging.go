@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"milesconnect-optimization/internal/logging"
+	"milesconnect-optimization/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// statusRecorder captures the status code written by the wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, to flush streamed responses
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// RequestID reuses a well-formed incoming X-Request-ID or generates one, and echoes it back
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog logs one structured line per request with status, duration, the
+// authenticated client and whatever the handler added through logging.Annotate, and
+// records the request metrics. Metrics are labelled with the mux pattern the request
+// matched rather than the raw path to keep label cardinality bounded.
+func AccessLog(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		ctx, fields := logging.WithFields(r.Context())
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		elapsed := time.Since(started)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("endpoint", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+		}
+		attrs = append(attrs, fields.Attrs()...)
+		slog.LogAttrs(ctx, slog.LevelInfo, "request", attrs...)
+
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+		client := "anonymous"
+		for _, a := range attrs {
+			if a.Key == "client" {
+				client = a.Value.String()
+			}
+		}
+		metrics.HTTPRequests.Inc(pattern, strconv.Itoa(rec.status), client)
+		metrics.HTTPDuration.Observe(elapsed.Seconds(), pattern)
+	})
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"milesconnect-optimization/internal/metrics"
+)
+
+// headerTracker notes whether the response has started, after which a 500 can no longer be sent
+type headerTracker struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (h *headerTracker) WriteHeader(code int) {
+	h.started = true
+	h.ResponseWriter.WriteHeader(code)
+}
+
+func (h *headerTracker) Write(b []byte) (int, error) {
+	h.started = true
+	return h.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (h *headerTracker) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
+// Recover turns a panic in next into a logged stack trace and a 500 JSON error, so a
+// single bad request can't take the process down. http.ErrAbortHandler is re-raised
+// since net/http uses it to abort a response deliberately.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &headerTracker{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			slog.ErrorContext(r.Context(), "panic serving request",
+				"method", r.Method, "endpoint", r.URL.Path,
+				"panic", fmt.Sprint(v), "stack", string(debug.Stack()))
+			metrics.Panics.Inc()
+			if !tw.started {
+				writeError(tw, http.StatusInternalServerError, "Internal server error")
+			}
+		}()
+		next.ServeHTTP(tw, r)
+	})
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+
+	"milesconnect-optimization/internal/buildinfo"
+)
+
+// VersionHeader names the build that served the response
+const VersionHeader = "X-Service-Version"
+
+// ServiceVersion adds the X-Service-Version header to every response
+func ServiceVersion(next http.Handler) http.Handler {
+	version := buildinfo.Get().String()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(VersionHeader, version)
+		next.ServeHTTP(w, r)
+	})
+}
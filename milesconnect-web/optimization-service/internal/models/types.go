@@ -1,9 +1,92 @@
 package models
 
-// Location represents a geographic point
+// Location represents a geographic point. A location given only by Address, with
+// lat and lng left out, is geocoded before solving.
 type Location struct {
-	Lat float64 `json:"lat"`
-	Lng float64 `json:"lng"`
+	ID        string        `json:"id,omitempty"`
+	Lat       float64       `json:"lat"`
+	Lng       float64       `json:"lng"`
+	Address   string        `json:"address,omitempty"`
+	Geocode   *GeocodeMatch `json:"geocode,omitempty"`    // how Lat and Lng were resolved from Address
+	MergedIDs []string      `json:"merged_ids,omitempty"` // IDs of duplicate stops folded into this one
+
+	// Scheduling, for requests with a departure time
+	Timezone       string      `json:"timezone,omitempty"` // IANA name; the request's timezone when empty
+	TimeWindow     *TimeWindow `json:"time_window,omitempty"`
+	ServiceMinutes float64     `json:"service_minutes,omitempty"` // time spent at the stop
+
+	Tier string `json:"tier,omitempty"` // customer tier: platinum, gold or standard (the default)
+
+	// DemandKg is what is delivered at the stop, for requests with a vehicle capacity
+	DemandKg float64 `json:"demand_kg,omitempty"`
+
+	// When the business at the stop takes deliveries, for requests with a departure
+	// time: its opening hours, every day round the clock when empty, and the holiday
+	// calendar whose dates it is closed on, the request's when empty
+	OpeningHours    []OpeningHours `json:"opening_hours,omitempty"`
+	HolidayCalendar string         `json:"holiday_calendar,omitempty"`
+
+	// Soft order rules for waypoints, checked against the solved route and reported as
+	// violations rather than enforced: UnloadPriority puts lower numbers first (0 for
+	// none), and After lists the IDs of waypoints to visit before this one
+	UnloadPriority int      `json:"unload_priority,omitempty"`
+	After          []string `json:"after,omitempty"`
+}
+
+// OpeningHours is one period a stop is open, from Open to Close, times of day in the
+// stop's timezone, on each of Days (mon to sun; every day when empty). A Close at or
+// before Open is the next day's, so 22:00 to 06:00 is overnight and 08:00 to 00:00
+// runs to midnight. A holiday closes the periods that open on it.
+type OpeningHours struct {
+	Days  []string `json:"days,omitempty"`
+	Open  string   `json:"open"`
+	Close string   `json:"close"`
+}
+
+// Customer tiers, whose penalties weigh being late or not served at all
+const (
+	TierPlatinum = "platinum"
+	TierGold     = "gold"
+	TierStandard = "standard"
+)
+
+// TierPenalty is what failing a customer of a tier costs, in the units of distance: a
+// LatePerMinute of 5 makes each minute past a stop's window as bad as 5 km more driving
+type TierPenalty struct {
+	LatePerMinute float64 `json:"late_per_minute"`
+	Unserved      float64 `json:"unserved"` // a shipment left unassigned
+}
+
+// Penalty is a tier penalty a solution incurred
+type Penalty struct {
+	Kind        string  `json:"kind"` // late or unserved
+	ID          string  `json:"id"`   // of the stop or shipment
+	Tier        string  `json:"tier"`
+	LateMinutes float64 `json:"late_minutes,omitempty"`
+	Cost        float64 `json:"cost"`
+}
+
+// Penalty kinds
+const (
+	PenaltyLate     = "late"
+	PenaltyUnserved = "unserved"
+)
+
+// TimeWindow is when a stop may be served. Each bound is an RFC 3339 time, a local
+// date-time (2006-01-02T15:04) or a time of day on the departure date (15:04), local
+// times being in the stop's timezone. Either bound may be left out.
+type TimeWindow struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// GeocodeMatch describes the provider match an address was resolved to, or, with
+// Reverse set, the match the address was looked up from the coordinates with
+type GeocodeMatch struct {
+	Provider         string  `json:"provider"`
+	Confidence       float64 `json:"confidence"` // 0 to 1
+	FormattedAddress string  `json:"formatted_address,omitempty"`
+	Reverse          bool    `json:"reverse,omitempty"`
 }
 
 type NamedLocation struct {
@@ -14,38 +97,561 @@ type NamedLocation struct {
 
 // OptimizationRequest is the input for Route Optimization (TSP)
 type OptimizationRequest struct {
-	Start     Location   `json:"start"`
-	End       Location   `json:"end"`
-	Waypoints []Location `json:"waypoints"`
+	Start      Location          `json:"start"`
+	End        Location          `json:"end"`
+	Waypoints  []Location        `json:"waypoints"`
+	Duplicates DuplicateHandling `json:"duplicates"`
+	Fields     []string          `json:"fields,omitempty"`   // response fields to return, e.g. "route.id"
+	NoCache    bool              `json:"no_cache,omitempty"` // solve afresh instead of returning a cached result
+
+	// ReverseGeocode fills in the address of route locations given by coordinates only
+	ReverseGeocode bool `json:"reverse_geocode,omitempty"`
+
+	// RouteID re-optimizes the stops still to visit on a route stored with POST /routes,
+	// from where its vehicle was last reported, keeping their order unless changing it
+	// saves enough (see PreviousRoute). Stops, limits and options come from the stored
+	// route; of the request's own fields only start, departure_time, solver and fields
+	// apply. Without a departure time the route's schedule starts now.
+	RouteID string `json:"route_id,omitempty"`
+
+	// RoadLegs solves on great-circle distances, even when the server routes on roads,
+	// and then measures only the legs of the solved route with the routing provider:
+	// one call for the route instead of the matrix of every pair of stops
+	RoadLegs bool `json:"road_legs,omitempty"`
+
+	// With DepartureTime set the response includes a schedule. It is an RFC 3339 time or
+	// a local date-time in Timezone, an IANA name (UTC when empty) that is also the
+	// default for stops.
+	DepartureTime string  `json:"departure_time,omitempty"`
+	Timezone      string  `json:"timezone,omitempty"`
+	SpeedKmh      float64 `json:"average_speed_kmh,omitempty"` // SpeedClasses, or 40, when unset
+
+	Explain bool `json:"explain,omitempty"` // annotate the response with the reasons behind the route
+
+	// TierPenalties overrides the server's penalties for the tiers it names
+	TierPenalties map[string]TierPenalty `json:"tier_penalties,omitempty"`
+
+	// Weather gives the conditions in regions along the route, slowing the legs through
+	// them in the schedule. It takes precedence over the server's weather provider.
+	Weather []WeatherRegion `json:"weather,omitempty"`
+
+	// Solver names the route solver to run, built in or plugged in; empty lets the
+	// server pick
+	Solver string `json:"solver,omitempty"`
+
+	// Profile names the server-configured defaults for the solver, currency, timezone,
+	// speeds, objective and emissions the request leaves unset; its tenant's when empty
+	Profile string `json:"profile,omitempty"`
+
+	// Objective weighs the parts of the route's cost; nil weighs distance, lateness and
+	// unserved 1 and the rest 0. EmissionsKgPerKm is the CO2 the vehicle emits per km,
+	// the server's when 0.
+	Objective        *ObjectiveWeights `json:"objective,omitempty"`
+	EmissionsKgPerKm float64           `json:"emissions_kg_per_km,omitempty"`
+
+	// With VehicleCapacityKg set the vehicle leaves Start full and goes back to it to
+	// reload whenever the next stops' demand won't fit, splitting the route into trips.
+	// Each reload takes ReloadMinutes in the schedule.
+	VehicleCapacityKg float64 `json:"vehicle_capacity_kg,omitempty"`
+	ReloadMinutes     float64 `json:"reload_minutes,omitempty"`
+
+	// MaxRangeKm is the farthest the vehicle can drive; waypoints the route can't reach
+	// within it, reloads included, are left out and returned as unassigned
+	MaxRangeKm float64 `json:"max_range_km,omitempty"`
+
+	// CaptureConsent lets the server keep an anonymized copy of the request when it
+	// fails validation or is slow to solve, for replaying while debugging
+	CaptureConsent bool `json:"capture_consent,omitempty"`
+
+	// Currency is the ISO 4217 code, e.g. "EUR", of the objective weights, the tier
+	// penalties and so every cost figure in the response; the server's when empty. The
+	// server's tier penalties are converted to it at the configured exchange rate.
+	Currency string `json:"currency,omitempty"`
+
+	// HolidayCalendars are holiday dates (2006-01-02) by calendar name, used with the
+	// server's for the names they don't define. HolidayCalendar is the calendar of stops
+	// that name none.
+	HolidayCalendars map[string][]string `json:"holiday_calendars,omitempty"`
+	HolidayCalendar  string              `json:"holiday_calendar,omitempty"`
+
+	// SpeedClasses time legs by their great-circle length when average_speed_kmh isn't
+	// set, so short urban legs can be slower than long highway ones; the server's when
+	// empty
+	SpeedClasses []SpeedClass `json:"speed_classes,omitempty"`
+
+	// PreviousRoute is the waypoint IDs in the order of an earlier plan, such as
+	// yesterday's. The route keeps that order, with the waypoints it doesn't list
+	// inserted where they add the least distance, unless the solved order is more than
+	// StabilityThresholdPct shorter; the server's threshold when 0.
+	PreviousRoute         []string `json:"previous_route,omitempty"`
+	StabilityThresholdPct float64  `json:"stability_threshold_pct,omitempty"`
+
+	// InitialRoute is waypoint IDs in an order to improve on, such as a dispatcher's
+	// draft, completed as PreviousRoute is; 2-opt starts from it instead of building a
+	// nearest-neighbor tour and the genetic solver seeds its first generation with it.
+	// Other solvers ignore it.
+	InitialRoute []string `json:"initial_route,omitempty"`
+
+	// LatenessRisk adds each windowed stop's on-time probability to the schedule, with
+	// leg driving times varying by a standard deviation of TravelTimeCV times their
+	// scheduled length; the server's when 0
+	LatenessRisk bool    `json:"lateness_risk,omitempty"`
+	TravelTimeCV float64 `json:"travel_time_cv,omitempty"`
+
+	// SolverParams tunes the solve within the server's limits
+	SolverParams *SolverParams `json:"solver_params,omitempty"`
+}
+
+// SolverParams override solver tuning for one request, up to the server's maximums.
+// TimeBudgetMs replaces the server's solver timeout. MaxIterations caps the improving
+// moves of iterative solvers (2-opt) and Neighborhood how many positions ahead a move
+// may reach; either is the server's maximum, or unlimited without one, when 0.
+// UTurnPenaltyKm makes 2-opt and the genetic solver count every U-turn, a heading
+// change of 150° or more between consecutive legs, as that many extra km, steering them
+// away from back-and-forth sequences that are short in a straight line but awkward on
+// streets; 0 turns it off.
+type SolverParams struct {
+	TimeBudgetMs   int     `json:"time_budget_ms,omitempty"`
+	MaxIterations  int     `json:"max_iterations,omitempty"`
+	Neighborhood   int     `json:"neighborhood,omitempty"`
+	UTurnPenaltyKm float64 `json:"uturn_penalty_km,omitempty"`
+}
+
+// SpeedClass is the speed legs longer than the previous class's UpToKm, up to its own,
+// are driven at. Classes are in increasing UpToKm; the last one's may be 0 for no
+// bound, and legs longer than every bound are driven at the last class's speed.
+type SpeedClass struct {
+	UpToKm   float64 `json:"up_to_km,omitempty"`
+	SpeedKmh float64 `json:"speed_kmh"`
+}
+
+// ObjectiveWeights weigh the parts of a solution's cost against each other. Weights a
+// request leaves out are 0, not their defaults. Lateness and Unserved scale the tier
+// penalties; the parts that don't apply to an endpoint are ignored by it.
+type ObjectiveWeights struct {
+	Distance  float64 `json:"distance"`  // per km driven
+	Duration  float64 `json:"duration"`  // per minute from departure to arrival at the end
+	Vehicles  float64 `json:"vehicles"`  // per vehicle used
+	Lateness  float64 `json:"lateness"`  // per unit of late penalty
+	Emissions float64 `json:"emissions"` // per kg of CO2
+	Unserved  float64 `json:"unserved"`  // per unit of unserved penalty
+}
+
+// CostBreakdown is a solution's cost under its request's objective, part by part
+type CostBreakdown struct {
+	Terms []CostTerm `json:"terms"`
+	Total float64    `json:"total"`
+}
+
+// CostTerm is one weighted part of a solution's cost: Value in Unit, times Weight
+type CostTerm struct {
+	Component string  `json:"component"` // distance, duration, vehicles, lateness, emissions or unserved
+	Unit      string  `json:"unit"`      // km, minutes, vehicles, penalty or kg_co2
+	Value     float64 `json:"value"`
+	Weight    float64 `json:"weight"`
+	Cost      float64 `json:"cost"`
+}
+
+// WeatherRegion is a circle of weather of one severity
+type WeatherRegion struct {
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	RadiusKm float64 `json:"radius_km"`
+	Severity string  `json:"severity"` // none, light, moderate or severe
+}
+
+// Weather severities, from none to severe
+const (
+	WeatherNone     = "none"
+	WeatherLight    = "light"
+	WeatherModerate = "moderate"
+	WeatherSevere   = "severe"
+)
+
+// Duplicate handling modes for waypoints that share (nearly) the same coordinates
+const (
+	DuplicatesKeep   = "keep"   // route every waypoint as given (default)
+	DuplicatesMerge  = "merge"  // fold duplicates into the first occurrence
+	DuplicatesReject = "reject" // fail validation when duplicates are present
+)
+
+// DuplicateHandling configures how near-duplicate waypoints are treated
+type DuplicateHandling struct {
+	Mode    string  `json:"mode"`
+	RadiusM float64 `json:"radius_m"` // waypoints within this distance are duplicates (0 = identical only)
 }
 
 // OptimizationResponse is the output for Route Optimization
 type OptimizationResponse struct {
-	Route       []Location `json:"route"`
-	TotalDistKm float64    `json:"total_distance_km"`
+	Route       []Location     `json:"route"`
+	TotalDistKm float64        `json:"total_distance_km"`
+	Schedule    []StopETA      `json:"schedule,omitempty"` // one entry per route location, for requests with a departure time
+	Trips       []Trip         `json:"trips,omitempty"`    // for requests with a vehicle capacity
+	Explanation *Explanation   `json:"explanation,omitempty"`
+	Penalties   []Penalty      `json:"penalties,omitempty"` // stops reached after their window closed, and unassigned ones
+	PenaltyCost float64        `json:"penalty_cost,omitempty"`
+	Cost        *CostBreakdown `json:"cost,omitempty"` // under the request's objective
+	Metadata    SolverMetadata `json:"metadata"`
+
+	// Unassigned are the waypoints left out for being beyond the vehicle's range
+	Unassigned []Location `json:"unassigned,omitempty"`
+	// UnassignedStops say, for each of Unassigned in the same order, where the route could
+	// least expensively take it back and which constraints doing so would break
+	UnassignedStops []UnassignedStop `json:"unassigned_stops,omitempty"`
+
+	// Currency is the ISO 4217 code of PenaltyCost, the penalties' and the cost
+	// breakdown's figures; empty when they're unitless
+	Currency string `json:"currency,omitempty"`
+
+	// TotalDurationMin is the time from leaving the start to reaching the end: the
+	// schedule's when there is one, otherwise driving time at the request's speeds plus
+	// service times
+	TotalDurationMin float64 `json:"total_duration_minutes"`
+
+	// Violations are the waypoints' order rules the route breaks, or that can't all
+	// hold together
+	Violations []Violation `json:"violations,omitempty"`
+
+	// Stability compares the route with the request's previous route, when it gave one
+	Stability *RouteStability `json:"stability,omitempty"`
+
+	// RoadLegs are the route's legs measured on roads, for requests that asked for them
+	RoadLegs *RoadLegs `json:"road_legs,omitempty"`
+}
+
+// RoadLegs are the legs of a route solved on great-circle distances, measured both in
+// a straight line and on roads. Road distances are absent when the routing provider
+// failed, as Source says.
+type RoadLegs struct {
+	Source     DistanceSource `json:"source"`
+	Legs       []RoadLeg      `json:"legs"`
+	StraightKm float64        `json:"straight_distance_km"`
+	RoadKm     float64        `json:"road_distance_km,omitempty"`
+}
+
+// RoadLeg is the drive from route location From to the next one, To, by their IDs
+type RoadLeg struct {
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	StraightKm float64  `json:"straight_km"`
+	RoadKm     *float64 `json:"road_km,omitempty"`
+}
+
+// TSPLIBResponse is the output of POST /tsplib: the route solved for a TSPLIB instance
+// and its tour measured with the instance's own distance function
+type TSPLIBResponse struct {
+	Instance       string  `json:"instance"`
+	Dimension      int     `json:"dimension"`
+	EdgeWeightType string  `json:"edge_weight_type"`
+	Tour           []int   `json:"tour"`   // node numbers as in the file, from the first node
+	Length         float64 `json:"length"` // in the instance's distance units
+	BestKnown      float64 `json:"best_known,omitempty"`
+	GapPct         float64 `json:"gap_pct,omitempty"` // of length over best_known, when the instance has one
+
+	Route OptimizationResponse `json:"route"`
+}
+
+// RouteStability is how a route solved against a previous one compares with it.
+// PreviousDistKm is the distance of the previous order, new waypoints inserted, and
+// SavingPct how much shorter the solved order was, as a percentage of it.
+type RouteStability struct {
+	KeptPrevious   bool    `json:"kept_previous"`
+	PreviousDistKm float64 `json:"previous_distance_km"`
+	SavingPct      float64 `json:"saving_pct"`
+	ThresholdPct   float64 `json:"threshold_pct"`
+	ChangedStops   int     `json:"changed_stops"` // stops not following the stop they followed before, new ones included
+}
+
+// Violation is a broken order rule. StopID is the stop whose rule it is, OtherID the
+// stop it is broken against.
+type Violation struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	StopID   string `json:"stop_id,omitempty"`
+	OtherID  string `json:"other_id,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Violation kinds, with their severity
+const (
+	ViolationPrecedence       = "precedence"             // error: visited before a stop it must come after
+	ViolationCycle            = "precedence_cycle"       // error: after rules that go round in a circle
+	ViolationPriorityOrder    = "priority_order"         // warning: visited after a stop of later unload priority
+	ViolationPriorityConflict = "priority_conflict"      // warning: an after rule against the unload priorities
+	ViolationUnassignedBefore = "predecessor_unassigned" // info: a stop it must come after isn't on the route
+)
+
+// Violation severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Trip is the part of a route between leaving Start loaded and the next reload there,
+// or the end
+type Trip struct {
+	StopIDs    []string `json:"stop_ids"`
+	LoadKg     float64  `json:"load_kg"`
+	DistanceKm float64  `json:"distance_km"`
+}
+
+// UnassignedStop is a waypoint left off the route, with the cheapest place to put it
+// back so a dispatcher can see what would have to give
+type UnassignedStop struct {
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"` // the constraint it was left out for, one of the Constraint values
+	Insertion Insertion `json:"cheapest_insertion"`
+}
+
+// Insertion is a stop put back into a route between two of its locations
+type Insertion struct {
+	AfterStops int     `json:"after_stops"` // deliveries before it on the route, reloads not counted
+	AfterID    string  `json:"after_id"`
+	BeforeID   string  `json:"before_id"`
+	ExtraKm    float64 `json:"extra_km"` // the route's distance grows by, reloads included
+
+	// BlockedBy are the constraints the insertion breaks: max_range by RangeExceededKm,
+	// time_window when the stop would be reached LateMinutes after its window or
+	// closed. It is empty when the route has room for the stop after all.
+	BlockedBy       []string `json:"blocked_by"`
+	RangeExceededKm float64  `json:"range_exceeded_km,omitempty"`
+	LateMinutes     float64  `json:"late_minutes,omitempty"`
+	Closed          bool     `json:"closed,omitempty"`
+}
+
+// Constraints a stop can be left out for or blocked by, and a shipment blocked by
+const (
+	ConstraintMaxRange    = "max_range"
+	ConstraintTimeWindow  = "time_window"
+	ConstraintCapacity    = "capacity"
+	ConstraintCompartment = "compartment"
+)
+
+// StopETA is when a route location is reached and left, in its local time
+type StopETA struct {
+	ID          string  `json:"id,omitempty"`
+	Arrival     string  `json:"arrival"`   // RFC 3339 with the local offset
+	Departure   string  `json:"departure"` // after any wait for the window and the service time
+	Timezone    string  `json:"timezone"`
+	WaitMinutes float64 `json:"wait_minutes,omitempty"` // arrived before the window or the stop opened
+	LateMinutes float64 `json:"late_minutes,omitempty"` // arrived after the window closed
+
+	// Weather is the worst severity on the leg to this stop, when it slowed the leg by
+	// WeatherDelayMinutes
+	Weather             string  `json:"weather,omitempty"`
+	WeatherDelayMinutes float64 `json:"weather_delay_minutes,omitempty"`
+
+	// Closed is set when the stop's opening hours and holidays keep it shut from arrival
+	// to the end of the scheduling horizon, so it can't be served
+	Closed bool `json:"closed,omitempty"`
+
+	// OnTimeProbability is the chance the stop is served within its window given how
+	// much driving times vary, for stops with a window when the request asks for
+	// lateness risk
+	OnTimeProbability *float64 `json:"on_time_probability,omitempty"`
+}
+
+// ETARequest re-times a route in progress from where its vehicle is now, without
+// solving it again
+type ETARequest struct {
+	Route     []Location `json:"route"`               // the route's stops in order, as solved
+	Position  Location   `json:"position"`            // where the vehicle is
+	Completed []string   `json:"completed,omitempty"` // IDs of the route stops already visited
+
+	// RouteID takes the route, the completed stops and, when the request gives none, the
+	// position from a route stored with POST /routes and what its driver has reported.
+	// Without a departure time the vehicle leaves now; the timezone, speeds and holiday
+	// calendars default to the stored route's.
+	RouteID string `json:"route_id,omitempty"`
+
+	// DepartureTime is when the vehicle leaves Position, with Timezone and SpeedKmh as
+	// in OptimizationRequest
+	DepartureTime string  `json:"departure_time"`
+	Timezone      string  `json:"timezone,omitempty"`
+	SpeedKmh      float64 `json:"average_speed_kmh,omitempty"`
+
+	Weather []WeatherRegion `json:"weather,omitempty"`
+
+	// Holiday calendars for the route's opening hours, as in OptimizationRequest
+	HolidayCalendars map[string][]string `json:"holiday_calendars,omitempty"`
+	HolidayCalendar  string              `json:"holiday_calendar,omitempty"`
+
+	SpeedClasses []SpeedClass `json:"speed_classes,omitempty"` // as in OptimizationRequest
+
+	// Lateness risk of the remaining stops, as in OptimizationRequest
+	LatenessRisk bool    `json:"lateness_risk,omitempty"`
+	TravelTimeCV float64 `json:"travel_time_cv,omitempty"`
+}
+
+// StopReport is the body of PATCH /routes/{id}/stops/{stopId}: what a driver reports at
+// a stop of a tracked route
+type StopReport struct {
+	Status   string    `json:"status"`             // arrived, completed or failed
+	Time     string    `json:"time,omitempty"`     // RFC 3339; when the report is received if empty
+	Position *Location `json:"position,omitempty"` // where the vehicle is, when not at the stop
+	Reason   string    `json:"reason,omitempty"`   // why the stop failed
+}
+
+// ETAResponse is the updated schedule of the stops still to visit
+type ETAResponse struct {
+	Schedule        []StopETA `json:"schedule"` // one entry per remaining stop, in route order
+	RemainingDistKm float64   `json:"remaining_distance_km"`
+}
+
+// Explanation gives the reasons behind a solution, for requests with explain set
+type Explanation struct {
+	Constraints []Reason          `json:"constraints"`         // what shaped the solution as a whole
+	Stops       []StopReasons     `json:"stops,omitempty"`     // route responses, in route order
+	Shipments   []ShipmentReasons `json:"shipments,omitempty"` // load responses, in the order shipments were placed
+}
+
+// Reason is one explanation: a stable code to match on and a sentence for people
+type Reason struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// StopReasons explains where a route location was placed
+type StopReasons struct {
+	ID       string   `json:"id,omitempty"`
+	Position int      `json:"position"` // index in the route
+	Reasons  []Reason `json:"reasons"`
+}
+
+// ShipmentReasons explains which vehicle a shipment went to, or why none
+type ShipmentReasons struct {
+	ShipmentID string   `json:"shipment_id"`
+	VehicleID  string   `json:"vehicle_id,omitempty"` // empty when unassigned
+	Reasons    []Reason `json:"reasons"`
+}
+
+// SolverMetadata describes the solver run that produced a response
+type SolverMetadata struct {
+	Solver          string  `json:"solver"`
+	Version         string  `json:"version"`
+	Iterations      int     `json:"iterations"`
+	ComputeTimeMs   float64 `json:"compute_time_ms"`
+	BudgetExhausted bool    `json:"time_budget_exhausted"`
+	ObjectiveValue  float64 `json:"objective_value"`
+	InitialValue    float64 `json:"initial_objective_value,omitempty"` // objective of the input as given, when meaningful
+	Cached          bool    `json:"cached,omitempty"`                  // served from the result cache; the other fields describe the original solve
+	Clusters        int     `json:"clusters,omitempty"`                // pieces a hierarchical solve split the request into
+	WarmStart       bool    `json:"warm_start,omitempty"`              // improved on the request's initial_route
+
+	// Distances reports where leg distances came from, for solvers that use a routing provider
+	Distances *DistanceSource `json:"distances,omitempty"`
+}
+
+// DistanceSource identifies the provider behind a solve's distances. Fallback is set
+// when the configured road-routing provider failed or its circuit breaker was open and
+// great-circle distances were used instead.
+type DistanceSource struct {
+	Provider       string `json:"provider"`
+	Fallback       bool   `json:"fallback"`
+	FallbackReason string `json:"fallback_reason,omitempty"`
 }
 
 // LoadRequest represents inputs for Load/Weight Optimization
 type LoadRequest struct {
 	Vehicles  []VehicleInfo  `json:"vehicles"`
 	Shipments []ShipmentInfo `json:"shipments"`
+	Fields    []string       `json:"fields,omitempty"`
+	NoCache   bool           `json:"no_cache,omitempty"`
+	Explain   bool           `json:"explain,omitempty"` // annotate the response with why each shipment went where it did
+
+	TierPenalties map[string]TierPenalty `json:"tier_penalties,omitempty"` // as on OptimizationRequest
+
+	// Objective weighs vehicles used against unserved penalties, as on OptimizationRequest
+	Objective *ObjectiveWeights `json:"objective,omitempty"`
+
+	CaptureConsent bool   `json:"capture_consent,omitempty"` // as on OptimizationRequest
+	Currency       string `json:"currency,omitempty"`        // likewise
+	Profile        string `json:"profile,omitempty"`         // likewise; only its currency and objective apply
+
+	// GroupByDestination puts shipments bound for the same area on the same vehicle, for
+	// shorter routes after: each goes with the vehicle whose shipments' destinations
+	// are centred nearest its own, within GroupRadiusKm (25 when 0), or else on a vehicle
+	// carrying none yet
+	GroupByDestination bool    `json:"group_by_destination,omitempty"`
+	GroupRadiusKm      float64 `json:"group_radius_km,omitempty"`
+
+	// SolverParams tunes the solve as on OptimizationRequest; only the time budget
+	// applies to fleet allocation
+	SolverParams *SolverParams `json:"solver_params,omitempty"`
 }
 
 type VehicleInfo struct {
 	ID          string  `json:"id"`
 	CapacityKg  float64 `json:"capacity_kg"`
 	CurrentLoad float64 `json:"current_load"` // 0 if empty
+
+	// With MaxRangeKm set the vehicle only takes shipments whose destination is within
+	// a round trip of that length from its Depot, by great circle
+	MaxRangeKm float64   `json:"max_range_km,omitempty"`
+	Depot      *Location `json:"depot,omitempty"`
+
+	// Compartments are the vehicle's separately loaded sections, such as frozen, chilled
+	// and ambient. Each shipment goes in one of them, within its capacity as well as the
+	// vehicle's.
+	Compartments []Compartment `json:"compartments,omitempty"`
+}
+
+// Compartment is one section of a vehicle
+type Compartment struct {
+	Name        string  `json:"name"`
+	CapacityKg  float64 `json:"capacity_kg"`
+	CurrentLoad float64 `json:"current_load,omitempty"` // counted in the vehicle's too
 }
 
 type ShipmentInfo struct {
 	ID       string  `json:"id"`
 	WeightKg float64 `json:"weight_kg"`
+	Tier     string  `json:"tier,omitempty"` // as on Location
+
+	Destination *Location `json:"destination,omitempty"` // where it is delivered; needed for vehicle ranges to apply
+
+	// Compartment names the vehicle compartment the shipment must travel in; it then
+	// only goes on vehicles that have one. Without it any compartment will do.
+	Compartment string `json:"compartment,omitempty"`
 }
 
 // LoadResponse represents the result of the allocation
 type LoadResponse struct {
-	Allocations []Allocation `json:"allocations"`
-	Unassigned  []string     `json:"unassigned_shipment_ids"`
+	Allocations []Allocation   `json:"allocations"`
+	Unassigned  []string       `json:"unassigned_shipment_ids"`
+	Explanation *Explanation   `json:"explanation,omitempty"`
+	Penalties   []Penalty      `json:"penalties,omitempty"` // unassigned shipments
+	PenaltyCost float64        `json:"penalty_cost,omitempty"`
+	Cost        *CostBreakdown `json:"cost,omitempty"` // under the request's objective
+	Metadata    SolverMetadata `json:"metadata"`
+
+	// UnassignedShipments say, for each of Unassigned in the same order, which vehicle
+	// comes closest to taking it and what stops it
+	UnassignedShipments []UnallocatedShipment `json:"unassigned_shipments,omitempty"`
+
+	Currency string `json:"currency,omitempty"` // as on OptimizationResponse
+}
+
+// UnallocatedShipment is a shipment no vehicle took, with the vehicle that comes closest
+// to taking it so a dispatcher can see what would have to give
+type UnallocatedShipment struct {
+	ID        string            `json:"id"`
+	Insertion ShipmentInsertion `json:"cheapest_insertion"`
+}
+
+// ShipmentInsertion is a shipment put on a vehicle as the allocation left it
+type ShipmentInsertion struct {
+	VehicleID   string `json:"vehicle_id"`
+	Compartment string `json:"compartment,omitempty"` // the one it would go in
+
+	// BlockedBy are the constraints putting it there breaks: capacity by ShortKg,
+	// compartment when the vehicle has none for it, max_range by RangeExceededKm there
+	// and back from the vehicle's depot. It is empty when the vehicle has room after
+	// all, as when the time budget ran out before the shipment's turn.
+	BlockedBy       []string `json:"blocked_by"`
+	ShortKg         float64  `json:"short_kg,omitempty"`
+	RangeExceededKm float64  `json:"range_exceeded_km,omitempty"`
 }
 
 type Allocation struct {
@@ -53,4 +659,266 @@ type Allocation struct {
 	ShipmentIDs    []string `json:"shipment_ids"`
 	TotalWeight    float64  `json:"total_weight"`
 	UtilizationPct float64  `json:"utilization_pct"`
+
+	Compartments []CompartmentAllocation `json:"compartments,omitempty"` // each of the vehicle's, in its order
+
+	// AreaRadiusKm is how far the farthest destination of the vehicle's shipments is from
+	// their centre, for shipments with destinations
+	AreaRadiusKm float64 `json:"area_radius_km,omitempty"`
+}
+
+// CompartmentAllocation is what one compartment of an allocated vehicle carries
+type CompartmentAllocation struct {
+	Name           string   `json:"name"`
+	ShipmentIDs    []string `json:"shipment_ids"`
+	TotalWeight    float64  `json:"total_weight"` // its current load included
+	UtilizationPct float64  `json:"utilization_pct"`
+}
+
+// ScenarioRequest is a fleet allocation, the baseline, and a hypothetical change to it
+type ScenarioRequest struct {
+	LoadRequest
+	Changes ScenarioChanges `json:"changes"`
+}
+
+// ScenarioChanges are what the scenario changes about the baseline, applied in order:
+// vehicles removed, then vehicles added, then demand scaled
+type ScenarioChanges struct {
+	RemoveVehicles []string      `json:"remove_vehicles,omitempty"` // IDs, e.g. of vehicles out for maintenance
+	AddVehicles    []VehicleInfo `json:"add_vehicles,omitempty"`
+	DemandPct      float64       `json:"demand_pct,omitempty"` // every shipment's weight changes by this percentage, e.g. 20 for 20% more
+}
+
+// ScenarioResponse is the baseline and scenario allocations and how they differ
+type ScenarioResponse struct {
+	Baseline LoadResponse `json:"baseline"`
+	Scenario LoadResponse `json:"scenario"`
+	Diff     ScenarioDiff `json:"diff"`
+}
+
+// LoadDiffRequest is two fleet allocations to compare, each as /optimize-load returned
+// it: yesterday's against today's, say, or one strategy's against another's
+type LoadDiffRequest struct {
+	Baseline LoadResponse `json:"baseline"`
+	Scenario LoadResponse `json:"scenario"`
+}
+
+// ScenarioDiff is the scenario against the baseline. The counts and costs are the
+// scenario's minus the baseline's; shipments are matched by ID.
+type ScenarioDiff struct {
+	// Identical is set when every shipment is where it was and the costs are the same
+	Identical    bool    `json:"identical"`
+	VehiclesUsed int     `json:"vehicles_used"`
+	Unassigned   int     `json:"unassigned"`
+	PenaltyCost  float64 `json:"penalty_cost"`
+	Cost         float64 `json:"cost"` // of the objective's total
+
+	NewlyUnassigned []string        `json:"newly_unassigned,omitempty"` // assigned in the baseline only
+	NewlyAssigned   []string        `json:"newly_assigned,omitempty"`   // assigned in the scenario only
+	Moved           []ShipmentMove  `json:"moved,omitempty"`            // assigned in both, to different vehicles
+	Vehicles        []VehicleChange `json:"vehicles,omitempty"`         // vehicles whose load changed
+}
+
+// ShipmentMove is a shipment the scenario puts on another vehicle
+type ShipmentMove struct {
+	ShipmentID string `json:"shipment_id"`
+	From       string `json:"from_vehicle_id"`
+	To         string `json:"to_vehicle_id"`
+}
+
+// VehicleChange is how a vehicle's load differs; a vehicle only in one of the two
+// solutions has zero load in the other
+type VehicleChange struct {
+	VehicleID       string  `json:"vehicle_id"`
+	BaselineWeight  float64 `json:"baseline_weight"`
+	ScenarioWeight  float64 `json:"scenario_weight"`
+	BaselineUtilPct float64 `json:"baseline_utilization_pct"`
+	ScenarioUtilPct float64 `json:"scenario_utilization_pct"`
+	ShipmentsDelta  int     `json:"shipments_delta"`
+}
+
+// CrossDockRequest assigns shipments unloaded from inbound trucks at a cross-dock to
+// the outbound trailers at its doors. Times are RFC 3339 or local date-times in
+// Timezone, UTC when empty.
+type CrossDockRequest struct {
+	Inbound  []InboundShipment `json:"inbound"`
+	Trailers []OutboundTrailer `json:"trailers"`
+	Timezone string            `json:"timezone,omitempty"`
+	Fields   []string          `json:"fields,omitempty"`
+
+	// HandlingMinutes is how long a shipment takes from its inbound door onto a trailer;
+	// it must be aboard by the trailer's departure
+	HandlingMinutes float64 `json:"handling_minutes,omitempty"`
+}
+
+// InboundShipment is a shipment coming off an inbound truck
+type InboundShipment struct {
+	ID          string  `json:"id"`
+	WeightKg    float64 `json:"weight_kg"`
+	Destination string  `json:"destination"`          // only trailers to the same destination take it
+	Door        int     `json:"door"`                 // inbound door it is unloaded at
+	ReadyTime   string  `json:"ready_time,omitempty"` // when it is off the truck; empty when already on the dock
+}
+
+// OutboundTrailer is a trailer loading at a door for one destination
+type OutboundTrailer struct {
+	ID          string  `json:"id"`
+	Destination string  `json:"destination"`
+	Door        int     `json:"door"`
+	CapacityKg  float64 `json:"capacity_kg"`
+	CurrentLoad float64 `json:"current_load"`        // 0 if empty
+	DockTime    string  `json:"dock_time,omitempty"` // when it is at its door; empty when already there
+	Departure   string  `json:"departure"`           // loading cutoff
+}
+
+// CrossDockResponse is the trailer each shipment goes on. HandlingMoves counts the
+// times shipments are moved: once straight across the dock, twice when one is staged
+// on the floor because its trailer isn't at the door yet.
+type CrossDockResponse struct {
+	Trailers      []TrailerLoad        `json:"trailers"`
+	Transfers     []CrossDockTransfer  `json:"transfers"`
+	Unassigned    []UnassignedShipment `json:"unassigned"`
+	HandlingMoves int                  `json:"handling_moves"`
+	DoorDistance  int                  `json:"door_distance"` // doors crossed by all transfers
+	Metadata      SolverMetadata       `json:"metadata"`
+}
+
+// TrailerLoad is what a trailer leaves with
+type TrailerLoad struct {
+	TrailerID      string   `json:"trailer_id"`
+	ShipmentIDs    []string `json:"shipment_ids"`
+	TotalWeight    float64  `json:"total_weight"`
+	UtilizationPct float64  `json:"utilization_pct"`
+}
+
+// CrossDockTransfer is one shipment's way across the dock
+type CrossDockTransfer struct {
+	ShipmentID   string `json:"shipment_id"`
+	TrailerID    string `json:"trailer_id"`
+	Staged       bool   `json:"staged,omitempty"`
+	Moves        int    `json:"moves"`
+	DoorDistance int    `json:"door_distance"`
+}
+
+// UnassignedShipment is a shipment no trailer could take, with why: no_trailer (none
+// to its destination), missed_cutoff (every one leaves before it can be aboard),
+// no_capacity (the ones it could make are full) or time_budget
+type UnassignedShipment struct {
+	ShipmentID string `json:"shipment_id"`
+	Reason     string `json:"reason"`
+}
+
+// DayPlanRequest assigns recurring customers to the weekdays they are delivered on,
+// keeping each day's customers close together and the days' workloads even. Customers
+// of one zone are delivered on the same day.
+type DayPlanRequest struct {
+	Customers []DayCustomer `json:"customers"`
+	Days      []string      `json:"days,omitempty"` // weekdays to deliver on, "mon" to "sun"; mon to fri when empty
+	Fields    []string      `json:"fields,omitempty"`
+
+	// BalanceWeight is what a unit of workload above or below a day's share costs,
+	// against a unit of workload a typical customer's distance from its day's centre;
+	// 1 when 0
+	BalanceWeight float64 `json:"balance_weight,omitempty"`
+}
+
+// DayCustomer is a customer delivered to once a week
+type DayCustomer struct {
+	Location
+	Zone     string   `json:"zone,omitempty"`     // customers of a zone share their day; empty is a zone of its own
+	Workload float64  `json:"workload,omitempty"` // e.g. minutes or kg; 1 when 0
+	Days     []string `json:"days,omitempty"`     // the weekdays the customer takes deliveries; any when empty
+}
+
+// DayPlanResponse is each delivery day's customers, with the waypoints to route them
+// with on /optimize
+type DayPlanResponse struct {
+	Days     []DeliveryDay  `json:"days"`
+	Metadata SolverMetadata `json:"metadata"`
+}
+
+// DeliveryDay is the customers delivered to on a weekday
+type DeliveryDay struct {
+	Day         string     `json:"day"`
+	CustomerIDs []string   `json:"customer_ids"`
+	Zones       []string   `json:"zones,omitempty"`
+	Workload    float64    `json:"workload"`
+	Centroid    Location   `json:"centroid"`
+	RadiusKm    float64    `json:"radius_km"` // farthest customer from the centroid
+	Waypoints   []Location `json:"waypoints"`
+}
+
+// SimulationRequest replays historical days through solver configurations, to compare
+// what each would have made of the same orders and fleets
+type SimulationRequest struct {
+	Days    []SimulationDay    `json:"days"`
+	Configs []SimulationConfig `json:"configs"`
+	NoCache bool               `json:"no_cache,omitempty"` // solve every allocation and route afresh
+	Fields  []string           `json:"fields,omitempty"`
+}
+
+// SimulationDay is a day's orders and fleet as they were. Each shipment is allocated to
+// a vehicle as on /optimize-load, then every vehicle used drives a round trip from its
+// depot, or the day's, to its shipments' destinations.
+type SimulationDay struct {
+	Date      string         `json:"date"` // names the day in the results, e.g. 2026-03-02
+	Depot     Location       `json:"depot"`
+	Vehicles  []VehicleInfo  `json:"vehicles"`
+	Shipments []ShipmentInfo `json:"shipments"` // each with an ID of its own and a destination
+
+	// With DepartureTime set, as on OptimizationRequest, every route leaves then and the
+	// destinations' time windows are checked for the on-time rate
+	DepartureTime string `json:"departure_time,omitempty"`
+	Timezone      string `json:"timezone,omitempty"`
+}
+
+// SimulationConfig is a solver configuration to replay the days with
+type SimulationConfig struct {
+	Name         string        `json:"name"`
+	Solver       string        `json:"solver,omitempty"`        // the routes', as on OptimizationRequest
+	SolverParams *SolverParams `json:"solver_params,omitempty"` // likewise; allocations take only the time budget
+	SpeedKmh     float64       `json:"average_speed_kmh,omitempty"`
+
+	// As on LoadRequest, for the allocations
+	Objective          *ObjectiveWeights `json:"objective,omitempty"`
+	GroupByDestination bool              `json:"group_by_destination,omitempty"`
+	GroupRadiusKm      float64           `json:"group_radius_km,omitempty"`
+}
+
+// SimulationResponse is each configuration's KPIs, in the request's order
+type SimulationResponse struct {
+	Results []SimulationResult `json:"results"`
+}
+
+// SimulationResult is a configuration's KPIs over all the days and on each
+type SimulationResult struct {
+	Config string              `json:"config"`
+	Total  SimulationKPIs      `json:"total"`
+	Days   []SimulationDayKPIs `json:"days"`
+}
+
+// SimulationDayKPIs are a configuration's KPIs on one day
+type SimulationDayKPIs struct {
+	Date string `json:"date"`
+	SimulationKPIs
+}
+
+// SimulationKPIs measure the allocations and routes of a configuration
+type SimulationKPIs struct {
+	TotalDistKm      float64 `json:"total_distance_km"`
+	TotalDurationMin float64 `json:"total_duration_min"`
+	VehiclesUsed     int     `json:"vehicles_used"` // summed over the days
+	Shipments        int     `json:"shipments"`
+	Unassigned       int     `json:"unassigned"` // shipments no vehicle took, or left off a route beyond its vehicle's range
+
+	// WindowStops are the delivered shipments whose destinations have a time window,
+	// on days with a departure time, and OnTimeStops those reached within it;
+	// OnTimeRatePct is the one of the other, unset without any
+	WindowStops   int      `json:"window_stops"`
+	OnTimeStops   int      `json:"on_time_stops"`
+	OnTimeRatePct *float64 `json:"on_time_rate_pct,omitempty"`
+	LateMinutes   float64  `json:"late_minutes"`
+
+	// ComputeTimeMs is the solvers' time, cached results at the time they first took
+	ComputeTimeMs float64 `json:"compute_time_ms"`
 }
@@ -0,0 +1,149 @@
+// Package natsrpc serves the optimize endpoints over NATS request-reply, for
+// deployments where HTTP load balancing is awkward.
+package natsrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+// Message headers read from requests
+const (
+	HeaderRequestID = "X-Request-ID"
+	HeaderTenant    = "X-Tenant-ID"
+)
+
+// Config selects the server, subjects and queue group
+type Config struct {
+	URL string
+	// Subjects are <SubjectPrefix>.optimize and <SubjectPrefix>.optimize-load
+	SubjectPrefix string
+	Queue         string // replicas in one queue group share the requests
+	Workers       int    // requests handled at once by this process
+}
+
+// Request is one received message; Endpoint is taken from the subject
+type Request struct {
+	ID       string
+	Endpoint string
+	Tenant   string
+	Body     []byte
+}
+
+// Handler solves a request and returns the reply body
+type Handler func(ctx context.Context, req Request) []byte
+
+var endpoints = []string{"optimize", "optimize-load"}
+
+// Server answers requests on the optimize subjects
+type Server struct {
+	cfg    Config
+	handle Handler
+	conn   *nats.Conn
+
+	msgs      chan *nats.Msg
+	subs      []*nats.Subscription
+	stopFetch context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// Connect connects to the NATS server at cfg.URL, retrying in the background while it
+// is unreachable; requests are served once started
+func Connect(cfg Config, handle Handler) (*Server, error) {
+	conn, err := nats.Connect(cfg.URL, nats.Name("milesconnect-optimization"),
+		nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("natsrpc: connect: %w", err)
+	}
+	return &Server{cfg: cfg, handle: handle, conn: conn, msgs: make(chan *nats.Msg, max(cfg.Workers, 1))}, nil
+}
+
+// Ping checks the connection is up, for readiness probes
+func (s *Server) Ping(ctx context.Context) error {
+	if !s.conn.IsConnected() {
+		return errors.New("natsrpc: " + s.conn.Status().String())
+	}
+	return nil
+}
+
+// Start subscribes to the subjects. Requests are solved under ctx.
+func (s *Server) Start(ctx context.Context) error {
+	for _, ep := range endpoints {
+		sub, err := s.conn.ChanQueueSubscribe(s.cfg.SubjectPrefix+"."+ep, s.cfg.Queue, s.msgs)
+		if err != nil {
+			return fmt.Errorf("natsrpc: subscribe: %w", err)
+		}
+		s.subs = append(s.subs, sub)
+	}
+	fetchCtx, cancel := context.WithCancel(ctx)
+	s.stopFetch = cancel
+	for i := 0; i < max(s.cfg.Workers, 1); i++ {
+		s.wg.Add(1)
+		go s.serve(ctx, fetchCtx)
+	}
+	return nil
+}
+
+// Stop unsubscribes, so other members of the queue group get new requests, and makes
+// the workers exit once their current request is answered
+func (s *Server) Stop() {
+	for _, sub := range s.subs {
+		sub.Unsubscribe()
+	}
+	if s.stopFetch != nil {
+		s.stopFetch()
+	}
+}
+
+// Wait blocks until the workers have exited after Stop
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+// Close flushes pending replies and closes the connection
+func (s *Server) Close() error {
+	var err error
+	if s.conn.IsConnected() {
+		err = s.conn.Flush()
+	}
+	s.conn.Close()
+	return err
+}
+
+func (s *Server) serve(ctx, fetchCtx context.Context) {
+	defer s.wg.Done()
+	for {
+		var msg *nats.Msg
+		select {
+		case <-fetchCtx.Done():
+			return
+		case msg = <-s.msgs:
+		}
+		if msg.Reply == "" {
+			continue // a publish, not a request; nobody would get the answer
+		}
+
+		req := Request{
+			ID:       msg.Header.Get(HeaderRequestID),
+			Endpoint: msg.Subject[len(s.cfg.SubjectPrefix)+1:],
+			Tenant:   msg.Header.Get(HeaderTenant),
+			Body:     msg.Data,
+		}
+		if req.ID == "" {
+			req.ID = nuid.Next()
+		}
+		reply := s.handle(ctx, req)
+		if ctx.Err() != nil {
+			return // the requester times out and retries elsewhere
+		}
+		if err := msg.Respond(reply); err != nil {
+			slog.Error("nats reply", "subject", msg.Subject, "request_id", req.ID, "error", err)
+		}
+	}
+}
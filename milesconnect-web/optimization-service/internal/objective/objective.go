@@ -0,0 +1,100 @@
+// Package objective weighs the parts of a solution's cost — distance, duration,
+// vehicles, lateness, emissions and unserved shipments — by the request's weights, so
+// business units can tune what the solvers trade off without endpoints of their own.
+package objective
+
+import (
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/schedule"
+	"time"
+)
+
+// DefaultEmissionsKgPerKm is a diesel delivery van's CO2, used when the server sets none
+const DefaultEmissionsKgPerKm = 0.25
+
+// Components of the cost, in CostTerm.Component
+const (
+	Distance  = "distance"
+	Duration  = "duration"
+	Vehicles  = "vehicles"
+	Lateness  = "lateness"
+	Emissions = "emissions"
+	Unserved  = "unserved"
+)
+
+// Defaults are the weights used when the request sets none: distance plus the tier
+// penalties, as the solvers minimised before weights could be set
+func Defaults() models.ObjectiveWeights {
+	return models.ObjectiveWeights{Distance: 1, Lateness: 1, Unserved: 1}
+}
+
+// Weights returns w, or Defaults when it is nil
+func Weights(w *models.ObjectiveWeights) models.ObjectiveWeights {
+	if w == nil {
+		return Defaults()
+	}
+	return *w
+}
+
+// KmCost is what a km costs under w at kgPerKm of CO2, distance and emissions together
+func KmCost(w models.ObjectiveWeights, kgPerKm float64) float64 {
+	return w.Distance + w.Emissions*kgPerKm
+}
+
+// Route breaks down the cost of resp, a solved and scheduled route for req. Duration
+// runs from departure to arrival at the end: from the schedule when there is one,
+// otherwise great-circle driving at the request's speed plus service times.
+func Route(req models.OptimizationRequest, resp models.OptimizationResponse) *models.CostBreakdown {
+	w := Weights(req.Objective)
+	b := &models.CostBreakdown{}
+	add(b, Distance, "km", resp.TotalDistKm, w.Distance)
+	add(b, Duration, "minutes", RouteMinutes(req, resp), w.Duration)
+	add(b, Vehicles, "vehicles", 1, w.Vehicles)
+	var late, unserved float64
+	for _, p := range resp.Penalties {
+		if p.Kind == models.PenaltyUnserved {
+			unserved += p.Cost
+		} else {
+			late += p.Cost
+		}
+	}
+	add(b, Lateness, "penalty", late, w.Lateness)
+	add(b, Emissions, "kg_co2", resp.TotalDistKm*req.EmissionsKgPerKm, w.Emissions)
+	if len(resp.Unassigned) > 0 {
+		add(b, Unserved, "penalty", unserved, w.Unserved)
+	}
+	return b
+}
+
+// Load breaks down the cost of resp, the allocation for req
+func Load(req models.LoadRequest, resp models.LoadResponse) *models.CostBreakdown {
+	w := Weights(req.Objective)
+	b := &models.CostBreakdown{}
+	add(b, Vehicles, "vehicles", resp.Metadata.ObjectiveValue, w.Vehicles)
+	add(b, Unserved, "penalty", resp.PenaltyCost, w.Unserved)
+	return b
+}
+
+func add(b *models.CostBreakdown, component, unit string, value, weight float64) {
+	cost := value * weight
+	b.Terms = append(b.Terms, models.CostTerm{Component: component, Unit: unit, Value: value, Weight: weight, Cost: cost})
+	b.Total += cost
+}
+
+// RouteMinutes is resp's time from leaving the start to reaching the end: its schedule's
+// when it has one, otherwise driving its legs at req's speeds plus service times
+func RouteMinutes(req models.OptimizationRequest, resp models.OptimizationResponse) float64 {
+	if s := resp.Schedule; len(s) > 1 {
+		first, err1 := time.Parse(time.RFC3339, s[0].Arrival)
+		last, err2 := time.Parse(time.RFC3339, s[len(s)-1].Arrival)
+		if err1 == nil && err2 == nil {
+			return last.Sub(first).Minutes()
+		}
+	}
+	var minutes float64
+	for i := 1; i < len(resp.Route); i++ {
+		minutes += schedule.LegHours(req, geo.HaversineKm(resp.Route[i-1], resp.Route[i]))*60 + resp.Route[i-1].ServiceMinutes
+	}
+	return minutes
+}
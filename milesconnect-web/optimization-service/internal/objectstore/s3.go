@@ -0,0 +1,73 @@
+// Package objectstore keeps large payloads in S3-compatible object storage.
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Config locates the bucket. Endpoint is host[:port] without a scheme, e.g.
+// s3.ap-south-1.amazonaws.com or minio:9000.
+type Config struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3 stores objects in one bucket of an S3-compatible service
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 returns a client for cfg's bucket. With no access key it falls back to the
+// standard AWS environment and instance credentials.
+func NewS3(cfg Config) (*S3, error) {
+	creds := credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, "")
+	if cfg.AccessKey == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{}, &credentials.IAM{},
+		})
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{Creds: creds, Secure: cfg.UseSSL, Region: cfg.Region})
+	if err != nil {
+		return nil, fmt.Errorf("objectstore: %w", err)
+	}
+	return &S3{client: client, bucket: cfg.Bucket}, nil
+}
+
+// Put uploads data under key
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// PresignGet returns a URL that downloads key without credentials until expiry passes
+func (s *S3) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Ping checks the bucket exists and the credentials can see it, for readiness probes
+func (s *S3) Ping(ctx context.Context) error {
+	ok, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("objectstore: bucket %q does not exist", s.bucket)
+	}
+	return nil
+}
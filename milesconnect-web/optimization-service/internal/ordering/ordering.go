@@ -0,0 +1,151 @@
+// Package ordering checks a solved route against its waypoints' order rules, unload
+// priorities and after lists, so a route that breaks them says so instead of being
+// returned as if it didn't.
+package ordering
+
+import (
+	"fmt"
+	"milesconnect-optimization/internal/models"
+	"slices"
+	"strings"
+)
+
+// Check lists the violations of resp, a solved route for req: rules that contradict
+// each other first, then the ones the route's order breaks, stop by stop. Stops are
+// matched to after lists by ID, the first stop having each.
+func Check(req models.OptimizationRequest, resp models.OptimizationResponse) []models.Violation {
+	byID := map[string]models.Location{}
+	for _, wp := range req.Waypoints {
+		if _, ok := byID[wp.ID]; wp.ID != "" && !ok {
+			byID[wp.ID] = wp
+		}
+	}
+	violations := cycles(req.Waypoints, byID)
+	for _, wp := range req.Waypoints {
+		for _, id := range wp.After {
+			before, ok := byID[id]
+			if ok && wp.UnloadPriority > 0 && before.UnloadPriority > wp.UnloadPriority {
+				violations = append(violations, models.Violation{
+					Kind: models.ViolationPriorityConflict, Severity: models.SeverityWarning, StopID: wp.ID, OtherID: id,
+					Message: fmt.Sprintf("%s is to come after %s, but its unload priority %d is ahead of %s's %d", wp.ID, id, wp.UnloadPriority, id, before.UnloadPriority),
+				})
+			}
+		}
+	}
+
+	if len(resp.Route) < 2 {
+		return violations
+	}
+	stops := resp.Route[1 : len(resp.Route)-1]
+	pos := map[string]int{}
+	for i, loc := range stops {
+		if _, ok := pos[loc.ID]; loc.ID != "" && !ok {
+			pos[loc.ID] = i
+		}
+	}
+	for i, loc := range stops {
+		for _, id := range loc.After {
+			switch j, ok := pos[id]; {
+			case !ok:
+				violations = append(violations, models.Violation{
+					Kind: models.ViolationUnassignedBefore, Severity: models.SeverityInfo, StopID: loc.ID, OtherID: id,
+					Message: fmt.Sprintf("%s is to come after %s, which isn't on the route", name(loc, i), id),
+				})
+			case j > i:
+				violations = append(violations, models.Violation{
+					Kind: models.ViolationPrecedence, Severity: models.SeverityError, StopID: loc.ID, OtherID: id,
+					Message: fmt.Sprintf("%s is visited before %s, which it is to come after", name(loc, i), id),
+				})
+			}
+		}
+		if p := loc.UnloadPriority; p > 0 {
+			if j := slices.IndexFunc(stops[:i], func(l models.Location) bool { return l.UnloadPriority > p }); j >= 0 {
+				violations = append(violations, models.Violation{
+					Kind: models.ViolationPriorityOrder, Severity: models.SeverityWarning, StopID: loc.ID, OtherID: stops[j].ID,
+					Message: fmt.Sprintf("%s has unload priority %d but is visited after %s, of priority %d", name(loc, i), p, name(stops[j], j), stops[j].UnloadPriority),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// name is how a stop at position i among the route's stops is referred to
+func name(loc models.Location, i int) string {
+	if loc.ID != "" {
+		return loc.ID
+	}
+	return fmt.Sprintf("the stop at position %d", i+1)
+}
+
+// cycles reports each group of waypoints whose after rules lead round in a circle, so
+// no order meets them all. Groups are found as the strongly connected components of the
+// after graph, in the order of their first waypoint.
+func cycles(waypoints []models.Location, byID map[string]models.Location) []models.Violation {
+	first := map[string]int{} // request position of each ID's waypoint
+	var order []string
+	for i, wp := range waypoints {
+		if _, ok := first[wp.ID]; wp.ID != "" && !ok {
+			first[wp.ID] = i
+			order = append(order, wp.ID)
+		}
+	}
+	// Tarjan's algorithm
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var groups [][]string
+	var visit func(id string)
+	visit = func(id string) {
+		index[id], low[id] = len(index), len(index)
+		stack = append(stack, id)
+		onStack[id] = true
+		for _, next := range byID[id].After {
+			if _, ok := byID[next]; !ok {
+				continue
+			}
+			if _, seen := index[next]; !seen {
+				visit(next)
+				low[id] = min(low[id], low[next])
+			} else if onStack[next] {
+				low[id] = min(low[id], index[next])
+			}
+		}
+		if low[id] != index[id] {
+			return
+		}
+		var group []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			group = append(group, top)
+			if top == id {
+				break
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	for _, id := range order {
+		if _, seen := index[id]; !seen {
+			visit(id)
+		}
+	}
+
+	byFirst := func(a, b string) int { return first[a] - first[b] }
+	for _, g := range groups {
+		slices.SortFunc(g, byFirst)
+	}
+	slices.SortFunc(groups, func(a, b []string) int { return byFirst(a[0], b[0]) })
+	var violations []models.Violation
+	for _, g := range groups {
+		violations = append(violations, models.Violation{
+			Kind: models.ViolationCycle, Severity: models.SeverityError, StopID: g[0],
+			Message: fmt.Sprintf("the after rules of %s go round in a circle, so not all of them can hold", strings.Join(g, ", ")),
+		})
+	}
+	return violations
+}
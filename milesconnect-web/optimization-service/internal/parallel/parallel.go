@@ -0,0 +1,44 @@
+// Package parallel spreads loops over large index ranges across the available CPUs
+package parallel
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Range is the half-open index range [Lo, Hi)
+type Range struct {
+	Lo, Hi int
+}
+
+// Split divides [0, n) into contiguous ranges of at least minSize indices, at most
+// one per GOMAXPROCS. Small n gives a single range.
+func Split(n, minSize int) []Range {
+	parts := min(runtime.GOMAXPROCS(0), n/max(minSize, 1))
+	if parts <= 1 {
+		return []Range{{0, n}}
+	}
+	ranges := make([]Range, parts)
+	for i := range ranges {
+		ranges[i] = Range{Lo: i * n / parts, Hi: (i + 1) * n / parts}
+	}
+	return ranges
+}
+
+// Do calls fn for every range, each on its own goroutine, and waits for them all. A
+// single range runs on the calling goroutine.
+func Do(ranges []Range, fn func(i int, r Range)) {
+	if len(ranges) == 1 {
+		fn(0, ranges[0])
+		return
+	}
+	var wg sync.WaitGroup
+	for i, r := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(i, r)
+		}()
+	}
+	wg.Wait()
+}
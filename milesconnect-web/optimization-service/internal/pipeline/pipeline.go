@@ -0,0 +1,130 @@
+// Package pipeline is what /optimize does around a route solver: the steps that adjust
+// the solved route and the ones that annotate it, shared by the service and the
+// command-line tools so they route a request alike.
+package pipeline
+
+import (
+	"context"
+	"math"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/maxrange"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/objective"
+	"milesconnect-optimization/internal/ordering"
+	"milesconnect-optimization/internal/priority"
+	"milesconnect-optimization/internal/reload"
+	"milesconnect-optimization/internal/schedule"
+	"milesconnect-optimization/internal/solvers"
+	"milesconnect-optimization/internal/stability"
+	"milesconnect-optimization/internal/weather"
+	"slices"
+	"time"
+)
+
+// Offline routes req as the service does with its built-in defaults, on great-circle
+// distances and the request's weather regions: Defaults, then Solve within Budget,
+// Schedule and Annotate.
+func Offline(ctx context.Context, req models.OptimizationRequest, solve solvers.Func, timeout time.Duration) models.OptimizationResponse {
+	req = Defaults(req)
+	solveCtx, cancel := context.WithTimeout(ctx, Budget(timeout, req.SolverParams))
+	resp := Solve(solveCtx, req, solve, nil)
+	cancel()
+	resp, _ = Schedule(ctx, req, resp, nil) // request regions only, which don't fail
+	return Annotate(req, resp)
+}
+
+// Defaults fills in the settings a request leaves 0 as a server configuring none
+// would: the emissions factor, the stability threshold and the travel time spread
+func Defaults(req models.OptimizationRequest) models.OptimizationRequest {
+	if req.EmissionsKgPerKm == 0 {
+		req.EmissionsKgPerKm = objective.DefaultEmissionsKgPerKm
+	}
+	if req.StabilityThresholdPct == 0 {
+		req.StabilityThresholdPct = stability.DefaultThresholdPct
+	}
+	if req.TravelTimeCV == 0 {
+		req.TravelTimeCV = schedule.DefaultTravelTimeCV
+	}
+	return req
+}
+
+// Budget is a solve's time budget: the solver parameters', or else timeout
+func Budget(timeout time.Duration, p *models.SolverParams) time.Duration {
+	if p != nil && p.TimeBudgetMs > 0 {
+		return time.Duration(p.TimeBudgetMs) * time.Millisecond
+	}
+	return timeout
+}
+
+// Solve runs solve, keeps the previous route when the solved one doesn't save enough
+// over it, then moves stops to cut time window penalties, leaves out the ones beyond
+// the vehicle's range and adds the reloads a capacity calls for. Distances come from
+// matrix (see geo.RequestPoints) when set, otherwise great circles.
+func Solve(ctx context.Context, req models.OptimizationRequest, solve solvers.Func, matrix geo.Matrix) models.OptimizationResponse {
+	return reload.Split(req, maxrange.Trim(req, priority.Reorder(ctx, req, stability.Keep(req, solve(ctx, req, matrix), matrix), matrix), matrix), matrix)
+}
+
+// Schedule times resp, solved for req, for requests with a departure time, slowing legs
+// through bad weather from w (nil uses the request's regions only), and checks the
+// unassigned stops' insertions against their windows. err is the weather lookup's; the
+// legs it couldn't look up are timed as clear.
+func Schedule(ctx context.Context, req models.OptimizationRequest, resp models.OptimizationResponse, w *weather.Service) (models.OptimizationResponse, error) {
+	plan, ok, err := schedule.NewPlan(req)
+	if !ok || err != nil {
+		return resp, nil
+	}
+	legs, err := w.Legs(ctx, resp.Route, req.Weather)
+	resp.Schedule = plan.Route(resp.Route, legs)
+	resp.UnassignedStops = timeInsertions(req, plan, resp, legs)
+	return resp, err
+}
+
+// Annotate adds what a scheduled route is reported with: penalties, the cost breakdown
+// and currency, the duration, ordering violations and the stops changed from the
+// previous route. resp may be a cached response; what it shares is left alone.
+func Annotate(req models.OptimizationRequest, resp models.OptimizationResponse) models.OptimizationResponse {
+	resp.Penalties, resp.PenaltyCost = priority.RoutePenalties(req, resp)
+	resp.Cost = objective.Route(req, resp)
+	resp.Currency = req.Currency
+	resp.TotalDurationMin = math.Round(objective.RouteMinutes(req, resp)*10) / 10
+	resp.Violations = ordering.Check(req, resp)
+	if s := resp.Stability; s != nil {
+		changed := *s // cached responses share theirs
+		changed.ChangedStops = stability.Changed(req, resp.Route)
+		resp.Stability = &changed
+	}
+	return resp
+}
+
+// timeInsertions marks the insertions of resp's unassigned stops that would reach the
+// stop late or closed. Legs up to an insertion keep their weather; the route after it
+// is timed as clear.
+func timeInsertions(req models.OptimizationRequest, plan schedule.Plan, resp models.OptimizationResponse, legs []weather.Leg) []models.UnassignedStop {
+	if len(resp.UnassignedStops) == 0 {
+		return resp.UnassignedStops
+	}
+	stops := slices.Clone(resp.UnassignedStops) // cached responses keep theirs
+	for i, u := range stops {
+		at := insertAt(req, resp.Route, u.Insertion.AfterStops)
+		route := slices.Insert(slices.Clone(resp.Route), at, resp.Unassigned[i])
+		eta := plan.Route(route, legs[:min(at, len(legs))])[at]
+		if eta.LateMinutes > 0 || eta.Closed {
+			u.Insertion.BlockedBy = append(slices.Clone(u.Insertion.BlockedBy), models.ConstraintTimeWindow)
+			u.Insertion.LateMinutes, u.Insertion.Closed = eta.LateMinutes, eta.Closed
+		}
+		stops[i] = u
+	}
+	return stops
+}
+
+// insertAt is the index in route just past its first n deliveries, reloads at req's
+// start not counted
+func insertAt(req models.OptimizationRequest, route []models.Location, n int) int {
+	i := 1
+	for ; n > 0 && i < len(route)-1; i++ {
+		if loc := route[i]; loc.ID != req.Start.ID || loc.Lat != req.Start.Lat || loc.Lng != req.Start.Lng {
+			n--
+		}
+	}
+	return i
+}
@@ -0,0 +1,240 @@
+// Package priority weighs customer tiers: what a stop reached after its window, or a
+// shipment left unassigned, costs for each tier, so solvers can prefer failing
+// standard customers over platinum ones when something has to give.
+package priority
+
+import (
+	"context"
+	"maps"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/objective"
+	"milesconnect-optimization/internal/schedule"
+	"slices"
+	"time"
+)
+
+// Tiers lists the customer tiers, highest first
+var Tiers = []string{models.TierPlatinum, models.TierGold, models.TierStandard}
+
+var defaults = map[string]models.TierPenalty{
+	models.TierPlatinum: {LatePerMinute: 10, Unserved: 1000},
+	models.TierGold:     {LatePerMinute: 3, Unserved: 300},
+	models.TierStandard: {LatePerMinute: 1, Unserved: 100},
+}
+
+// Defaults are the penalties used when neither the server nor the request sets any
+func Defaults() map[string]models.TierPenalty {
+	return maps.Clone(defaults)
+}
+
+// Valid reports whether tier names a tier; empty is standard
+func Valid(tier string) bool {
+	return tier == "" || slices.Contains(Tiers, tier)
+}
+
+// Merge returns base with the tiers in overrides replaced
+func Merge(base, overrides map[string]models.TierPenalty) map[string]models.TierPenalty {
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = map[string]models.TierPenalty{}
+	}
+	maps.Copy(merged, overrides)
+	return merged
+}
+
+// Convert returns table with every penalty multiplied by rate, the value of one unit of
+// its currency in another; table itself when rate is 1
+func Convert(table map[string]models.TierPenalty, rate float64) map[string]models.TierPenalty {
+	if rate == 1 {
+		return table
+	}
+	converted := make(map[string]models.TierPenalty, len(table))
+	for tier, p := range table {
+		converted[tier] = models.TierPenalty{LatePerMinute: p.LatePerMinute * rate, Unserved: p.Unserved * rate}
+	}
+	return converted
+}
+
+// Lookup returns tier's penalty from table, falling back to Defaults
+func Lookup(table map[string]models.TierPenalty, tier string) models.TierPenalty {
+	if tier == "" {
+		tier = models.TierStandard
+	}
+	if p, ok := table[tier]; ok {
+		return p
+	}
+	return defaults[tier]
+}
+
+func tierName(tier string) string {
+	if tier == "" {
+		return models.TierStandard
+	}
+	return tier
+}
+
+// RoutePenalties lists the late penalties of resp's schedule and the unserved ones of
+// its unassigned waypoints
+func RoutePenalties(req models.OptimizationRequest, resp models.OptimizationResponse) (penalties []models.Penalty, total float64) {
+	for i, eta := range resp.Schedule {
+		if eta.LateMinutes <= 0 || i >= len(resp.Route) {
+			continue
+		}
+		tier := resp.Route[i].Tier
+		cost := eta.LateMinutes * Lookup(req.TierPenalties, tier).LatePerMinute
+		penalties = append(penalties, models.Penalty{Kind: models.PenaltyLate, ID: eta.ID, Tier: tierName(tier), LateMinutes: eta.LateMinutes, Cost: cost})
+		total += cost
+	}
+	for _, loc := range resp.Unassigned {
+		cost := Lookup(req.TierPenalties, loc.Tier).Unserved
+		penalties = append(penalties, models.Penalty{Kind: models.PenaltyUnserved, ID: loc.ID, Tier: tierName(loc.Tier), Cost: cost})
+		total += cost
+	}
+	return penalties, total
+}
+
+// LoadPenalties lists the unserved penalties of resp's unassigned shipments
+func LoadPenalties(req models.LoadRequest, resp models.LoadResponse) (penalties []models.Penalty, total float64) {
+	// Shipment IDs needn't be unique; each unassigned ID uses up one shipment of that ID
+	byID := make(map[string][]string, len(req.Shipments))
+	for _, s := range req.Shipments {
+		byID[s.ID] = append(byID[s.ID], s.Tier)
+	}
+	for _, id := range resp.Unassigned {
+		var tier string
+		if tiers := byID[id]; len(tiers) > 0 {
+			tier, byID[id] = tiers[0], tiers[1:]
+		}
+		cost := Lookup(req.TierPenalties, tier).Unserved
+		penalties = append(penalties, models.Penalty{Kind: models.PenaltyUnserved, ID: id, Tier: tierName(tier), Cost: cost})
+		total += cost
+	}
+	return penalties, total
+}
+
+// MaxReorderWaypoints is the most waypoints Reorder rearranges; each pass tries every
+// move of every waypoint and times the whole route for each
+const MaxReorderWaypoints = 200
+
+// stop is a route location's timing input, as instants
+type stop struct {
+	start, end time.Time // zero when open
+	service    time.Duration
+	latePerMin float64
+}
+
+// Reorder improves resp, a solved route for req, when the request has a departure time
+// and some waypoint has a time window, opening hours or holidays or its objective
+// weighs duration: waypoints are
+// moved one at a time to wherever lowers the route's cost under the objective, until no
+// move helps or ctx is done. Distances come from matrix (see geo.RequestPoints) when
+// set, otherwise great circles; lateness and duration are timed as the schedule is,
+// over great circles at the request's speed.
+func Reorder(ctx context.Context, req models.OptimizationRequest, resp models.OptimizationResponse, matrix geo.Matrix) models.OptimizationResponse {
+	w := objective.Weights(req.Objective)
+	plan, ok, err := schedule.NewPlan(req)
+	if !ok || err != nil || len(req.Waypoints) > MaxReorderWaypoints || len(resp.Route) != len(req.Waypoints)+2 ||
+		(w.Duration == 0 && !slices.ContainsFunc(req.Waypoints, plan.Constrained)) {
+		return resp
+	}
+	points := geo.RequestPoints(req)
+	index, ok := geo.RouteIndices(points, resp.Route)
+	if !ok {
+		return resp
+	}
+
+	stops := make([]stop, len(points))
+	for p, loc := range points {
+		start, end, _ := plan.Window(loc)
+		stops[p] = stop{start, end, time.Duration(loc.ServiceMinutes * float64(time.Minute)), Lookup(req.TierPenalties, loc.Tier).LatePerMinute}
+	}
+	// Every move is timed over the same legs, so great circles are worked out once
+	gc := geo.HaversineMatrix(points)
+	km := gc
+	if matrix != nil {
+		km = matrix
+	}
+	perKm := objective.KmCost(w, req.EmissionsKgPerKm)
+	// cost is the weighted distance, duration and late penalties of the route through index
+	cost := func() (total, dist float64) {
+		var late float64
+		t := plan.Departure
+		for i := 1; i < len(index); i++ {
+			a, b := index[i-1], index[i]
+			dist += km[a][b]
+			hours := plan.LegHours(gc[a][b])
+			t = t.Add(time.Duration(hours * float64(time.Hour)))
+			s := stops[b]
+			last := i == len(index)-1 // the route ends on arrival
+			if !last {
+				if !s.start.IsZero() && t.Before(s.start) {
+					t = s.start
+				}
+				if open, ok := plan.OpenAt(points[b], t); ok {
+					t = open
+				}
+			}
+			if !s.end.IsZero() && t.After(s.end) {
+				late += t.Sub(s.end).Minutes() * s.latePerMin
+			}
+			if last {
+				break
+			}
+			t = t.Add(s.service)
+		}
+		return perKm*dist + w.Duration*t.Sub(plan.Departure).Minutes() + w.Lateness*late, dist
+	}
+
+	best, _ := cost()
+	initial := best
+	exhausted := false
+	// Positions 1 to n are the waypoints; the start and end stay put
+	n := len(index) - 2
+	for improved := true; improved && !exhausted; {
+		improved = false
+		for i := 1; i <= n && !exhausted; i++ {
+			for j := 1; j <= n; j++ {
+				if j == i {
+					continue
+				}
+				if ctx.Err() != nil {
+					exhausted = true
+					break
+				}
+				move(index, i, j)
+				if c, _ := cost(); c < best-1e-9 {
+					best, improved = c, true
+					break
+				}
+				move(index, j, i)
+			}
+		}
+	}
+	if best >= initial-1e-9 {
+		resp.Metadata.BudgetExhausted = resp.Metadata.BudgetExhausted || exhausted
+		return resp
+	}
+
+	route := make([]models.Location, len(index))
+	for i, p := range index {
+		route[i] = points[p]
+	}
+	_, dist := cost()
+	resp.Route = route
+	resp.TotalDistKm = dist
+	resp.Metadata.ObjectiveValue = dist
+	resp.Metadata.BudgetExhausted = resp.Metadata.BudgetExhausted || exhausted
+	return resp
+}
+
+// move takes the element at i out of s and puts it back in at j
+func move(s []int, i, j int) {
+	v := s[i]
+	if i < j {
+		copy(s[i:j], s[i+1:j+1])
+	} else {
+		copy(s[j+1:i+1], s[j:i])
+	}
+	s[j] = v
+}
@@ -0,0 +1,133 @@
+// Package reload splits a solved route whose stops need more than the vehicle carries
+// into trips, sending the vehicle back to its start to reload between them.
+package reload
+
+import (
+	"math"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+)
+
+// Split returns resp, a solved route for req, with reload stops at req.Start where
+// they add the least distance, keeping the stops in their order: every way of cutting
+// the route into trips that fit req.VehicleCapacityKg is weighed, shortest first. A
+// reload stop is req.Start taking req.ReloadMinutes. Distances come from matrix (see
+// geo.RequestPoints) when set, otherwise great circles. resp is returned as it is when
+// the request has no capacity or its route isn't one of the request's points.
+func Split(req models.OptimizationRequest, resp models.OptimizationResponse, matrix geo.Matrix) models.OptimizationResponse {
+	if req.VehicleCapacityKg <= 0 {
+		return resp
+	}
+	points := geo.RequestPoints(req)
+	index, ok := geo.RouteIndices(points, resp.Route)
+	if !ok || len(index) < 2 {
+		return resp
+	}
+	gc := geo.Prepare(points)
+	km := func(a, b int) float64 {
+		if matrix != nil {
+			return matrix[a][b]
+		}
+		return gc.Km(a, b)
+	}
+	stops := index[1 : len(index)-1]
+	total, starts := trips(points, stops, req.VehicleCapacityKg, km)
+	if math.IsInf(total, 1) {
+		return resp // a stop that doesn't fit on its own, which validation rules out
+	}
+	const depot = 0
+	end := len(points) - 1
+	n := len(stops)
+
+	reload := req.Start
+	reload.ServiceMinutes = req.ReloadMinutes
+	reload.TimeWindow = nil
+	route := []models.Location{points[depot]}
+	for t, s := range starts {
+		e, back := n, end
+		if t+1 < len(starts) {
+			e, back = starts[t+1], depot
+		}
+		if t > 0 {
+			route = append(route, reload)
+		}
+		trip := models.Trip{StopIDs: []string{}}
+		prev := depot
+		for _, p := range stops[s:e] {
+			route = append(route, points[p])
+			trip.StopIDs = append(trip.StopIDs, points[p].ID)
+			trip.LoadKg += points[p].DemandKg
+			trip.DistanceKm += km(prev, p)
+			prev = p
+		}
+		trip.DistanceKm += km(prev, back)
+		resp.Trips = append(resp.Trips, trip)
+	}
+	resp.Route = append(route, points[end])
+	resp.TotalDistKm = total
+	resp.Metadata.ObjectiveValue = total
+	return resp
+}
+
+// Distance is the length of the route from points[0] through stops to the last of
+// points, stops being indices into points as in geo.RequestPoints, with the reloads
+// Split adds for capacity; a capacity of 0 adds none. It is infinite when a stop
+// needs more than capacity.
+func Distance(points []models.Location, stops []int, capacity float64, km func(a, b int) float64) float64 {
+	total, _ := trips(points, stops, capacity, km)
+	return total
+}
+
+// trips finds the shortest way of serving stops in trips that fit capacity, returning
+// its length and the positions in stops where each trip starts
+func trips(points []models.Location, stops []int, capacity float64, km func(a, b int) float64) (total float64, starts []int) {
+	const depot = 0
+	end := len(points) - 1
+	n := len(stops)
+	if n == 0 || capacity <= 0 {
+		prev := depot
+		for _, p := range stops {
+			total += km(prev, p)
+			prev = p
+		}
+		return total + km(prev, end), []int{0}
+	}
+
+	// best[i] is the least distance serving stops[:i] in trips back to the depot, the
+	// last of which starts at stops[from[i]]
+	best := make([]float64, n+1)
+	from := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(1)
+	}
+	last := 0 // where the final trip, to the end, starts
+	total = math.Inf(1)
+	for i := 0; i < n; i++ {
+		if math.IsInf(best[i], 1) {
+			continue
+		}
+		var load, inner float64
+		for j := i; j < n; j++ {
+			if load += points[stops[j]].DemandKg; load > capacity {
+				break
+			}
+			if j > i {
+				inner += km(stops[j-1], stops[j])
+			}
+			if c := best[i] + km(depot, stops[i]) + inner + km(stops[j], depot); c < best[j+1] {
+				best[j+1], from[j+1] = c, i
+			}
+			if c := best[i] + km(depot, stops[i]) + inner + km(stops[j], end); j == n-1 && c < total {
+				last, total = i, c
+			}
+		}
+	}
+	if math.IsInf(total, 1) {
+		return total, nil
+	}
+	starts = []int{last}
+	for s := last; s > 0; s = from[s] {
+		starts = append([]int{from[s]}, starts...)
+	}
+	return total, starts
+}
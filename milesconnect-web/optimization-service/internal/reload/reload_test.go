@@ -0,0 +1,99 @@
+package reload
+
+import (
+	"math"
+	"math/rand"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"testing"
+)
+
+// tripsLength is the length of serving stops in the trips beginning at starts, every
+// trip but the last ending back at the depot; infinite when one needs more than capacity
+func tripsLength(points []models.Location, stops []int, starts []int, capacity float64, km func(a, b int) float64) float64 {
+	total := 0.0
+	for t, s := range starts {
+		e, to := len(stops), len(points)-1
+		if t+1 < len(starts) {
+			e, to = starts[t+1], 0
+		}
+		load, prev := 0.0, 0
+		for _, p := range stops[s:e] {
+			load += points[p].DemandKg
+			total += km(prev, p)
+			prev = p
+		}
+		if capacity > 0 && load > capacity {
+			return math.Inf(1)
+		}
+		total += km(prev, to)
+	}
+	return total
+}
+
+// bruteForce tries every way of cutting stops into trips
+func bruteForce(points []models.Location, stops []int, capacity float64, km func(a, b int) float64) float64 {
+	best := math.Inf(1)
+	for cuts := 0; cuts < 1<<max(len(stops)-1, 0); cuts++ {
+		starts := []int{0}
+		for i := 1; i < len(stops); i++ {
+			if cuts&(1<<(i-1)) != 0 {
+				starts = append(starts, i)
+			}
+		}
+		best = min(best, tripsLength(points, stops, starts, capacity, km))
+	}
+	return best
+}
+
+func TestTripsMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name     string
+		n        int
+		capacity float64
+		endAway  bool // the route ends somewhere other than the depot
+	}{
+		{"no stops", 0, 10, false},
+		{"no capacity", 6, 0, false},
+		{"one trip", 6, 1000, false},
+		{"tight", 8, 12, false},
+		{"loose", 10, 30, false},
+		{"open end", 9, 15, true},
+		{"too heavy", 5, 4, false},
+	}
+	for _, tt := range tests {
+		for round := range 20 {
+			points := make([]models.Location, tt.n+2)
+			for i := range points {
+				points[i] = models.Location{Lat: 28 + rng.Float64(), Lng: 77 + rng.Float64(), DemandKg: float64(1 + rng.Intn(8))}
+			}
+			if !tt.endAway {
+				points[len(points)-1] = points[0]
+			}
+			stops := rng.Perm(tt.n)
+			for i := range stops {
+				stops[i]++
+			}
+			p := geo.Prepare(points)
+
+			got, starts := trips(points, stops, tt.capacity, p.Km)
+			want := bruteForce(points, stops, tt.capacity, p.Km)
+			if math.IsInf(want, 1) {
+				if !math.IsInf(got, 1) || starts != nil {
+					t.Fatalf("%s, round %d: trips = %v, %v; want +Inf, nil", tt.name, round, got, starts)
+				}
+				continue
+			}
+			if math.Abs(got-want) > 1e-9 {
+				t.Fatalf("%s, round %d: trips = %v, brute force %v", tt.name, round, got, want)
+			}
+			if l := tripsLength(points, stops, starts, tt.capacity, p.Km); math.Abs(l-got) > 1e-9 {
+				t.Fatalf("%s, round %d: starts %v come to %v, not %v", tt.name, round, starts, l, got)
+			}
+			if d := Distance(points, stops, tt.capacity, p.Km); d != got {
+				t.Fatalf("%s, round %d: Distance = %v, trips %v", tt.name, round, d, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package retry re-runs transient failures with exponential backoff and jitter,
+// within a time budget and the caller's deadline.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy configures retries. The zero value makes a single attempt.
+type Policy struct {
+	MaxAttempts int           // total attempts including the first
+	BaseDelay   time.Duration // delay before the first retry; doubled for each one after
+	MaxDelay    time.Duration // cap on a single delay
+	Budget      time.Duration // total time for all attempts and delays; 0 means only the deadline limits it
+}
+
+type permanentError struct{ err error }
+
+func (p permanentError) Error() string { return p.err.Error() }
+func (p permanentError) Unwrap() error { return p.err }
+
+// Permanent marks err as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// Do calls fn until it succeeds, returns a permanent error, or the attempts run out.
+// A retry is skipped when its delay plus the duration of the last attempt would
+// overrun the budget or ctx's deadline, since it could not finish in time anyway.
+// The last error from fn is returned.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	started := time.Now()
+	attempts := max(p.MaxAttempts, 1)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		attemptStarted := time.Now()
+		err = fn(ctx)
+		if err == nil || IsPermanent(err) || attempt == attempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := p.delay(attempt)
+		needed := delay + time.Since(attemptStarted)
+		if p.Budget > 0 && time.Since(started)+needed > p.Budget {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < needed {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// delay is the backoff before retry number attempt, with jitter in [d/2, d]
+func (p Policy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if p.MaxDelay > 0 && (d > p.MaxDelay || d <= 0) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,105 @@
+package routing
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState is the circuit breaker's current mode
+type BreakerState int
+
+const (
+	Closed   BreakerState = iota // calls go through
+	HalfOpen                     // one probe call is let through after the cooldown
+	Open                         // calls are short-circuited
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerConfig sets when a breaker trips and how long it stays open
+type BreakerConfig struct {
+	FailureThreshold int           // consecutive failures that open the breaker
+	SlowCall         time.Duration // calls slower than this count as failures; 0 disables
+	Cooldown         time.Duration // time open before a probe call is allowed
+}
+
+// Breaker is a consecutive-failure circuit breaker. Slow calls count as failures
+// even when they succeed, so a provider that answers but too slowly also trips it.
+type Breaker struct {
+	cfg BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker returns a closed breaker
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = 1
+	}
+	return &Breaker{cfg: cfg}
+}
+
+// Allow reports whether a call may go through. After the cooldown a single probe is
+// allowed; its outcome, passed to Record, closes or re-opens the breaker.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.state = HalfOpen
+		b.probing = true
+		return true
+	case HalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record reports the outcome of a call that Allow let through
+func (b *Breaker) Record(err error, elapsed time.Duration) {
+	failed := err != nil || (b.cfg.SlowCall > 0 && elapsed > b.cfg.SlowCall)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.state = Closed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.state = Open
+		b.openedAt = time.Now()
+	}
+}
+
+// State returns the breaker's current state
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
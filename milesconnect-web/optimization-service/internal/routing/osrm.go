@@ -0,0 +1,133 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/retry"
+)
+
+// OSRMName identifies the OSRM provider in responses and metrics
+const OSRMName = "osrm"
+
+// OSRM fetches road distances from an OSRM server's table service
+type OSRM struct {
+	BaseURL string // e.g. http://osrm:5000
+	Profile string // "driving" when empty
+	Client  *http.Client
+}
+
+func (o *OSRM) Name() string { return OSRMName }
+
+// osrmResponse is the body of both the table and the route service
+type osrmResponse struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Distances [][]*float64 `json:"distances"` // table: metres; null when no route exists
+	Routes    []struct {
+		Legs []struct {
+			Distance float64 `json:"distance"` // metres
+		} `json:"legs"`
+	} `json:"routes"`
+}
+
+// Matrix requests the full table for points. A pair OSRM can't route between is an
+// error rather than a guess, so the caller can fall back for the whole solve.
+// Rejections of the request itself (4xx, unroutable pairs) are marked permanent;
+// network errors and 5xx responses may be retried.
+func (o *OSRM) Matrix(ctx context.Context, points []models.Location) (geo.Matrix, error) {
+	table, err := o.get(ctx, "table", points, "annotations=distance")
+	if err != nil {
+		return nil, err
+	}
+	if len(table.Distances) != len(points) {
+		return nil, retry.Permanent(errors.New("osrm: table size does not match the request"))
+	}
+
+	m := make(geo.Matrix, len(points))
+	for i, row := range table.Distances {
+		if len(row) != len(points) {
+			return nil, retry.Permanent(errors.New("osrm: table size does not match the request"))
+		}
+		m[i] = make([]float64, len(points))
+		for j, d := range row {
+			if d == nil {
+				return nil, retry.Permanent(fmt.Errorf("osrm: no route from point %d to point %d", i, j))
+			}
+			m[i][j] = *d / 1000
+		}
+	}
+	return m, nil
+}
+
+// Legs asks the route service for the road route through path, in order, and returns
+// the length of each of its legs. Errors are marked as Matrix marks them.
+func (o *OSRM) Legs(ctx context.Context, path []models.Location) ([]float64, error) {
+	route, err := o.get(ctx, "route", path, "overview=false")
+	if err != nil {
+		return nil, err
+	}
+	if len(route.Routes) == 0 || len(route.Routes[0].Legs) != len(path)-1 {
+		return nil, retry.Permanent(errors.New("osrm: route legs do not match the request"))
+	}
+	legs := make([]float64, len(path)-1)
+	for i, leg := range route.Routes[0].Legs {
+		legs[i] = leg.Distance / 1000
+	}
+	return legs, nil
+}
+
+// get calls the OSRM service with points and the query string and decodes its response,
+// failing unless its code is Ok
+func (o *OSRM) get(ctx context.Context, service string, points []models.Location, query string) (osrmResponse, error) {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = strconv.FormatFloat(p.Lng, 'f', 6, 64) + "," + strconv.FormatFloat(p.Lat, 'f', 6, 64)
+	}
+	profile := o.Profile
+	if profile == "" {
+		profile = "driving"
+	}
+	url := fmt.Sprintf("%s/%s/v1/%s/%s?%s",
+		strings.TrimRight(o.BaseURL, "/"), service, profile, strings.Join(coords, ";"), query)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return osrmResponse{}, err
+	}
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return osrmResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	rejected := resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests
+
+	var body osrmResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		err = fmt.Errorf("osrm: decoding %s (HTTP %d): %w", service, resp.StatusCode, err)
+		if rejected {
+			err = retry.Permanent(err)
+		}
+		return osrmResponse{}, err
+	}
+	if body.Code != "Ok" {
+		err := fmt.Errorf("osrm: %s: %s (HTTP %d)", body.Code, body.Message, resp.StatusCode)
+		if rejected || body.Code == "NoRoute" {
+			err = retry.Permanent(err)
+		}
+		return osrmResponse{}, err
+	}
+	return body, nil
+}
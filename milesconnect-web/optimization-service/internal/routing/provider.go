@@ -0,0 +1,34 @@
+// Package routing supplies distance matrices for solvers, either great-circle
+// distances or road distances from an external routing engine.
+package routing
+
+import (
+	"context"
+
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+)
+
+// HaversineName identifies great-circle distances in responses and metrics
+const HaversineName = "haversine"
+
+// Provider computes the distance matrix between points
+type Provider interface {
+	Name() string
+	Matrix(ctx context.Context, points []models.Location) (geo.Matrix, error)
+}
+
+// LegProvider is a Provider that measures the legs of a path, from each point to the
+// next, in one call, far cheaper than the matrix of its points
+type LegProvider interface {
+	Legs(ctx context.Context, path []models.Location) ([]float64, error)
+}
+
+// Haversine is the built-in provider using great-circle distances. It never fails.
+type Haversine struct{}
+
+func (Haversine) Name() string { return HaversineName }
+
+func (Haversine) Matrix(_ context.Context, points []models.Location) (geo.Matrix, error) {
+	return geo.HaversineMatrix(points), nil
+}
@@ -0,0 +1,117 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/metrics"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/retry"
+)
+
+// Resilient calls Primary through a circuit breaker, retrying transient failures,
+// and falls back to great-circle distances when the call fails or the breaker is
+// open, so a routing outage lowers route quality instead of failing requests.
+type Resilient struct {
+	Primary Provider
+	Breaker *Breaker
+	Retry   retry.Policy
+	Timeout time.Duration // per-attempt limit on top of the caller's deadline; 0 means none
+}
+
+// errBreakerOpen is reported as the fallback reason while calls are short-circuited
+var errBreakerOpen = errors.New("circuit breaker open")
+
+// Matrix returns the distance matrix for points and where it came from. It never fails.
+func (r *Resilient) Matrix(ctx context.Context, points []models.Location) (geo.Matrix, models.DistanceSource) {
+	var m geo.Matrix
+	source, ok := r.do(ctx, func(ctx context.Context) (err error) {
+		m, err = r.Primary.Matrix(ctx, points)
+		return err
+	})
+	if !ok {
+		return geo.HaversineMatrix(points), source
+	}
+	return m, source
+}
+
+// Legs returns the road length of each leg of path, path[i] to path[i+1], and where
+// they came from, asking a Primary that isn't a LegProvider for the matrix of path.
+// When the call fails legs is nil and the source says why; it never fails.
+func (r *Resilient) Legs(ctx context.Context, path []models.Location) ([]float64, models.DistanceSource) {
+	var legs []float64
+	source, ok := r.do(ctx, func(ctx context.Context) (err error) {
+		if lp, ok := r.Primary.(LegProvider); ok {
+			legs, err = lp.Legs(ctx, path)
+			return err
+		}
+		m, err := r.Primary.Matrix(ctx, path)
+		if err != nil {
+			return err
+		}
+		legs = make([]float64, len(path)-1)
+		for i := range legs {
+			legs[i] = m[i][i+1]
+		}
+		return nil
+	})
+	if !ok {
+		return nil, source
+	}
+	return legs, source
+}
+
+// do runs call against the primary and reports where the distances came from: the
+// primary, or great-circle distances with ok false when it failed
+func (r *Resilient) do(ctx context.Context, call func(ctx context.Context) error) (source models.DistanceSource, ok bool) {
+	name := r.Primary.Name()
+	err := r.call(ctx, call)
+	metrics.RoutingBreakerState.Set(float64(r.Breaker.State()), name)
+	if err == nil {
+		metrics.RoutingCalls.Inc(name, "ok")
+		return models.DistanceSource{Provider: name}, true
+	}
+
+	// Clients get a short reason; the provider's error (URLs included) only goes to the log
+	outcome, reason := "short_circuited", name+" circuit breaker open"
+	if !errors.Is(err, errBreakerOpen) {
+		outcome, reason = "error", name+" request failed"
+		slog.WarnContext(ctx, "routing provider failed, using great-circle distances", "provider", name, "error", err)
+	}
+	metrics.RoutingCalls.Inc(name, outcome)
+	return models.DistanceSource{
+		Provider:       HaversineName,
+		Fallback:       true,
+		FallbackReason: reason,
+	}, false
+}
+
+func (r *Resilient) call(ctx context.Context, call func(ctx context.Context) error) error {
+	attempt := 0
+	return r.Retry.Do(ctx, func(ctx context.Context) error {
+		if attempt++; attempt > 1 {
+			metrics.RoutingRetries.Inc(r.Primary.Name())
+		}
+		if !r.Breaker.Allow() {
+			return retry.Permanent(errBreakerOpen)
+		}
+		if r.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+			defer cancel()
+		}
+		started := time.Now()
+		err := call(ctx)
+
+		// Requests the provider rejects outright say nothing about its health
+		breakerErr := err
+		if retry.IsPermanent(err) {
+			breakerErr = nil
+		}
+		r.Breaker.Record(breakerErr, time.Since(started))
+		return err
+	})
+}
@@ -0,0 +1,104 @@
+// Package scenario builds what-if variants of a fleet allocation — vehicles taken out
+// or added, demand scaled — and compares their solutions with the baseline's, for
+// capacity planning.
+package scenario
+
+import (
+	"cmp"
+	"maps"
+	"milesconnect-optimization/internal/models"
+	"slices"
+)
+
+// Apply returns the baseline request of req with its changes made
+func Apply(req models.ScenarioRequest) models.LoadRequest {
+	out := req.LoadRequest
+	removed := make(map[string]bool, len(req.Changes.RemoveVehicles))
+	for _, id := range req.Changes.RemoveVehicles {
+		removed[id] = true
+	}
+	out.Vehicles = slices.DeleteFunc(slices.Clone(req.Vehicles), func(v models.VehicleInfo) bool { return removed[v.ID] })
+	out.Vehicles = append(out.Vehicles, req.Changes.AddVehicles...)
+	if p := req.Changes.DemandPct; p != 0 {
+		out.Shipments = slices.Clone(req.Shipments)
+		for i := range out.Shipments {
+			out.Shipments[i].WeightKg *= 1 + p/100
+		}
+	}
+	return out
+}
+
+// Diff compares scenario with baseline, either solved here or by an earlier
+// /optimize-load. Shipment IDs are matched in order, so repeated IDs pair up first to
+// first.
+func Diff(baseline, scenario models.LoadResponse) models.ScenarioDiff {
+	d := models.ScenarioDiff{
+		VehiclesUsed: len(scenario.Allocations) - len(baseline.Allocations),
+		Unassigned:   len(scenario.Unassigned) - len(baseline.Unassigned),
+		PenaltyCost:  scenario.PenaltyCost - baseline.PenaltyCost,
+	}
+	if baseline.Cost != nil && scenario.Cost != nil {
+		d.Cost = scenario.Cost.Total - baseline.Cost.Total
+	}
+
+	before, after := placements(baseline), placements(scenario)
+	for _, id := range slices.Sorted(maps.Keys(before)) {
+		from, to := before[id], after[id]
+		for i := range max(len(from), len(to)) {
+			switch {
+			case i >= len(to):
+				d.NewlyUnassigned = append(d.NewlyUnassigned, id)
+			case i >= len(from):
+				d.NewlyAssigned = append(d.NewlyAssigned, id)
+			case from[i] != to[i]:
+				d.Moved = append(d.Moved, models.ShipmentMove{ShipmentID: id, From: from[i], To: to[i]})
+			}
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(after)) {
+		if _, ok := before[id]; !ok {
+			for range after[id] {
+				d.NewlyAssigned = append(d.NewlyAssigned, id)
+			}
+		}
+	}
+
+	loads := map[string]*models.VehicleChange{}
+	change := func(id string) *models.VehicleChange {
+		if loads[id] == nil {
+			loads[id] = &models.VehicleChange{VehicleID: id}
+		}
+		return loads[id]
+	}
+	for _, a := range baseline.Allocations {
+		c := change(a.VehicleID)
+		c.BaselineWeight, c.BaselineUtilPct = a.TotalWeight, a.UtilizationPct
+		c.ShipmentsDelta -= len(a.ShipmentIDs)
+	}
+	for _, a := range scenario.Allocations {
+		c := change(a.VehicleID)
+		c.ScenarioWeight, c.ScenarioUtilPct = a.TotalWeight, a.UtilizationPct
+		c.ShipmentsDelta += len(a.ShipmentIDs)
+	}
+	for _, c := range loads {
+		if c.BaselineWeight != c.ScenarioWeight || c.ShipmentsDelta != 0 {
+			d.Vehicles = append(d.Vehicles, *c)
+		}
+	}
+	slices.SortFunc(d.Vehicles, func(a, b models.VehicleChange) int { return cmp.Compare(a.VehicleID, b.VehicleID) })
+	d.Identical = d.VehiclesUsed == 0 && d.Unassigned == 0 && d.PenaltyCost == 0 && d.Cost == 0 &&
+		len(d.NewlyUnassigned) == 0 && len(d.NewlyAssigned) == 0 && len(d.Moved) == 0 && len(d.Vehicles) == 0
+	return d
+}
+
+// placements lists the vehicle each assigned shipment went to, by shipment ID in
+// allocation order
+func placements(resp models.LoadResponse) map[string][]string {
+	on := map[string][]string{}
+	for _, a := range resp.Allocations {
+		for _, id := range a.ShipmentIDs {
+			on[id] = append(on[id], a.VehicleID)
+		}
+	}
+	return on
+}
@@ -0,0 +1,51 @@
+package schedule
+
+import "math"
+
+// DefaultTravelTimeCV is the spread of leg driving times, as a fraction of them, on-time
+// probabilities assume when neither the request nor the server gives one
+const DefaultTravelTimeCV = 0.15
+
+// delay is how far behind its schedule the vehicle runs, in minutes, taken to be
+// normally distributed. Legs add to its variance; waiting at a stop takes up delay,
+// which keeps the distribution normal only approximately, by matching its moments.
+type delay struct {
+	mean, variance float64
+}
+
+// drive is d after a leg of the given minutes whose driving time has a standard
+// deviation of cv times that
+func (d delay) drive(minutes, cv float64) delay {
+	d.variance += cv * minutes * cv * minutes
+	return d
+}
+
+// within is the probability d is at most slack minutes
+func (d delay) within(slack float64) float64 {
+	sd := math.Sqrt(d.variance)
+	if sd == 0 {
+		if d.mean <= slack {
+			return 1
+		}
+		return 0
+	}
+	return normalCDF((slack - d.mean) / sd)
+}
+
+// atLeast is the delay max(d, floor), as the normal distribution with its mean and
+// variance (Clark's approximation)
+func (d delay) atLeast(floor float64) delay {
+	sd := math.Sqrt(d.variance)
+	if sd == 0 {
+		return delay{max(d.mean, floor), 0}
+	}
+	a := (floor - d.mean) / sd
+	below, density := normalCDF(a), math.Exp(-a*a/2)/math.Sqrt(2*math.Pi)
+	m1 := floor*below + d.mean*(1-below) + sd*density
+	m2 := floor*floor*below + (d.mean*d.mean+d.variance)*(1-below) + (d.mean+floor)*sd*density
+	return delay{m1, max(m2-m1*m1, 0)}
+}
+
+func normalCDF(z float64) float64 {
+	return math.Erfc(-z/math.Sqrt2) / 2
+}
@@ -0,0 +1,410 @@
+// Package schedule times a solved route: when each stop is reached and left, given a
+// departure time, an average speed, service times, time windows and opening hours. Times are kept as
+// instants and only rendered in a stop's timezone, so routes crossing timezones or a
+// daylight saving change come out right.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/weather"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // zones work on hosts and images without a zoneinfo database
+)
+
+// DefaultSpeedKmh is the average speed legs are driven at when the request gives none
+const DefaultSpeedKmh = 40
+
+// ErrNonexistent is returned for local times skipped by a daylight saving change
+var ErrNonexistent = errors.New("does not exist in that timezone (skipped by a daylight saving change)")
+
+// FieldError is a scheduling input that doesn't parse, named by its request field
+type FieldError struct {
+	Field string // e.g. departure_time or time_window.end
+	Err   error
+}
+
+func (e *FieldError) Error() string { return e.Field + ": " + e.Err.Error() }
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// Zone loads an IANA timezone; empty is UTC
+func Zone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	// LoadLocation also accepts "Local", which would depend on the host
+	if name == "Local" {
+		return nil, errors.New("unknown time zone Local")
+	}
+	return time.LoadLocation(name)
+}
+
+// Local date-time and time-of-day layouts accepted next to RFC 3339
+var (
+	dateTimeLayouts  = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+	timeOfDayLayouts = []string{"15:04:05", "15:04"}
+)
+
+// ParseTime reads s as an RFC 3339 time with an offset, a local date-time such as
+// 2026-03-08T09:30 in loc, or, when day is set, a time of day such as 09:30 on day's
+// date in loc. A local time that occurs twice, when clocks go back, is the earlier of
+// the two instants; one that never occurs fails with ErrNonexistent.
+func ParseTime(s string, loc *time.Location, day time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range dateTimeLayouts {
+		if wall, err := time.Parse(layout, s); err == nil {
+			return resolve(wall, loc)
+		}
+	}
+	for _, layout := range timeOfDayLayouts {
+		if clock, err := time.Parse(layout, s); err == nil {
+			if day.IsZero() {
+				return time.Time{}, errors.New("a time of day needs departure_time")
+			}
+			y, m, d := day.In(loc).Date()
+			return resolve(time.Date(y, m, d, clock.Hour(), clock.Minute(), clock.Second(), 0, time.UTC), loc)
+		}
+	}
+	return time.Time{}, errors.New("must be an RFC 3339 time, a local date-time like 2006-01-02T15:04 or a time of day like 15:04")
+}
+
+// resolve finds the instant whose wall clock in loc reads wall's UTC fields. The zone
+// offsets in effect half a day either side cover any daylight saving change.
+func resolve(wall time.Time, loc *time.Location) (time.Time, error) {
+	var best time.Time
+	for _, probe := range []time.Time{wall.Add(-12 * time.Hour), wall.Add(12 * time.Hour)} {
+		_, offset := probe.In(loc).Zone()
+		t := wall.Add(-time.Duration(offset) * time.Second)
+		if sameWall(t.In(loc), wall) && (best.IsZero() || t.Before(best)) {
+			best = t
+		}
+	}
+	if best.IsZero() {
+		return time.Time{}, ErrNonexistent
+	}
+	return best, nil
+}
+
+func sameWall(t, wall time.Time) bool {
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := wall.Date()
+	return y1 == y2 && m1 == m2 && d1 == d2 && t.Hour() == wall.Hour() && t.Minute() == wall.Minute() && t.Second() == wall.Second()
+}
+
+// OpeningHorizonDays is how far past arrival a closed stop's next opening is looked for
+const OpeningHorizonDays = 31
+
+// dateLayout is the layout of holiday dates
+const dateLayout = "2006-01-02"
+
+// weekdays are the opening hours day names, by time.Weekday
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Plan is a request's parsed scheduling input
+type Plan struct {
+	Departure time.Time
+	SpeedKmh  float64
+	zone      *time.Location             // the request's
+	holidays  map[string]map[string]bool // dates by calendar name
+	calendar  string                     // the request's
+	classes   []models.SpeedClass        // by leg length, when the request gives no speed
+	risk      bool                       // the request asks for on-time probabilities
+	cv        float64                    // the spread of leg driving times they assume
+}
+
+// NewPlan parses req's departure time, timezone and holiday calendars. ok is false
+// when the request asks for no schedule. Errors are *FieldError.
+func NewPlan(req models.OptimizationRequest) (p Plan, ok bool, err error) {
+	if req.DepartureTime == "" {
+		return Plan{}, false, nil
+	}
+	if p.zone, err = Zone(req.Timezone); err != nil {
+		return Plan{}, false, &FieldError{"timezone", err}
+	}
+	if p.Departure, err = ParseTime(req.DepartureTime, p.zone, time.Time{}); err != nil {
+		return Plan{}, false, &FieldError{"departure_time", err}
+	}
+	p.SpeedKmh = req.SpeedKmh
+	if p.SpeedKmh == 0 {
+		p.SpeedKmh, p.classes = DefaultSpeedKmh, req.SpeedClasses
+	}
+	p.holidays = make(map[string]map[string]bool, len(req.HolidayCalendars))
+	for _, name := range slices.Sorted(maps.Keys(req.HolidayCalendars)) {
+		dates := make(map[string]bool, len(req.HolidayCalendars[name]))
+		for i, d := range req.HolidayCalendars[name] {
+			if _, err := time.Parse(dateLayout, d); err != nil {
+				return Plan{}, false, &FieldError{fmt.Sprintf("holiday_calendars.%s[%d]", name, i), errors.New("must be a date like 2006-01-02")}
+			}
+			dates[d] = true
+		}
+		p.holidays[name] = dates
+	}
+	if p.calendar = req.HolidayCalendar; p.calendar != "" && p.holidays[p.calendar] == nil {
+		return Plan{}, false, &FieldError{"holiday_calendar", errUnknownCalendar}
+	}
+	p.risk, p.cv = req.LatenessRisk, req.TravelTimeCV
+	return p, true, nil
+}
+
+var errUnknownCalendar = errors.New("unknown holiday calendar")
+
+// LegHours is how long a leg of km great-circle kilometres takes to drive, before weather
+func (p Plan) LegHours(km float64) float64 {
+	return km / legSpeed(p.SpeedKmh, p.classes, km)
+}
+
+// LegHours is Plan.LegHours for req, which needn't have a departure time
+func LegHours(req models.OptimizationRequest, km float64) float64 {
+	if req.SpeedKmh != 0 {
+		return km / req.SpeedKmh
+	}
+	return km / legSpeed(DefaultSpeedKmh, req.SpeedClasses, km)
+}
+
+// legSpeed is the speed of classes a leg of km falls in, speed without classes
+func legSpeed(speed float64, classes []models.SpeedClass, km float64) float64 {
+	for _, c := range classes {
+		if c.UpToKm == 0 || km <= c.UpToKm {
+			return c.SpeedKmh
+		}
+	}
+	if len(classes) > 0 {
+		return classes[len(classes)-1].SpeedKmh
+	}
+	return speed
+}
+
+// StopZone is the timezone loc's times are read and rendered in
+func (p Plan) StopZone(loc models.Location) (*time.Location, error) {
+	if loc.Timezone == "" {
+		return p.zone, nil
+	}
+	return Zone(loc.Timezone)
+}
+
+// Window returns loc's time window as instants. Times of day are on the departure's
+// date in the stop's timezone; a window whose end is a time of day at or before its
+// start ends the next day. Open ends, and a missing window, are zero. Errors are *FieldError.
+func (p Plan) Window(loc models.Location) (start, end time.Time, err error) {
+	zone, err := p.StopZone(loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, &FieldError{"timezone", err}
+	}
+	w := loc.TimeWindow
+	if w == nil {
+		return time.Time{}, time.Time{}, nil
+	}
+	if w.Start != "" {
+		if start, err = ParseTime(w.Start, zone, p.Departure); err != nil {
+			return time.Time{}, time.Time{}, &FieldError{"time_window.start", err}
+		}
+	}
+	if w.End != "" {
+		if end, err = ParseTime(w.End, zone, p.Departure); err != nil {
+			return time.Time{}, time.Time{}, &FieldError{"time_window.end", err}
+		}
+		if isTimeOfDay(w.End) && !start.IsZero() && !end.After(start) {
+			end, err = ParseTime(w.End, zone, p.Departure.In(zone).AddDate(0, 0, 1))
+			if err != nil {
+				return time.Time{}, time.Time{}, &FieldError{"time_window.end", err}
+			}
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return time.Time{}, time.Time{}, &FieldError{"time_window.end", errors.New("must be after time_window.start")}
+	}
+	return start, end, nil
+}
+
+// Hours checks loc's opening hours and holiday calendar. Errors are *FieldError.
+func (p Plan) Hours(loc models.Location) error {
+	if loc.HolidayCalendar != "" && p.holidays[loc.HolidayCalendar] == nil {
+		return &FieldError{"holiday_calendar", errUnknownCalendar}
+	}
+	for i, h := range loc.OpeningHours {
+		field := fmt.Sprintf("opening_hours[%d]", i)
+		for j, d := range h.Days {
+			if !slices.Contains(weekdays, d) {
+				return &FieldError{fmt.Sprintf("%s.days[%d]", field, j), errors.New("must be one of mon, tue, wed, thu, fri, sat or sun")}
+			}
+		}
+		if _, err := parseClock(h.Open); err != nil {
+			return &FieldError{field + ".open", err}
+		}
+		if _, err := parseClock(h.Close); err != nil {
+			return &FieldError{field + ".close", err}
+		}
+	}
+	return nil
+}
+
+// Constrained reports whether loc has a time window, opening hours or a holiday
+// calendar, so when it is reached matters
+func (p Plan) Constrained(loc models.Location) bool {
+	return loc.TimeWindow != nil || len(loc.OpeningHours) > 0 || len(p.closedOn(loc)) > 0
+}
+
+// closedOn is the holiday calendar loc follows
+func (p Plan) closedOn(loc models.Location) map[string]bool {
+	if loc.HolidayCalendar != "" {
+		return p.holidays[loc.HolidayCalendar]
+	}
+	return p.holidays[p.calendar]
+}
+
+// OpenAt returns the first instant from t on at which loc is open: t itself for
+// stops without opening hours or holidays. ok is false when it doesn't open within
+// OpeningHorizonDays. loc passed Hours.
+func (p Plan) OpenAt(loc models.Location, t time.Time) (open time.Time, ok bool) {
+	closed := p.closedOn(loc)
+	if len(loc.OpeningHours) == 0 && len(closed) == 0 {
+		return t, true
+	}
+	zone, _ := p.StopZone(loc)
+	hours := loc.OpeningHours
+	if len(hours) == 0 {
+		hours = []models.OpeningHours{{Open: "00:00", Close: "00:00"}}
+	}
+	y, m, d := t.In(zone).Date()
+	// A period is the day's it opens on, so yesterday's may still be open at t
+	for day := -1; day <= OpeningHorizonDays; day++ {
+		date := time.Date(y, m, d+day, 0, 0, 0, 0, time.UTC) // a wall date
+		if !closed[date.Format(dateLayout)] {
+			for _, h := range hours {
+				if len(h.Days) > 0 && !slices.Contains(h.Days, weekdays[date.Weekday()]) {
+					continue
+				}
+				from, to, err := period(h, date, zone)
+				if err != nil || !t.Before(to) {
+					continue
+				}
+				if from.Before(t) {
+					from = t
+				}
+				if !ok || from.Before(open) {
+					open, ok = from, true
+				}
+			}
+		}
+		// Later days' periods open after this one ends
+		if next, err := resolve(date.AddDate(0, 0, 1), zone); ok && (err != nil || !open.After(next)) {
+			return open, true
+		}
+	}
+	return open, ok
+}
+
+// period is when h is open starting on the wall date date in zone
+func period(h models.OpeningHours, date time.Time, zone *time.Location) (from, to time.Time, err error) {
+	open, err := parseClock(h.Open)
+	if err != nil {
+		return
+	}
+	shut, err := parseClock(h.Close)
+	if err != nil {
+		return
+	}
+	end := date.Add(shut)
+	if shut <= open {
+		end = end.AddDate(0, 0, 1)
+	}
+	if from, err = resolve(date.Add(open), zone); err != nil {
+		return
+	}
+	to, err = resolve(end, zone)
+	return
+}
+
+// parseClock reads a time of day such as 09:30 as the time since midnight
+func parseClock(s string) (time.Duration, error) {
+	for _, layout := range timeOfDayLayouts {
+		if clock, err := time.Parse(layout, s); err == nil {
+			return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute + time.Duration(clock.Second())*time.Second, nil
+		}
+	}
+	return 0, errors.New("must be a time of day like 15:04")
+}
+
+func isTimeOfDay(s string) bool {
+	return !strings.Contains(s, "T")
+}
+
+// Route times route, driving each leg's great-circle distance at the plan's speeds,
+// slowed by the leg's weather when legs is set (legs[i] is the leg into route[i]).
+// Stops reached before their window opens, or while they are closed, wait; ones
+// served after their window closes are late, and ones that don't open again within
+// OpeningHorizonDays are marked closed. Locations passed request validation, so their
+// timezones, windows and opening hours parse.
+//
+// When the request asks for lateness risk, stops with a window also get the
+// probability they are served in it, with each leg's driving time normally distributed
+// around its scheduled time with a standard deviation of the plan's cv times that, and
+// legs independent. Waits for a window or opening take up delay from the legs before;
+// delay that makes a stop miss its opening is not modelled further.
+func (p Plan) Route(route []models.Location, legs []weather.Leg) []models.StopETA {
+	etas := make([]models.StopETA, len(route))
+	t := p.Departure
+	var behind delay
+	for i, loc := range route {
+		var eta models.StopETA
+		if i > 0 {
+			hours := p.LegHours(geo.HaversineKm(route[i-1], loc))
+			if i < len(legs) && legs[i].Factor > 1 {
+				eta.Weather = legs[i].Severity
+				eta.WeatherDelayMinutes = minutes(time.Duration(hours * (legs[i].Factor - 1) * float64(time.Hour)))
+				hours *= legs[i].Factor
+			}
+			t = t.Add(time.Duration(hours * float64(time.Hour)))
+			behind = behind.drive(hours*60, p.cv)
+		}
+		zone, _ := p.StopZone(loc)
+		eta.ID, eta.Timezone, eta.Arrival = loc.ID, zone.String(), t.In(zone).Format(time.RFC3339)
+		leave := t
+		start, end, _ := p.Window(loc)
+		if !start.IsZero() && leave.Before(start) {
+			leave = start
+		}
+		if open, ok := p.OpenAt(loc, leave); !ok {
+			eta.Closed = true
+		} else {
+			leave = open
+		}
+		eta.WaitMinutes = minutes(leave.Sub(t))
+		if !end.IsZero() && leave.After(end) {
+			eta.LateMinutes = minutes(leave.Sub(end))
+		}
+		if p.risk {
+			wait := leave.Sub(t).Minutes()
+			if !end.IsZero() {
+				var onTime float64 // a stop closed, or waited for past its window, can't be on time
+				if !eta.Closed && (wait == 0 || !leave.After(end)) {
+					onTime = math.Round(behind.within(end.Sub(t).Minutes())*1000) / 1000
+				}
+				eta.OnTimeProbability = &onTime
+			}
+			switch {
+			case wait > 0:
+				behind = delay{behind.mean - wait, behind.variance}.atLeast(0)
+			case !start.IsZero():
+				behind = behind.atLeast(start.Sub(t).Minutes())
+			}
+		}
+		leave = leave.Add(time.Duration(loc.ServiceMinutes * float64(time.Minute)))
+		eta.Departure = leave.In(zone).Format(time.RFC3339)
+		etas[i] = eta
+		t = leave
+	}
+	return etas
+}
+
+func minutes(d time.Duration) float64 {
+	return math.Round(d.Minutes()*10) / 10
+}
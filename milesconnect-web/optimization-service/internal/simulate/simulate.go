@@ -0,0 +1,207 @@
+// Package simulate replays historical days of orders and fleets through solver
+// configurations, allocating each day's shipments to its vehicles and routing every
+// vehicle used, and totals what each configuration made of them, so a solver or
+// configuration change can be measured before it is rolled out.
+package simulate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/validation"
+)
+
+// Solvers solve a simulation's allocations and routes: the service's pipelines, with
+// their defaults and cache, or the solvers called directly. Requests are as LoadRequest
+// and RouteRequest build them; errors end the simulation.
+type Solvers struct {
+	Load  func(ctx context.Context, req models.LoadRequest) (models.LoadResponse, error)
+	Route func(ctx context.Context, req models.OptimizationRequest) (models.OptimizationResponse, error)
+}
+
+// Run replays every day of req under each of its configurations in turn. The first
+// error stops it, named with the day, configuration and vehicle it came from; a
+// validation.Errors stays one, its fields prefixed days[i].configs[j]. and, for routes,
+// vehicles[k]. by the day's vehicle. When ctx ends between solves it stops with ctx's
+// error.
+func Run(ctx context.Context, req models.SimulationRequest, s Solvers) (models.SimulationResponse, error) {
+	resp := models.SimulationResponse{Results: make([]models.SimulationResult, 0, len(req.Configs))}
+	for j, c := range req.Configs {
+		result := models.SimulationResult{Config: c.Name, Days: make([]models.SimulationDayKPIs, 0, len(req.Days))}
+		for i, d := range req.Days {
+			kpis, err := day(ctx, d, c, req.NoCache, s)
+			var invalid validation.Errors
+			switch {
+			case errors.As(err, &invalid):
+				return resp, prefixed(fmt.Sprintf("days[%d].configs[%d].", i, j), invalid)
+			case err != nil:
+				return resp, fmt.Errorf("day %s, config %s: %w", d.Date, c.Name, err)
+			}
+			result.Total = sum(result.Total, kpis)
+			result.Days = append(result.Days, models.SimulationDayKPIs{Date: d.Date, SimulationKPIs: finish(kpis)})
+		}
+		result.Total = finish(result.Total)
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+// day allocates and routes d under c
+func day(ctx context.Context, d models.SimulationDay, c models.SimulationConfig, noCache bool, s Solvers) (models.SimulationKPIs, error) {
+	if err := ctx.Err(); err != nil {
+		return models.SimulationKPIs{}, err
+	}
+	load := LoadRequest(d, c)
+	load.NoCache = noCache
+	alloc, err := s.Load(ctx, load)
+	if err != nil {
+		return models.SimulationKPIs{}, err
+	}
+	kpis := models.SimulationKPIs{
+		Shipments:     len(d.Shipments),
+		Unassigned:    len(alloc.Unassigned),
+		ComputeTimeMs: alloc.Metadata.ComputeTimeMs,
+	}
+
+	vehicles := make(map[string]int, len(d.Vehicles))
+	for i, v := range d.Vehicles {
+		vehicles[v.ID] = i
+	}
+	shipments := make(map[string]models.ShipmentInfo, len(d.Shipments))
+	for _, sh := range d.Shipments {
+		shipments[sh.ID] = sh
+	}
+	for _, a := range alloc.Allocations {
+		if len(a.ShipmentIDs) == 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return models.SimulationKPIs{}, err
+		}
+		carried := make([]models.ShipmentInfo, len(a.ShipmentIDs))
+		for i, id := range a.ShipmentIDs {
+			carried[i] = shipments[id]
+		}
+		k := vehicles[a.VehicleID]
+		req := RouteRequest(d, c, d.Vehicles[k], carried)
+		req.NoCache = noCache
+		route, err := s.Route(ctx, req)
+		var invalid validation.Errors
+		switch {
+		case errors.As(err, &invalid):
+			return models.SimulationKPIs{}, prefixed(fmt.Sprintf("vehicles[%d].", k), invalid)
+		case err != nil:
+			return models.SimulationKPIs{}, fmt.Errorf("vehicle %s: %w", a.VehicleID, err)
+		}
+		kpis.VehiclesUsed++
+		kpis.TotalDistKm += route.TotalDistKm
+		kpis.TotalDurationMin += route.TotalDurationMin
+		kpis.Unassigned += len(route.Unassigned)
+		kpis.ComputeTimeMs += route.Metadata.ComputeTimeMs
+		onTime(&kpis, req, route)
+	}
+	return kpis, nil
+}
+
+// onTime counts the deliveries of route, solved for req, that have a time window, and
+// the ones reached within it
+func onTime(kpis *models.SimulationKPIs, req models.OptimizationRequest, route models.OptimizationResponse) {
+	for i, eta := range route.Schedule {
+		loc := route.Route[i]
+		if i == 0 || i == len(route.Route)-1 || loc.TimeWindow == nil || loc.TimeWindow.End == "" {
+			continue
+		}
+		if loc.ID == req.Start.ID && loc.Lat == req.Start.Lat && loc.Lng == req.Start.Lng {
+			continue // a reload
+		}
+		kpis.WindowStops++
+		kpis.LateMinutes += eta.LateMinutes
+		if eta.LateMinutes == 0 && !eta.Closed {
+			kpis.OnTimeStops++
+		}
+	}
+}
+
+// LoadRequest is the /optimize-load request allocating d's shipments to its vehicles
+// under c
+func LoadRequest(d models.SimulationDay, c models.SimulationConfig) models.LoadRequest {
+	req := models.LoadRequest{
+		Vehicles:           d.Vehicles,
+		Shipments:          d.Shipments,
+		Objective:          c.Objective,
+		GroupByDestination: c.GroupByDestination,
+		GroupRadiusKm:      c.GroupRadiusKm,
+	}
+	if p := c.SolverParams; p != nil && p.TimeBudgetMs > 0 {
+		req.SolverParams = &models.SolverParams{TimeBudgetMs: p.TimeBudgetMs}
+	}
+	return req
+}
+
+// RouteRequest is the /optimize request for v's round trip from its depot, or d's, to
+// the destinations of shipments under c. Each waypoint takes its shipment's ID, weight
+// and, when the destination has none, tier.
+func RouteRequest(d models.SimulationDay, c models.SimulationConfig, v models.VehicleInfo, shipments []models.ShipmentInfo) models.OptimizationRequest {
+	depot := d.Depot
+	if v.Depot != nil {
+		depot = *v.Depot
+	}
+	req := models.OptimizationRequest{
+		Start:         depot,
+		End:           depot,
+		Waypoints:     make([]models.Location, len(shipments)),
+		DepartureTime: d.DepartureTime,
+		Timezone:      d.Timezone,
+		SpeedKmh:      c.SpeedKmh,
+		Solver:        c.Solver,
+		SolverParams:  c.SolverParams,
+		MaxRangeKm:    v.MaxRangeKm,
+	}
+	for i, s := range shipments {
+		wp := *s.Destination
+		wp.ID, wp.DemandKg = s.ID, s.WeightKg
+		if wp.Tier == "" {
+			wp.Tier = s.Tier
+		}
+		req.Waypoints[i] = wp
+	}
+	return req
+}
+
+// prefixed is errs with prefix before each field
+func prefixed(prefix string, errs validation.Errors) validation.Errors {
+	out := make(validation.Errors, len(errs))
+	for i, fe := range errs {
+		out[i] = validation.FieldError{Field: prefix + fe.Field, Message: fe.Message}
+	}
+	return out
+}
+
+// sum adds up the counts of a and b
+func sum(a, b models.SimulationKPIs) models.SimulationKPIs {
+	a.TotalDistKm += b.TotalDistKm
+	a.TotalDurationMin += b.TotalDurationMin
+	a.VehiclesUsed += b.VehiclesUsed
+	a.Shipments += b.Shipments
+	a.Unassigned += b.Unassigned
+	a.WindowStops += b.WindowStops
+	a.OnTimeStops += b.OnTimeStops
+	a.LateMinutes += b.LateMinutes
+	a.ComputeTimeMs += b.ComputeTimeMs
+	return a
+}
+
+// finish rounds k's figures and works out its on-time rate
+func finish(k models.SimulationKPIs) models.SimulationKPIs {
+	k.TotalDistKm = math.Round(k.TotalDistKm*100) / 100
+	k.TotalDurationMin = math.Round(k.TotalDurationMin*10) / 10
+	k.LateMinutes = math.Round(k.LateMinutes*10) / 10
+	k.ComputeTimeMs = math.Round(k.ComputeTimeMs*10) / 10
+	if k.WindowStops > 0 {
+		rate := math.Round(float64(k.OnTimeStops)/float64(k.WindowStops)*1000) / 10
+		k.OnTimeRatePct = &rate
+	}
+	return k
+}
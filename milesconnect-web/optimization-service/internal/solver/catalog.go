@@ -0,0 +1,96 @@
+package solver
+
+import "milesconnect-optimization/internal/catalog"
+
+func init() {
+	h := DefaultHierarchicalParams()
+	// Set in solver_params, up to the server's limits
+	moves := []catalog.Param{
+		{Name: "max_iterations", Type: "integer", Description: "Improving moves before the search stops; 0 is the server's limit.",
+			Default: 0, Min: catalog.Bound(0), Scope: "request"},
+		{Name: "neighborhood", Type: "integer", Description: "Most positions ahead a move may reach; 0 is the server's limit.",
+			Default: 0, Min: catalog.Bound(0), Scope: "request"},
+		{Name: "uturn_penalty_km", Type: "number", Description: "Extra km a move is charged for each U-turn (a heading change of 150° or more between legs); 0 is off.",
+			Default: 0.0, Min: catalog.Bound(0), Scope: "request"},
+	}
+	catalog.Register(catalog.Descriptor{
+		Name:        NearestNeighborName,
+		Version:     NearestNeighborVersion,
+		Problem:     "tsp",
+		Endpoint:    "/optimize",
+		Description: "Greedy nearest-neighbor route construction between a fixed start and end.",
+		Capabilities: catalog.Capabilities{
+			FixedEndpoints: true,
+			Duplicates:     true,
+			TimeBudget:     true,
+		},
+	})
+	catalog.Register(catalog.Descriptor{
+		Name:        TwoOptName,
+		Version:     TwoOptVersion,
+		Problem:     "tsp",
+		Endpoint:    "/optimize",
+		Description: "Nearest-neighbor construction improved by 2-opt moves; used on /optimize when the two_opt feature is on.",
+		Capabilities: catalog.Capabilities{
+			FixedEndpoints: true,
+			Duplicates:     true,
+			TimeBudget:     true,
+		},
+		Params: moves,
+	})
+	catalog.Register(catalog.Descriptor{
+		Name:        HierarchicalName,
+		Version:     HierarchicalVersion,
+		Problem:     "tsp",
+		Endpoint:    "/optimize",
+		Description: "2-opt for very large /optimize requests without a routing provider: stops are clustered, the clusters ordered, each cluster routed with 2-opt and the pieces joined.",
+		Capabilities: catalog.Capabilities{
+			FixedEndpoints: true,
+			Duplicates:     true,
+			TimeBudget:     true,
+		},
+		Params: append([]catalog.Param{
+			{Name: "hierarchical_threshold", Type: "integer", Description: "Waypoints above which requests are solved hierarchically; 0 disables it.",
+				Default: h.Threshold, Min: catalog.Bound(0), Scope: "server"},
+			{Name: "cluster_size", Type: "integer", Description: "Most waypoints per cluster.",
+				Default: h.ClusterSize, Min: catalog.Bound(1), Scope: "server"},
+		}, moves...),
+	})
+	catalog.Register(catalog.Descriptor{
+		Name:        FleetAllocationName,
+		Version:     FleetAllocationVersion,
+		Problem:     "fleet-allocation",
+		Endpoint:    "/optimize-load",
+		Description: "Best-fit decreasing assignment of shipments to vehicles by weight.",
+		Capabilities: catalog.Capabilities{
+			Capacities: true,
+			TimeBudget: true,
+		},
+	})
+	catalog.Register(catalog.Descriptor{
+		Name:        CrossDockName,
+		Version:     CrossDockVersion,
+		Problem:     "cross-dock",
+		Endpoint:    "/optimize-crossdock",
+		Description: "Assignment of inbound shipments to outbound trailers of their destination, fewest handling moves first, within trailer capacities and departure cutoffs.",
+		Capabilities: catalog.Capabilities{
+			Capacities:  true,
+			TimeWindows: true,
+			TimeBudget:  true,
+		},
+	})
+	catalog.Register(catalog.Descriptor{
+		Name:        DayPlanName,
+		Version:     DayPlanVersion,
+		Problem:     "delivery-days",
+		Endpoint:    "/plan-days",
+		Description: "Assignment of recurring customers to delivery weekdays, zone by zone: a workload-balanced sweep by bearing, improved by moving zones between days for compact, even days.",
+		Capabilities: catalog.Capabilities{
+			TimeBudget: true,
+		},
+		Params: []catalog.Param{
+			{Name: "balance_weight", Type: "number", Description: "Cost of a unit of workload off a day's even share, against a unit of workload a typical distance from its day's centre.",
+				Default: 1.0, Min: catalog.Bound(0), Scope: "request"},
+		},
+	})
+}
@@ -0,0 +1,70 @@
+package solver
+
+import (
+	"context"
+	"time"
+)
+
+// Checkpoint is the state of an interrupted iterative solve, enough to resume it
+type Checkpoint struct {
+	Solver     string `json:"solver"`
+	Tour       []int  `json:"tour"` // point indices, as from nearestNeighborTour
+	Iterations int    `json:"iterations"`
+}
+
+// Checkpoints lets a long solve save its progress every Interval and pick up from
+// Resume instead of starting over. Save runs on the solving goroutine, so it should
+// be quick.
+type Checkpoints struct {
+	Interval time.Duration
+	Resume   *Checkpoint
+	Save     func(Checkpoint)
+
+	last time.Time
+}
+
+type checkpointsKey struct{}
+
+// WithCheckpoints returns ctx with cp attached for the iterative solvers run under it
+func WithCheckpoints(ctx context.Context, cp *Checkpoints) context.Context {
+	return context.WithValue(ctx, checkpointsKey{}, cp)
+}
+
+// checkpointsFrom returns the checkpoints attached to ctx, or nil
+func checkpointsFrom(ctx context.Context) *Checkpoints {
+	cp, _ := ctx.Value(checkpointsKey{}).(*Checkpoints)
+	return cp
+}
+
+// resume returns the saved tour of solver when it is a permutation of count waypoints
+func (cp *Checkpoints) resume(solver string, count int) (Checkpoint, bool) {
+	if cp == nil || cp.Resume == nil || cp.Resume.Solver != solver || len(cp.Resume.Tour) != count {
+		return Checkpoint{}, false
+	}
+	seen := make([]bool, count)
+	for _, p := range cp.Resume.Tour {
+		if p < 1 || p > count || seen[p-1] {
+			return Checkpoint{}, false
+		}
+		seen[p-1] = true
+	}
+	return *cp.Resume, true
+}
+
+// save hands a copy of tour to Save once Interval has passed since the solve started
+// or last saved
+func (cp *Checkpoints) save(solver string, tour []int, iterations int) {
+	if cp == nil || cp.Save == nil || cp.Interval <= 0 {
+		return
+	}
+	now := time.Now()
+	if cp.last.IsZero() {
+		cp.last = now
+		return
+	}
+	if now.Sub(cp.last) < cp.Interval {
+		return
+	}
+	cp.last = now
+	cp.Save(Checkpoint{Solver: solver, Tour: append([]int(nil), tour...), Iterations: iterations})
+}
@@ -0,0 +1,159 @@
+package solver
+
+import (
+	"context"
+	"math"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/parallel"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Solver identification reported in response metadata
+const (
+	HierarchicalName    = "tsp-hierarchical"
+	HierarchicalVersion = "1.0.0"
+)
+
+// HierarchicalParams select which /optimize requests are solved hierarchically: those
+// with more than Threshold waypoints (0 disables it), in clusters of at most ClusterSize
+type HierarchicalParams struct {
+	Threshold   int
+	ClusterSize int
+}
+
+// DefaultHierarchicalParams are the hierarchical settings used unless configured otherwise
+func DefaultHierarchicalParams() HierarchicalParams {
+	return HierarchicalParams{Threshold: 2000, ClusterSize: 500}
+}
+
+// Applies reports whether a request with the given waypoint count is solved hierarchically
+func (p HierarchicalParams) Applies(waypoints int) bool {
+	return p.Threshold > 0 && waypoints > p.Threshold
+}
+
+// RouteSolveFunc is the signature shared by the /optimize solvers
+type RouteSolveFunc func(ctx context.Context, req models.OptimizationRequest, matrix geo.Matrix) models.OptimizationResponse
+
+// SolveTSPHierarchical routes very large requests in pieces: the waypoints are split
+// into compact clusters of at most clusterSize by recursive median bisection, solve
+// orders the clusters by their centroids, then routes each cluster on its own from
+// the previous cluster's centroid towards the next one's, and the cluster routes are
+// joined. The cluster solves run in parallel. Distances are great-circle.
+func SolveTSPHierarchical(ctx context.Context, req models.OptimizationRequest, solve RouteSolveFunc, clusterSize int) models.OptimizationResponse {
+	started := time.Now()
+	// The pieces are unrelated to the request's tour, so they neither save nor resume
+	// its checkpoints
+	ctx = WithCheckpoints(ctx, nil)
+
+	all := make([]int, len(req.Waypoints))
+	for j := range all {
+		all[j] = j
+	}
+	clusters := bisect(req.Waypoints, all, max(clusterSize, 1))
+	centroids := make([]models.Location, len(clusters))
+	for c, members := range clusters {
+		centroids[c] = centroid(req.Waypoints, members)
+	}
+
+	top := solve(ctx, piece(req.Start, req.End, centroids, nil, req.SolverParams), nil)
+	order := routeOrder(top.Route)
+	iterations, exhausted := top.Metadata.Iterations, top.Metadata.BudgetExhausted
+
+	tours := make([][]int, len(order))
+	metas := make([]models.SolverMetadata, len(order))
+	parallel.Do(parallel.Split(len(order), 1), func(_ int, r parallel.Range) {
+		for p := r.Lo; p < r.Hi; p++ {
+			from, to := req.Start, req.End
+			if p > 0 {
+				from = centroids[order[p-1]]
+			}
+			if p < len(order)-1 {
+				to = centroids[order[p+1]]
+			}
+			members := clusters[order[p]]
+			resp := solve(ctx, piece(from, to, req.Waypoints, members, req.SolverParams), nil)
+			tours[p], metas[p] = make([]int, 0, len(members)), resp.Metadata
+			for _, local := range routeOrder(resp.Route) {
+				tours[p] = append(tours[p], members[local]+1)
+			}
+		}
+	})
+
+	tour := make([]int, 0, len(req.Waypoints))
+	for p := range tours {
+		tour = append(tour, tours[p]...)
+		iterations += metas[p].Iterations
+		exhausted = exhausted || metas[p].BudgetExhausted
+	}
+	return tourResponse(req, tour, distances(req, nil), models.SolverMetadata{
+		Solver:          HierarchicalName,
+		Version:         HierarchicalVersion,
+		Iterations:      iterations,
+		ComputeTimeMs:   elapsedMs(started),
+		BudgetExhausted: exhausted,
+		Clusters:        len(clusters),
+	})
+}
+
+// bisect splits members, indices into waypoints, in half across their wider extent
+// until every part has at most size waypoints
+func bisect(waypoints []models.Location, members []int, size int) [][]int {
+	if len(members) <= size {
+		return [][]int{members}
+	}
+	minLat, maxLat, minLng, maxLng := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, j := range members {
+		minLat, maxLat = min(minLat, waypoints[j].Lat), max(maxLat, waypoints[j].Lat)
+		minLng, maxLng = min(minLng, waypoints[j].Lng), max(maxLng, waypoints[j].Lng)
+	}
+	// A degree of longitude shrinks towards the poles
+	cosLat := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	key := func(j int) float64 { return waypoints[j].Lat }
+	if (maxLng-minLng)*cosLat > maxLat-minLat {
+		key = func(j int) float64 { return waypoints[j].Lng }
+	}
+	sort.SliceStable(members, func(a, b int) bool { return key(members[a]) < key(members[b]) })
+	half := len(members) / 2
+	return append(bisect(waypoints, members[:half], size), bisect(waypoints, members[half:], size)...)
+}
+
+func centroid(waypoints []models.Location, members []int) models.Location {
+	var c models.Location
+	for _, j := range members {
+		c.Lat += waypoints[j].Lat
+		c.Lng += waypoints[j].Lng
+	}
+	c.Lat /= float64(len(members))
+	c.Lng /= float64(len(members))
+	return c
+}
+
+// piece is the request routing members of points (all of them when nil) from start to
+// end with the solver parameters params. Each waypoint's ID is its position in the
+// piece, read back by routeOrder.
+func piece(start, end models.Location, points []models.Location, members []int, params *models.SolverParams) models.OptimizationRequest {
+	if members == nil {
+		members = make([]int, len(points))
+		for j := range members {
+			members[j] = j
+		}
+	}
+	waypoints := make([]models.Location, len(members))
+	for local, j := range members {
+		waypoints[local] = models.Location{ID: strconv.Itoa(local), Lat: points[j].Lat, Lng: points[j].Lng}
+	}
+	return models.OptimizationRequest{Start: start, End: end, Waypoints: waypoints, SolverParams: params}
+}
+
+// routeOrder lists the piece positions of a piece's route, without its start and end
+func routeOrder(route []models.Location) []int {
+	order := make([]int, 0, max(len(route)-2, 0))
+	for _, loc := range route[1 : len(route)-1] {
+		local, _ := strconv.Atoi(loc.ID)
+		order = append(order, local)
+	}
+	return order
+}
@@ -0,0 +1,245 @@
+package solver
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/schedule"
+	"slices"
+	"time"
+)
+
+// Solver identification reported in response metadata
+const (
+	CrossDockName    = "crossdock-min-moves"
+	CrossDockVersion = "1.0.0"
+)
+
+// Reasons a cross-dock shipment is left unassigned, in UnassignedShipment.Reason
+const (
+	CrossDockNoTrailer    = "no_trailer"
+	CrossDockMissedCutoff = "missed_cutoff"
+	CrossDockNoCapacity   = "no_capacity"
+	CrossDockTimeBudget   = "time_budget"
+)
+
+// crossDockTrailer is an outbound trailer's times and the capacity it has left
+type crossDockTrailer struct {
+	info       models.OutboundTrailer
+	dock, cuts time.Time // dock is zero when the trailer is already at its door
+	freeKg     float64
+}
+
+// crossDockMove is what putting a shipment on a trailer costs: handling moves first,
+// then doors crossed
+type crossDockMove struct {
+	moves, doors int
+}
+
+func (m crossDockMove) compare(o crossDockMove) int {
+	return cmp.Or(cmp.Compare(m.moves, o.moves), cmp.Compare(m.doors, o.doors))
+}
+
+// OptimizeCrossDock assigns inbound shipments to outbound trailers of their
+// destination, minimising handling moves and then doors crossed. A trailer takes a
+// shipment when it has room and the shipment can be aboard, handling time included, by
+// its departure. Shipments with the fewest trailers to choose from are placed first,
+// heaviest first among equals, each on its cheapest trailer with room, tightest fit
+// breaking ties. Shipments are then moved to cheaper trailers, and ones left over for
+// lack of room placed by moving a shipment out of their way, until nothing improves or
+// ctx is done. The reported objective value is the handling moves.
+func OptimizeCrossDock(ctx context.Context, req models.CrossDockRequest) models.CrossDockResponse {
+	started := time.Now()
+	exhausted := false
+	zone, _ := schedule.Zone(req.Timezone)
+	at := func(s string) time.Time {
+		if s == "" {
+			return time.Time{}
+		}
+		t, _ := schedule.ParseTime(s, zone, time.Time{})
+		return t
+	}
+	handling := time.Duration(req.HandlingMinutes * float64(time.Minute))
+
+	trailers := make([]*crossDockTrailer, len(req.Trailers))
+	for i, t := range req.Trailers {
+		trailers[i] = &crossDockTrailer{info: t, dock: at(t.DockTime), cuts: at(t.Departure), freeKg: t.CapacityKg - t.CurrentLoad}
+	}
+
+	// Each shipment's trailers, and why it has none
+	candidates := make([][]int, len(req.Inbound))
+	reasons := make([]string, len(req.Inbound))
+	for i, s := range req.Inbound {
+		ready := at(s.ReadyTime)
+		reasons[i] = CrossDockNoTrailer
+		for j, t := range trailers {
+			if t.info.Destination != s.Destination {
+				continue
+			}
+			reasons[i] = CrossDockMissedCutoff
+			loading := ready
+			if t.dock.After(loading) {
+				loading = t.dock
+			}
+			if loading.IsZero() || !loading.Add(handling).After(t.cuts) {
+				candidates[i] = append(candidates[i], j)
+			}
+		}
+		if len(candidates[i]) > 0 {
+			reasons[i] = CrossDockNoCapacity
+		}
+	}
+	cost := func(i, j int) crossDockMove {
+		s, t := req.Inbound[i], trailers[j]
+		m := crossDockMove{moves: 1, doors: abs(s.Door - t.info.Door)}
+		if ready := at(s.ReadyTime); !t.dock.IsZero() && ready.Before(t.dock) {
+			m.moves = 2 // on the floor until the trailer docks
+		}
+		return m
+	}
+
+	order := make([]int, len(req.Inbound))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Or(cmp.Compare(len(candidates[a]), len(candidates[b])), cmp.Compare(req.Inbound[b].WeightKg, req.Inbound[a].WeightKg))
+	})
+
+	on := make([]int, len(req.Inbound)) // trailer index; -1 when unassigned
+	for i := range on {
+		on[i] = -1
+	}
+	put := func(i, j int) {
+		if on[i] >= 0 {
+			trailers[on[i]].freeKg += req.Inbound[i].WeightKg
+		}
+		on[i] = j
+		trailers[j].freeKg -= req.Inbound[i].WeightKg
+	}
+	// room is the free capacity trailer j would have left with i aboard
+	room := func(i, j int) float64 {
+		if on[i] == j {
+			return trailers[j].freeKg
+		}
+		return trailers[j].freeKg - req.Inbound[i].WeightKg
+	}
+	// cheapest is the trailer with room that i costs least on, or -1
+	cheapest := func(i int) int {
+		best := -1
+		for _, j := range candidates[i] {
+			if room(i, j) < 0 {
+				continue
+			}
+			if best == -1 {
+				best = j
+			} else if c := cost(i, j).compare(cost(i, best)); c < 0 || c == 0 && room(i, j) < room(i, best) {
+				best = j
+			}
+		}
+		return best
+	}
+
+	iterations := 0
+	for _, i := range order {
+		if ctx.Err() != nil {
+			exhausted = true
+			reasons[i] = CrossDockTimeBudget
+			continue
+		}
+		iterations++
+		if j := cheapest(i); j >= 0 {
+			put(i, j)
+		}
+	}
+
+	for improved := true; improved && !exhausted; {
+		improved = false
+		for _, i := range order {
+			if ctx.Err() != nil {
+				exhausted = true
+				break
+			}
+			iterations++
+			if on[i] >= 0 {
+				if j := cheapest(i); j != on[i] && cost(i, j).compare(cost(i, on[i])) < 0 {
+					put(i, j)
+					improved = true
+				}
+			} else if reasons[i] == CrossDockNoCapacity && makeRoom(req, trailers, candidates, on, i, put) {
+				improved = true
+			}
+		}
+	}
+
+	resp := models.CrossDockResponse{Trailers: []models.TrailerLoad{}, Transfers: []models.CrossDockTransfer{}, Unassigned: []models.UnassignedShipment{}}
+	loads := make([]models.TrailerLoad, len(trailers))
+	for i, s := range req.Inbound {
+		j := on[i]
+		if j < 0 {
+			resp.Unassigned = append(resp.Unassigned, models.UnassignedShipment{ShipmentID: s.ID, Reason: reasons[i]})
+			continue
+		}
+		m := cost(i, j)
+		resp.Transfers = append(resp.Transfers, models.CrossDockTransfer{
+			ShipmentID:   s.ID,
+			TrailerID:    trailers[j].info.ID,
+			Staged:       m.moves > 1,
+			Moves:        m.moves,
+			DoorDistance: m.doors,
+		})
+		resp.HandlingMoves += m.moves
+		resp.DoorDistance += m.doors
+		loads[j].ShipmentIDs = append(loads[j].ShipmentIDs, s.ID)
+	}
+	for j, t := range trailers {
+		if len(loads[j].ShipmentIDs) == 0 {
+			continue
+		}
+		loaded := t.info.CapacityKg - t.freeKg
+		resp.Trailers = append(resp.Trailers, models.TrailerLoad{
+			TrailerID:      t.info.ID,
+			ShipmentIDs:    loads[j].ShipmentIDs,
+			TotalWeight:    loaded,
+			UtilizationPct: math.Round(loaded/t.info.CapacityKg*100*100) / 100,
+		})
+	}
+	resp.Metadata = models.SolverMetadata{
+		Solver:          CrossDockName,
+		Version:         CrossDockVersion,
+		Iterations:      iterations,
+		ComputeTimeMs:   elapsedMs(started),
+		BudgetExhausted: exhausted,
+		ObjectiveValue:  float64(resp.HandlingMoves),
+	}
+	return resp
+}
+
+// makeRoom places unassigned shipment i by moving one shipment off a trailer i could
+// go on to another of that shipment's trailers with room, reporting whether it did
+func makeRoom(req models.CrossDockRequest, trailers []*crossDockTrailer, candidates [][]int, on []int, i int, put func(i, j int)) bool {
+	need := req.Inbound[i].WeightKg
+	for _, j := range candidates[i] {
+		for k := range req.Inbound {
+			if on[k] != j || trailers[j].freeKg+req.Inbound[k].WeightKg < need {
+				continue
+			}
+			for _, alt := range candidates[k] {
+				if alt != j && trailers[alt].freeKg >= req.Inbound[k].WeightKg {
+					put(k, alt)
+					put(i, j)
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,251 @@
+package solver
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"slices"
+	"time"
+)
+
+// Solver identification reported in response metadata
+const (
+	DayPlanName    = "dayplan-sweep-balance"
+	DayPlanVersion = "1.0.0"
+)
+
+// Weekdays are the delivery day names, in week order
+var Weekdays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// DefaultDeliveryDays are the days planned when the request names none
+var DefaultDeliveryDays = Weekdays[:5]
+
+// dayUnit is a zone, or a customer without one: customers planned as one
+type dayUnit struct {
+	members  []int // request customer indices
+	center   models.Location
+	workload float64
+	days     []int // request day indices it can go on
+}
+
+// PlanDeliveryDays assigns customers to delivery days. Each zone is planned as one
+// unit at its customers' centroid, on the days all of them take deliveries. The units
+// are swept by bearing around the centroid of all customers into pie slices of about
+// equal workload, one per day, then moved between days while that lowers the cost: the
+// workload-weighted distance of each unit from its day's centroid, in units of the
+// mean distance from the overall centroid, plus BalanceWeight times how far each
+// day's workload is from an even share. The reported objective value is that cost,
+// the initial value the sweep's.
+func PlanDeliveryDays(ctx context.Context, req models.DayPlanRequest) models.DayPlanResponse {
+	started := time.Now()
+	days := req.Days
+	if len(days) == 0 {
+		days = DefaultDeliveryDays
+	}
+	balance := req.BalanceWeight
+	if balance == 0 {
+		balance = 1
+	}
+	units := dayUnits(req, days)
+
+	var total float64
+	var all models.Location
+	for _, u := range units {
+		total += u.workload
+		all.Lat += u.center.Lat * u.workload
+		all.Lng += u.center.Lng * u.workload
+	}
+	if total > 0 {
+		all.Lat /= total
+		all.Lng /= total
+	}
+	share := total / float64(len(days))
+	var scale float64
+	for _, u := range units {
+		scale += geo.HaversineKm(u.center, all) * u.workload
+	}
+	if total > 0 {
+		scale /= total
+	}
+	scale = max(scale, 0.1) // all customers in one place: distances don't matter
+
+	// Sweep: each unit's day is the slice its workload midpoint falls in, or the least
+	// loaded of its own days when that isn't one
+	bearing := func(p models.Location) float64 { return math.Atan2(p.Lat-all.Lat, p.Lng-all.Lng) }
+	sweep := make([]int, len(units))
+	for i := range sweep {
+		sweep[i] = i
+	}
+	slices.SortStableFunc(sweep, func(a, b int) int { return cmp.Compare(bearing(units[a].center), bearing(units[b].center)) })
+	on := make([]int, len(units))
+	load := make([]float64, len(days))
+	var swept float64
+	for _, i := range sweep {
+		u := units[i]
+		d := min(int((swept+u.workload/2)/max(share, math.SmallestNonzeroFloat64)), len(days)-1)
+		swept += u.workload
+		if !slices.Contains(u.days, d) {
+			d = slices.MinFunc(u.days, func(a, b int) int { return cmp.Compare(load[a], load[b]) })
+		}
+		on[i] = d
+		load[d] += u.workload
+	}
+
+	// dayCost is day d's spread and imbalance with its units as in on, the distances
+	// from its centre to its units' taken in one batch
+	centres := make(geo.Prepared, len(units))
+	for i, u := range units {
+		centres.Set(i, u.center)
+	}
+	centre := make(geo.Prepared, 1)
+	members := make(geo.Prepared, 0, len(units))
+	weights := make([]float64, 0, len(units))
+	km := make([]float64, len(units))
+	dayCost := func(d int) float64 {
+		var c models.Location
+		var w float64
+		members, weights = members[:0], weights[:0]
+		for i, u := range units {
+			if on[i] == d {
+				c.Lat += u.center.Lat * u.workload
+				c.Lng += u.center.Lng * u.workload
+				w += u.workload
+				members, weights = append(members, centres[i]), append(weights, u.workload)
+			}
+		}
+		if w == 0 {
+			return balance * share
+		}
+		c.Lat /= w
+		c.Lng /= w
+		centre.Set(0, c)
+		centre.KmFrom(0, members, km)
+		var spread float64
+		for k, uw := range weights {
+			spread += km[k] * uw
+		}
+		return spread/scale + balance*math.Abs(w-share)
+	}
+	costs := make([]float64, len(days))
+	var initial float64
+	for d := range days {
+		costs[d] = dayCost(d)
+		initial += costs[d]
+	}
+
+	iterations := 0
+	exhausted := false
+	for improved := true; improved; {
+		improved = false
+		for i, u := range units {
+			if ctx.Err() != nil {
+				exhausted = true
+				break
+			}
+			iterations++
+			from := on[i]
+			for _, to := range u.days {
+				if to == from {
+					continue
+				}
+				on[i] = to
+				cf, ct := dayCost(from), dayCost(to)
+				if cf+ct < costs[from]+costs[to]-1e-9 {
+					costs[from], costs[to] = cf, ct
+					from = to
+					improved = true
+				} else {
+					on[i] = from
+				}
+			}
+		}
+		if exhausted {
+			break
+		}
+	}
+
+	resp := models.DayPlanResponse{Days: make([]models.DeliveryDay, len(days))}
+	var cost float64
+	for d, name := range days {
+		day := models.DeliveryDay{Day: name, CustomerIDs: []string{}, Waypoints: []models.Location{}}
+		for i, u := range units {
+			if on[i] != d {
+				continue
+			}
+			for _, j := range u.members {
+				day.CustomerIDs = append(day.CustomerIDs, req.Customers[j].ID)
+				day.Waypoints = append(day.Waypoints, req.Customers[j].Location)
+			}
+			day.Centroid.Lat += u.center.Lat * u.workload
+			day.Centroid.Lng += u.center.Lng * u.workload
+			if z := req.Customers[u.members[0]].Zone; z != "" {
+				day.Zones = append(day.Zones, z)
+			}
+			day.Workload += u.workload
+		}
+		if day.Workload > 0 {
+			day.Centroid.Lat /= day.Workload
+			day.Centroid.Lng /= day.Workload
+		}
+		for _, p := range day.Waypoints {
+			day.RadiusKm = math.Max(day.RadiusKm, geo.HaversineKm(p, day.Centroid))
+		}
+		day.RadiusKm = math.Round(day.RadiusKm*100) / 100
+		resp.Days[d] = day
+		cost += costs[d]
+	}
+	resp.Metadata = models.SolverMetadata{
+		Solver:          DayPlanName,
+		Version:         DayPlanVersion,
+		Iterations:      iterations,
+		ComputeTimeMs:   elapsedMs(started),
+		BudgetExhausted: exhausted,
+		ObjectiveValue:  cost,
+		InitialValue:    initial,
+	}
+	return resp
+}
+
+// dayUnits groups the request's customers into zones, in order of first appearance,
+// with the days every member takes deliveries on
+func dayUnits(req models.DayPlanRequest, days []string) []dayUnit {
+	var units []dayUnit
+	zones := map[string]int{}
+	for j, c := range req.Customers {
+		i, ok := zones[c.Zone]
+		if !ok || c.Zone == "" {
+			i = len(units)
+			units = append(units, dayUnit{})
+			for d, name := range days {
+				if len(c.Days) == 0 || slices.Contains(c.Days, name) {
+					units[i].days = append(units[i].days, d)
+				}
+			}
+			if c.Zone != "" {
+				zones[c.Zone] = i
+			}
+		} else if len(c.Days) > 0 {
+			units[i].days = slices.DeleteFunc(units[i].days, func(d int) bool { return !slices.Contains(c.Days, days[d]) })
+		}
+		u := &units[i]
+		u.members = append(u.members, j)
+		u.workload += customerWorkload(c)
+		u.center.Lat += c.Lat
+		u.center.Lng += c.Lng
+	}
+	for i := range units {
+		units[i].center.Lat /= float64(len(units[i].members))
+		units[i].center.Lng /= float64(len(units[i].members))
+	}
+	return units
+}
+
+// customerWorkload is c's workload: as given, or 1
+func customerWorkload(c models.DayCustomer) float64 {
+	if c.Workload == 0 {
+		return 1
+	}
+	return c.Workload
+}
@@ -0,0 +1,32 @@
+package genetic
+
+import "milesconnect-optimization/internal/catalog"
+
+func init() {
+	d := DefaultParams()
+	catalog.Register(catalog.Descriptor{
+		Name:        Name,
+		Version:     Version,
+		Problem:     "tsp",
+		Endpoint:    "/optimize-india",
+		Description: "Genetic algorithm over the built-in all-India city tour.",
+		Capabilities: catalog.Capabilities{
+			FixedEndpoints: true,
+			TimeBudget:     true,
+		},
+		Params: []catalog.Param{
+			{Name: "population_size", Type: "integer", Description: "Tours per generation.",
+				Default: d.PopulationSize, Min: catalog.Bound(2), Scope: "server"},
+			{Name: "generations", Type: "integer", Description: "Generations evolved unless the time budget runs out first.",
+				Default: d.Generations, Min: catalog.Bound(0), Scope: "server"},
+			{Name: "mutation_rate", Type: "number", Description: "Probability a child tour is mutated.",
+				Default: d.MutationRate, Min: catalog.Bound(0), Max: catalog.Bound(1), Scope: "server"},
+			{Name: "tournament_size", Type: "integer", Description: "Contestants per tournament selection.",
+				Default: d.TournamentSize, Min: catalog.Bound(1), Scope: "server"},
+			{Name: "seed", Type: "integer", Description: "Random source seed for reproducible runs; 0 seeds every solve from the clock.",
+				Default: d.Seed, Scope: "server"},
+			{Name: "uturn_penalty_km", Type: "number", Description: "Extra km a tour's fitness is charged for each U-turn (a heading change of 150° or more between legs); 0 is off.",
+				Default: 0.0, Min: catalog.Bound(0), Scope: "request"},
+		},
+	})
+}
@@ -1,9 +1,12 @@
 package genetic
 
 import (
-	"math"
+	"context"
 	"math/rand"
+	"milesconnect-optimization/internal/geo"
 	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/stability"
 	"sort"
 	"time"
 )
@@ -11,6 +14,7 @@ import (
 type Tour struct {
 	Path     []int
 	Distance float64
+	Fitness  float64 // Distance plus the request's U-turn penalties; lower is fitter
 }
 
 type Population struct {
@@ -18,16 +22,41 @@ type Population struct {
 }
 
 // Params for the GA
+type Params struct {
+	PopulationSize int
+	Generations    int
+	MutationRate   float64
+	TournamentSize int
+	Seed           int64 // random source seed, for reproducible runs; 0 seeds from the clock
+}
+
+// DefaultParams are the GA settings used unless configured otherwise
+func DefaultParams() Params {
+	return Params{
+		PopulationSize: 100,
+		Generations:    500,
+		MutationRate:   0.05,
+		TournamentSize: 5,
+	}
+}
+
+// Solver identification reported in response metadata
 const (
-	PopulationSize = 100
-	Generations    = 500
-	MutationRate   = 0.05
-	TournamentSize = 5
+	Name    = "tsp-genetic"
+	Version = "1.0.0"
 )
 
-// SolveTSPGenetic runs the genetic algorithm to solve TSP
-func SolveTSPGenetic(req models.OptimizationRequest) models.OptimizationResponse {
-	rand.Seed(time.Now().UnixNano())
+// SolveTSPGenetic runs the genetic algorithm to solve TSP.
+// Evolution stops early when ctx expires and the best tour found so far is returned.
+// The request's initial route, when it has one, is one of the first generation's tours,
+// and its U-turn penalty is charged in the fitness but not the reported distance.
+func SolveTSPGenetic(ctx context.Context, req models.OptimizationRequest, params Params) models.OptimizationResponse {
+	started := time.Now()
+	seed := params.Seed
+	if seed == 0 {
+		seed = started.UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
 
 	// Combine Start, Waypoints, End into a single list of points for the GA to optimize (excluding start/end fixed positions if we want closed loop,
 	// but here we treat it as Open TSP: Start -> [Visit All] -> End)
@@ -39,42 +68,63 @@ func SolveTSPGenetic(req models.OptimizationRequest) models.OptimizationResponse
 	if n == 0 {
 		return models.OptimizationResponse{
 			Route:       []models.Location{req.Start, req.End},
-			TotalDistKm: haversine(req.Start, req.End),
+			TotalDistKm: geo.HaversineKm(req.Start, req.End),
+			Metadata:    metadata(started, 0, false, false, geo.HaversineKm(req.Start, req.End), 0),
 		}
 	}
 
 	// Initialize Population
 	// Each individual is a permutation of indices 0 to n-1 (representing waypoints)
-	pop := initializePopulation(n, PopulationSize)
+	pop := initializePopulation(rng, n, params.PopulationSize)
+
+	// Every generation scores tours over the same pairs, so distances are computed once
+	dist := geo.GreatCircle(geo.RequestPoints(req))
+	defer dist.Release()
+	d := dist.Km
+	turn := solver.UTurnPenalty(req)
+
+	// A warm start survives as the elite until a child beats it
+	warm := len(req.InitialRoute) > 0
+	if warm {
+		order := stability.Order(req, req.InitialRoute, d)
+		for i, p := range order[1 : len(order)-1] {
+			pop.Tours[0].Path[i] = p - 1
+		}
+	}
 
 	// Evaluate initial fitness
-	evaluatePopulation(pop, req.Start, req.End, waypoints)
+	evaluatePopulation(pop, d, turn)
 
 	// Evolution Loop
-	for g := 0; g < Generations; g++ {
-		newTours := make([]Tour, 0, PopulationSize)
+	generations := 0
+	for ; generations < params.Generations; generations++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		newTours := make([]Tour, 0, params.PopulationSize)
 
 		// Elitism: Keep the best one
 		newTours = append(newTours, pop.Tours[0])
 
-		for len(newTours) < PopulationSize {
+		for len(newTours) < params.PopulationSize {
 			// Selection
-			p1 := tournamentSelection(pop)
-			p2 := tournamentSelection(pop)
+			p1 := tournamentSelection(rng, pop, params.TournamentSize)
+			p2 := tournamentSelection(rng, pop, params.TournamentSize)
 
 			// Crossover
-			childPath := orderedCrossover(p1.Path, p2.Path)
+			childPath := orderedCrossover(rng, p1.Path, p2.Path)
 
 			// Mutation
-			if rand.Float64() < MutationRate {
-				mutate(childPath)
+			if rng.Float64() < params.MutationRate {
+				mutate(rng, childPath)
 			}
 
 			newTours = append(newTours, Tour{Path: childPath})
 		}
 
 		pop.Tours = newTours
-		evaluatePopulation(pop, req.Start, req.End, waypoints)
+		evaluatePopulation(pop, d, turn)
 	}
 
 	// Best tour is at index 0 (sorted)
@@ -91,10 +141,24 @@ func SolveTSPGenetic(req models.OptimizationRequest) models.OptimizationResponse
 	return models.OptimizationResponse{
 		Route:       optimizedRoute,
 		TotalDistKm: bestTour.Distance,
+		Metadata:    metadata(started, generations, generations < params.Generations, warm, bestTour.Distance, geo.RouteKm(req.Start, waypoints, req.End)),
 	}
 }
 
-func initializePopulation(n int, size int) *Population {
+func metadata(started time.Time, generations int, exhausted, warm bool, distance, initial float64) models.SolverMetadata {
+	return models.SolverMetadata{
+		Solver:          Name,
+		Version:         Version,
+		Iterations:      generations,
+		ComputeTimeMs:   float64(time.Since(started).Microseconds()) / 1000,
+		BudgetExhausted: exhausted,
+		WarmStart:       warm,
+		ObjectiveValue:  distance,
+		InitialValue:    initial,
+	}
+}
+
+func initializePopulation(rng *rand.Rand, n int, size int) *Population {
 	pop := &Population{Tours: make([]Tour, size)}
 	base := make([]int, n)
 	for i := 0; i < n; i++ {
@@ -104,56 +168,63 @@ func initializePopulation(n int, size int) *Population {
 	for i := 0; i < size; i++ {
 		perm := make([]int, n)
 		copy(perm, base)
-		rand.Shuffle(n, func(i, j int) { perm[i], perm[j] = perm[j], perm[i] })
+		rng.Shuffle(n, func(i, j int) { perm[i], perm[j] = perm[j], perm[i] })
 		pop.Tours[i] = Tour{Path: perm}
 	}
 	return pop
 }
 
-func evaluatePopulation(pop *Population, start, end models.Location, waypoints []models.Location) {
+func evaluatePopulation(pop *Population, d func(i, j int) float64, turn func(a, m, b int) float64) {
 	for i := range pop.Tours {
-		pop.Tours[i].Distance = calculateDistance(pop.Tours[i].Path, start, end, waypoints)
+		t := &pop.Tours[i]
+		t.Distance = calculateDistance(t.Path, d)
+		t.Fitness = t.Distance + turnPenalties(t.Path, turn)
 	}
-	// Sort by distance (asc)
+	// Sort by fitness (asc)
 	sort.Slice(pop.Tours, func(i, j int) bool {
-		return pop.Tours[i].Distance < pop.Tours[j].Distance
+		return pop.Tours[i].Fitness < pop.Tours[j].Fitness
 	})
 }
 
-func calculateDistance(path []int, start, end models.Location, waypoints []models.Location) float64 {
+// calculateDistance is the length of start -> path -> end, where d is over
+// geo.RequestPoints: the start is point 0 and waypoint idx is point idx+1
+func calculateDistance(path []int, d func(i, j int) float64) float64 {
 	dist := 0.0
-	current := start
+	current := 0
 
 	for _, idx := range path {
-		next := waypoints[idx]
-		dist += haversine(current, next)
+		next := idx + 1
+		dist += d(current, next)
 		current = next
 	}
 
-	dist += haversine(current, end)
+	dist += d(current, len(path)+1)
 	return dist
 }
 
-func haversine(p1, p2 models.Location) float64 {
-	const R = 6371 // Earth radius in km
-	dLat := (p2.Lat - p1.Lat) * (math.Pi / 180.0)
-	dLon := (p2.Lng - p1.Lng) * (math.Pi / 180.0)
-
-	lat1 := p1.Lat * (math.Pi / 180.0)
-	lat2 := p2.Lat * (math.Pi / 180.0)
-
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Sin(dLon/2)*math.Sin(dLon/2)*math.Cos(lat1)*math.Cos(lat2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	return R * c
+// turnPenalties is turn summed over the stops of start -> path -> end, indexed as in
+// calculateDistance; 0 when turn is nil
+func turnPenalties(path []int, turn func(a, m, b int) float64) float64 {
+	if turn == nil {
+		return 0
+	}
+	total, prev := 0.0, 0
+	for i, idx := range path {
+		next := len(path) + 1
+		if i+1 < len(path) {
+			next = path[i+1] + 1
+		}
+		total += turn(prev, idx+1, next)
+		prev = idx + 1
+	}
+	return total
 }
 
-func tournamentSelection(pop *Population) Tour {
-	best := pop.Tours[rand.Intn(len(pop.Tours))]
-	for i := 0; i < TournamentSize; i++ {
-		contestant := pop.Tours[rand.Intn(len(pop.Tours))]
-		if contestant.Distance < best.Distance {
+func tournamentSelection(rng *rand.Rand, pop *Population, size int) Tour {
+	best := pop.Tours[rng.Intn(len(pop.Tours))]
+	for i := 0; i < size; i++ {
+		contestant := pop.Tours[rng.Intn(len(pop.Tours))]
+		if contestant.Fitness < best.Fitness {
 			best = contestant
 		}
 	}
@@ -161,10 +232,10 @@ func tournamentSelection(pop *Population) Tour {
 }
 
 // Ordered Crossover (OX1)
-func orderedCrossover(p1, p2 []int) []int {
+func orderedCrossover(rng *rand.Rand, p1, p2 []int) []int {
 	size := len(p1)
-	start := rand.Intn(size)
-	end := rand.Intn(size)
+	start := rng.Intn(size)
+	end := rng.Intn(size)
 	if start > end {
 		start, end = end, start
 	}
@@ -199,9 +270,9 @@ func orderedCrossover(p1, p2 []int) []int {
 	return child
 }
 
-func mutate(path []int) {
-	i := rand.Intn(len(path))
-	j := rand.Intn(len(path))
+func mutate(rng *rand.Rand, path []int) {
+	i := rng.Intn(len(path))
+	j := rng.Intn(len(path))
 	path[i], path[j] = path[j], path[i]
 }
 
@@ -1,58 +1,70 @@
 package solver
 
 import (
+	"cmp"
+	"context"
 	"math"
+	"milesconnect-optimization/internal/geo"
 	"milesconnect-optimization/internal/models"
-	"sort"
+	"milesconnect-optimization/internal/objective"
+	"milesconnect-optimization/internal/priority"
+	"slices"
+	"time"
 )
 
-// OptimizeFleetAllocation solves the fleet assignment problem using Best Fit Decreasing
-func OptimizeFleetAllocation(req models.LoadRequest) models.LoadResponse {
-	// 1. Sort shipments by weight (Descending) - heavier items first are harder to place
-	shipments := make([]models.ShipmentInfo, len(req.Shipments))
-	copy(shipments, req.Shipments)
-	sort.Slice(shipments, func(i, j int) bool {
-		return shipments[i].WeightKg > shipments[j].WeightKg
-	})
+// Solver identification reported in response metadata
+const (
+	FleetAllocationName    = "fleet-best-fit-decreasing"
+	FleetAllocationVersion = "1.0.0"
+)
 
-	// Initialize vehicles
-	// We create a map to track current state
-	type VehicleState struct {
-		Info     models.VehicleInfo
-		LoadedKg float64
-		Assigned []string
-	}
+// OptimizeFleetAllocation solves the fleet assignment problem using Best Fit Decreasing,
+// placing high-tier shipments first when capacity is short (see placementOrder).
+// Vehicles only take shipments in their range (see InRange), and those with
+// compartments pack each shipment into one, the one it names if it does. With
+// GroupByDestination, shipments go with others bound for the same area (see
+// fleetLoad.place).
+// The reported objective value is the number of vehicles used. Shipments not yet
+// placed when ctx is done are reported as unassigned.
+func OptimizeFleetAllocation(ctx context.Context, req models.LoadRequest) models.LoadResponse {
+	started := time.Now()
+	exhausted := false
 
-	vStates := make([]*VehicleState, len(req.Vehicles))
+	// 1. Sort shipments by weight (Descending) - heavier items first are harder to place
+	shipments := placementOrder(req)
+
+	load := newFleetLoad(req)
+	assigned := make([][]string, len(req.Vehicles))
+	dests := make([][]models.Location, len(req.Vehicles))
+	inCompartment := make([][][]string, len(req.Vehicles))
 	for i, v := range req.Vehicles {
-		vStates[i] = &VehicleState{
-			Info:     v,
-			LoadedKg: v.CurrentLoad,
-			Assigned: []string{},
-		}
+		inCompartment[i] = make([][]string, len(v.Compartments))
 	}
 
 	var unassigned []string
 
 	// 2. Iterate through shipments and find Best Fit vehicle
+	placed := 0
 	for _, s := range shipments {
-		bestIdx := -1
-		minRemaining := math.MaxFloat64
-
-		for i, v := range vStates {
-			remaining := v.Info.CapacityKg - (v.LoadedKg + s.WeightKg)
-
-			// If it fits and is tighter fit than current best
-			if remaining >= 0 && remaining < minRemaining {
-				minRemaining = remaining
-				bestIdx = i
-			}
+		if ctx.Err() != nil {
+			exhausted = true
+			unassigned = append(unassigned, s.ID)
+			continue
 		}
+		placed++
+
+		bestIdx := load.place(s).vehicle
 
 		if bestIdx != -1 {
 			// Assign to vehicle
-			vStates[bestIdx].LoadedKg += s.WeightKg
-			vStates[bestIdx].Assigned = append(vStates[bestIdx].Assigned, s.ID)
+			c := load.take(bestIdx, s)
+			assigned[bestIdx] = append(assigned[bestIdx], s.ID)
+			if s.Destination != nil {
+				dests[bestIdx] = append(dests[bestIdx], *s.Destination)
+			}
+			if c >= 0 {
+				inCompartment[bestIdx][c] = append(inCompartment[bestIdx][c], s.ID)
+			}
 		} else {
 			// Cannot fit anywhere
 			unassigned = append(unassigned, s.ID)
@@ -61,20 +73,441 @@ func OptimizeFleetAllocation(req models.LoadRequest) models.LoadResponse {
 
 	// 3. Construct response
 	allocations := []models.Allocation{}
-	for _, v := range vStates {
-		if len(v.Assigned) > 0 {
-			utilization := (v.LoadedKg / v.Info.CapacityKg) * 100
-			allocations = append(allocations, models.Allocation{
-				VehicleID:      v.Info.ID,
-				ShipmentIDs:    v.Assigned,
-				TotalWeight:    v.LoadedKg,
-				UtilizationPct: math.Round(utilization*100) / 100,
+	for i, v := range req.Vehicles {
+		if len(assigned[i]) == 0 {
+			continue
+		}
+		a := models.Allocation{
+			VehicleID:      v.ID,
+			ShipmentIDs:    assigned[i],
+			TotalWeight:    load.vehicle[i],
+			UtilizationPct: percent(load.vehicle[i], v.CapacityKg),
+			AreaRadiusKm:   math.Round(areaRadiusKm(dests[i])*100) / 100,
+		}
+		for c, comp := range v.Compartments {
+			a.Compartments = append(a.Compartments, models.CompartmentAllocation{
+				Name:           comp.Name,
+				ShipmentIDs:    append([]string{}, inCompartment[i][c]...),
+				TotalWeight:    load.compartment[i][c],
+				UtilizationPct: percent(load.compartment[i][c], comp.CapacityKg),
 			})
 		}
+		allocations = append(allocations, a)
 	}
 
 	return models.LoadResponse{
 		Allocations: allocations,
 		Unassigned:  unassigned,
+		Metadata: models.SolverMetadata{
+			Solver:          FleetAllocationName,
+			Version:         FleetAllocationVersion,
+			Iterations:      placed,
+			ComputeTimeMs:   elapsedMs(started),
+			BudgetExhausted: exhausted,
+			ObjectiveValue:  float64(len(allocations)),
+		},
+	}
+}
+
+// placementOrder is the order shipments are placed in: heaviest first, which packs
+// tightest. When that leaves shipments unassigned and their tiers' unserved penalties
+// differ, the shipments are also tried by penalty, highest first and heaviest first
+// within a penalty, and that order wins if it costs less under the request's
+// objective: vehicles used and unserved penalty, weighted. Equal keys keep their
+// request order so TraceFleetAllocation replays the same sequence.
+func placementOrder(req models.LoadRequest) []models.ShipmentInfo {
+	penalty := func(s models.ShipmentInfo) float64 { return priority.Lookup(req.TierPenalties, s.Tier).Unserved }
+	byWeight := slices.Clone(req.Shipments)
+	slices.SortStableFunc(byWeight, func(a, b models.ShipmentInfo) int { return cmp.Compare(b.WeightKg, a.WeightKg) })
+	if len(req.Shipments) == 0 || !slices.ContainsFunc(req.Shipments, func(s models.ShipmentInfo) bool { return penalty(s) != penalty(req.Shipments[0]) }) {
+		return byWeight
+	}
+	lost, used := placementCost(req, byWeight, penalty)
+	if lost == 0 {
+		return byWeight
+	}
+	byPenalty := slices.Clone(req.Shipments)
+	slices.SortStableFunc(byPenalty, func(a, b models.ShipmentInfo) int {
+		return cmp.Or(cmp.Compare(penalty(b), penalty(a)), cmp.Compare(b.WeightKg, a.WeightKg))
+	})
+	w := objective.Weights(req.Objective)
+	cost := func(lost float64, used int) float64 { return w.Unserved*lost + w.Vehicles*float64(used) }
+	if l, u := placementCost(req, byPenalty, penalty); cost(l, u) < cost(lost, used) {
+		return byPenalty
+	}
+	return byWeight
+}
+
+// placementCost allocates shipments in order, summing the penalties of the ones that
+// don't fit and counting the vehicles used
+func placementCost(req models.LoadRequest, order []models.ShipmentInfo, penalty func(models.ShipmentInfo) float64) (lost float64, used int) {
+	load := newFleetLoad(req)
+	taken := make([]bool, len(req.Vehicles))
+	for _, s := range order {
+		i := load.place(s).vehicle
+		if i < 0 {
+			lost += penalty(s)
+			continue
+		}
+		load.take(i, s)
+		if !taken[i] {
+			taken[i] = true
+			used++
+		}
+	}
+	return lost, used
+}
+
+// InRange reports whether s's destination is within v's range of its depot, there and
+// back. Shipments without a destination and vehicles without a range are always in
+// range.
+func InRange(v models.VehicleInfo, s models.ShipmentInfo) bool {
+	if v.MaxRangeKm == 0 || v.Depot == nil || s.Destination == nil {
+		return true
+	}
+	return 2*geo.HaversineKm(*v.Depot, *s.Destination) <= v.MaxRangeKm
+}
+
+// UnassignedShipments says, for each of resp.Unassigned in the same order, which vehicle
+// of req comes closest to taking it with the fleet loaded as resp leaves it, and what
+// stops it: of the vehicles with a compartment for it, if any, the one it breaks fewest
+// constraints on, then the one it is fewest kg too heavy for, then the one whose range
+// it exceeds least, ties going to the first.
+func UnassignedShipments(req models.LoadRequest, resp models.LoadResponse) []models.UnallocatedShipment {
+	if len(resp.Unassigned) == 0 || len(req.Vehicles) == 0 {
+		return nil
+	}
+	load := newFleetLoad(req)
+	vehicle := make(map[string]int, len(req.Vehicles))
+	for i, v := range req.Vehicles {
+		vehicle[v.ID] = i
+	}
+	for _, a := range resp.Allocations {
+		i, ok := vehicle[a.VehicleID]
+		if !ok {
+			continue
+		}
+		load.vehicle[i] = a.TotalWeight
+		for c, comp := range a.Compartments {
+			if c < len(load.compartment[i]) {
+				load.compartment[i][c] = comp.TotalWeight
+			}
+		}
+	}
+	shipments := make(map[string]models.ShipmentInfo, len(req.Shipments))
+	for _, s := range req.Shipments {
+		if _, ok := shipments[s.ID]; !ok {
+			shipments[s.ID] = s
+		}
+	}
+
+	out := make([]models.UnallocatedShipment, len(resp.Unassigned))
+	for k, id := range resp.Unassigned {
+		s := shipments[id]
+		var best models.ShipmentInsertion
+		for i, v := range req.Vehicles {
+			ins := models.ShipmentInsertion{VehicleID: v.ID, BlockedBy: []string{}}
+			if kg, c, ok := load.room(i, s); !ok {
+				ins.BlockedBy = append(ins.BlockedBy, models.ConstraintCompartment)
+			} else {
+				if c >= 0 {
+					ins.Compartment = v.Compartments[c].Name
+				}
+				if short := s.WeightKg - kg; short > 0 {
+					ins.BlockedBy = append(ins.BlockedBy, models.ConstraintCapacity)
+					ins.ShortKg = math.Round(short*100) / 100
+				}
+			}
+			if !InRange(v, s) {
+				ins.BlockedBy = append(ins.BlockedBy, models.ConstraintMaxRange)
+				ins.RangeExceededKm = math.Round((2*geo.HaversineKm(*v.Depot, *s.Destination)-v.MaxRangeKm)*100) / 100
+			}
+			if i == 0 || cmp.Or(
+				compareBool(slices.Contains(ins.BlockedBy, models.ConstraintCompartment), slices.Contains(best.BlockedBy, models.ConstraintCompartment)),
+				cmp.Compare(len(ins.BlockedBy), len(best.BlockedBy)),
+				cmp.Compare(ins.ShortKg, best.ShortKg),
+				cmp.Compare(ins.RangeExceededKm, best.RangeExceededKm),
+			) < 0 {
+				best = ins
+			}
+		}
+		out[k] = models.UnallocatedShipment{ID: id, Insertion: best}
+	}
+	return out
+}
+
+// compareBool orders false before true
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// DefaultGroupRadiusKm is how near the centre of a vehicle's shipments a destination
+// must be to join them when grouping by destination, for requests that don't say
+const DefaultGroupRadiusKm = 25
+
+// fleetLoad is what each vehicle, and each of its compartments, carries as shipments
+// are placed
+type fleetLoad struct {
+	vehicles    []models.VehicleInfo
+	vehicle     []float64
+	compartment [][]float64 // by vehicle, then compartment
+
+	// With grouping by destination, the sum of each vehicle's shipment destinations and
+	// their count, for their centre, which centres keeps prepared for distances to the
+	// next shipment's destination, into km
+	group    bool
+	radiusKm float64
+	sum      []models.Location
+	dests    []int
+	centres  geo.Prepared
+	dest     geo.Prepared
+	km       []float64
+}
+
+func newFleetLoad(req models.LoadRequest) *fleetLoad {
+	vehicles := req.Vehicles
+	l := &fleetLoad{vehicles: vehicles, vehicle: make([]float64, len(vehicles)), compartment: make([][]float64, len(vehicles))}
+	if req.GroupByDestination {
+		l.group, l.radiusKm = true, cmp.Or(req.GroupRadiusKm, DefaultGroupRadiusKm)
+		l.sum, l.dests = make([]models.Location, len(vehicles)), make([]int, len(vehicles))
+		l.centres, l.dest, l.km = make(geo.Prepared, len(vehicles)), make(geo.Prepared, 1), make([]float64, len(vehicles))
+	}
+	for i, v := range vehicles {
+		l.vehicle[i] = v.CurrentLoad
+		l.compartment[i] = make([]float64, len(v.Compartments))
+		for c, comp := range v.Compartments {
+			l.compartment[i][c] = comp.CurrentLoad
+		}
+	}
+	return l
+}
+
+// free is the room vehicle i has for s: the least of its own free capacity and that
+// of the compartment s would go in, which is returned too, -1 on a vehicle without
+// compartments. A shipment naming a compartment goes in the vehicle's of that name;
+// one that doesn't, in the compartment it fits tightest, or else the one with the most
+// room. ok is false when s can't go on the vehicle at all: it is out of range, or
+// needs a compartment the vehicle doesn't have.
+func (l *fleetLoad) free(i int, s models.ShipmentInfo) (kg float64, compartment int, ok bool) {
+	if !InRange(l.vehicles[i], s) {
+		return 0, -1, false
+	}
+	return l.room(i, s)
+}
+
+// room is free without the range check
+func (l *fleetLoad) room(i int, s models.ShipmentInfo) (kg float64, compartment int, ok bool) {
+	v := l.vehicles[i]
+	kg = v.CapacityKg - l.vehicle[i]
+	if len(v.Compartments) == 0 {
+		return kg, -1, s.Compartment == ""
+	}
+	compartment = -1
+	var best float64
+	for c, comp := range v.Compartments {
+		if s.Compartment != "" && comp.Name != s.Compartment {
+			continue
+		}
+		room := comp.CapacityKg - l.compartment[i][c]
+		var better bool
+		switch fits, bestFits := room >= s.WeightKg, best >= s.WeightKg; {
+		case compartment < 0:
+			better = true
+		case fits != bestFits:
+			better = fits
+		case fits:
+			better = room < best
+		default:
+			better = room > best
+		}
+		if better {
+			compartment, best = c, room
+		}
+	}
+	if compartment < 0 {
+		return 0, -1, false
+	}
+	return min(kg, best), compartment, true
+}
+
+// remaining is the room vehicle i has left after taking s, negative when it can't
+func (l *fleetLoad) remaining(i int, s models.ShipmentInfo) float64 {
+	kg, _, ok := l.free(i, s)
+	if !ok {
+		return -1
+	}
+	return kg - s.WeightKg
+}
+
+// take puts s on vehicle i, returning the compartment it went in
+func (l *fleetLoad) take(i int, s models.ShipmentInfo) int {
+	_, c, _ := l.free(i, s)
+	l.vehicle[i] += s.WeightKg
+	if c >= 0 {
+		l.compartment[i][c] += s.WeightKg
+	}
+	if l.group && s.Destination != nil {
+		l.sum[i].Lat += s.Destination.Lat
+		l.sum[i].Lng += s.Destination.Lng
+		l.dests[i]++
+		n := float64(l.dests[i])
+		l.centres.Set(i, models.Location{Lat: l.sum[i].Lat / n, Lng: l.sum[i].Lng / n})
+	}
+	return c
+}
+
+// How a shipment was placed when grouping by destination, in Placement.Group
+const (
+	GroupedNear    = "near"    // with the nearest vehicle whose shipments are within the radius
+	GroupedNew     = "new"     // on a vehicle without shipments for a destination, none being near
+	GroupedNearest = "nearest" // with the nearest vehicle's shipments, beyond the radius; no vehicle was free
+)
+
+// choice is the vehicle a shipment goes on, -1 for none, and as what, GroupedNear or
+// GroupedNearest at areaKm from the centre of the vehicle's shipments; group is empty
+// when capacity alone decided
+type choice struct {
+	vehicle int
+	group   string
+	areaKm  float64
+}
+
+// place picks the vehicle for s: the best fit (see bestFit), or when grouping by
+// destination, for a shipment with one, the vehicle with room whose shipments' centre
+// is nearest if it is within the group radius, else the best fit among the vehicles
+// without shipments for a destination, else the nearest after all
+func (l *fleetLoad) place(s models.ShipmentInfo) choice {
+	best := bestFit(len(l.vehicles), func(i int) float64 { return l.remaining(i, s) })
+	if !l.group || s.Destination == nil || best < 0 {
+		return choice{vehicle: best}
+	}
+	near := choice{vehicle: -1, areaKm: math.Inf(1)}
+	l.dest.Set(0, *s.Destination)
+	l.dest.KmFrom(0, l.centres, l.km)
+	for i := range l.vehicles {
+		if l.dests[i] == 0 || l.remaining(i, s) < 0 {
+			continue
+		}
+		if d := l.km[i]; d < near.areaKm {
+			near.vehicle, near.areaKm = i, d
+		}
+	}
+	if near.vehicle >= 0 && near.areaKm <= l.radiusKm {
+		near.group = GroupedNear
+		return near
+	}
+	if empty := bestFit(len(l.vehicles), func(i int) float64 {
+		if l.dests[i] > 0 {
+			return -1
+		}
+		return l.remaining(i, s)
+	}); empty >= 0 {
+		return choice{vehicle: empty, group: GroupedNew}
+	}
+	near.group = GroupedNearest
+	return near
+}
+
+// areaRadiusKm is how far the farthest of dests is from their centre; 0 without any
+func areaRadiusKm(dests []models.Location) float64 {
+	if len(dests) == 0 {
+		return 0
+	}
+	members := make([]int, len(dests))
+	for j := range members {
+		members[j] = j
+	}
+	centre := centroid(dests, members)
+	var radius float64
+	for _, d := range dests {
+		radius = max(radius, geo.HaversineKm(centre, d))
+	}
+	return radius
+}
+
+// percent is loaded as a percentage of capacity, to two decimals
+func percent(loaded, capacity float64) float64 {
+	return math.Round(loaded/capacity*100*100) / 100
+}
+
+// bestFit returns the vehicle with the least room remaining after taking a shipment,
+// or -1 when none has room. Ties go to the first vehicle.
+func bestFit(vehicles int, remainingKg func(i int) float64) int {
+	bestIdx := -1
+	minRemaining := math.MaxFloat64
+	for i := range vehicles {
+		// If it fits and is tighter fit than current best
+		if remaining := remainingKg(i); remaining >= 0 && remaining < minRemaining {
+			minRemaining = remaining
+			bestIdx = i
+		}
+	}
+	return bestIdx
+}
+
+// Placement is one step of the fleet allocation: a shipment, where it went and the
+// vehicles' free capacity when its turn came
+type Placement struct {
+	Shipment   models.ShipmentInfo
+	Vehicle    int     // request vehicle index; -1 when no vehicle had room
+	FreeKg     float64 // the chosen vehicle's free capacity before taking the shipment
+	MostFreeKg float64 // the most free capacity any vehicle in range had
+	Fits       int     // vehicles with room for the shipment
+
+	// Compartment is the index of the chosen vehicle's compartment the shipment went
+	// in, -1 without one; FreeKg is then the least of the vehicle's and the
+	// compartment's free capacity, and MostFreeKg is over the vehicles with a
+	// compartment for it
+	Compartment int
+
+	// Group is how grouping by destination placed the shipment, GroupedNear or
+	// GroupedNearest AreaKm from the centre of the vehicle's shipments; empty when
+	// capacity decided
+	Group  string
+	AreaKm float64
+}
+
+// FleetTrace is a replay of a fleet allocation
+type FleetTrace struct {
+	Steps    []Placement
+	Unplaced []models.ShipmentInfo // left unassigned by the time budget, in placement order
+	ByTier   bool                  // shipments were placed by tier penalty rather than by weight
+}
+
+// TraceFleetAllocation replays the first placed shipments of OptimizeFleetAllocation
+// for req, in the order it considered them; placed is the response's iteration count.
+func TraceFleetAllocation(req models.LoadRequest, placed int) FleetTrace {
+	shipments := placementOrder(req)
+	placed = min(placed, len(shipments))
+	load := newFleetLoad(req)
+	trace := FleetTrace{Steps: make([]Placement, placed), Unplaced: shipments[placed:]}
+	for k, s := range shipments[:placed] {
+		c := load.place(s)
+		step := Placement{Shipment: s, Vehicle: c.vehicle, Compartment: -1, Group: c.group, AreaKm: c.areaKm}
+		for i := range req.Vehicles {
+			free, _, ok := load.free(i, s)
+			if !ok {
+				continue
+			}
+			step.MostFreeKg = max(step.MostFreeKg, free)
+			if free >= s.WeightKg {
+				step.Fits++
+			}
+		}
+		if step.Vehicle >= 0 {
+			step.FreeKg, _, _ = load.free(step.Vehicle, s)
+			step.Compartment = load.take(step.Vehicle, s)
+		}
+		trace.Steps[k] = step
+	}
+	for k := 1; k < len(shipments) && !trace.ByTier; k++ {
+		trace.ByTier = shipments[k].WeightKg > shipments[k-1].WeightKg
 	}
+	return trace
 }
@@ -1,64 +1,196 @@
 package solver
 
 import (
+	"context"
 	"math"
+	"milesconnect-optimization/internal/bufpool"
+	"milesconnect-optimization/internal/geo"
 	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/parallel"
+	"time"
 )
 
-// SolveTSPNearestNeighbor solves the TSP using the Nearest Neighbor heuristic
-func SolveTSPNearestNeighbor(req models.OptimizationRequest) models.OptimizationResponse {
-	// 1. Start at 'Start'
-	current := req.Start
-	route := []models.Location{current}
-	visited := make([]bool, len(req.Waypoints))
-	totalDist := 0.0
+// Solver identification reported in response metadata
+const (
+	NearestNeighborName    = "tsp-nearest-neighbor"
+	NearestNeighborVersion = "1.0.0"
+)
+
+// SolveTSPNearestNeighbor solves the TSP using the Nearest Neighbor heuristic.
+// matrix holds the distances between geo.RequestPoints(req); when nil,
+// great-circle distances are used. If ctx expires mid-construction the unvisited
+// waypoints are appended in request order and the response is flagged as having
+// exhausted its time budget.
+func SolveTSPNearestNeighbor(ctx context.Context, req models.OptimizationRequest, matrix geo.Matrix) models.OptimizationResponse {
+	started := time.Now()
+	d := distances(req, matrix)
+	tour, iterations, exhausted := nearestNeighborTour(ctx, req, matrix, d)
+	defer tourBuffers.Put(tour)
+	return tourResponse(req, tour, d, models.SolverMetadata{
+		Solver:          NearestNeighborName,
+		Version:         NearestNeighborVersion,
+		Iterations:      iterations,
+		ComputeTimeMs:   elapsedMs(started),
+		BudgetExhausted: exhausted,
+	})
+}
+
+// distFunc is the distance between two points of geo.RequestPoints
+type distFunc func(a, b int) float64
+
+func distances(req models.OptimizationRequest, matrix geo.Matrix) distFunc {
+	if matrix != nil {
+		return func(a, b int) float64 { return matrix[a][b] }
+	}
+	return geo.Prepare(geo.RequestPoints(req)).Km
+}
+
+// tourBuffers and visitBuffers recycle the per-solve tour scratch; the response
+// copies the tour's locations, so solvers hand it back once the response is built
+var (
+	tourBuffers  bufpool.Pool[int]
+	visitBuffers bufpool.Pool[bool]
+)
+
+// scanWaypoints is the fewest waypoints worth scanning on a goroutine of their own
+const scanWaypoints = 512
 
+// nearestNeighborTour returns the waypoints' point indices (waypoint j is point j+1,
+// the start is point 0) in nearest-neighbor order. With great-circle distances (no
+// matrix) the next stop comes from a k-d tree over the remaining waypoints, in about
+// O(log n) per step; road matrices are scanned, split across CPUs for large requests.
+// Either way ties go to the lowest waypoint index.
+func nearestNeighborTour(ctx context.Context, req models.OptimizationRequest, matrix geo.Matrix, d distFunc) (tour []int, iterations int, exhausted bool) {
 	count := len(req.Waypoints)
+	// 1. Start at 'Start'
+	current := 0
+	tour = tourBuffers.Get(count)[:0]
+	visited := visitBuffers.Get(count)
+	clear(visited)
+	defer visitBuffers.Put(visited)
+
+	nearest := scanNearest(count, d, visited)
+	if matrix == nil {
+		nearest = indexNearest(req)
+	}
 	for i := 0; i < count; i++ {
-		nearestIdx := -1
-		minDist := math.MaxFloat64
+		if ctx.Err() != nil {
+			exhausted = true
+			break
+		}
+		iterations++
 
-		for j, wp := range req.Waypoints {
+		if nearestIdx := nearest(current); nearestIdx != -1 {
+			visited[nearestIdx] = true
+			current = nearestIdx + 1
+			tour = append(tour, current)
+		}
+	}
+
+	// Out of time: visit whatever is left in the order given
+	if exhausted {
+		for j := 0; j < count; j++ {
 			if !visited[j] {
-				dist := haversine(current, wp)
-				if dist < minDist {
-					minDist = dist
-					nearestIdx = j
-				}
+				tour = append(tour, j+1)
 			}
 		}
+	}
+	return tour, iterations, exhausted
+}
 
-		if nearestIdx != -1 {
-			visited[nearestIdx] = true
-			current = req.Waypoints[nearestIdx]
-			route = append(route, current)
-			totalDist += minDist
+// indexNearest returns the waypoint nearest to point current among those it hasn't
+// returned yet, by great-circle distance
+func indexNearest(req models.OptimizationRequest) func(current int) int {
+	ix := geo.NewIndex(req.Waypoints)
+	return func(current int) int {
+		from := req.Start
+		if current > 0 {
+			from = req.Waypoints[current-1]
+		}
+		j := ix.Nearest(from)
+		if j != -1 {
+			ix.Remove(j)
 		}
+		return j
 	}
+}
 
-	// 2. Finally go to 'End'
-	finalLeg := haversine(current, req.End)
-	route = append(route, req.End)
-	totalDist += finalLeg
+// scanNearest returns the unvisited waypoint nearest to point current by d, checking
+// every one
+func scanNearest(count int, d distFunc, visited []bool) func(current int) int {
+	ranges := parallel.Split(count, scanWaypoints)
+	nearest := make([]int, len(ranges))
+	nearestDist := make([]float64, len(ranges))
+	return func(current int) int {
+		parallel.Do(ranges, func(k int, r parallel.Range) {
+			nearest[k], nearestDist[k] = -1, math.MaxFloat64
+			for j := r.Lo; j < r.Hi; j++ {
+				if !visited[j] {
+					dist := d(current, j+1)
+					if dist < nearestDist[k] {
+						nearestDist[k] = dist
+						nearest[k] = j
+					}
+				}
+			}
+		})
+		nearestIdx := -1
+		minDist := math.MaxFloat64
+		for k := range nearest {
+			if nearest[k] != -1 && nearestDist[k] < minDist {
+				minDist, nearestIdx = nearestDist[k], nearest[k]
+			}
+		}
+		return nearestIdx
+	}
+}
 
-	return models.OptimizationResponse{
-		Route:       route,
-		TotalDistKm: totalDist,
+// tourKm is the length of start -> tour -> end
+func tourKm(tour []int, d distFunc) float64 {
+	endIdx := len(tour) + 1
+	total := 0.0
+	current := 0
+	for _, p := range tour {
+		total += d(current, p)
+		current = p
 	}
+	// 2. Finally go to 'End'
+	return total + d(current, endIdx)
 }
 
-// haversine calculates distance between two points in km
-func haversine(p1, p2 models.Location) float64 {
-	const R = 6371 // Earth radius in km
-	dLat := (p2.Lat - p1.Lat) * (math.Pi / 180.0)
-	dLon := (p2.Lng - p1.Lng) * (math.Pi / 180.0)
+// tourResponse builds the response for tour, filling in the objective values of meta
+func tourResponse(req models.OptimizationRequest, tour []int, d distFunc, meta models.SolverMetadata) models.OptimizationResponse {
+	route := make([]models.Location, 0, len(tour)+2)
+	route = append(route, req.Start)
+	for _, p := range tour {
+		route = append(route, req.Waypoints[p-1])
+	}
+	route = append(route, req.End)
 
-	lat1 := p1.Lat * (math.Pi / 180.0)
-	lat2 := p2.Lat * (math.Pi / 180.0)
+	// Objective of the waypoints in the order given: point p to p+1, start to end
+	initial := 0.0
+	for p := 0; p <= len(req.Waypoints); p++ {
+		initial += d(p, p+1)
+	}
+
+	total := tourKm(tour, d)
+	meta.ObjectiveValue = total
+	meta.InitialValue = initial
+	return models.OptimizationResponse{Route: route, TotalDistKm: total, Metadata: meta}
+}
 
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Sin(dLon/2)*math.Sin(dLon/2)*math.Cos(lat1)*math.Cos(lat2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+// OrderResponse builds the response for visiting req's waypoints in order, given as
+// waypoint indices, on matrix's distances (great circles when nil), filling in the
+// objective values of meta. It is for solvers outside this package.
+func OrderResponse(req models.OptimizationRequest, order []int, matrix geo.Matrix, meta models.SolverMetadata) models.OptimizationResponse {
+	tour := make([]int, len(order))
+	for i, w := range order {
+		tour[i] = w + 1
+	}
+	return tourResponse(req, tour, distances(req, matrix), meta)
+}
 
-	return R * c
+// elapsedMs reports the time since start in fractional milliseconds
+func elapsedMs(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
 }
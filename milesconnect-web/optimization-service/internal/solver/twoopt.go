@@ -0,0 +1,181 @@
+package solver
+
+import (
+	"context"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/stability"
+	"time"
+)
+
+// Solver identification reported in response metadata
+const (
+	TwoOptName    = "tsp-2opt"
+	TwoOptVersion = "1.0.0"
+)
+
+// SolveTSPTwoOpt builds a nearest-neighbor tour and improves it with 2-opt moves
+// (reversing a stretch of the route) until no move shortens it or ctx expires, in
+// which case the best tour so far is returned. matrix is as for SolveTSPNearestNeighbor.
+// The request's solver parameters cap the moves and how far apart their ends may be,
+// and may charge U-turns as extra distance: the tour is then the shortest with the
+// penalty, while the response reports its distance without.
+// With Checkpoints on ctx it saves the tour as it improves and resumes from a saved one;
+// otherwise it starts from the request's initial route when it has one.
+func SolveTSPTwoOpt(ctx context.Context, req models.OptimizationRequest, matrix geo.Matrix) models.OptimizationResponse {
+	started := time.Now()
+	d := distances(req, matrix)
+	cp := checkpointsFrom(ctx)
+	var tour []int
+	var iterations int
+	var exhausted, warm bool
+	if saved, ok := cp.resume(TwoOptName, len(req.Waypoints)); ok {
+		tour, iterations = saved.Tour, saved.Iterations
+	} else if len(req.InitialRoute) > 0 {
+		order := stability.Order(req, req.InitialRoute, d)
+		tour = append(tourBuffers.Get(len(req.Waypoints))[:0], order[1:len(order)-1]...)
+		defer tourBuffers.Put(tour)
+		warm = true
+	} else {
+		tour, iterations, exhausted = nearestNeighborTour(ctx, req, matrix, d)
+		defer tourBuffers.Put(tour)
+	}
+	if !exhausted {
+		// Every pass revisits the same pairs, so great-circle distances are computed once
+		improve := d
+		if matrix == nil {
+			dist := geo.GreatCircle(geo.RequestPoints(req))
+			defer dist.Release()
+			improve = dist.Km
+		}
+		var moves int
+		moves, exhausted = twoOpt(ctx, tour, improve, uTurns(req), matrix == nil, movesOf(req.SolverParams), func(current []int, moves int) {
+			cp.save(TwoOptName, current, iterations+moves)
+		})
+		iterations += moves
+	}
+	return tourResponse(req, tour, d, models.SolverMetadata{
+		Solver:          TwoOptName,
+		Version:         TwoOptVersion,
+		Iterations:      iterations,
+		ComputeTimeMs:   elapsedMs(started),
+		BudgetExhausted: exhausted,
+		WarmStart:       warm,
+	})
+}
+
+// moveLimits bound a 2-opt search: it stops after max moves and only reverses
+// stretches of up to window positions; zero is unlimited
+type moveLimits struct {
+	max, window int
+}
+
+func movesOf(p *models.SolverParams) moveLimits {
+	if p == nil {
+		return moveLimits{}
+	}
+	return moveLimits{max: p.MaxIterations, window: p.Neighborhood}
+}
+
+// uTurnDegrees is the heading change between consecutive legs from which a turn is a U-turn
+const uTurnDegrees = 150
+
+// turnFunc is the penalty for turning at point m between points a and b of
+// geo.RequestPoints; it is the same either way round
+type turnFunc func(a, m, b int) float64
+
+// uTurns charges the request's U-turn penalty for turns of uTurnDegrees or more; nil
+// when the request sets none
+func uTurns(req models.OptimizationRequest) turnFunc {
+	p := req.SolverParams
+	if p == nil || p.UTurnPenaltyKm == 0 {
+		return nil
+	}
+	km, points := p.UTurnPenaltyKm, geo.Prepare(geo.RequestPoints(req))
+	return func(a, m, b int) float64 {
+		if points.TurnDeg(a, m, b) >= uTurnDegrees {
+			return km
+		}
+		return 0
+	}
+}
+
+// UTurnPenalty is uTurns for the solvers outside this package, so a U-turn costs them
+// what it costs 2-opt; nil when the request sets no penalty
+func UTurnPenalty(req models.OptimizationRequest) func(a, m, b int) float64 {
+	return uTurns(req)
+}
+
+// twoOpt improves tour in place and returns the number of moves applied, at most
+// limits allow. Road matrices can be asymmetric, so unless symmetric is set a reversal
+// also accounts for the changed cost of the reversed stretch. turn, if not nil, adds a
+// penalty for each turn to the length being shortened. progress, if not nil, is shown
+// the current tour between passes of the outer loop and must not keep it.
+func twoOpt(ctx context.Context, tour []int, d distFunc, turn turnFunc, symmetric bool, limits moveLimits, progress func(tour []int, moves int)) (moves int, exhausted bool) {
+	n := len(tour)
+	// path[0] is the start and path[n+1] the end; only the waypoints between move
+	path := tourBuffers.Get(n + 2)[:0]
+	defer tourBuffers.Put(path)
+	path = append(path, 0)
+	path = append(path, tour...)
+	path = append(path, n+1)
+
+	for improved := true; improved; {
+		improved = false
+		for i := 1; i < n; i++ {
+			if ctx.Err() != nil {
+				copy(tour, path[1:n+1])
+				return moves, true
+			}
+			if progress != nil {
+				progress(path[1:n+1], moves)
+			}
+			last := n
+			if limits.window > 0 {
+				last = min(n, i+limits.window)
+			}
+			for k := i + 1; k <= last; k++ {
+				a, b, c, e := path[i-1], path[i], path[k], path[k+1]
+				delta := d(a, c) + d(b, e) - d(a, b) - d(c, e)
+				if !symmetric {
+					for m := i; m < k; m++ {
+						delta += d(path[m+1], path[m]) - d(path[m], path[m+1])
+					}
+				}
+				if turn != nil {
+					delta += turnDelta(path, i, k, turn)
+				}
+				if delta < -1e-9 {
+					for lo, hi := i, k; lo < hi; lo, hi = lo+1, hi-1 {
+						path[lo], path[hi] = path[hi], path[lo]
+					}
+					moves++
+					improved = true
+					if moves == limits.max {
+						copy(tour, path[1:n+1])
+						return moves, false
+					}
+				}
+			}
+		}
+	}
+	copy(tour, path[1:n+1])
+	return moves, false
+}
+
+// turnDelta is the change in turn penalties from reversing path[i..k]. Turns inside the
+// stretch are the same driven backwards, so only those at its ends and at the stops
+// either side of it change; the start and end have no turn.
+func turnDelta(path []int, i, k int, turn turnFunc) float64 {
+	a, b, c, e := path[i-1], path[i], path[k], path[k+1]
+	delta := turn(a, c, path[k-1]) + turn(path[i+1], b, e) - turn(a, b, path[i+1]) - turn(path[k-1], c, e)
+	if i > 1 {
+		before := path[i-2]
+		delta += turn(before, a, c) - turn(before, a, b)
+	}
+	if k+2 < len(path) {
+		after := path[k+2]
+		delta += turn(b, e, after) - turn(c, e, after)
+	}
+	return delta
+}
@@ -0,0 +1,94 @@
+// Package solvers looks up the route solvers by name and runs them in-process, for the
+// server, the command-line tools and the embeddable pkg/optimizer API. Solvers of
+// other packages join the built-in ones with Register.
+package solvers
+
+import (
+	"context"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/solver/genetic"
+	"sort"
+	"sync"
+)
+
+// Func solves a route request. matrix holds the distances between
+// geo.RequestPoints(req); nil means great-circle distances, the only ones solvers
+// without AcceptsMatrix use.
+type Func func(ctx context.Context, req models.OptimizationRequest, matrix geo.Matrix) models.OptimizationResponse
+
+// Options tune the solvers that take parameters
+type Options struct {
+	Genetic     genetic.Params
+	ClusterSize int // of the hierarchical solver
+}
+
+// DefaultOptions are the server's default solver settings
+func DefaultOptions() Options {
+	return Options{Genetic: genetic.DefaultParams(), ClusterSize: solver.DefaultHierarchicalParams().ClusterSize}
+}
+
+var (
+	mu sync.RWMutex
+	// route builds each solver from the options
+	route = map[string]func(opts Options) Func{
+		solver.NearestNeighborName: func(Options) Func { return solver.SolveTSPNearestNeighbor },
+		solver.TwoOptName:          func(Options) Func { return solver.SolveTSPTwoOpt },
+		solver.HierarchicalName: func(opts Options) Func {
+			return func(ctx context.Context, req models.OptimizationRequest, _ geo.Matrix) models.OptimizationResponse {
+				return solver.SolveTSPHierarchical(ctx, req, solver.SolveTSPTwoOpt, opts.ClusterSize)
+			}
+		},
+		genetic.Name: func(opts Options) Func {
+			return func(ctx context.Context, req models.OptimizationRequest, _ geo.Matrix) models.OptimizationResponse {
+				return genetic.SolveTSPGenetic(ctx, req, opts.Genetic)
+			}
+		},
+	}
+	// matrix holds the solvers that route on a given distance matrix
+	matrix = map[string]bool{solver.NearestNeighborName: true, solver.TwoOptName: true}
+)
+
+// Register adds the route solver name, built by build from the server's options like
+// the built-in ones; acceptsMatrix says whether it routes on a given distance matrix.
+// It is meant for init functions: registering a name twice panics.
+func Register(name string, build func(opts Options) Func, acceptsMatrix bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := route[name]; dup {
+		panic("solvers: route solver " + name + " registered twice")
+	}
+	route[name] = build
+	matrix[name] = acceptsMatrix
+}
+
+// AcceptsMatrix reports whether the named solver routes on a given distance matrix
+func AcceptsMatrix(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return matrix[name]
+}
+
+// Route returns the route solver named name, configured with opts
+func Route(name string, opts Options) (Func, bool) {
+	mu.RLock()
+	build, ok := route[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return build(opts), true
+}
+
+// RouteNames lists the route solvers Route knows, sorted
+func RouteNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(route))
+	for name := range route {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,146 @@
+// Package stability keeps a re-optimized route in the order of a previous plan unless
+// changing it saves enough, so drivers aren't handed a new order every day for a few
+// kilometres.
+package stability
+
+import (
+	"math"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"slices"
+)
+
+// DefaultThresholdPct is the saving a solved order must beat to replace the previous
+// one, for servers that don't configure theirs
+const DefaultThresholdPct = 5
+
+// Keep returns resp, a solved route for req, in the order of req.PreviousRoute when
+// the solved order is no more than req.StabilityThresholdPct shorter, with
+// resp.Stability saying how they compare. The previous order is laid out by Order.
+// Distances come from matrix
+// (see geo.RequestPoints) when set, otherwise great circles. resp is returned as it is
+// when the request has no previous route or its route isn't one of the request's
+// points.
+func Keep(req models.OptimizationRequest, resp models.OptimizationResponse, matrix geo.Matrix) models.OptimizationResponse {
+	if len(req.PreviousRoute) == 0 {
+		return resp
+	}
+	points := geo.RequestPoints(req)
+	index, ok := geo.RouteIndices(points, resp.Route)
+	if !ok || len(index) != len(points) {
+		return resp
+	}
+	gc := geo.Prepare(points)
+	km := func(a, b int) float64 {
+		if matrix != nil {
+			return matrix[a][b]
+		}
+		return gc.Km(a, b)
+	}
+	pathKm := func(path []int) float64 {
+		var total float64
+		for i := 1; i < len(path); i++ {
+			total += km(path[i-1], path[i])
+		}
+		return total
+	}
+
+	previous := Order(req, req.PreviousRoute, km)
+	solvedKm, previousKm := pathKm(index), pathKm(previous)
+	var saving float64
+	if previousKm > 0 {
+		saving = (previousKm - solvedKm) / previousKm * 100
+	}
+	resp.Stability = &models.RouteStability{
+		PreviousDistKm: previousKm,
+		SavingPct:      math.Round(saving*100) / 100,
+		ThresholdPct:   req.StabilityThresholdPct,
+	}
+	if saving > req.StabilityThresholdPct {
+		return resp
+	}
+	resp.Stability.KeptPrevious = true
+	resp.Route = make([]models.Location, len(previous))
+	for i, p := range previous {
+		resp.Route[i] = points[p]
+	}
+	resp.TotalDistKm = previousKm
+	resp.Metadata.ObjectiveValue = previousKm
+	return resp
+}
+
+// Order is the point indices (see geo.RequestPoints) of req's waypoints in the order of
+// ids, start and end included. Each ID stands for the first waypoint with it; IDs no
+// waypoint has are skipped, and the waypoints ids leave out are inserted one by one, in
+// request order, where they add the least km.
+func Order(req models.OptimizationRequest, ids []string, km func(a, b int) float64) []int {
+	first := map[string]int{} // point index of the first waypoint with each ID
+	for i, wp := range req.Waypoints {
+		if _, ok := first[wp.ID]; wp.ID != "" && !ok {
+			first[wp.ID] = i + 1
+		}
+	}
+	end := len(req.Waypoints) + 1
+	order := []int{0}
+	listed := make([]bool, end)
+	for _, id := range ids {
+		if p, ok := first[id]; ok {
+			order = append(order, p)
+			listed[p] = true
+		}
+	}
+	order = append(order, end)
+	for p := 1; p < end; p++ {
+		if listed[p] {
+			continue
+		}
+		at, best := 1, math.Inf(1)
+		for i := 1; i < len(order); i++ {
+			a, b := order[i-1], order[i]
+			if added := km(a, p) + km(p, b) - km(a, b); added < best {
+				at, best = i, added
+			}
+		}
+		order = slices.Insert(order, at, p)
+	}
+	return order
+}
+
+// Changed counts the stops of route, a route for req, that don't follow the stop they
+// followed in req.PreviousRoute, the waypoints it doesn't list included. Reloads,
+// stops at the start, don't count and don't break the order.
+func Changed(req models.OptimizationRequest, route []models.Location) int {
+	if len(route) < 2 {
+		return 0
+	}
+	waypoints := map[string]bool{}
+	for _, wp := range req.Waypoints {
+		waypoints[wp.ID] = wp.ID != ""
+	}
+	// after is, for each ID, the ID of the stop before it in the previous route, "" for
+	// the start
+	after := map[string]string{}
+	prev := ""
+	for _, id := range req.PreviousRoute {
+		if waypoints[id] {
+			after[id], prev = prev, id
+		}
+	}
+
+	changed := 0
+	seen := map[string]bool{}
+	prev, known := "", true // the last stop and whether it was in the previous route
+	start := req.Start
+	for _, loc := range route[1 : len(route)-1] {
+		if loc.ID == start.ID && loc.Lat == start.Lat && loc.Lng == start.Lng {
+			continue
+		}
+		before, ok := after[loc.ID]
+		if !ok || seen[loc.ID] || !known || before != prev {
+			changed++
+		}
+		known = ok && !seen[loc.ID]
+		seen[loc.ID], prev = true, loc.ID
+	}
+	return changed
+}
@@ -0,0 +1,290 @@
+// Package stats keeps aggregate solver statistics for GET /stats: solves per solver
+// with their runtimes, sizes and improvement over the initial solution, and result
+// cache hit rates. They count from startup, or, when saved to a file, from the first
+// start that used it, for capacity planning and quality tracking without a metrics
+// stack.
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RecentSolves is how many of each solver's latest runtimes the percentiles are over
+const RecentSolves = 1000
+
+// Collector aggregates solve and cache statistics
+type Collector struct {
+	mu      sync.Mutex
+	since   time.Time
+	solvers map[string]*solverTotals
+	cache   map[string]*cacheTotals // by endpoint
+}
+
+// Default is the collector the service records into
+var Default = New()
+
+// New returns an empty collector counting from now
+func New() *Collector {
+	return &Collector{since: time.Now().UTC(), solvers: map[string]*solverTotals{}, cache: map[string]*cacheTotals{}}
+}
+
+// solverTotals and cacheTotals are also the saved form, so their fields are exported
+type solverTotals struct {
+	Solves          int64     `json:"solves"`
+	BudgetExhausted int64     `json:"budget_exhausted"`
+	SolveMs         float64   `json:"solve_ms"`
+	Stops           float64   `json:"stops"`
+	Improved        int64     `json:"improved"` // solves with an initial value to compare with
+	Improvement     float64   `json:"improvement"`
+	Recent          []float64 `json:"recent"` // runtimes in ms, a ring of RecentSolves
+	Next            int       `json:"next"`   // where the ring is written next
+}
+
+type cacheTotals struct {
+	Hit    int64 `json:"hit"`
+	Miss   int64 `json:"miss"`
+	Bypass int64 `json:"bypass"`
+}
+
+// RecordSolve adds a finished solve by solver of stops stops taking solveMs.
+// improvement is the relative improvement over the initial solution, NaN when there
+// was none to compare with.
+func (c *Collector) RecordSolve(solver string, stops int, solveMs, improvement float64, exhausted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.solvers[solver]
+	if s == nil {
+		s = &solverTotals{}
+		c.solvers[solver] = s
+	}
+	s.Solves++
+	s.SolveMs += solveMs
+	s.Stops += float64(stops)
+	if exhausted {
+		s.BudgetExhausted++
+	}
+	if !math.IsNaN(improvement) {
+		s.Improved++
+		s.Improvement += improvement
+	}
+	if len(s.Recent) < RecentSolves {
+		s.Recent = append(s.Recent, solveMs)
+	} else {
+		s.Recent[s.Next] = solveMs
+	}
+	s.Next = (s.Next + 1) % RecentSolves
+}
+
+// RecordCacheLookup adds a result cache lookup for endpoint with outcome hit, miss or
+// bypass
+func (c *Collector) RecordCacheLookup(endpoint, outcome string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.cache[endpoint]
+	if t == nil {
+		t = &cacheTotals{}
+		c.cache[endpoint] = t
+	}
+	switch outcome {
+	case "hit":
+		t.Hit++
+	case "miss":
+		t.Miss++
+	case "bypass":
+		t.Bypass++
+	}
+}
+
+// Report is the response of GET /stats
+type Report struct {
+	Since   time.Time      `json:"since"`
+	Solvers []SolverReport `json:"solvers"` // by name
+	Cache   []CacheReport  `json:"cache"`   // by endpoint
+}
+
+// SolverReport is one solver's statistics. The percentiles are over its latest
+// RecentSolves solves; the rest over all of them.
+type SolverReport struct {
+	Solver          string  `json:"solver"`
+	Solves          int64   `json:"solves"`
+	BudgetExhausted int64   `json:"budget_exhausted"`
+	MeanSolveMs     float64 `json:"mean_solve_ms"`
+	P50SolveMs      float64 `json:"p50_solve_ms"`
+	P90SolveMs      float64 `json:"p90_solve_ms"`
+	P99SolveMs      float64 `json:"p99_solve_ms"`
+	MeanStops       float64 `json:"mean_stops"`
+
+	// MeanImprovement is the mean relative objective improvement over the initial
+	// solution, of the solves that had one
+	MeanImprovement float64 `json:"mean_improvement"`
+}
+
+// CacheReport is the result cache lookups of one endpoint. HitRate is hits over hits
+// and misses; bypassed lookups don't count.
+type CacheReport struct {
+	Endpoint string  `json:"endpoint"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	Bypassed int64   `json:"bypassed"`
+	HitRate  float64 `json:"hit_rate"`
+}
+
+// Report returns the statistics so far
+func (c *Collector) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rep := Report{Since: c.since, Solvers: []SolverReport{}, Cache: []CacheReport{}}
+	for _, name := range sortedKeys(c.solvers) {
+		s := c.solvers[name]
+		sr := SolverReport{Solver: name, Solves: s.Solves, BudgetExhausted: s.BudgetExhausted}
+		if s.Solves > 0 {
+			sr.MeanSolveMs = s.SolveMs / float64(s.Solves)
+			sr.MeanStops = s.Stops / float64(s.Solves)
+		}
+		if s.Improved > 0 {
+			sr.MeanImprovement = s.Improvement / float64(s.Improved)
+		}
+		recent := slices.Sorted(slices.Values(s.Recent))
+		sr.P50SolveMs, sr.P90SolveMs, sr.P99SolveMs = percentile(recent, 0.5), percentile(recent, 0.9), percentile(recent, 0.99)
+		rep.Solvers = append(rep.Solvers, sr)
+	}
+	for _, endpoint := range sortedKeys(c.cache) {
+		t := c.cache[endpoint]
+		cr := CacheReport{Endpoint: endpoint, Hits: t.Hit, Misses: t.Miss, Bypassed: t.Bypass}
+		if n := t.Hit + t.Miss; n > 0 {
+			cr.HitRate = float64(t.Hit) / float64(n)
+		}
+		rep.Cache = append(rep.Cache, cr)
+	}
+	return rep
+}
+
+// Handler serves GET /stats
+func (c *Collector) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Report())
+	})
+}
+
+// percentile is the nearest-rank p-th percentile of sorted; 0 when it is empty
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// saved is the file form of a collector
+type saved struct {
+	Since   time.Time                `json:"since"`
+	Solvers map[string]*solverTotals `json:"solvers"`
+	Cache   map[string]*cacheTotals  `json:"cache"`
+}
+
+// Load replaces the collector's statistics with those saved in path; a missing file
+// leaves them as they are
+func (c *Collector) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var s saved
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s.Solvers == nil {
+		s.Solvers = map[string]*solverTotals{}
+	}
+	if s.Cache == nil {
+		s.Cache = map[string]*cacheTotals{}
+	}
+	for _, t := range s.Solvers {
+		if len(t.Recent) > RecentSolves {
+			t.Recent = t.Recent[:RecentSolves]
+		}
+		t.Next %= RecentSolves
+	}
+	c.mu.Lock()
+	c.since, c.solvers, c.cache = s.Since, s.Solvers, s.Cache
+	c.mu.Unlock()
+	return nil
+}
+
+// Save writes the collector's statistics to path, replacing it in one step
+func (c *Collector) Save(path string) error {
+	c.mu.Lock()
+	b, err := json.Marshal(saved{Since: c.since, Solvers: c.solvers, Cache: c.cache})
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", b, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Saver saves a collector to a file periodically and once more when closed
+type Saver struct {
+	c    *Collector
+	path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// SaveEvery saves c to path every interval until the returned saver is stopped
+func (c *Collector) SaveEvery(path string, interval time.Duration) *Saver {
+	s := &Saver{c: c, path: path, stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-tick.C:
+				if err := c.Save(path); err != nil {
+					slog.Error("saving solver statistics", "path", path, "error", err)
+				}
+			}
+		}
+	}()
+	return s
+}
+
+// Stop ends the periodic saves
+func (s *Saver) Stop() { close(s.stop) }
+
+// Wait waits for a save in progress to finish after Stop
+func (s *Saver) Wait() { <-s.done }
+
+// Close saves the statistics a last time
+func (s *Saver) Close() error { return s.c.Save(s.path) }
@@ -0,0 +1,108 @@
+// Package stopfile reads stop lists from CSV files, for the command-line tools
+package stopfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"milesconnect-optimization/internal/models"
+	"strconv"
+	"strings"
+)
+
+// List is a CSV file's stops in file order
+type List struct {
+	Stops     []models.Location
+	BestKnown float64 // from a "# best_known: <km>" comment; 0 when absent
+}
+
+// ReadCSV reads one stop per row. A header row names the columns: lat or latitude,
+// lng, lon or longitude, and optionally id or name. Without one the last two columns
+// are lat and lng, and a third before them is the ID. Lines starting with # are
+// comments.
+func ReadCSV(r io.Reader) (List, error) {
+	var list List
+	var body bytes.Buffer
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if comment, ok := strings.CutPrefix(strings.TrimSpace(line), "#"); ok {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(comment), "best_known:"); ok {
+				n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil || n <= 0 {
+					return List{}, fmt.Errorf("invalid best_known %q", strings.TrimSpace(v))
+				}
+				list.BestKnown = n
+			}
+			continue
+		}
+		body.WriteString(line)
+		body.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return List{}, err
+	}
+
+	cr := csv.NewReader(&body)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return List{}, err
+	}
+	if len(rows) == 0 {
+		return List{}, errors.New("no stops")
+	}
+
+	idCol, latCol, lngCol := len(rows[0])-3, len(rows[0])-2, len(rows[0])-1
+	if _, err := strconv.ParseFloat(strings.TrimSpace(rows[0][max(latCol, 0)]), 64); err != nil {
+		idCol, latCol, lngCol = -1, -1, -1
+		for i, name := range rows[0] {
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "id", "name":
+				idCol = i
+			case "lat", "latitude":
+				latCol = i
+			case "lng", "lon", "long", "longitude":
+				lngCol = i
+			}
+		}
+		rows = rows[1:]
+	}
+	if latCol < 0 || lngCol < 0 {
+		return List{}, errors.New("no lat and lng columns")
+	}
+
+	list.Stops = make([]models.Location, len(rows))
+	for i, row := range rows {
+		if max(latCol, lngCol, idCol) >= len(row) {
+			return List{}, fmt.Errorf("stop %d: missing columns", i+1)
+		}
+		lat, errLat := strconv.ParseFloat(strings.TrimSpace(row[latCol]), 64)
+		lng, errLng := strconv.ParseFloat(strings.TrimSpace(row[lngCol]), 64)
+		if err := errors.Join(errLat, errLng); err != nil {
+			return List{}, fmt.Errorf("stop %d: %w", i+1, err)
+		}
+		list.Stops[i] = models.Location{Lat: lat, Lng: lng}
+		if idCol >= 0 {
+			list.Stops[i].ID = strings.TrimSpace(row[idCol])
+		}
+	}
+	return list, nil
+}
+
+// Request is the /optimize request visiting the stops from the first one, back to it
+// when roundTrip is set or else ending at the last
+func (l List) Request(roundTrip bool) models.OptimizationRequest {
+	if len(l.Stops) == 0 {
+		return models.OptimizationRequest{}
+	}
+	req := models.OptimizationRequest{Start: l.Stops[0], End: l.Stops[0], Waypoints: l.Stops[1:]}
+	if !roundTrip && len(l.Stops) > 1 {
+		req.End, req.Waypoints = l.Stops[len(l.Stops)-1], l.Stops[1:len(l.Stops)-1]
+	}
+	return req
+}
@@ -0,0 +1,38 @@
+package tenant
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// Middleware resolves the request's tenant and enforces its rate limit.
+// It must run inside authentication so the authenticated client is known.
+func (r *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t := r.Get(r.identify(req.Context(), req.Header.Get))
+		if ok, wait := t.allow(); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "Tenant rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(WithTenant(req.Context(), t)))
+	})
+}
+
+// ServeHTTP handles GET /admin/tenants with every tenant's limits and usage
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"tenants": r.Snapshot()})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,225 @@
+// Package tenant identifies which customer a request belongs to and enforces that
+// customer's rate limit, concurrency cap and problem size limit, keeping usage
+// counters per tenant.
+package tenant
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"milesconnect-optimization/internal/logging"
+	"milesconnect-optimization/internal/middleware"
+)
+
+// Anonymous is the tenant of requests that carry no identity
+const Anonymous = "anonymous"
+
+// Limits caps one tenant's use of the shared instance; zero values mean unlimited
+type Limits struct {
+	RPS           float64 `json:"rps"`
+	Burst         int     `json:"burst"`
+	MaxConcurrent int     `json:"max_concurrent"` // solves running at once
+	MaxStops      int     `json:"max_stops"`      // waypoints or shipments per request
+}
+
+// Usage counts what a tenant has done since the process started
+type Usage struct {
+	Requests            int64     `json:"requests"`
+	RateLimited         int64     `json:"rate_limited"`
+	ConcurrencyRejected int64     `json:"concurrency_rejected"`
+	Solves              int64     `json:"solves"`
+	Stops               int64     `json:"stops"`
+	SolveMs             float64   `json:"solve_ms"`
+	InFlight            int       `json:"in_flight"`
+	LastSeen            time.Time `json:"last_seen"`
+}
+
+// Tenant is the per-customer state. Methods are safe on a nil *Tenant and do nothing,
+// so code paths without tenant middleware need no special casing.
+type Tenant struct {
+	Name    string
+	limiter *middleware.RateLimiter
+
+	mu     sync.Mutex
+	limits Limits
+	usage  Usage
+}
+
+// Limits returns the tenant's current limits
+func (t *Tenant) Limits() Limits {
+	if t == nil {
+		return Limits{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limits
+}
+
+// allow counts a request and takes a token from the tenant's bucket
+func (t *Tenant) allow() (bool, time.Duration) {
+	t.mu.Lock()
+	t.usage.Requests++
+	t.usage.LastSeen = time.Now()
+	t.mu.Unlock()
+
+	ok, wait := t.limiter.Allow(t.Name)
+	if !ok {
+		t.mu.Lock()
+		t.usage.RateLimited++
+		t.mu.Unlock()
+	}
+	return ok, wait
+}
+
+// Acquire takes one of the tenant's concurrent solve slots without waiting.
+// It returns false when the tenant is at its MaxConcurrent.
+func (t *Tenant) Acquire() (release func(), ok bool) {
+	if t == nil {
+		return func() {}, true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limits.MaxConcurrent > 0 && t.usage.InFlight >= t.limits.MaxConcurrent {
+		t.usage.ConcurrencyRejected++
+		return nil, false
+	}
+	t.usage.InFlight++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.usage.InFlight--
+			t.mu.Unlock()
+		})
+	}, true
+}
+
+// RecordSolve adds a finished solve to the tenant's usage
+func (t *Tenant) RecordSolve(stops int, solveMs float64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage.Solves++
+	t.usage.Stops += int64(stops)
+	t.usage.SolveMs += solveMs
+}
+
+// Status is a tenant's entry in the admin usage report
+type Status struct {
+	Tenant string `json:"tenant"`
+	Limits Limits `json:"limits"`
+	Usage  Usage  `json:"usage"`
+}
+
+func (t *Tenant) status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Status{Tenant: t.Name, Limits: t.limits, Usage: t.usage}
+}
+
+func (t *Tenant) setLimits(l Limits) {
+	t.mu.Lock()
+	t.limits = l
+	t.mu.Unlock()
+	t.limiter.SetLimits(l.RPS, l.Burst)
+}
+
+// Registry holds every tenant seen so far and the limits that apply to them
+type Registry struct {
+	mu        sync.Mutex
+	header    string
+	defaults  Limits
+	overrides map[string]Limits
+	tenants   map[string]*Tenant
+}
+
+// NewRegistry returns a registry with no limits
+func NewRegistry() *Registry {
+	return &Registry{tenants: map[string]*Tenant{}}
+}
+
+// Configure sets the header that names the tenant (empty disables it), the limits
+// for tenants without an override, and per-tenant overrides. Known tenants pick up
+// the new limits immediately.
+func (r *Registry) Configure(header string, defaults Limits, overrides map[string]Limits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.header, r.defaults, r.overrides = header, defaults, overrides
+	for name, t := range r.tenants {
+		t.setLimits(r.limitsFor(name))
+	}
+}
+
+func (r *Registry) limitsFor(name string) Limits {
+	if l, ok := r.overrides[name]; ok {
+		return l
+	}
+	return r.defaults
+}
+
+// Get returns the named tenant, creating it on first use
+func (r *Registry) Get(name string) *Tenant {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tenants[name]
+	if !ok {
+		l := r.limitsFor(name)
+		t = &Tenant{Name: name, limiter: middleware.NewRateLimiter(l.RPS, l.Burst), limits: l}
+		r.tenants[name] = t
+	}
+	return t
+}
+
+// Snapshot returns every tenant's limits and usage ordered by name
+func (r *Registry) Snapshot() []Status {
+	r.mu.Lock()
+	tenants := make([]*Tenant, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		tenants = append(tenants, t)
+	}
+	r.mu.Unlock()
+
+	out := make([]Status, len(tenants))
+	for i, t := range tenants {
+		out[i] = t.status()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tenant < out[j].Tenant })
+	return out
+}
+
+// identify names the tenant: the tenant header when configured and present (for
+// deployments behind a gateway that sets it), else the authenticated client
+func (r *Registry) identify(ctx context.Context, headerValue func(string) string) string {
+	r.mu.Lock()
+	header := r.header
+	r.mu.Unlock()
+	if header != "" {
+		if name := headerValue(header); name != "" {
+			return name
+		}
+	}
+	if client := middleware.ClientFrom(ctx); client != "" {
+		return client
+	}
+	return Anonymous
+}
+
+type tenantKey struct{}
+
+// WithTenant attaches t to ctx and the request's access log
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	logging.Annotate(ctx, slog.String("tenant", t.Name))
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// From returns the request's tenant, or nil outside the tenant middleware
+func From(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return t
+}
@@ -0,0 +1,200 @@
+// Package tracking keeps solved routes that are being driven, with what their drivers
+// have reported at each stop, so the stops still to visit can be re-timed and
+// re-optimized from where the vehicle is.
+package tracking
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"milesconnect-optimization/internal/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Stop statuses. A stop goes from Pending to Arrived, Completed or Failed, and from
+// Arrived to Completed or Failed; Completed and Failed are final.
+const (
+	Pending   = "pending"
+	Arrived   = "arrived"
+	Completed = "completed"
+	Failed    = "failed"
+)
+
+var (
+	// ErrNotFound is returned for unknown route IDs, and routes of another tenant
+	ErrNotFound = errors.New("tracking: route not found")
+	// ErrUnknownStop is returned by Report for a stop ID the route doesn't have
+	ErrUnknownStop = errors.New("tracking: route has no such stop")
+	// ErrFinalStatus is returned by Report for a stop already completed or failed
+	ErrFinalStatus = errors.New("tracking: stop has already been completed or failed")
+)
+
+// Route is a stored route and its progress
+type Route struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Stops     []Stop    `json:"stops"` // the deliveries in route order, without the start, end and reloads
+	// Position is the vehicle's last known position: the stop it last reported at, or
+	// where that report placed it, and the route's start before any
+	Position models.Location `json:"position"`
+	// Plan is the solved route as /optimize returned it
+	Plan models.OptimizationResponse `json:"plan"`
+
+	// Request is the checked /optimize request the route was solved for
+	Request models.OptimizationRequest `json:"-"`
+}
+
+// Stop is a delivery of a route and what its driver has reported
+type Stop struct {
+	Location    models.Location `json:"location"`
+	Status      string          `json:"status"`
+	ArrivedAt   *time.Time      `json:"arrived_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"` // when it was completed or failed
+	Reason      string          `json:"reason,omitempty"`       // why it failed
+}
+
+// Remaining are the stops still to visit, pending or arrived, in route order
+func (r Route) Remaining() []models.Location {
+	var left []models.Location
+	for _, s := range r.Stops {
+		if s.Status == Pending || s.Status == Arrived {
+			left = append(left, s.Location)
+		}
+	}
+	return left
+}
+
+// Report is what a driver reports at a stop
+type Report struct {
+	Status   string
+	Time     time.Time        // when it happened
+	Position *models.Location // where the vehicle is, when not at the stop
+	Reason   string           // for Failed
+}
+
+// New lays out resp, solved for req, as a route to track with every stop pending.
+// Returns to the start mid-route are reloads, not stops.
+func New(tenant string, req models.OptimizationRequest, resp models.OptimizationResponse) Route {
+	now := time.Now().UTC()
+	r := Route{Tenant: tenant, CreatedAt: now, UpdatedAt: now, Position: req.Start, Plan: resp, Request: req}
+	if len(resp.Route) > 2 {
+		for _, loc := range resp.Route[1 : len(resp.Route)-1] {
+			if loc.ID == req.Start.ID && loc.Lat == req.Start.Lat && loc.Lng == req.Start.Lng {
+				continue
+			}
+			r.Stops = append(r.Stops, Stop{Location: loc, Status: Pending})
+		}
+	}
+	return r
+}
+
+// Store keeps routes in memory, for ttl after their last update and at most max of
+// them, the least recently updated dropped first; zero disables either limit. It is
+// safe for concurrent use.
+type Store struct {
+	ttl time.Duration
+	max int
+
+	mu     sync.Mutex
+	routes map[string]Route
+}
+
+// NewStore returns an empty store
+func NewStore(ttl time.Duration, max int) *Store {
+	return &Store{ttl: ttl, max: max, routes: map[string]Route{}}
+}
+
+// Save stores r under a new ID and returns it with the ID set
+func (s *Store) Save(r Route) Route {
+	b := make([]byte, 16)
+	rand.Read(b)
+	r.ID = hex.EncodeToString(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes[r.ID] = r
+	s.evict(time.Now())
+	return r
+}
+
+// Get returns tenant's route with the given ID
+func (s *Store) Get(tenant, id string) (Route, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(tenant, id, time.Now())
+}
+
+// Report records rep at the stop with stopID on tenant's route id and returns the
+// route. Reporting the status a stop already has changes nothing, so reports can be
+// retried.
+func (s *Store) Report(tenant, id, stopID string, rep Report) (Route, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.get(tenant, id, time.Now())
+	if err != nil {
+		return Route{}, err
+	}
+	i := slices.IndexFunc(r.Stops, func(st Stop) bool { return st.Location.ID == stopID })
+	if i < 0 {
+		return Route{}, ErrUnknownStop
+	}
+	stop := r.Stops[i]
+	switch {
+	case stop.Status == rep.Status:
+		return r, nil
+	case stop.Status == Completed || stop.Status == Failed:
+		return Route{}, ErrFinalStatus
+	}
+
+	r.Stops = slices.Clone(r.Stops) // routes handed out keep theirs
+	at := rep.Time.UTC()
+	if rep.Status == Arrived {
+		stop.ArrivedAt = &at
+	} else {
+		stop.CompletedAt, stop.Reason = &at, rep.Reason
+	}
+	stop.Status = rep.Status
+	r.Stops[i] = stop
+	r.Position = stop.Location
+	if rep.Position != nil {
+		r.Position = *rep.Position
+	}
+	r.UpdatedAt = time.Now().UTC()
+	s.routes[id] = r
+	return r, nil
+}
+
+// get returns tenant's route id unless it has expired; the caller holds s.mu
+func (s *Store) get(tenant, id string, now time.Time) (Route, error) {
+	r, ok := s.routes[id]
+	if ok && s.ttl > 0 && now.Sub(r.UpdatedAt) > s.ttl {
+		delete(s.routes, id)
+		ok = false
+	}
+	if !ok || r.Tenant != tenant {
+		return Route{}, ErrNotFound
+	}
+	return r, nil
+}
+
+// evict drops expired routes, then the least recently updated beyond the limit; the
+// caller holds s.mu
+func (s *Store) evict(now time.Time) {
+	for id, r := range s.routes {
+		if s.ttl > 0 && now.Sub(r.UpdatedAt) > s.ttl {
+			delete(s.routes, id)
+		}
+	}
+	for s.max > 0 && len(s.routes) > s.max {
+		var oldest string
+		for id, r := range s.routes {
+			if oldest == "" || r.UpdatedAt.Before(s.routes[oldest].UpdatedAt) {
+				oldest = id
+			}
+		}
+		delete(s.routes, oldest)
+	}
+}
@@ -0,0 +1,242 @@
+// Package tsplib reads symmetric TSP instances in the TSPLIB format and measures tours
+// with the instance's own distance function, so results compare with published optima.
+package tsplib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"milesconnect-optimization/internal/models"
+	"strconv"
+	"strings"
+)
+
+// Edge weight types with node coordinates that Parse accepts
+const (
+	Euclidean = "EUC_2D"
+	Ceiling   = "CEIL_2D"
+	Geo       = "GEO"
+	Pseudo    = "ATT" // pseudo-Euclidean, used by att48 and att532
+)
+
+// Node is a city with its TSPLIB coordinates. For GEO instances X is the latitude and
+// Y the longitude, both in DDD.MM degrees and minutes.
+type Node struct {
+	ID   int
+	X, Y float64
+}
+
+// Problem is a parsed instance
+type Problem struct {
+	Name           string
+	Comment        string
+	EdgeWeightType string
+	Nodes          []Node // in file order
+}
+
+// Parse reads a TSP instance with a NODE_COORD_SECTION. Explicit weight matrices aren't
+// supported: the service routes on coordinates.
+func Parse(r io.Reader) (*Problem, error) {
+	p := &Problem{}
+	dimension := -1
+	inCoords := false
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		if text == "EOF" {
+			break
+		}
+		if inCoords {
+			fields := strings.Fields(text)
+			if len(fields) == 3 {
+				node, err := parseNode(fields)
+				if err != nil {
+					return nil, fmt.Errorf("tsplib: line %d: %w", line, err)
+				}
+				p.Nodes = append(p.Nodes, node)
+				continue
+			}
+			inCoords = false
+		}
+
+		key, value, _ := strings.Cut(text, ":")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "NAME":
+			p.Name = value
+		case "COMMENT":
+			p.Comment = strings.TrimSpace(p.Comment + " " + value)
+		case "TYPE":
+			if value != "TSP" {
+				return nil, fmt.Errorf("tsplib: unsupported problem type %q", value)
+			}
+		case "DIMENSION":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("tsplib: line %d: invalid dimension %q", line, value)
+			}
+			dimension = n
+		case "EDGE_WEIGHT_TYPE":
+			switch value {
+			case Euclidean, Ceiling, Geo, Pseudo:
+				p.EdgeWeightType = value
+			default:
+				return nil, fmt.Errorf("tsplib: unsupported edge weight type %q", value)
+			}
+		case "NODE_COORD_SECTION":
+			inCoords = true
+		case "DISPLAY_DATA_TYPE", "NODE_COORD_TYPE":
+		default:
+			return nil, fmt.Errorf("tsplib: line %d: unsupported entry %q", line, key)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("tsplib: %w", err)
+	}
+
+	switch {
+	case p.EdgeWeightType == "":
+		return nil, errors.New("tsplib: missing EDGE_WEIGHT_TYPE")
+	case len(p.Nodes) == 0:
+		return nil, errors.New("tsplib: missing NODE_COORD_SECTION")
+	case dimension >= 0 && dimension != len(p.Nodes):
+		return nil, fmt.Errorf("tsplib: DIMENSION is %d but %d nodes are listed", dimension, len(p.Nodes))
+	}
+	return p, nil
+}
+
+func parseNode(fields []string) (Node, error) {
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Node{}, fmt.Errorf("invalid node number %q", fields[0])
+	}
+	x, errX := strconv.ParseFloat(fields[1], 64)
+	y, errY := strconv.ParseFloat(fields[2], 64)
+	if errX != nil || errY != nil {
+		return Node{}, fmt.Errorf("invalid coordinates for node %d", id)
+	}
+	return Node{ID: id, X: x, Y: y}, nil
+}
+
+// Distance is the TSPLIB distance between nodes i and j, positions in Nodes. Like
+// every TSPLIB distance it is a whole number.
+func (p *Problem) Distance(i, j int) float64 {
+	a, b := p.Nodes[i], p.Nodes[j]
+	dx, dy := a.X-b.X, a.Y-b.Y
+	switch p.EdgeWeightType {
+	case Ceiling:
+		return math.Ceil(math.Sqrt(dx*dx + dy*dy))
+	case Geo:
+		latA, lngA := geoRadians(a.X), geoRadians(a.Y)
+		latB, lngB := geoRadians(b.X), geoRadians(b.Y)
+		q1 := math.Cos(lngA - lngB)
+		q2 := math.Cos(latA - latB)
+		q3 := math.Cos(latA + latB)
+		return math.Trunc(6378.388*math.Acos(0.5*((1+q1)*q2-(1-q1)*q3)) + 1)
+	case Pseudo:
+		r := math.Sqrt((dx*dx + dy*dy) / 10)
+		t := math.Round(r)
+		if t < r {
+			t++
+		}
+		return t
+	default:
+		return math.Round(math.Sqrt(dx*dx + dy*dy))
+	}
+}
+
+// geoRadians converts a GEO coordinate as the TSPLIB reference code does, with its
+// value of pi, so lengths match the published optima
+func geoRadians(v float64) float64 {
+	const pi = 3.141592
+	deg := math.Trunc(v)
+	return pi * (deg + 5*(v-deg)/3) / 180
+}
+
+// TourLength is the length of the closed tour visiting tour, positions in Nodes, in order
+func (p *Problem) TourLength(tour []int) float64 {
+	var total float64
+	for k := range tour {
+		total += p.Distance(tour[k], tour[(k+1)%len(tour)])
+	}
+	return total
+}
+
+// Locations places the nodes on the map, each with its position in Nodes as ID. GEO
+// nodes keep their coordinates. Planar ones are scaled into a square degree at (0, 0),
+// small enough that great-circle distances there are proportional to planar ones.
+func (p *Problem) Locations() []models.Location {
+	locs := make([]models.Location, len(p.Nodes))
+	if p.EdgeWeightType == Geo {
+		for i, n := range p.Nodes {
+			locs[i] = models.Location{ID: strconv.Itoa(i), Lat: geoDegrees(n.X), Lng: geoDegrees(n.Y)}
+		}
+		return locs
+	}
+	minX, maxX, minY, maxY := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, n := range p.Nodes {
+		minX, maxX = min(minX, n.X), max(maxX, n.X)
+		minY, maxY = min(minY, n.Y), max(maxY, n.Y)
+	}
+	scale := 1.0
+	if extent := max(maxX-minX, maxY-minY); extent > 0 {
+		scale = 1 / extent
+	}
+	for i, n := range p.Nodes {
+		locs[i] = models.Location{ID: strconv.Itoa(i), Lat: (n.Y - minY) * scale, Lng: (n.X - minX) * scale}
+	}
+	return locs
+}
+
+// Request is the /optimize request for the instance: a round trip from its first node
+// through the others, with every other setting left to the server
+func (p *Problem) Request() models.OptimizationRequest {
+	locs := p.Locations()
+	return models.OptimizationRequest{Start: locs[0], End: locs[0], Waypoints: locs[1:]}
+}
+
+// Tour is the closed tour of route, a route for Request, as positions in Nodes. ok is
+// false unless the route visits every node once.
+func (p *Problem) Tour(route []models.Location) (tour []int, ok bool) {
+	if len(route) < 2 {
+		return nil, false
+	}
+	seen := make([]bool, len(p.Nodes))
+	for _, loc := range route[:len(route)-1] {
+		i, err := strconv.Atoi(loc.ID)
+		if err != nil || i < 0 || i >= len(p.Nodes) || seen[i] {
+			return nil, false
+		}
+		seen[i] = true
+		tour = append(tour, i)
+	}
+	return tour, len(tour) == len(p.Nodes)
+}
+
+func geoDegrees(v float64) float64 {
+	deg := math.Trunc(v)
+	return deg + 5*(v-deg)/3
+}
+
+// bestKnown are the published optimal tour lengths of TSPLIB instances Parse accepts
+var bestKnown = map[string]float64{
+	"a280": 2579, "ali535": 202339, "att48": 10628, "att532": 27686, "berlin52": 7542,
+	"bier127": 118282, "burma14": 3323, "ch130": 6110, "ch150": 6528, "d198": 15780,
+	"dsj1000": 18659688, "eil51": 426, "eil76": 538, "eil101": 629, "gr96": 55209,
+	"gr137": 69853, "gr202": 40160, "gr229": 134602, "gr431": 171414, "gr666": 294358,
+	"kroA100": 21282, "kroB100": 22141, "kroC100": 20749, "kroD100": 21294, "kroE100": 22068,
+	"kroA150": 26524, "kroA200": 29368, "lin105": 14379, "pcb442": 50778, "pr76": 108159,
+	"pr1002": 259045, "pr2392": 378032, "rat99": 1211, "st70": 675, "ts225": 126643,
+	"tsp225": 3916, "ulysses16": 6859, "ulysses22": 7013,
+}
+
+// BestKnown returns the published optimal tour length of the named instance
+func BestKnown(name string) (float64, bool) {
+	v, ok := bestKnown[name]
+	return v, ok
+}
@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"fmt"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+)
+
+// ApplyDuplicates enforces the request's duplicate handling mode on its waypoints.
+// In merge mode each group of duplicates collapses into its first occurrence, which
+// keeps the IDs of every folded stop in MergedIDs and their demand added up, which must
+// still fit a vehicle that reloads. In reject mode every duplicate is reported as a
+// field error.
+func ApplyDuplicates(req models.OptimizationRequest) (models.OptimizationRequest, Errors) {
+	mode := req.Duplicates.Mode
+	if mode == "" || mode == models.DuplicatesKeep {
+		return req, nil
+	}
+
+	radiusKm := req.Duplicates.RadiusM / 1000
+	absorbed := make([]bool, len(req.Waypoints))
+	kept := make([]models.Location, 0, len(req.Waypoints))
+	var errs Errors
+	points := geo.Prepare(req.Waypoints)
+	dist := make([]float64, len(points))
+
+	for i, anchor := range req.Waypoints {
+		if absorbed[i] {
+			continue
+		}
+
+		var ids []string
+		merged := false
+		points.KmFrom(i, points[i+1:], dist)
+		for j := i + 1; j < len(req.Waypoints); j++ {
+			if absorbed[j] || dist[j-i-1] > radiusKm {
+				continue
+			}
+			absorbed[j] = true
+
+			if mode == models.DuplicatesReject {
+				errs.add(fmt.Sprintf("waypoints[%d]", j), "duplicates waypoints[%d]", i)
+				continue
+			}
+			if !merged {
+				merged = true
+				ids = appendID(ids, anchor.ID)
+				ids = append(ids, anchor.MergedIDs...)
+			}
+			ids = appendID(ids, req.Waypoints[j].ID)
+			ids = append(ids, req.Waypoints[j].MergedIDs...)
+			anchor.DemandKg += req.Waypoints[j].DemandKg
+		}
+
+		if merged {
+			anchor.MergedIDs = ids
+			if c := req.VehicleCapacityKg; c > 0 && anchor.DemandKg > c {
+				errs.add(fmt.Sprintf("waypoints[%d].demand_kg", i), "exceeds vehicle_capacity_kg with the duplicates merged into it")
+			}
+		}
+		kept = append(kept, anchor)
+	}
+
+	if len(errs) > 0 {
+		return req, errs
+	}
+
+	req.Waypoints = kept
+	return req, nil
+}
+
+func appendID(ids []string, id string) []string {
+	if id == "" {
+		return ids
+	}
+	return append(ids, id)
+}
@@ -0,0 +1,176 @@
+package validation
+
+import (
+	"fmt"
+	"milesconnect-optimization/internal/models"
+)
+
+// Diagnostic severities
+const (
+	SeverityError   = "error"   // the solver cannot produce a meaningful result
+	SeverityWarning = "warning" // the solver will run but part of the request will be dropped
+	SeverityInfo    = "info"
+)
+
+// Diagnostic is a feasibility finding reported by a dry run
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Report is the outcome of a dry-run check: field errors plus feasibility diagnostics
+type Report struct {
+	Valid       bool         `json:"valid"`
+	Errors      Errors       `json:"errors,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+func newReport(errs Errors, diags []Diagnostic) Report {
+	valid := len(errs) == 0
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			valid = false
+		}
+	}
+	return Report{Valid: valid, Errors: errs, Diagnostics: diags}
+}
+
+// CheckOptimizationRequest validates a route request and reports what the solver would do with it
+func CheckOptimizationRequest(req models.OptimizationRequest) Report {
+	errs := OptimizationRequest(req)
+	if len(errs) > 0 {
+		return newReport(errs, nil)
+	}
+
+	var diags []Diagnostic
+	merged, dupErrs := ApplyDuplicates(req)
+	errs = append(errs, dupErrs...)
+
+	if n := len(req.Waypoints) - len(merged.Waypoints); n > 0 {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityInfo,
+			Code:     "waypoints_merged",
+			Field:    "waypoints",
+			Message:  fmt.Sprintf("%d duplicate waypoints would be merged", n),
+		})
+	}
+	if len(req.Waypoints) == 0 {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityInfo,
+			Code:     "no_waypoints",
+			Field:    "waypoints",
+			Message:  "route contains only start and end",
+		})
+	}
+
+	return newReport(errs, diags)
+}
+
+// CheckLoadRequest validates a load request and checks capacity against shipment weights
+func CheckLoadRequest(req models.LoadRequest) Report {
+	errs := LoadRequest(req)
+	if len(errs) > 0 {
+		return newReport(errs, nil)
+	}
+
+	var diags []Diagnostic
+	if len(req.Vehicles) == 0 {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError,
+			Code:     "no_vehicles",
+			Field:    "vehicles",
+			Message:  "at least one vehicle is required",
+		})
+	}
+
+	diags = append(diags, duplicateIDs("vehicles", vehicleIDs(req.Vehicles))...)
+	diags = append(diags, duplicateIDs("shipments", shipmentIDs(req.Shipments))...)
+
+	freeCapacity := 0.0
+	largestFree := 0.0
+	for _, v := range req.Vehicles {
+		free := v.CapacityKg - v.CurrentLoad
+		if free < 0 {
+			free = 0
+		}
+		freeCapacity += free
+		if free > largestFree {
+			largestFree = free
+		}
+	}
+
+	compartments := map[string]bool{}
+	for _, v := range req.Vehicles {
+		for _, c := range v.Compartments {
+			compartments[c.Name] = true
+		}
+	}
+
+	totalWeight := 0.0
+	for i, s := range req.Shipments {
+		totalWeight += s.WeightKg
+		if s.Compartment != "" && !compartments[s.Compartment] {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "no_compartment",
+				Field:    fmt.Sprintf("shipments[%d].compartment", i),
+				Message:  fmt.Sprintf("no vehicle has a %q compartment", s.Compartment),
+			})
+		}
+		if len(req.Vehicles) > 0 && s.WeightKg > largestFree {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "shipment_exceeds_capacity",
+				Field:    fmt.Sprintf("shipments[%d].weight_kg", i),
+				Message:  fmt.Sprintf("%.2f kg exceeds the largest free capacity of %.2f kg", s.WeightKg, largestFree),
+			})
+		}
+	}
+
+	if len(req.Vehicles) > 0 && totalWeight > freeCapacity {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     "insufficient_capacity",
+			Field:    "shipments",
+			Message:  fmt.Sprintf("total weight %.2f kg exceeds free fleet capacity %.2f kg", totalWeight, freeCapacity),
+		})
+	}
+
+	return newReport(errs, diags)
+}
+
+func duplicateIDs(field string, ids []string) []Diagnostic {
+	var diags []Diagnostic
+	seen := make(map[string]int, len(ids))
+	for i, id := range ids {
+		if first, ok := seen[id]; ok {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "duplicate_id",
+				Field:    fmt.Sprintf("%s[%d].id", field, i),
+				Message:  fmt.Sprintf("id %q already used by %s[%d]", id, field, first),
+			})
+			continue
+		}
+		seen[id] = i
+	}
+	return diags
+}
+
+func vehicleIDs(vehicles []models.VehicleInfo) []string {
+	ids := make([]string, len(vehicles))
+	for i, v := range vehicles {
+		ids[i] = v.ID
+	}
+	return ids
+}
+
+func shipmentIDs(shipments []models.ShipmentInfo) []string {
+	ids := make([]string, len(shipments))
+	for i, s := range shipments {
+		ids[i] = s.ID
+	}
+	return ids
+}
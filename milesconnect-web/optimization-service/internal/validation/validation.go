@@ -0,0 +1,801 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/priority"
+	"milesconnect-optimization/internal/schedule"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/solvers"
+	"milesconnect-optimization/internal/weather"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FieldError describes a problem with a single request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects every field error found in a request
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (e *Errors) add(field, format string, args ...any) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// OptimizationRequest checks coordinates, duplicate settings and scheduling input of a
+// route request
+func OptimizationRequest(req models.OptimizationRequest) Errors {
+	var errs Errors
+
+	checkLocation(&errs, "start", req.Start)
+	checkLocation(&errs, "end", req.End)
+	for i, wp := range req.Waypoints {
+		checkLocation(&errs, fmt.Sprintf("waypoints[%d]", i), wp)
+	}
+
+	switch req.Duplicates.Mode {
+	case "", models.DuplicatesKeep, models.DuplicatesMerge, models.DuplicatesReject:
+	default:
+		errs.add("duplicates.mode", "must be one of %q, %q or %q",
+			models.DuplicatesKeep, models.DuplicatesMerge, models.DuplicatesReject)
+	}
+	if r := req.Duplicates.RadiusM; !isFinite(r) || r < 0 {
+		errs.add("duplicates.radius_m", "must be a non-negative number")
+	}
+	stops := []namedStop{{"start", req.Start}, {"end", req.End}}
+	for i, wp := range req.Waypoints {
+		stops = append(stops, namedStop{fmt.Sprintf("waypoints[%d]", i), wp})
+	}
+	checkSchedule(&errs, req, stops)
+	checkTierPenalties(&errs, req.TierPenalties)
+	checkWeather(&errs, req.Weather)
+	checkObjective(&errs, req.Objective)
+	checkCurrency(&errs, req.Currency)
+	if !isFinite(req.EmissionsKgPerKm) || req.EmissionsKgPerKm < 0 {
+		errs.add("emissions_kg_per_km", "must not be negative")
+	}
+	if req.Solver != "" {
+		if _, ok := solvers.Route(req.Solver, solvers.Options{}); !ok {
+			errs.add("solver", "unknown solver; must be one of %s", strings.Join(solvers.RouteNames(), ", "))
+		}
+	}
+	checkReloads(&errs, req)
+	checkOrderRules(&errs, req.Waypoints)
+	checkPreviousRoute(&errs, req)
+	errs = append(errs, SolverParams(req.SolverParams, models.SolverParams{})...)
+	if r := req.MaxRangeKm; !isFinite(r) || r < 0 {
+		errs.add("max_range_km", "must not be negative")
+	} else if r > 0 && geo.HaversineKm(req.Start, req.End) > r {
+		errs.add("max_range_km", "is less than the distance from start to end")
+	}
+
+	return errs
+}
+
+// checkOrderRules checks the waypoints' unload priorities and that their after lists
+// name other waypoints
+func checkOrderRules(errs *Errors, waypoints []models.Location) {
+	ids := make(map[string]bool, len(waypoints))
+	for _, wp := range waypoints {
+		ids[wp.ID] = wp.ID != ""
+	}
+	for i, wp := range waypoints {
+		field := fmt.Sprintf("waypoints[%d]", i)
+		if wp.UnloadPriority < 0 {
+			errs.add(field+".unload_priority", "must not be negative")
+		}
+		for j, id := range wp.After {
+			switch {
+			case id == wp.ID && id != "":
+				errs.add(fmt.Sprintf("%s.after[%d]", field, j), "is the waypoint's own id")
+			case !ids[id]:
+				errs.add(fmt.Sprintf("%s.after[%d]", field, j), "no waypoint has id %q", id)
+			}
+		}
+	}
+}
+
+// checkPreviousRoute checks the IDs of a previous and an initial route are given once
+// each and the stability threshold is a percentage. IDs no waypoint has are stops since
+// dropped, not errors.
+func checkPreviousRoute(errs *Errors, req models.OptimizationRequest) {
+	checkRouteIDs(errs, "previous_route", "previous", req.PreviousRoute)
+	checkRouteIDs(errs, "initial_route", "initial", req.InitialRoute)
+	if t := req.StabilityThresholdPct; !isFinite(t) || t < 0 || t > 100 {
+		errs.add("stability_threshold_pct", "must be between 0 and 100")
+	}
+}
+
+func checkRouteIDs(errs *Errors, field, name string, ids []string) {
+	seen := make(map[string]bool, len(ids))
+	for i, id := range ids {
+		switch {
+		case id == "":
+			errs.add(fmt.Sprintf("%s[%d]", field, i), "must not be empty")
+		case seen[id]:
+			errs.add(fmt.Sprintf("%s[%d]", field, i), "%q is already in the %s route", id, name)
+		}
+		seen[id] = true
+	}
+}
+
+// checkReloads checks the capacity input of a route that reloads: every waypoint's
+// demand must fit in the vehicle on its own
+func checkReloads(errs *Errors, req models.OptimizationRequest) {
+	capacity := req.VehicleCapacityKg
+	if !isFinite(capacity) || capacity < 0 {
+		errs.add("vehicle_capacity_kg", "must not be negative")
+		capacity = 0
+	}
+	if !isFinite(req.ReloadMinutes) || req.ReloadMinutes < 0 {
+		errs.add("reload_minutes", "must not be negative")
+	}
+	for i, wp := range req.Waypoints {
+		field := fmt.Sprintf("waypoints[%d].demand_kg", i)
+		switch {
+		case !isFinite(wp.DemandKg) || wp.DemandKg < 0:
+			errs.add(field, "must not be negative")
+		case capacity > 0 && wp.DemandKg > capacity:
+			errs.add(field, "exceeds vehicle_capacity_kg")
+		}
+	}
+}
+
+// ETARequest checks the route, position and completed stops of an ETA request, and its
+// scheduling input as OptimizationRequest does
+func ETARequest(req models.ETARequest) Errors {
+	var errs Errors
+
+	checkLocation(&errs, "position", req.Position)
+	var stops []namedStop
+	ids := map[string]int{}
+	for i, loc := range req.Route {
+		field := fmt.Sprintf("route[%d]", i)
+		checkLocation(&errs, field, loc)
+		stops = append(stops, namedStop{field, loc})
+		ids[loc.ID]++
+	}
+	// A stop ID may be completed as many times as the route visits it
+	for i, id := range req.Completed {
+		if ids[id] == 0 {
+			errs.add(fmt.Sprintf("completed[%d]", i), "no route stop left with id %q", id)
+			continue
+		}
+		ids[id]--
+	}
+
+	if req.DepartureTime == "" {
+		errs.add("departure_time", "is required")
+	} else {
+		checkSchedule(&errs, models.OptimizationRequest{DepartureTime: req.DepartureTime, Timezone: req.Timezone, SpeedKmh: req.SpeedKmh, HolidayCalendars: req.HolidayCalendars, HolidayCalendar: req.HolidayCalendar, SpeedClasses: req.SpeedClasses,
+			LatenessRisk: req.LatenessRisk, TravelTimeCV: req.TravelTimeCV}, stops)
+	}
+	checkWeather(&errs, req.Weather)
+
+	return errs
+}
+
+func checkWeather(errs *Errors, regions []models.WeatherRegion) {
+	for i, r := range regions {
+		field := fmt.Sprintf("weather[%d]", i)
+		checkLocation(errs, field, models.Location{Lat: r.Lat, Lng: r.Lng})
+		if !isFinite(r.RadiusKm) || r.RadiusKm <= 0 {
+			errs.add(field+".radius_km", "must be positive")
+		}
+		if !weather.Valid(r.Severity) {
+			errs.add(field+".severity", "must be one of %s", strings.Join(weather.Severities, ", "))
+		}
+	}
+}
+
+func checkTier(errs *Errors, field, tier string) {
+	if !priority.Valid(tier) {
+		errs.add(field, "must be one of %s", strings.Join(priority.Tiers, ", "))
+	}
+}
+
+func checkTierPenalties(errs *Errors, penalties map[string]models.TierPenalty) {
+	for _, tier := range slices.Sorted(maps.Keys(penalties)) {
+		field := "tier_penalties." + tier
+		if tier == "" || !priority.Valid(tier) {
+			errs.add(field, "unknown tier; must be one of %s", strings.Join(priority.Tiers, ", "))
+			continue
+		}
+		p := penalties[tier]
+		if !isFinite(p.LatePerMinute) || p.LatePerMinute < 0 {
+			errs.add(field+".late_per_minute", "must not be negative")
+		}
+		if !isFinite(p.Unserved) || p.Unserved < 0 {
+			errs.add(field+".unserved", "must not be negative")
+		}
+	}
+}
+
+// namedStop is a location to check, with the request field it came from
+type namedStop struct {
+	field string
+	loc   models.Location
+}
+
+// checkSchedule checks req's departure time and timezone, and the tiers, service times,
+// timezones and time windows of stops, which must parse in their timezones
+func checkSchedule(errs *Errors, req models.OptimizationRequest, stops []namedStop) {
+	if req.SpeedKmh != 0 && !(isFinite(req.SpeedKmh) && req.SpeedKmh >= 1) {
+		errs.add("average_speed_kmh", "must be at least 1")
+	}
+	if req.SpeedKmh != 0 && len(req.SpeedClasses) > 0 {
+		errs.add("speed_classes", "must not be set with average_speed_kmh")
+	}
+	for i, c := range req.SpeedClasses {
+		field := fmt.Sprintf("speed_classes[%d]", i)
+		if !(isFinite(c.SpeedKmh) && c.SpeedKmh >= 1) {
+			errs.add(field+".speed_kmh", "must be at least 1")
+		}
+		switch {
+		case !isFinite(c.UpToKm) || c.UpToKm < 0:
+			errs.add(field+".up_to_km", "must not be negative")
+		case c.UpToKm == 0 && i < len(req.SpeedClasses)-1:
+			errs.add(field+".up_to_km", "may only be left out on the last class")
+		case c.UpToKm > 0 && i > 0 && c.UpToKm <= req.SpeedClasses[i-1].UpToKm:
+			errs.add(field+".up_to_km", "must be greater than the previous class's")
+		}
+	}
+	if cv := req.TravelTimeCV; !isFinite(cv) || cv < 0 || cv > 1 {
+		errs.add("travel_time_cv", "must be between 0 and 1")
+	}
+	if req.LatenessRisk && req.DepartureTime == "" {
+		errs.add("lateness_risk", "needs departure_time")
+	}
+	plan, ok, err := schedule.NewPlan(req)
+	var fe *schedule.FieldError
+	if errors.As(err, &fe) {
+		errs.add(fe.Field, "%s", fe.Err)
+		return
+	}
+	if !ok && req.Timezone != "" {
+		if _, err := schedule.Zone(req.Timezone); err != nil {
+			errs.add("timezone", "%s", err)
+		}
+	}
+	check := func(field string, loc models.Location) {
+		checkTier(errs, field+".tier", loc.Tier)
+		if !isFinite(loc.ServiceMinutes) || loc.ServiceMinutes < 0 {
+			errs.add(field+".service_minutes", "must not be negative")
+		}
+		if loc.Timezone != "" {
+			if _, err := schedule.Zone(loc.Timezone); err != nil {
+				errs.add(field+".timezone", "%s", err)
+				return
+			}
+		}
+		if !ok {
+			if loc.TimeWindow != nil {
+				errs.add(field+".time_window", "needs departure_time")
+			}
+			if len(loc.OpeningHours) > 0 {
+				errs.add(field+".opening_hours", "needs departure_time")
+			}
+			return
+		}
+		if _, _, err := plan.Window(loc); errors.As(err, &fe) {
+			errs.add(field+"."+fe.Field, "%s", fe.Err)
+		}
+		if err := plan.Hours(loc); errors.As(err, &fe) {
+			errs.add(field+"."+fe.Field, "%s", fe.Err)
+		}
+	}
+	for _, s := range stops {
+		check(s.field, s.loc)
+	}
+}
+
+// TrackedRoute checks that the waypoints of req, a request to store as a tracked route,
+// can be reported on: each needs an ID of its own
+func TrackedRoute(req models.OptimizationRequest) Errors {
+	var errs Errors
+	seen := map[string]int{}
+	for i, wp := range req.Waypoints {
+		field := fmt.Sprintf("waypoints[%d].id", i)
+		if wp.ID == "" {
+			errs.add(field, "is required to track the route")
+			continue
+		}
+		if j, ok := seen[wp.ID]; ok {
+			errs.add(field, "duplicates waypoints[%d].id; tracked stops need distinct IDs", j)
+			continue
+		}
+		seen[wp.ID] = i
+	}
+	return errs
+}
+
+// StopReport checks a driver's report at a tracked stop
+func StopReport(rep models.StopReport) Errors {
+	var errs Errors
+	switch rep.Status {
+	case "arrived", "completed", "failed":
+	default:
+		errs.add("status", "must be arrived, completed or failed")
+	}
+	if rep.Time != "" {
+		if _, err := time.Parse(time.RFC3339, rep.Time); err != nil {
+			errs.add("time", "must be an RFC 3339 time")
+		}
+	}
+	if rep.Position != nil {
+		checkLocation(&errs, "position", *rep.Position)
+	}
+	if rep.Reason != "" && rep.Status != "failed" {
+		errs.add("reason", "only applies to failed stops")
+	}
+	return errs
+}
+
+// LoadRequest checks vehicle capacities and shipment weights of a load request
+func LoadRequest(req models.LoadRequest) Errors {
+	var errs Errors
+
+	for i, v := range req.Vehicles {
+		checkVehicle(&errs, fmt.Sprintf("vehicles[%d]", i), v)
+	}
+
+	for i, s := range req.Shipments {
+		errs = append(errs, Shipment(fmt.Sprintf("shipments[%d]", i), s)...)
+	}
+	checkTierPenalties(&errs, req.TierPenalties)
+	checkObjective(&errs, req.Objective)
+	checkCurrency(&errs, req.Currency)
+	switch r := req.GroupRadiusKm; {
+	case !isFinite(r) || r < 0:
+		errs.add("group_radius_km", "must not be negative")
+	case r > 0 && !req.GroupByDestination:
+		errs.add("group_radius_km", "needs group_by_destination")
+	}
+	if p := req.SolverParams; p != nil {
+		errs = append(errs, SolverParams(p, models.SolverParams{})...)
+		if p.MaxIterations != 0 {
+			errs.add("solver_params.max_iterations", "doesn't apply to fleet allocation")
+		}
+		if p.Neighborhood != 0 {
+			errs.add("solver_params.neighborhood", "doesn't apply to fleet allocation")
+		}
+	}
+
+	return errs
+}
+
+// ScenarioRequest checks a scenario's baseline as LoadRequest does, and its changes:
+// removed vehicles must be in the fleet, added ones must not, and demand can't drop by
+// 100% or more
+func ScenarioRequest(req models.ScenarioRequest) Errors {
+	errs := LoadRequest(req.LoadRequest)
+
+	fleet := map[string]bool{}
+	for _, v := range req.Vehicles {
+		fleet[v.ID] = true
+	}
+	for i, id := range req.Changes.RemoveVehicles {
+		if !fleet[id] {
+			errs.add(fmt.Sprintf("changes.remove_vehicles[%d]", i), "no vehicle %q in the fleet", id)
+			continue
+		}
+		delete(fleet, id)
+	}
+	for i, v := range req.Changes.AddVehicles {
+		field := fmt.Sprintf("changes.add_vehicles[%d]", i)
+		checkVehicle(&errs, field, v)
+		if fleet[v.ID] {
+			errs.add(field+".id", "vehicle %q is already in the fleet", v.ID)
+		}
+		fleet[v.ID] = true
+	}
+	if p := req.Changes.DemandPct; !isFinite(p) || p <= -100 {
+		errs.add("changes.demand_pct", "must be greater than -100")
+	}
+
+	return errs
+}
+
+// LoadDiffRequest checks that both allocations are given, and that neither loads a
+// vehicle twice
+func LoadDiffRequest(req models.LoadDiffRequest) Errors {
+	var errs Errors
+	for _, side := range []struct {
+		field string
+		resp  models.LoadResponse
+	}{{"baseline", req.Baseline}, {"scenario", req.Scenario}} {
+		if side.resp.Allocations == nil && side.resp.Unassigned == nil {
+			errs.add(side.field, "is required")
+			continue
+		}
+		seen := map[string]bool{}
+		for i, a := range side.resp.Allocations {
+			if seen[a.VehicleID] {
+				errs.add(fmt.Sprintf("%s.allocations[%d].vehicle_id", side.field, i), "vehicle %q is allocated twice", a.VehicleID)
+			}
+			seen[a.VehicleID] = true
+		}
+	}
+	return errs
+}
+
+// CrossDockRequest checks a cross-dock assignment: positive weights and capacities,
+// destinations, non-negative doors and times that parse, with each trailer docking by
+// its departure. Trailer IDs name the trailers in the response, so they must be unique.
+func CrossDockRequest(req models.CrossDockRequest) Errors {
+	var errs Errors
+
+	zone, err := schedule.Zone(req.Timezone)
+	if err != nil {
+		errs.add("timezone", "%s", err)
+	}
+	parse := func(field, s string) (time.Time, bool) {
+		if zone == nil {
+			return time.Time{}, false
+		}
+		t, err := schedule.ParseTime(s, zone, time.Time{})
+		if err != nil {
+			errs.add(field, "%s", err)
+			return time.Time{}, false
+		}
+		return t, true
+	}
+	if !isFinite(req.HandlingMinutes) || req.HandlingMinutes < 0 {
+		errs.add("handling_minutes", "must not be negative")
+	}
+
+	for i, s := range req.Inbound {
+		field := fmt.Sprintf("inbound[%d]", i)
+		errs = append(errs, InboundShipment(field, s)...)
+		if s.ReadyTime != "" {
+			parse(field+".ready_time", s.ReadyTime)
+		}
+	}
+
+	ids := map[string]bool{}
+	for i, t := range req.Trailers {
+		field := fmt.Sprintf("trailers[%d]", i)
+		if ids[t.ID] {
+			errs.add(field+".id", "duplicate trailer id %q", t.ID)
+		}
+		ids[t.ID] = true
+		checkVehicle(&errs, field, models.VehicleInfo{CapacityKg: t.CapacityKg, CurrentLoad: t.CurrentLoad})
+		if t.Destination == "" {
+			errs.add(field+".destination", "is required")
+		}
+		if t.Door < 0 {
+			errs.add(field+".door", "must not be negative")
+		}
+		if t.Departure == "" {
+			errs.add(field+".departure", "is required")
+			continue
+		}
+		departs, ok := parse(field+".departure", t.Departure)
+		if t.DockTime == "" {
+			continue
+		}
+		if docks, ok2 := parse(field+".dock_time", t.DockTime); ok && ok2 && docks.After(departs) {
+			errs.add(field+".dock_time", "must not be after departure")
+		}
+	}
+
+	return errs
+}
+
+// DayPlanRequest checks a delivery day plan: weekday names, each used once in days,
+// customers that take deliveries on one of the days planned and zones whose customers
+// share such a day
+func DayPlanRequest(req models.DayPlanRequest) Errors {
+	var errs Errors
+
+	days := req.Days
+	if len(days) == 0 {
+		days = solver.DefaultDeliveryDays
+	}
+	seen := map[string]bool{}
+	for i, d := range req.Days {
+		field := fmt.Sprintf("days[%d]", i)
+		switch {
+		case !slices.Contains(solver.Weekdays, d):
+			errs.add(field, "must be one of %s", strings.Join(solver.Weekdays, ", "))
+		case seen[d]:
+			errs.add(field, "duplicate day %q", d)
+		}
+		seen[d] = true
+	}
+	if !isFinite(req.BalanceWeight) || req.BalanceWeight < 0 {
+		errs.add("balance_weight", "must not be negative")
+	}
+
+	zones := map[string][]string{} // zone -> the days all its customers so far take
+	for i, c := range req.Customers {
+		field := fmt.Sprintf("customers[%d]", i)
+		checkLocation(&errs, field, c.Location)
+		if !isFinite(c.Workload) || c.Workload < 0 {
+			errs.add(field+".workload", "must not be negative")
+		}
+		open := slices.Clone(days)
+		for k, d := range c.Days {
+			if !slices.Contains(solver.Weekdays, d) {
+				errs.add(fmt.Sprintf("%s.days[%d]", field, k), "must be one of %s", strings.Join(solver.Weekdays, ", "))
+			}
+		}
+		if len(c.Days) > 0 {
+			open = slices.DeleteFunc(open, func(d string) bool { return !slices.Contains(c.Days, d) })
+		}
+		if len(open) == 0 {
+			errs.add(field+".days", "takes none of the days planned")
+			continue
+		}
+		if c.Zone == "" {
+			continue
+		}
+		if prev, ok := zones[c.Zone]; ok {
+			open = slices.DeleteFunc(open, func(d string) bool { return !slices.Contains(prev, d) })
+			if len(open) == 0 {
+				errs.add(field+".days", "no day in common with the other customers of zone %q", c.Zone)
+				continue
+			}
+		}
+		zones[c.Zone] = open
+	}
+
+	return errs
+}
+
+// SimulationRequest checks a simulation's configurations, each like the solver options
+// of a route and an allocation, and its days: their fleets and shipments as LoadRequest
+// checks them, every shipment with an ID of its own and a destination, and the depot,
+// departure time and destinations as OptimizationRequest checks a route's
+func SimulationRequest(req models.SimulationRequest) Errors {
+	var errs Errors
+	prefixed := func(prefix string, found Errors) {
+		for _, fe := range found {
+			errs = append(errs, FieldError{Field: prefix + "." + fe.Field, Message: fe.Message})
+		}
+	}
+
+	if len(req.Configs) == 0 {
+		errs.add("configs", "is required")
+	}
+	names := map[string]bool{}
+	for i, c := range req.Configs {
+		field := fmt.Sprintf("configs[%d]", i)
+		switch {
+		case c.Name == "":
+			errs.add(field+".name", "is required")
+		case names[c.Name]:
+			errs.add(field+".name", "duplicate configuration %q", c.Name)
+		}
+		names[c.Name] = true
+		if c.Solver != "" {
+			if _, ok := solvers.Route(c.Solver, solvers.Options{}); !ok {
+				errs.add(field+".solver", "unknown solver; must be one of %s", strings.Join(solvers.RouteNames(), ", "))
+			}
+		}
+		if c.SpeedKmh != 0 && !(isFinite(c.SpeedKmh) && c.SpeedKmh >= 1) {
+			errs.add(field+".average_speed_kmh", "must be at least 1")
+		}
+		var found Errors
+		checkObjective(&found, c.Objective)
+		switch r := c.GroupRadiusKm; {
+		case !isFinite(r) || r < 0:
+			found.add("group_radius_km", "must not be negative")
+		case r > 0 && !c.GroupByDestination:
+			found.add("group_radius_km", "needs group_by_destination")
+		}
+		prefixed(field, append(found, SolverParams(c.SolverParams, models.SolverParams{})...))
+	}
+
+	if len(req.Days) == 0 {
+		errs.add("days", "is required")
+	}
+	for i, d := range req.Days {
+		field := fmt.Sprintf("days[%d]", i)
+		if d.Date == "" {
+			errs.add(field+".date", "is required")
+		}
+		if len(d.Vehicles) == 0 {
+			errs.add(field+".vehicles", "is required")
+		}
+		found := LoadRequest(models.LoadRequest{Vehicles: d.Vehicles, Shipments: d.Shipments})
+		checkLocation(&found, "depot", d.Depot)
+		stops := []namedStop{{"depot", d.Depot}}
+		ids := map[string]bool{}
+		for k, sh := range d.Shipments {
+			f := fmt.Sprintf("shipments[%d]", k)
+			switch {
+			case sh.ID == "":
+				found.add(f+".id", "is required")
+			case ids[sh.ID]:
+				found.add(f+".id", "duplicate shipment %q", sh.ID)
+			}
+			ids[sh.ID] = true
+			if sh.Destination == nil {
+				found.add(f+".destination", "is required")
+				continue
+			}
+			stops = append(stops, namedStop{f + ".destination", *sh.Destination})
+		}
+		checkSchedule(&found, models.OptimizationRequest{DepartureTime: d.DepartureTime, Timezone: d.Timezone}, stops)
+		prefixed(field, found)
+	}
+
+	return errs
+}
+
+func checkVehicle(errs *Errors, field string, v models.VehicleInfo) {
+	if !isFinite(v.CapacityKg) || v.CapacityKg <= 0 {
+		errs.add(field+".capacity_kg", "must be positive")
+	}
+	if !isFinite(v.CurrentLoad) || v.CurrentLoad < 0 {
+		errs.add(field+".current_load", "must not be negative")
+	}
+	switch r := v.MaxRangeKm; {
+	case !isFinite(r) || r < 0:
+		errs.add(field+".max_range_km", "must not be negative")
+	case r > 0 && v.Depot == nil:
+		errs.add(field+".depot", "is required with max_range_km")
+	}
+	if v.Depot != nil {
+		checkLocation(errs, field+".depot", *v.Depot)
+	}
+	names := map[string]bool{}
+	for j, c := range v.Compartments {
+		f := fmt.Sprintf("%s.compartments[%d]", field, j)
+		switch {
+		case c.Name == "":
+			errs.add(f+".name", "is required")
+		case names[c.Name]:
+			errs.add(f+".name", "%q is already a compartment of the vehicle", c.Name)
+		}
+		names[c.Name] = true
+		if !isFinite(c.CapacityKg) || c.CapacityKg <= 0 {
+			errs.add(f+".capacity_kg", "must be positive")
+		}
+		if !isFinite(c.CurrentLoad) || c.CurrentLoad < 0 {
+			errs.add(f+".current_load", "must not be negative")
+		}
+	}
+}
+
+func checkObjective(errs *Errors, w *models.ObjectiveWeights) {
+	if w == nil {
+		return
+	}
+	for _, c := range []struct {
+		name   string
+		weight float64
+	}{
+		{"distance", w.Distance}, {"duration", w.Duration}, {"vehicles", w.Vehicles},
+		{"lateness", w.Lateness}, {"emissions", w.Emissions}, {"unserved", w.Unserved},
+	} {
+		if !isFinite(c.weight) || c.weight < 0 {
+			errs.add("objective."+c.name, "must not be negative")
+		}
+	}
+}
+
+// SolverParams rejects negative solver parameters and ones above limits, the server's
+// maximums; limits' zero fields are unlimited
+func SolverParams(p *models.SolverParams, limits models.SolverParams) Errors {
+	if p == nil {
+		return nil
+	}
+	var errs Errors
+	for _, c := range []struct {
+		name         string
+		value, limit int
+	}{
+		{"time_budget_ms", p.TimeBudgetMs, limits.TimeBudgetMs},
+		{"max_iterations", p.MaxIterations, limits.MaxIterations},
+		{"neighborhood", p.Neighborhood, limits.Neighborhood},
+	} {
+		switch {
+		case c.value < 0:
+			errs.add("solver_params."+c.name, "must not be negative")
+		case c.limit > 0 && c.value > c.limit:
+			errs.add("solver_params."+c.name, "must be at most %d, the server's limit", c.limit)
+		}
+	}
+	if km := p.UTurnPenaltyKm; !isFinite(km) || km < 0 {
+		errs.add("solver_params.uturn_penalty_km", "must not be negative")
+	}
+	return errs
+}
+
+// MaxItems rejects a list field with more than limit entries; a limit of 0 or less disables the check
+func MaxItems(field string, n, limit int) Errors {
+	if limit <= 0 || n <= limit {
+		return nil
+	}
+	return Errors{{Field: field, Message: fmt.Sprintf("at most %d entries allowed, got %d", limit, n)}}
+}
+
+// Location checks the coordinates of a location at field, as the request checks do
+// for each of theirs; for checking list entries as they are decoded
+func Location(field string, loc models.Location) Errors {
+	var errs Errors
+	checkLocation(&errs, field, loc)
+	return errs
+}
+
+// Shipment checks a shipment at field as LoadRequest does: its weight, tier and
+// destination
+func Shipment(field string, s models.ShipmentInfo) Errors {
+	var errs Errors
+	if !isFinite(s.WeightKg) || s.WeightKg <= 0 {
+		errs.add(field+".weight_kg", "must be positive")
+	}
+	checkTier(&errs, field+".tier", s.Tier)
+	if s.Destination != nil {
+		checkLocation(&errs, field+".destination", *s.Destination)
+	}
+	return errs
+}
+
+// InboundShipment checks an inbound shipment at field as CrossDockRequest does, all
+// but its ready time, which needs the request's timezone
+func InboundShipment(field string, s models.InboundShipment) Errors {
+	var errs Errors
+	if !isFinite(s.WeightKg) || s.WeightKg <= 0 {
+		errs.add(field+".weight_kg", "must be positive")
+	}
+	if s.Destination == "" {
+		errs.add(field+".destination", "is required")
+	}
+	if s.Door < 0 {
+		errs.add(field+".door", "must not be negative")
+	}
+	return errs
+}
+
+func checkLocation(errs *Errors, field string, loc models.Location) {
+	if !isFinite(loc.Lat) || loc.Lat < -90 || loc.Lat > 90 {
+		errs.add(field+".lat", "must be between -90 and 90")
+	}
+	if !isFinite(loc.Lng) || loc.Lng < -180 || loc.Lng > 180 {
+		errs.add(field+".lng", "must be between -180 and 180")
+	}
+}
+
+// checkCurrency checks that code, when set, looks like an ISO 4217 currency code
+func checkCurrency(errs *Errors, code string) {
+	if code != "" && !IsCurrency(code) {
+		errs.add("currency", "must be a three-letter ISO 4217 code such as EUR")
+	}
+}
+
+// IsCurrency reports whether code has the form of an ISO 4217 currency code: three
+// upper-case letters
+func IsCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
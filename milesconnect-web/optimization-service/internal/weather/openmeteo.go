@@ -0,0 +1,80 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"milesconnect-optimization/internal/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// OpenMeteoName identifies the Open-Meteo provider in metrics
+const OpenMeteoName = "open-meteo"
+
+// OpenMeteo reads current conditions from the Open-Meteo forecast API, which needs no key
+type OpenMeteo struct {
+	BaseURL string // https://api.open-meteo.com when empty
+	Client  *http.Client
+}
+
+func (o *OpenMeteo) Name() string { return OpenMeteoName }
+
+// Severity maps the current WMO weather code to a severity: drizzle and light rain are
+// light; heavy rain, snow and fog moderate; freezing rain, heavy snow and thunderstorms
+// with hail severe
+func (o *OpenMeteo) Severity(ctx context.Context, lat, lng float64) (string, error) {
+	base := o.BaseURL
+	if base == "" {
+		base = "https://api.open-meteo.com"
+	}
+	q := url.Values{
+		"latitude":  {strconv.FormatFloat(lat, 'f', 4, 64)},
+		"longitude": {strconv.FormatFloat(lng, 'f', 4, 64)},
+		"current":   {"weather_code"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+"/v1/forecast?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("open-meteo: HTTP %d", resp.StatusCode)
+	}
+	var body struct {
+		Current struct {
+			WeatherCode *int `json:"weather_code"`
+		} `json:"current"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("open-meteo: decoding response: %w", err)
+	}
+	if body.Current.WeatherCode == nil {
+		return "", fmt.Errorf("open-meteo: no current weather_code")
+	}
+	return wmoSeverity(*body.Current.WeatherCode), nil
+}
+
+// wmoSeverity maps a WMO 4677 present-weather code, as Open-Meteo reports it
+func wmoSeverity(code int) string {
+	switch code {
+	case 51, 53, 55, 56, 61, 63, 80, 81:
+		return models.WeatherLight
+	case 45, 48, 57, 65, 71, 73, 77, 82, 85, 95:
+		return models.WeatherModerate
+	case 66, 67, 75, 86, 96, 99:
+		return models.WeatherSevere
+	default:
+		return models.WeatherNone
+	}
+}
@@ -0,0 +1,221 @@
+// Package weather finds the conditions along route legs, from regions the caller gives
+// or an external provider, so schedules can slow the legs driven through bad weather.
+package weather
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"milesconnect-optimization/internal/cache"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/metrics"
+	"milesconnect-optimization/internal/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Severities lists the weather severities, mildest first
+var Severities = []string{models.WeatherNone, models.WeatherLight, models.WeatherModerate, models.WeatherSevere}
+
+// Valid reports whether severity is one of Severities
+func Valid(severity string) bool {
+	return slices.Contains(Severities, severity)
+}
+
+// worse reports whether severity a is worse than b
+func worse(a, b string) bool {
+	return slices.Index(Severities, a) > slices.Index(Severities, b)
+}
+
+// DefaultMultipliers are the travel-time factors by severity used when none are configured
+func DefaultMultipliers() map[string]float64 {
+	return map[string]float64{models.WeatherLight: 1.1, models.WeatherModerate: 1.25, models.WeatherSevere: 1.5}
+}
+
+// Provider reports the current weather severity at a point
+type Provider interface {
+	Name() string
+	Severity(ctx context.Context, lat, lng float64) (string, error)
+}
+
+// Service works out the weather on route legs. Its zero value uses caller regions only,
+// with DefaultMultipliers.
+type Service struct {
+	Provider    Provider           // nil uses caller regions only
+	Timeout     time.Duration      // for all of one route's lookups; 0 means the caller's deadline
+	Concurrency int                // lookups run at once
+	Cache       *cache.Cache       // severities by grid cell; nil disables caching
+	Multipliers map[string]float64 // travel-time factor by severity; missing severities are 1
+}
+
+// Leg is the weather on a leg: its worst severity and the factor its travel time is
+// multiplied by
+type Leg struct {
+	Severity string
+	Factor   float64
+}
+
+// sampleKm is the spacing of the points a leg's weather is sampled at
+const sampleKm = 25
+
+// maxSamples caps the points sampled on one leg
+const maxSamples = 20
+
+// cellDegrees is the grid provider lookups are rounded to, about 10 km
+const cellDegrees = 0.1
+
+// Legs returns the weather on each leg of route; legs[i] is the leg into route[i] and
+// legs[0] is empty. Each leg is sampled at its ends and every sampleKm between. A point
+// in a caller region has the worst severity of the regions it is in; other points are
+// looked up from the provider. Lookups are best effort: points whose lookup fails, or
+// isn't done within Timeout, count as clear, and err reports the first failure.
+func (s *Service) Legs(ctx context.Context, route []models.Location, regions []models.WeatherRegion) (legs []Leg, err error) {
+	if s == nil {
+		s = &Service{}
+	}
+	legs = make([]Leg, len(route))
+	if len(regions) == 0 && s.Provider == nil {
+		return legs, nil
+	}
+
+	type cell struct{ lat, lng float64 }
+	samples := make([][]cell, len(route))
+	var lookups []cell
+	seen := map[cell]bool{}
+	for i := 1; i < len(route); i++ {
+		a, b := route[i-1], route[i]
+		n := min(int(math.Ceil(geo.HaversineKm(a, b)/sampleKm)), maxSamples-1)
+		for k := 0; k <= n; k++ {
+			f := 0.0
+			if n > 0 {
+				f = float64(k) / float64(n)
+			}
+			// Straight interpolation is close enough to the great circle at sampleKm steps
+			p := cell{a.Lat + (b.Lat-a.Lat)*f, a.Lng + (b.Lng-a.Lng)*f}
+			samples[i] = append(samples[i], p)
+			if s.Provider == nil || inRegion(p.lat, p.lng, regions) != "" {
+				continue
+			}
+			c := cell{math.Round(p.lat/cellDegrees) * cellDegrees, math.Round(p.lng/cellDegrees) * cellDegrees}
+			if !seen[c] {
+				seen[c] = true
+				lookups = append(lookups, c)
+			}
+		}
+	}
+
+	looked := make(map[cell]string, len(lookups))
+	if len(lookups) > 0 {
+		var severities []string
+		severities, err = s.lookup(ctx, len(lookups), func(ctx context.Context, i int) (string, error) {
+			return s.severity(ctx, lookups[i].lat, lookups[i].lng)
+		})
+		for i, c := range lookups {
+			looked[c] = severities[i]
+		}
+	}
+
+	for i := 1; i < len(route); i++ {
+		worst := models.WeatherNone
+		for _, p := range samples[i] {
+			sev := inRegion(p.lat, p.lng, regions)
+			if sev == "" {
+				sev = looked[cell{math.Round(p.lat/cellDegrees) * cellDegrees, math.Round(p.lng/cellDegrees) * cellDegrees}]
+			}
+			if worse(sev, worst) {
+				worst = sev
+			}
+		}
+		legs[i] = Leg{Severity: worst, Factor: s.factor(worst)}
+	}
+	return legs, err
+}
+
+// inRegion returns the worst severity of the regions containing the point, or "" when
+// it is in none
+func inRegion(lat, lng float64, regions []models.WeatherRegion) string {
+	var sev string
+	for _, r := range regions {
+		if geo.HaversineKm(models.Location{Lat: lat, Lng: lng}, models.Location{Lat: r.Lat, Lng: r.Lng}) <= r.RadiusKm &&
+			(sev == "" || worse(r.Severity, sev)) {
+			sev = r.Severity
+		}
+	}
+	return sev
+}
+
+func (s *Service) factor(severity string) float64 {
+	m := s.Multipliers
+	if m == nil {
+		m = DefaultMultipliers()
+	}
+	if f, ok := m[severity]; ok && f > 0 {
+		return f
+	}
+	return 1
+}
+
+// severity looks the cell up in the cache or from the provider
+func (s *Service) severity(ctx context.Context, lat, lng float64) (string, error) {
+	key := fmt.Sprintf("%.1f,%.1f", lat, lng)
+	if s.Cache != nil {
+		if v, ok := s.Cache.Get(key); ok {
+			metrics.WeatherLookups.Inc(s.Provider.Name(), "cached")
+			return v.(string), nil
+		}
+	}
+	sev, err := s.Provider.Severity(ctx, lat, lng)
+	if err != nil {
+		metrics.WeatherLookups.Inc(s.Provider.Name(), "error")
+		return models.WeatherNone, err
+	}
+	metrics.WeatherLookups.Inc(s.Provider.Name(), "ok")
+	if s.Cache != nil {
+		s.Cache.Put(key, sev)
+	}
+	return sev, nil
+}
+
+// lookup runs fn for 0 to n-1, up to Concurrency at a time and within Timeout. Failed
+// and unfinished lookups are WeatherNone; err is the first failure.
+func (s *Service) lookup(ctx context.Context, n int, fn func(ctx context.Context, i int) (string, error)) (severities []string, err error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	severities = make([]string, n)
+	var mu sync.Mutex
+	sem := make(chan struct{}, max(s.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range n {
+		severities[i] = models.WeatherNone
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			if err == nil {
+				err = ctx.Err()
+			}
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			sev, lerr := fn(ctx, i)
+			mu.Lock()
+			defer mu.Unlock()
+			if lerr != nil {
+				if err == nil {
+					err = lerr
+				}
+				return
+			}
+			severities[i] = sev
+		}()
+	}
+	wg.Wait()
+	return severities, err
+}
@@ -0,0 +1,138 @@
+// Package workpool bounds how many CPU-heavy jobs run at once. Callers beyond the
+// limit wait in a FIFO queue of bounded length for a bounded time.
+package workpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when every worker is busy and the queue is at capacity
+	ErrQueueFull = errors.New("workpool: queue full")
+	// ErrQueueTimeout is returned when no worker became free within the queue timeout
+	ErrQueueTimeout = errors.New("workpool: timed out waiting for a worker")
+)
+
+// Pool hands out worker slots. The zero value is not usable; use New.
+type Pool struct {
+	mu      sync.Mutex
+	workers int
+	queue   int
+	timeout time.Duration
+	running int
+	waiting []chan struct{}
+}
+
+// New allows workers concurrent jobs with up to queue callers waiting at most timeout each
+func New(workers, queue int, timeout time.Duration) *Pool {
+	p := &Pool{}
+	p.SetLimits(workers, queue, timeout)
+	return p
+}
+
+// SetLimits changes the pool size, queue length and queue timeout. Running jobs are
+// not interrupted when the pool shrinks; new jobs wait until enough of them finish.
+func (p *Pool) SetLimits(workers, queue int, timeout time.Duration) {
+	if workers < 1 {
+		workers = 1
+	}
+	if queue < 0 {
+		queue = 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.workers, p.queue, p.timeout = workers, queue, timeout
+	p.dispatch()
+}
+
+// Acquire blocks until a worker slot is free and returns the func that gives it back.
+// It fails with ErrQueueFull, ErrQueueTimeout or ctx's error.
+func (p *Pool) Acquire(ctx context.Context) (release func(), err error) {
+	p.mu.Lock()
+	if p.running < p.workers && len(p.waiting) == 0 {
+		p.running++
+		p.mu.Unlock()
+		return p.releaseOnce(), nil
+	}
+	if len(p.waiting) >= p.queue {
+		p.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	ready := make(chan struct{})
+	p.waiting = append(p.waiting, ready)
+	timeout := p.timeout
+	p.mu.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-ready:
+		return p.releaseOnce(), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-expired:
+		err = ErrQueueTimeout
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, ch := range p.waiting {
+		if ch == ready {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			return nil, err
+		}
+	}
+	// The slot was granted while giving up; hand it straight to the next caller
+	p.running--
+	p.dispatch()
+	return nil, err
+}
+
+// TryAcquire takes a free slot without queueing, for work that should only use
+// spare capacity. It returns false when every worker is busy or callers are waiting.
+func (p *Pool) TryAcquire() (release func(), ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running >= p.workers || len(p.waiting) > 0 {
+		return nil, false
+	}
+	p.running++
+	return p.releaseOnce(), true
+}
+
+// Stats reports the jobs running and the callers waiting
+func (p *Pool) Stats() (running, waiting int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running, len(p.waiting)
+}
+
+func (p *Pool) releaseOnce() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.running--
+			p.dispatch()
+		})
+	}
+}
+
+// dispatch wakes queued callers while slots are free; p.mu must be held
+func (p *Pool) dispatch() {
+	for p.running < p.workers && len(p.waiting) > 0 {
+		ready := p.waiting[0]
+		p.waiting = p.waiting[1:]
+		p.running++
+		close(ready)
+	}
+}
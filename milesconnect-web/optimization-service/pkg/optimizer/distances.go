@@ -0,0 +1,66 @@
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/routing"
+	"net/http"
+)
+
+// DistanceProvider supplies the leg distances routes are optimised on
+type DistanceProvider interface {
+	// Matrix returns the km distance from every point to every other one:
+	// Matrix[i][j] is from points[i] to points[j]
+	Matrix(ctx context.Context, points []Point) ([][]float64, error)
+}
+
+// OSRM returns a provider of road distances from the OSRM server at baseURL (e.g.
+// http://osrm:5000) with the routing profile ("driving" when empty). A nil client
+// uses http.DefaultClient. Unlike the service, which falls back to great-circle
+// distances when OSRM fails, solves with it fail.
+func OSRM(baseURL, profile string, client *http.Client) DistanceProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return osrm{&routing.OSRM{BaseURL: baseURL, Profile: profile, Client: client}}
+}
+
+type osrm struct {
+	provider *routing.OSRM
+}
+
+func (o osrm) Matrix(ctx context.Context, points []Point) ([][]float64, error) {
+	locs := make([]models.Location, len(points))
+	for i, p := range points {
+		locs[i] = location(p)
+	}
+	return o.provider.Matrix(ctx, locs)
+}
+
+// matrix asks the configured provider for the distances between the request's points,
+// or returns nil for great-circle distances
+func (o options) matrix(ctx context.Context, req models.OptimizationRequest) (geo.Matrix, error) {
+	if o.distances == nil {
+		return nil, nil
+	}
+	locs := geo.RequestPoints(req)
+	points := make([]Point, len(locs))
+	for i, loc := range locs {
+		points[i] = point(loc)
+	}
+	m, err := o.distances.Matrix(ctx, points)
+	if err != nil {
+		return nil, fmt.Errorf("optimizer: distances: %w", err)
+	}
+	if len(m) != len(points) {
+		return nil, fmt.Errorf("optimizer: distances: %d rows for %d points", len(m), len(points))
+	}
+	for i, row := range m {
+		if len(row) != len(points) {
+			return nil, fmt.Errorf("optimizer: distances: row %d has %d entries for %d points", i, len(row), len(points))
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,67 @@
+package optimizer
+
+import (
+	"context"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/validation"
+)
+
+// Vehicle has CapacityKg in total, of which CurrentLoadKg is already taken
+type Vehicle struct {
+	ID            string
+	CapacityKg    float64
+	CurrentLoadKg float64
+}
+
+// Shipment is a load to place on one vehicle
+type Shipment struct {
+	ID       string
+	WeightKg float64
+}
+
+// FleetPlan assigns shipments to vehicles. Loads lists the vehicles used.
+type FleetPlan struct {
+	Loads      []VehicleLoad
+	Unassigned []string // IDs of shipments no vehicle had room for
+	Stats      Stats
+}
+
+// VehicleLoad is what one vehicle carries; TotalWeightKg includes its current load
+type VehicleLoad struct {
+	VehicleID      string
+	ShipmentIDs    []string
+	TotalWeightKg  float64
+	UtilizationPct float64
+}
+
+// AllocateFleet places shipments on vehicles as POST /optimize-load does, using as few
+// vehicles as it can. Of the options only WithTimeLimit applies. Invalid input fails
+// with a *ValidationError.
+func AllocateFleet(ctx context.Context, vehicles []Vehicle, shipments []Shipment, opts ...Option) (FleetPlan, error) {
+	o := newOptions(opts)
+	req := models.LoadRequest{
+		Vehicles:  make([]models.VehicleInfo, len(vehicles)),
+		Shipments: make([]models.ShipmentInfo, len(shipments)),
+	}
+	for i, v := range vehicles {
+		req.Vehicles[i] = models.VehicleInfo{ID: v.ID, CapacityKg: v.CapacityKg, CurrentLoad: v.CurrentLoadKg}
+	}
+	for i, s := range shipments {
+		req.Shipments[i] = models.ShipmentInfo{ID: s.ID, WeightKg: s.WeightKg}
+	}
+	if errs := validation.LoadRequest(req); len(errs) > 0 {
+		return FleetPlan{}, invalid(errs)
+	}
+
+	ctx, cancel := o.deadline(ctx)
+	defer cancel()
+	resp := solver.OptimizeFleetAllocation(ctx, req)
+
+	plan := FleetPlan{Loads: make([]VehicleLoad, len(resp.Allocations)), Unassigned: resp.Unassigned, Stats: stats(resp.Metadata)}
+	for i, a := range resp.Allocations {
+		plan.Loads[i] = VehicleLoad{VehicleID: a.VehicleID, ShipmentIDs: a.ShipmentIDs,
+			TotalWeightKg: a.TotalWeight, UtilizationPct: a.UtilizationPct}
+	}
+	return plan, nil
+}
@@ -0,0 +1,164 @@
+// Package optimizer embeds the optimization service's solvers in other Go programs, for
+// problems small enough that a network call to the service costs more than solving.
+// It runs the same solvers and checks as POST /optimize and POST /optimize-load, with
+// types of its own that stay stable while the service's internals change:
+//
+//	route, err := optimizer.SolveRoute(ctx, optimizer.RouteProblem{
+//		Start: depot, End: depot, Stops: stops,
+//	}, optimizer.WithSolver("tsp-2opt"), optimizer.WithTimeLimit(2*time.Second))
+//
+// Services in the monorepo depend on it with a replace directive pointing at
+// milesconnect-web/optimization-service.
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/solvers"
+	"milesconnect-optimization/internal/validation"
+	"strings"
+	"time"
+)
+
+// Point is a stop. MergedIDs lists the IDs of duplicates folded into it by
+// WithDuplicates("merge", ...).
+type Point struct {
+	ID        string
+	Lat, Lng  float64
+	MergedIDs []string
+}
+
+// RouteProblem asks for the shortest route from Start through every stop to End
+type RouteProblem struct {
+	Start, End Point
+	Stops      []Point
+}
+
+// Route is a solved RouteProblem: Stops runs from Start to End in visiting order
+type Route struct {
+	Stops      []Point
+	DistanceKm float64
+	Stats      Stats
+}
+
+// Stats describe the solver run behind a result
+type Stats struct {
+	Solver          string
+	Version         string
+	Iterations      int
+	Duration        time.Duration
+	BudgetExhausted bool    // the time limit or ctx ended the solve; the result is the best found by then
+	Objective       float64 // what the solver minimised: route km, or vehicles used for fleet plans
+	InitialKm       float64 // route length of the stops in the order given
+	Clusters        int     // pieces a hierarchical solve split the problem into
+}
+
+// FieldError is a problem with one field of the input, named as POST /optimize would
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError lists everything wrong with an input
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, fe := range e.Fields {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "optimizer: invalid input: " + strings.Join(parts, "; ")
+}
+
+// DefaultSolver is the route solver used without WithSolver
+const DefaultSolver = solver.TwoOptName
+
+// Solvers lists the route solver names WithSolver accepts
+func Solvers() []string {
+	return solvers.RouteNames()
+}
+
+// SolveRoute routes problem. Invalid problems fail with a *ValidationError, and a
+// failing DistanceProvider fails the solve. Running out of time does not: the best
+// route found is returned with Stats.BudgetExhausted set.
+func SolveRoute(ctx context.Context, problem RouteProblem, opts ...Option) (Route, error) {
+	o := newOptions(opts)
+	solve, ok := solvers.Route(o.solver, o.solvers)
+	if !ok {
+		return Route{}, fmt.Errorf("optimizer: unknown solver %q", o.solver)
+	}
+	if o.distances != nil && !solvers.AcceptsMatrix(o.solver) {
+		return Route{}, fmt.Errorf("optimizer: solver %s supports great-circle distances only", o.solver)
+	}
+
+	req := models.OptimizationRequest{
+		Start:      location(problem.Start),
+		End:        location(problem.End),
+		Waypoints:  make([]models.Location, len(problem.Stops)),
+		Duplicates: o.duplicates,
+	}
+	for i, p := range problem.Stops {
+		req.Waypoints[i] = location(p)
+	}
+	errs := validation.OptimizationRequest(req)
+	if len(errs) == 0 {
+		req, errs = validation.ApplyDuplicates(req)
+	}
+	if len(errs) > 0 {
+		return Route{}, invalid(errs)
+	}
+
+	ctx, cancel := o.deadline(ctx)
+	defer cancel()
+	matrix, err := o.matrix(ctx, req)
+	if err != nil {
+		return Route{}, err
+	}
+	resp := solve(ctx, req, matrix)
+
+	route := Route{Stops: make([]Point, len(resp.Route)), DistanceKm: resp.TotalDistKm, Stats: stats(resp.Metadata)}
+	for i, loc := range resp.Route {
+		route.Stops[i] = point(loc)
+	}
+	return route, nil
+}
+
+// HaversineKm is the great-circle distance between a and b, as the solvers measure it
+// without a DistanceProvider
+func HaversineKm(a, b Point) float64 {
+	return geo.HaversineKm(location(a), location(b))
+}
+
+func location(p Point) models.Location {
+	return models.Location{ID: p.ID, Lat: p.Lat, Lng: p.Lng, MergedIDs: p.MergedIDs}
+}
+
+func point(loc models.Location) Point {
+	return Point{ID: loc.ID, Lat: loc.Lat, Lng: loc.Lng, MergedIDs: loc.MergedIDs}
+}
+
+func stats(meta models.SolverMetadata) Stats {
+	return Stats{
+		Solver:          meta.Solver,
+		Version:         meta.Version,
+		Iterations:      meta.Iterations,
+		Duration:        time.Duration(meta.ComputeTimeMs * float64(time.Millisecond)),
+		BudgetExhausted: meta.BudgetExhausted,
+		Objective:       meta.ObjectiveValue,
+		InitialKm:       meta.InitialValue,
+		Clusters:        meta.Clusters,
+	}
+}
+
+func invalid(errs validation.Errors) error {
+	v := &ValidationError{Fields: make([]FieldError, len(errs))}
+	for i, fe := range errs {
+		v.Fields[i] = FieldError{Field: fe.Field, Message: fe.Message}
+	}
+	return v
+}
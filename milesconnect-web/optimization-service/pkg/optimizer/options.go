@@ -0,0 +1,99 @@
+package optimizer
+
+import (
+	"context"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/solvers"
+	"time"
+)
+
+// Option configures a solve
+type Option func(*options)
+
+type options struct {
+	solver     string
+	timeLimit  time.Duration
+	distances  DistanceProvider
+	duplicates models.DuplicateHandling
+	solvers    solvers.Options
+}
+
+func newOptions(opts []Option) options {
+	o := options{solver: DefaultSolver, solvers: solvers.DefaultOptions()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// deadline bounds ctx by the time limit, when one was set
+func (o options) deadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.timeLimit <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.timeLimit)
+}
+
+// WithSolver picks the route solver by name, one of Solvers(). The default is
+// DefaultSolver.
+func WithSolver(name string) Option {
+	return func(o *options) { o.solver = name }
+}
+
+// WithTimeLimit bounds the solve on top of ctx. Without it only ctx does, so callers
+// without a deadline of their own should set one: the service uses 30s.
+func WithTimeLimit(d time.Duration) Option {
+	return func(o *options) { o.timeLimit = d }
+}
+
+// WithDistances routes on p's distances instead of great-circle ones. Only
+// tsp-nearest-neighbor, tsp-2opt and solvers registered with SolverInfo.Distances
+// accept them.
+func WithDistances(p DistanceProvider) Option {
+	return func(o *options) { o.distances = p }
+}
+
+// WithDuplicates sets how stops within radiusM metres of each other are handled:
+// "keep" routes them all (the default), "merge" folds them into the first one and
+// "reject" fails validation.
+func WithDuplicates(mode string, radiusM float64) Option {
+	return func(o *options) { o.duplicates = models.DuplicateHandling{Mode: mode, RadiusM: radiusM} }
+}
+
+// GeneticParams tune the tsp-genetic solver; zero fields keep the service defaults
+type GeneticParams struct {
+	PopulationSize int
+	Generations    int
+	MutationRate   float64
+	TournamentSize int
+	Seed           int64 // for reproducible runs; 0 seeds from the clock
+}
+
+// WithGenetic tunes the tsp-genetic solver
+func WithGenetic(p GeneticParams) Option {
+	return func(o *options) {
+		g := &o.solvers.Genetic
+		if p.PopulationSize > 0 {
+			g.PopulationSize = p.PopulationSize
+		}
+		if p.Generations > 0 {
+			g.Generations = p.Generations
+		}
+		if p.MutationRate > 0 {
+			g.MutationRate = p.MutationRate
+		}
+		if p.TournamentSize > 0 {
+			g.TournamentSize = p.TournamentSize
+		}
+		g.Seed = p.Seed
+	}
+}
+
+// WithClusterSize sets the most stops per cluster of the tsp-hierarchical solver
+func WithClusterSize(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.solvers.ClusterSize = n
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"milesconnect-optimization/internal/catalog"
+	"milesconnect-optimization/internal/geo"
+	"milesconnect-optimization/internal/models"
+	"milesconnect-optimization/internal/solver"
+	"milesconnect-optimization/internal/solvers"
+	"time"
+)
+
+// Solver is a route solver of your own, plugged in with RegisterSolver. It orders
+// problem.Stops between problem.Start and problem.End and returns the visiting order as
+// indices into problem.Stops, each exactly once. distances, when set, are in km between
+// Start, Stops... and End in that order; without them the solver measures distances
+// itself, e.g. with HaversineKm. Solve should return its best order so far when ctx is
+// done.
+type Solver interface {
+	Solve(ctx context.Context, problem RouteProblem, distances [][]float64) (order []int, err error)
+}
+
+// SolverFunc adapts a function to Solver
+type SolverFunc func(ctx context.Context, problem RouteProblem, distances [][]float64) ([]int, error)
+
+func (f SolverFunc) Solve(ctx context.Context, problem RouteProblem, distances [][]float64) ([]int, error) {
+	return f(ctx, problem, distances)
+}
+
+// SolverInfo describes a registered solver, in /solvers and in response metadata
+type SolverInfo struct {
+	Name        string // how requests, WithSolver and the shadow config select it
+	Version     string
+	Description string
+	// Distances is set when the solver routes on given distances; the service then passes
+	// its road distances when a routing provider is configured. Without it distances is
+	// always nil.
+	Distances bool
+}
+
+// RegisterSolver plugs s in next to the built-in solvers, so the service's /optimize
+// (with "solver": name), SolveRoute and milesopt can run it. Call it from an init
+// function of a package the binary imports, e.g. with a blank import in cmd/server:
+//
+//	func init() {
+//		optimizer.RegisterSolver(optimizer.SolverInfo{Name: "acme-sweep", Version: "1.0.0"}, acmeSweep{})
+//	}
+//
+// The route's distance and metadata are worked out from the order s returns. A solve
+// that fails or returns something other than an order of every stop is logged and
+// answered by tsp-nearest-neighbor instead, so a faulty plugin can't fail requests.
+// RegisterSolver panics when the name is empty or already taken.
+func RegisterSolver(info SolverInfo, s Solver) {
+	if info.Name == "" {
+		panic("optimizer: RegisterSolver needs a name")
+	}
+	solvers.Register(info.Name, func(solvers.Options) solvers.Func {
+		return func(ctx context.Context, req models.OptimizationRequest, matrix geo.Matrix) models.OptimizationResponse {
+			return solvePlugin(ctx, info, s, req, matrix)
+		}
+	}, info.Distances)
+	catalog.Register(catalog.Descriptor{
+		Name:        info.Name,
+		Version:     info.Version,
+		Problem:     "tsp",
+		Endpoint:    "/optimize",
+		Description: info.Description,
+		Capabilities: catalog.Capabilities{
+			FixedEndpoints: true,
+			Duplicates:     true,
+		},
+	})
+}
+
+func solvePlugin(ctx context.Context, info SolverInfo, s Solver, req models.OptimizationRequest, matrix geo.Matrix) models.OptimizationResponse {
+	started := time.Now()
+	problem := RouteProblem{Start: point(req.Start), End: point(req.End), Stops: make([]Point, len(req.Waypoints))}
+	for i, loc := range req.Waypoints {
+		problem.Stops[i] = point(loc)
+	}
+	order, err := s.Solve(ctx, problem, matrix)
+	if err == nil {
+		err = checkOrder(order, len(req.Waypoints))
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "plugged-in solver failed; solving with "+solver.NearestNeighborName, "solver", info.Name, "error", err)
+		return solver.SolveTSPNearestNeighbor(ctx, req, matrix)
+	}
+	return solver.OrderResponse(req, order, matrix, models.SolverMetadata{
+		Solver:          info.Name,
+		Version:         info.Version,
+		ComputeTimeMs:   float64(time.Since(started).Microseconds()) / 1000,
+		BudgetExhausted: ctx.Err() != nil,
+	})
+}
+
+// checkOrder reports whether order visits each of n stops exactly once
+func checkOrder(order []int, n int) error {
+	if len(order) != n {
+		return fmt.Errorf("returned %d stops, want %d", len(order), n)
+	}
+	seen := make([]bool, n)
+	for _, i := range order {
+		if i < 0 || i >= n || seen[i] {
+			return fmt.Errorf("stop index %d is out of range or repeated", i)
+		}
+		seen[i] = true
+	}
+	return nil
+}